@@ -0,0 +1,104 @@
+// Command url-shortener-export writes clicks or click rollups of the
+// configured storage as a CSV or Parquet file:
+//
+//	url-shortener-export -from 2026-03-01T00:00:00Z -to 2026-03-02T00:00:00Z -gzip -out clicks.csv.gz
+//	url-shortener-export -source daily -format parquet -tenant acme -code promo -code docs -out daily.parquet
+//	url-shortener-export -cursor <cursor> -limit 1000000 -out part2.csv
+//
+// The number of rows written and the cursor resuming after the last one are
+// printed to stderr, also when the export is interrupted. Rollups only exist
+// with postgres storage.
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/export"
+	"url-shortener/internal/model"
+	"url-shortener/internal/storage"
+)
+
+func main() {
+	var req export.Request
+	var codes []string
+
+	flag.StringVar(&req.Source, "source", export.SourceClicks, "data to export: clicks, hourly or daily")
+	flag.StringVar(&req.Format, "format", export.FormatCSV, "file format: csv or parquet")
+	flag.BoolVar(&req.Gzip, "gzip", false, "compress the file")
+	from := flag.String("from", "", "start of the range, RFC 3339; 24h before -to by default")
+	to := flag.String("to", "", "end of the range, RFC 3339; now by default")
+	tenant := flag.String("tenant", "", "tenant of the -code links; empty is the default tenant")
+	domain := flag.String("domain", "", "domain of the -code links; empty is the default domain")
+	flag.Func("code", "short code of a link to export; repeat for more, all links if none", func(code string) error {
+		codes = append(codes, code)
+		return nil
+	})
+	flag.StringVar(&req.Cursor, "cursor", "", "resume after the row of this cursor")
+	flag.IntVar(&req.Limit, "limit", 0, "maximum rows to export; 0 exports all")
+	out := flag.String("out", "", "file to write; stdout if empty")
+	flag.Parse()
+
+	var err error
+	if *from != "" {
+		if req.Query.From, err = time.Parse(time.RFC3339, *from); err != nil {
+			fail(fmt.Errorf("invalid -from: %w", err))
+		}
+	}
+	if *to != "" {
+		if req.Query.To, err = time.Parse(time.RFC3339, *to); err != nil {
+			fail(fmt.Errorf("invalid -to: %w", err))
+		}
+	}
+	for _, code := range codes {
+		req.Query.Links = append(req.Query.Links, model.LinkKey{Tenant: *tenant, Domain: *domain, ShortURL: code})
+	}
+
+	if req, err = req.Normalize(time.Now().UTC()); err != nil {
+		fail(err)
+	}
+
+	cfg := config.MustLoadConfig()
+	db, err := storage.NewStorage(&cfg.Storage, zap.NewNop())
+	if err != nil {
+		fail(err)
+	}
+
+	file := os.Stdout
+	if *out != "" {
+		if file, err = os.Create(*out); err != nil {
+			fail(err)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	w := bufio.NewWriter(file)
+	result, err := export.New(db, zap.NewNop()).Export(ctx, w, req)
+	if flushErr := w.Flush(); err == nil {
+		err = flushErr
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	fmt.Fprintf(os.Stderr, "rows:   %d\ncursor: %s\n", result.Rows, result.Cursor)
+	if err != nil {
+		fail(err)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "error: "+err.Error())
+	os.Exit(1)
+}
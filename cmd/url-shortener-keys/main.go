@@ -0,0 +1,122 @@
+// Command url-shortener-keys manages API keys in the configured storage:
+//
+//	url-shortener-keys create -name ci -scopes links:create,links:read
+//	url-shortener-keys list
+//	url-shortener-keys rotate -id <id> -grace 24h
+//	url-shortener-keys revoke -id <id>
+//
+// Keys only persist with postgres storage.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"go.uber.org/zap"
+
+	"url-shortener/internal/auth"
+	"url-shortener/internal/config"
+	"url-shortener/internal/model"
+	"url-shortener/internal/storage"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	cfg := config.MustLoadConfig()
+	db, err := storage.NewStorage(&cfg.Storage, zap.NewNop())
+	if err != nil {
+		fail(err)
+	}
+	keys := auth.NewKeys(db, zap.NewNop())
+
+	cmd, args := os.Args[1], os.Args[2:]
+	switch cmd {
+	case "create":
+		fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+		name := fs.String("name", "", "key name")
+		scopes := fs.String("scopes", "", "comma-separated scopes: "+strings.Join(auth.Scopes, ", "))
+		tenant := fs.String("tenant", "", "tenant the key acts for; empty is the default tenant")
+		_ = fs.Parse(args)
+
+		if *name == "" || *scopes == "" {
+			fs.Usage()
+			os.Exit(2)
+		}
+
+		plain, key, err := keys.Create(*name, *tenant, strings.Split(*scopes, ","))
+		if err != nil {
+			fail(err)
+		}
+		fmt.Printf("id:  %s\nkey: %s\n", key.ID, plain)
+	case "list":
+		stored, err := keys.List()
+		if err != nil {
+			fail(err)
+		}
+		printKeys(stored)
+	case "rotate":
+		fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+		id := fs.String("id", "", "key id")
+		grace := fs.Duration("grace", 0, "how long the old key keeps working")
+		_ = fs.Parse(args)
+
+		plain, key, err := keys.Rotate(*id, *grace)
+		if err != nil {
+			fail(err)
+		}
+		fmt.Printf("id:  %s\nkey: %s\n", key.ID, plain)
+	case "revoke":
+		fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+		id := fs.String("id", "", "key id")
+		_ = fs.Parse(args)
+
+		if err := keys.Revoke(*id); err != nil {
+			fail(err)
+		}
+	default:
+		usage()
+	}
+}
+
+func printKeys(keys []model.APIKey) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ID\tNAME\tTENANT\tSCOPES\tCREATED\tLAST USED\tREVOKED")
+	for _, key := range keys {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", key.ID, key.Name, orDash(key.Tenant), strings.Join(key.Scopes, ","),
+			formatTime(key.CreatedAt), formatTime(key.LastUsedAt), formatTime(key.RevokedAt))
+	}
+	_ = w.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+
+	return t.Format(time.RFC3339)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: url-shortener-keys create|list|rotate|revoke [flags]")
+	os.Exit(2)
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "error: "+err.Error())
+	os.Exit(1)
+}
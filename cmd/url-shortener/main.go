@@ -4,8 +4,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"sync"
@@ -17,10 +19,26 @@ import (
 
 	"url-shortener/cmd/url-shortener/server/grpcserver"
 	"url-shortener/cmd/url-shortener/server/httpserver"
+	"url-shortener/internal/analytics"
+	"url-shortener/internal/audit"
+	"url-shortener/internal/auth"
+	"url-shortener/internal/bots"
 	"url-shortener/internal/config"
+	"url-shortener/internal/domain"
+	"url-shortener/internal/events"
+	"url-shortener/internal/export"
+	"url-shortener/internal/generator"
+	"url-shortener/internal/geoip"
 	"url-shortener/internal/logger"
+	"url-shortener/internal/normalize"
+	"url-shortener/internal/policy"
+	"url-shortener/internal/ratelimit"
 	"url-shortener/internal/service"
 	"url-shortener/internal/storage"
+	"url-shortener/internal/tenant"
+	"url-shortener/internal/threat"
+	"url-shortener/internal/trending"
+	"url-shortener/internal/webhook"
 )
 
 const (
@@ -38,17 +56,276 @@ func main() {
 	}
 	log.Info("Initialized storage")
 
+	gen, err := generator.New(cfg.Generator, db)
+	if err != nil {
+		log.Error("Failed to initialize code generator: " + err.Error())
+		os.Exit(1)
+	}
+
+	enc, err := generator.EncodingFromConfig(cfg.Generator)
+	if err != nil {
+		log.Error("Failed to initialize code encoding: " + err.Error())
+		os.Exit(1)
+	}
+
+	domains := domain.NewRegistry(cfg.Domains)
+	// Links to our own short domains would redirect in a loop, and so would
+	// links to the base URL short links are made of without them.
+	cfg.Policy.ShortDomains = append(cfg.Policy.ShortDomains, domains.Hosts()...)
+	if base, err := url.Parse(cfg.Server.PublicBaseURL); err == nil && base.Hostname() != "" {
+		cfg.Policy.ShortDomains = append(cfg.Policy.ShortDomains, base.Hostname())
+	}
+
 	shortener := service.NewShortener(db, log)
-	httpServer, grpcServer, lis := initializeServers(cfg, shortener, log)
+	shortener.Generator = gen
+	shortener.Alphabet = enc.Alphabet()
+	shortener.Normalizer = normalize.New(cfg.Normalize)
+	shortener.Policy = policy.New(cfg.Policy, nil)
+	shortener.Domains = domains
+	shortener.BaseURL = cfg.Server.PublicBaseURL
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if len(cfg.Threat.DomainLists) > 0 || len(cfg.Threat.HashPrefixLists) > 0 {
+		threats, err := threat.NewListChecker(cfg.Threat, log)
+		if err != nil {
+			log.Error("Failed to load threat lists: " + err.Error())
+			os.Exit(1)
+		}
+		go threats.Run(ctx)
+
+		shortener.Threats = threats
+		shortener.CheckThreatsOnResolve = cfg.Threat.CheckOnResolve
+	}
+	shortener.CheckDigit = generator.CheckDigitFromConfig(cfg.Generator, enc)
+	shortener.LegacyCodes = cfg.Generator.ChecksumLegacy
+
+	var background sync.WaitGroup
+	if cfg.Analytics.Enabled {
+		// Sketches merged across instances and restarts must hash a client
+		// the same way, so shared storage keeps a generated salt.
+		if store, ok := db.(analytics.SaltStore); ok && cfg.Analytics.IPSalt == "" {
+			cfg.Analytics.IPSalt, err = analytics.SharedSalt(store)
+			if err != nil {
+				log.Error("Failed to initialize IP salt: " + err.Error())
+				os.Exit(1)
+			}
+		}
+
+		clicks := analytics.NewRecorder(db, cfg.Analytics, log)
+		if cfg.GeoIP.Database != "" {
+			clicks.Locations, err = geoip.NewLocator(cfg.GeoIP, log)
+			if err != nil {
+				log.Error("Failed to load GeoIP database: " + err.Error())
+				os.Exit(1)
+			}
+			go clicks.Locations.Run(ctx)
+		}
+
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			clicks.Run(ctx)
+		}()
+
+		shortener.Clicks = clicks
+	}
+
+	if cfg.Analytics.Rollup.Enabled {
+		if store, ok := db.(analytics.RollupStore); ok {
+			rollup := analytics.NewRollup(store, cfg.Analytics.Rollup, log)
+			background.Add(1)
+			go func() {
+				defer background.Done()
+				rollup.Run(ctx)
+			}()
+		} else {
+			log.Warn("Click rollups need postgres storage; raw clicks are kept in memory until restart")
+		}
+	}
+
+	var detector *bots.Detector
+	if cfg.Bots.Enabled {
+		detector, err = bots.NewDetector(cfg.Bots, log)
+		if err != nil {
+			log.Error("Failed to load bot signatures: " + err.Error())
+			os.Exit(1)
+		}
+		go detector.Run(ctx)
+	}
+
+	var tracker *trending.Tracker
+	if cfg.Trending.Enabled {
+		tracker = trending.NewTracker(cfg.Trending.TopK)
+		shortener.Trending = tracker
+	}
+
+	var dispatcher *webhook.Dispatcher
+	if cfg.Webhooks.Enabled {
+		dispatcher = webhook.NewDispatcher(db, cfg.Webhooks, log)
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			dispatcher.Run(ctx)
+		}()
+
+		shortener.Events = dispatcher
+	}
+
+	// The relay stops after the other background work, so it also publishes
+	// the events of the clicks written last.
+	relayCtx, stopRelay := context.WithCancel(context.Background())
+	defer stopRelay()
+	var relaying sync.WaitGroup
+	if cfg.Events.Enabled {
+		if !cfg.Storage.Outbox {
+			log.Warn("Events are relayed but storage.outbox is off, so no events are written")
+		}
+
+		publisher, err := events.NewPublisher(cfg.Events, log)
+		if err != nil {
+			log.Error("Failed to initialize events publisher: " + err.Error())
+			os.Exit(1)
+		}
+
+		relay := events.NewRelay(db, publisher, cfg.Events, log)
+		relaying.Add(1)
+		go func() {
+			defer relaying.Done()
+			relay.Run(relayCtx)
+		}()
+	}
+
+	var auditLog *audit.Log
+	if cfg.Audit.Enabled {
+		store, err := newAuditStore(cfg.Audit, db, log)
+		if err != nil {
+			log.Error("Failed to open audit log: " + err.Error())
+			os.Exit(1)
+		}
+		if closer, ok := store.(io.Closer); ok {
+			defer func() { _ = closer.Close() }()
+		}
+
+		auditLog = audit.New(store, cfg.Audit, log)
+		shortener.Audit = auditLog
+	}
+
+	if cfg.Generator.DenyList != "" {
+		denyList, err := generator.LoadDenyList(cfg.Generator.DenyList)
+		if err != nil {
+			log.Error("Failed to load deny list: " + err.Error())
+			os.Exit(1)
+		}
+		shortener.Filter = denyList
+	}
+	limiter, err := newLimiter(cfg.RateLimit, db)
+	if err != nil {
+		log.Error("Failed to initialize rate limiter: " + err.Error())
+		os.Exit(1)
+	}
+
+	tenants := tenant.NewRegistry(cfg.Tenants, limiter, log)
+	shortener.Tenants = tenants
+
+	var authn *auth.Authenticator
+	if cfg.Auth.Enabled {
+		authn = &auth.Authenticator{Keys: auth.NewKeys(db, log)}
+		if err := bootstrapAdminKey(authn.Keys, log); err != nil {
+			log.Error("Failed to bootstrap admin API key: " + err.Error())
+			os.Exit(1)
+		}
+
+		if cfg.Auth.JWT.Enabled() {
+			jwks := auth.NewJWKS(cfg.Auth.JWT.JWKSFile, cfg.Auth.JWT.JWKSURL, cfg.Auth.JWT.CacheTTL, log)
+			authn.Tokens, err = auth.NewTokenVerifier(cfg.Auth.JWT, jwks)
+			if err != nil {
+				log.Error("Failed to initialize JWT verification: " + err.Error())
+				os.Exit(1)
+			}
+		}
+	}
+
+	exporter := export.New(db, log)
+
+	httpServer, grpcServer, lis := initializeServers(cfg, shortener, limiter, authn, tenants, domains, tracker, detector,
+		exporter, dispatcher, auditLog, log)
 	defer func(lis net.Listener) {
 		_ = lis.Close()
 	}(lis)
 
 	runServers(httpServer, grpcServer, lis, log)
+
+	// The servers are stopped, so no more clicks come in; write the queued ones.
+	cancel()
+	background.Wait()
+	stopRelay()
+	relaying.Wait()
+
+	if closer, ok := gen.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			log.Error("Failed to close code generator: " + err.Error())
+		}
+	}
 }
 
-func initializeServers(cfg *config.Config, shortener *service.Shortener, log *zap.Logger) (*http.Server, *grpc.Server, net.Listener) {
-	httpServer := httpserver.NewHTTPServer(cfg.Server, shortener, log)
+// newAuditStore keeps the audit log in postgres storage, or with the memory
+// backend in cfg.File, or in memory if there is none.
+func newAuditStore(cfg config.AuditConfig, db storage.Storage, log *zap.Logger) (audit.Store, error) {
+	if store, ok := db.(audit.Store); ok {
+		return store, nil
+	}
+
+	if cfg.File == "" {
+		log.Warn("audit.file is not set; the audit log is kept in memory and lost on restart")
+		return audit.NewMemoryStore(), nil
+	}
+
+	return audit.OpenFile(cfg.File)
+}
+
+func newLimiter(cfg config.RateLimitConfig, db storage.Storage) (ratelimit.Limiter, error) {
+	if cfg.Backend != "postgres" {
+		return ratelimit.NewMemory(), nil
+	}
+
+	store, ok := db.(ratelimit.TokenStore)
+	if !ok {
+		return nil, errors.New("the postgres rate limit backend needs postgres storage")
+	}
+
+	return ratelimit.NewShared(store), nil
+}
+
+// bootstrapAdminKey issues an admin key when there are no keys yet, so the
+// admin API can be reached on a fresh database. The key is printed once to
+// stderr, outside the log, which only gets its ID.
+func bootstrapAdminKey(keys *auth.Keys, log *zap.Logger) error {
+	existing, err := keys.List()
+	if err != nil || len(existing) > 0 {
+		return err
+	}
+
+	plain, key, err := keys.Create("bootstrap", tenant.Default, []string{auth.ScopeAdmin})
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(os.Stderr, "Bootstrap admin API key (shown once): %s\n", plain); err != nil {
+		return fmt.Errorf("print bootstrap key: %w", err)
+	}
+	log.Warn("Issued bootstrap admin API key to stderr; store it and rotate it", zap.String("id", key.ID))
+
+	return nil
+}
+
+func initializeServers(cfg *config.Config, shortener *service.Shortener, limiter ratelimit.Limiter, authn *auth.Authenticator,
+	tenants *tenant.Registry, domains *domain.Registry, tracker *trending.Tracker, detector *bots.Detector,
+	exporter *export.Exporter, dispatcher *webhook.Dispatcher, auditLog *audit.Log, log *zap.Logger,
+) (*http.Server, *grpc.Server, net.Listener) {
+	httpServer := httpserver.NewHTTPServer(cfg, shortener, limiter, authn, tenants, domains, tracker, detector, exporter,
+		dispatcher, auditLog, log)
 	log.Info(fmt.Sprintf("Starting HTTP server on %s", httpServer.Addr))
 
 	lis, err := net.Listen("tcp", cfg.Server.GRPCPort)
@@ -57,7 +334,7 @@ func initializeServers(cfg *config.Config, shortener *service.Shortener, log *za
 		os.Exit(1)
 	}
 
-	grpcServer := grpcserver.New(cfg.Server, shortener, log)
+	grpcServer := grpcserver.New(cfg, shortener, limiter, authn, tenants, domains, tracker, detector, log)
 	log.Info(fmt.Sprintf("Starting gRPC server on port %s", cfg.Server.GRPCPort))
 
 	return httpServer, grpcServer, lis
@@ -115,8 +392,22 @@ func shutdownServers(httpServer *http.Server, grpcServer *grpc.Server, log *zap.
 
 	go func(grpcServer *grpc.Server) {
 		defer wg.Done()
-		grpcServer.GracefulStop()
-		log.Info("gRPC server shutdown gracefully")
+
+		// Streams such as WatchTrending only end when their clients leave, so
+		// they are cut off once the shutdown timeout expires.
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+			log.Info("gRPC server shutdown gracefully")
+		case <-shutdownCtx.Done():
+			grpcServer.Stop()
+			log.Warn("gRPC server shutdown timed out, closed remaining streams")
+		}
 	}(grpcServer)
 
 	wg.Wait()
@@ -1,25 +1,90 @@
 package grpcserver
 
 import (
+	"context"
+	"strings"
+
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 
+	"url-shortener/internal/auth"
+	"url-shortener/internal/bots"
 	"url-shortener/internal/config"
+	"url-shortener/internal/domain"
+	"url-shortener/internal/grpc/interceptor"
 	grpcShortoner "url-shortener/internal/grpc/server"
 	"url-shortener/internal/grpc/urlshortener"
+	"url-shortener/internal/model"
+	"url-shortener/internal/ratelimit"
+	"url-shortener/internal/service"
+	"url-shortener/internal/tenant"
+	"url-shortener/internal/trending"
 )
 
 type Service interface {
-	Resolve(url string) (string, error)
-	Shorten(url string) (string, error)
+	LookupContext(ctx context.Context, url string) (service.Resolution, error)
+	ShortenContext(ctx context.Context, url, alias string) (string, error)
+	ShortURL(ctx context.Context, code string) string
+	LinkURL(ctx context.Context, link model.Link) string
+	ListMine(ctx context.Context, after string, limit int) (service.LinkPage, error)
+	Update(ctx context.Context, code, url string) (model.Link, error)
+	Delete(ctx context.Context, code string) error
+	Stats(ctx context.Context, code string, q model.ClickQuery) (model.ClickStats, error)
 }
 
-func New(cfg config.ServerConfig, service Service, log *zap.Logger) *grpc.Server {
+// New builds the gRPC server. authn may be nil when cfg.Auth is disabled,
+// tracker when trending links are not tracked and detector when bots are not
+// detected.
+func New(cfg *config.Config, service Service, limiter ratelimit.Limiter, authn *auth.Authenticator,
+	tenants *tenant.Registry, domains *domain.Registry, tracker *trending.Tracker, detector *bots.Detector, log *zap.Logger,
+) *grpc.Server {
+	rules := map[string]ratelimit.Rule{
+		urlshortener.URLShortener_Shorten_FullMethodName: ratelimit.RuleFromConfig("shorten", cfg.RateLimit.Shorten),
+		urlshortener.URLShortener_Resolve_FullMethodName: ratelimit.RuleFromConfig("resolve", cfg.RateLimit.Resolve),
+	}
+
+	interceptors := []grpc.UnaryServerInterceptor{
+		interceptor.Request(),
+		interceptor.Tenant(tenants),
+		interceptor.Domain(domains),
+		interceptor.Visitor(detector),
+		interceptor.RateLimit(limiter, rules, strings.ToLower(cfg.RateLimit.APIKeyHeader), log),
+	}
+	streamInterceptors := []grpc.StreamServerInterceptor{
+		interceptor.StreamDomain(domains),
+	}
+
+	if cfg.Auth.Enabled {
+		scopes := map[string]string{
+			urlshortener.URLShortener_Shorten_FullMethodName:      auth.ScopeLinksCreate,
+			urlshortener.URLShortener_ListMyLinks_FullMethodName:  auth.ScopeLinksRead,
+			urlshortener.URLShortener_UpdateLink_FullMethodName:   auth.ScopeLinksCreate,
+			urlshortener.URLShortener_DeleteLink_FullMethodName:   auth.ScopeLinksDelete,
+			urlshortener.URLShortener_GetLinkStats_FullMethodName: auth.ScopeLinksRead,
+		}
+		if cfg.Auth.RequireRead {
+			scopes[urlshortener.URLShortener_Resolve_FullMethodName] = auth.ScopeLinksRead
+		}
+		interceptors = append(interceptors, interceptor.Auth(authn, scopes, strings.ToLower(cfg.Auth.APIKeyHeader), log))
+
+		streamScopes := map[string]string{
+			urlshortener.URLShortener_WatchTrending_FullMethodName: auth.ScopeAdmin,
+		}
+		streamInterceptors = append(streamInterceptors,
+			interceptor.StreamAuth(authn, streamScopes, strings.ToLower(cfg.Auth.APIKeyHeader), log))
+	}
+
 	server := grpc.NewServer(
-		grpc.ConnectionTimeout(cfg.Timeout),
+		grpc.ConnectionTimeout(cfg.Server.Timeout),
+		grpc.ChainUnaryInterceptor(interceptors...),
+		grpc.ChainStreamInterceptor(streamInterceptors...),
 	)
 
 	grpcServer := &grpcShortoner.GRPCServer{Service: service, Log: log}
+	// WatchTrending is admin only, so it is not served without auth.
+	if tracker != nil && cfg.Auth.Enabled {
+		grpcServer.Trending = tracker
+	}
 	urlshortener.RegisterURLShortenerServer(server, grpcServer)
 
 	return server
@@ -1,40 +1,139 @@
 package httpserver
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 
+	al "url-shortener/internal/audit"
+	"url-shortener/internal/auth"
+	"url-shortener/internal/bots"
 	"url-shortener/internal/config"
+	"url-shortener/internal/domain"
+	exp "url-shortener/internal/export"
+	"url-shortener/internal/http/handlers/apikeys"
+	"url-shortener/internal/http/handlers/audit"
+	"url-shortener/internal/http/handlers/export"
+	"url-shortener/internal/http/handlers/links"
+	"url-shortener/internal/http/handlers/redirect"
 	"url-shortener/internal/http/handlers/resolve"
 	"url-shortener/internal/http/handlers/shorten"
+	"url-shortener/internal/http/handlers/stats"
+	"url-shortener/internal/http/handlers/trending"
+	"url-shortener/internal/http/handlers/webhooks"
+	"url-shortener/internal/http/middleware/mvaudit"
+	"url-shortener/internal/http/middleware/mvauth"
+	"url-shortener/internal/http/middleware/mvdomain"
+	"url-shortener/internal/http/middleware/mvforwarded"
 	"url-shortener/internal/http/middleware/mvlogger"
+	"url-shortener/internal/http/middleware/mvratelimit"
+	"url-shortener/internal/http/middleware/mvrequest"
+	"url-shortener/internal/http/middleware/mvtenant"
+	"url-shortener/internal/http/middleware/mvvisitor"
+	"url-shortener/internal/model"
+	"url-shortener/internal/ratelimit"
+	"url-shortener/internal/service"
+	"url-shortener/internal/tenant"
+	tr "url-shortener/internal/trending"
+	"url-shortener/internal/webhook"
 )
 
 type Service interface {
-	Resolve(url string) (string, error)
-	Shorten(url string) (string, error)
+	LookupContext(ctx context.Context, url string) (service.Resolution, error)
+	ShortenContext(ctx context.Context, url, alias string) (string, error)
+	ShortURL(ctx context.Context, code string) string
+	LinkURL(ctx context.Context, link model.Link) string
+	ListMine(ctx context.Context, after string, limit int) (service.LinkPage, error)
+	Update(ctx context.Context, code, url string) (model.Link, error)
+	Delete(ctx context.Context, code string) error
+	Stats(ctx context.Context, code string, q model.ClickQuery) (model.ClickStats, error)
 }
 
-func NewHTTPServer(cfg config.ServerConfig, service Service, log *zap.Logger) *http.Server {
+// NewHTTPServer builds the HTTP API. authn may be nil when cfg.Auth is
+// disabled, tracker when trending links are not tracked, detector when bots
+// are not detected, dispatcher when webhooks are disabled and auditLog when
+// the audit log is.
+func NewHTTPServer(cfg *config.Config, service Service, limiter ratelimit.Limiter, authn *auth.Authenticator,
+	tenants *tenant.Registry, domains *domain.Registry, tracker *tr.Tracker, detector *bots.Detector,
+	exporter *exp.Exporter, dispatcher *webhook.Dispatcher, auditLog *al.Log, log *zap.Logger,
+) *http.Server {
 	gin.SetMode(gin.ReleaseMode)
 
 	r := gin.New()
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Error("Invalid trusted proxies, trusting none: " + err.Error())
+		_ = r.SetTrustedProxies(nil)
+	}
 
 	r.Use(gin.Recovery())
 	r.Use(mvlogger.NewLoggerMiddleware(log))
+	r.Use(mvforwarded.New(cfg.Server.TrustedProxies, log))
+	r.Use(mvrequest.New())
+	r.Use(mvtenant.New(tenants))
+	r.Use(mvdomain.New(domains))
+
+	shortenLimit := mvratelimit.New(limiter, ratelimit.RuleFromConfig("shorten", cfg.RateLimit.Shorten), cfg.RateLimit.APIKeyHeader, log)
+	resolveLimit := mvratelimit.New(limiter, ratelimit.RuleFromConfig("resolve", cfg.RateLimit.Resolve), cfg.RateLimit.APIKeyHeader, log)
+
+	createAuth, readAuth, ownAuth, deleteAuth := noop, noop, noop, noop
+	if cfg.Auth.Enabled {
+		createAuth = mvauth.New(authn, cfg.Auth.APIKeyHeader, auth.ScopeLinksCreate, log)
+		ownAuth = mvauth.New(authn, cfg.Auth.APIKeyHeader, auth.ScopeLinksRead, log)
+		deleteAuth = mvauth.New(authn, cfg.Auth.APIKeyHeader, auth.ScopeLinksDelete, log)
+		if cfg.Auth.RequireRead {
+			readAuth = ownAuth
+		}
+	}
+
+	// Without auth nobody can be told apart from an admin, so there is no
+	// admin API.
+	if cfg.Auth.Enabled {
+		adminAudit := noop
+		if auditLog != nil {
+			adminAudit = mvaudit.New(auditLog)
+		}
 
-	r.POST("/shorten", shorten.New(service, log))
-	r.GET("/resolve", resolve.New(service, log))
+		admin := r.Group("/admin", adminAudit, mvauth.New(authn, cfg.Auth.APIKeyHeader, auth.ScopeAdmin, log))
+		apikeys.Register(admin, authn.Keys, log)
+		if tracker != nil {
+			admin.GET("/trending", trending.New(tracker, service, log))
+		}
+		admin.GET("/export", export.New(exporter, cfg.Server.Timeout, log))
+		if dispatcher != nil {
+			webhooks.Register(admin, dispatcher, log)
+		}
+		if auditLog != nil {
+			audit.Register(admin, auditLog, log)
+		}
+	} else {
+		log.Warn("Auth is disabled; the admin API is not served")
+	}
+
+	r.POST("/shorten", shortenLimit, createAuth, shorten.New(service, log))
+	visitor := mvvisitor.New(detector)
+	r.GET("/resolve", resolveLimit, readAuth, visitor, resolve.New(service, log))
+	r.GET("/:code", resolveLimit, visitor, redirect.New(service, log))
+
+	// Without auth there is no caller to own links, so these answer 401.
+	api := r.Group("/api/v1")
+	api.GET("/links", ownAuth, links.NewList(service, log))
+	api.PATCH("/links/:code", createAuth, links.NewUpdate(service, log))
+	api.DELETE("/links/:code", deleteAuth, links.NewDelete(service, log))
+	api.GET("/links/:code/stats", ownAuth, stats.New(service, log))
 
 	server := &http.Server{
-		Addr:         cfg.HTTPPort,
+		Addr:         cfg.Server.HTTPPort,
 		Handler:      r,
-		ReadTimeout:  cfg.Timeout,
-		WriteTimeout: cfg.Timeout,
-		IdleTimeout:  cfg.IdleTimeout,
+		ReadTimeout:  cfg.Server.Timeout,
+		WriteTimeout: cfg.Server.Timeout,
+		IdleTimeout:  cfg.Server.IdleTimeout,
 	}
 
 	return server
 }
+
+func noop(c *gin.Context) {
+	c.Next()
+}
@@ -0,0 +1,272 @@
+package analytics
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/geoip"
+	"url-shortener/internal/model"
+	"url-shortener/internal/sketch"
+	"url-shortener/internal/useragent"
+)
+
+const (
+	defaultBufferSize    = 10000
+	defaultBatchSize     = 500
+	defaultFlushInterval = time.Second
+
+	// maxFieldLength bounds the referrer and user agent kept per click.
+	maxFieldLength = 512
+	// ipHashBytes is how much of the HMAC of an address is kept.
+	ipHashBytes = 16
+)
+
+type Store interface {
+	PutClicks(clicks []model.Click) error
+	// MergeVisitors merges each sketch into the stored one of its link and
+	// day.
+	MergeVisitors(sketches []model.VisitorSketch) error
+}
+
+// SaltStore keeps the IP salt shared by every instance of a deployment.
+// postgres.Storage implements it.
+type SaltStore interface {
+	// IPSalt returns the stored salt, storing salt first if there is none.
+	IPSalt(salt string) (string, error)
+}
+
+// SharedSalt returns the IP salt kept in store, generating it the first time,
+// so that every instance and restart hashes an address the same way.
+func SharedSalt(store SaltStore) (string, error) {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+
+	salt, err := store.IPSalt(hex.EncodeToString(b))
+	if err != nil {
+		return "", fmt.Errorf("failed to load IP salt: %w", err)
+	}
+
+	return salt, nil
+}
+
+// Recorder writes click events to storage in the background. Resolves only
+// queue a click; when storage falls behind and the queue is full, clicks are
+// dropped rather than slowing redirects down.
+//
+// Clicks are enriched in the background too: the client address is hashed
+// and located, and the device, OS and browser are parsed from the user agent.
+// The address itself is never stored.
+type Recorder struct {
+	// Locations finds the country and city of clicks; nil leaves them
+	// empty.
+	Locations *geoip.Locator
+
+	store     Store
+	events    chan event
+	batchSize int
+	interval  time.Duration
+	salt      []byte
+	dropped   atomic.Int64
+	log       *zap.Logger
+}
+
+// event is a queued click with the address of its client.
+type event struct {
+	click model.Click
+	ip    string
+}
+
+func NewRecorder(store Store, cfg config.AnalyticsConfig, log *zap.Logger) *Recorder {
+	r := &Recorder{
+		store:     store,
+		events:    make(chan event, orDefault(cfg.BufferSize, defaultBufferSize)),
+		batchSize: orDefault(cfg.BatchSize, defaultBatchSize),
+		interval:  cfg.FlushInterval,
+		salt:      []byte(cfg.IPSalt),
+		log:       log,
+	}
+
+	if r.interval <= 0 {
+		r.interval = defaultFlushInterval
+	}
+
+	if len(r.salt) == 0 {
+		r.salt = make([]byte, 32)
+		_, _ = rand.Read(r.salt)
+	}
+
+	return r
+}
+
+func orDefault(n, def int) int {
+	if n <= 0 {
+		return def
+	}
+
+	return n
+}
+
+// Record queues a click on the link identified by key by the visitor in ctx.
+// It never blocks.
+func (r *Recorder) Record(ctx context.Context, key model.LinkKey) {
+	e := event{click: model.Click{Tenant: key.Tenant, Domain: key.Domain, ShortURL: key.ShortURL, At: time.Now().UTC()}}
+	if v, ok := VisitorFromContext(ctx); ok {
+		e.click.Referrer = truncate(cleanReferrer(v.Referrer), maxFieldLength)
+		e.click.UserAgent = truncate(v.UserAgent, maxFieldLength)
+		e.click.Class, e.click.Bot = v.Class, v.Bot
+		e.ip = v.IP
+	}
+
+	select {
+	case r.events <- e:
+	default:
+		r.dropped.Add(1)
+	}
+}
+
+// Run writes queued clicks in batches until ctx is done, then writes what is
+// still queued and returns.
+func (r *Recorder) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	batch := make([]model.Click, 0, r.batchSize)
+	for {
+		select {
+		case <-ctx.Done():
+			for {
+				select {
+				case e := <-r.events:
+					batch = append(batch, r.enrich(e))
+					if len(batch) >= r.batchSize {
+						batch = r.flush(batch)
+					}
+				default:
+					r.flush(batch)
+					return
+				}
+			}
+		case e := <-r.events:
+			batch = append(batch, r.enrich(e))
+			if len(batch) >= r.batchSize {
+				batch = r.flush(batch)
+			}
+		case <-ticker.C:
+			batch = r.flush(batch)
+		}
+	}
+}
+
+// enrich completes the click of e from its client address and user agent.
+func (r *Recorder) enrich(e event) model.Click {
+	click := e.click
+	if e.ip != "" {
+		click.IPHash = HashIP(r.salt, e.ip)
+
+		location := r.Locations.Locate(e.ip)
+		click.Country, click.City = location.Country, truncate(location.City, maxFieldLength)
+	}
+
+	client := useragent.Parse(click.UserAgent)
+	click.Device, click.OS, click.Browser = client.Device, client.OS, client.Browser
+
+	return click
+}
+
+// flush writes batch and returns it emptied. Clicks that fail to be written
+// are lost.
+func (r *Recorder) flush(batch []model.Click) []model.Click {
+	if dropped := r.dropped.Swap(0); dropped > 0 {
+		r.log.Warn("click buffer full, clicks dropped", zap.Int64("dropped", dropped))
+	}
+
+	if len(batch) == 0 {
+		return batch
+	}
+
+	if err := r.store.PutClicks(batch); err != nil {
+		r.log.Error("failed to write clicks", zap.Int("clicks", len(batch)), zap.Error(err))
+	}
+
+	if sketches := visitorSketches(batch); len(sketches) > 0 {
+		if err := r.store.MergeVisitors(sketches); err != nil {
+			r.log.Error("failed to merge visitor sketches", zap.Int("sketches", len(sketches)), zap.Error(err))
+		}
+	}
+
+	return batch[:0]
+}
+
+// visitorSketches builds one sketch per link and day of the human clicks that
+// have a client identifier, so storage merges once per link and day, not per
+// click.
+func visitorSketches(batch []model.Click) []model.VisitorSketch {
+	type linkDay struct {
+		key model.LinkKey
+		day time.Time
+	}
+
+	index := make(map[linkDay]int)
+	var sketches []model.VisitorSketch
+	for _, click := range batch {
+		if click.IPHash == "" || (click.Class != "" && click.Class != model.ClassHuman) {
+			continue
+		}
+
+		k := linkDay{key: click.Key(), day: click.At.UTC().Truncate(24 * time.Hour)}
+		i, ok := index[k]
+		if !ok {
+			h, _ := sketch.NewHLL(sketch.HLLPrecision)
+			i = len(sketches)
+			index[k] = i
+			sketches = append(sketches, model.VisitorSketch{
+				Tenant: click.Tenant, Domain: click.Domain, ShortURL: click.ShortURL, Day: k.day, Sketch: h,
+			})
+		}
+		sketches[i].Sketch.Add([]byte(click.IPHash))
+	}
+
+	return sketches
+}
+
+// HashIP returns a keyed hash of ip. Without the salt it cannot be reversed by
+// hashing every possible address.
+func HashIP(salt []byte, ip string) string {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte(ip))
+
+	return hex.EncodeToString(mac.Sum(nil)[:ipHashBytes])
+}
+
+// cleanReferrer drops the query, fragment and credentials of a referrer, which
+// may identify the visitor, and anything that is not an absolute URL.
+func cleanReferrer(ref string) string {
+	u, err := url.Parse(ref)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return ""
+	}
+
+	u.User, u.RawQuery, u.Fragment, u.RawFragment = nil, "", "", ""
+
+	return u.String()
+}
+
+// truncate cuts s to at most n bytes of valid UTF-8.
+func truncate(s string, n int) string {
+	if len(s) > n {
+		s = s[:n]
+	}
+
+	return strings.ToValidUTF8(s, "")
+}
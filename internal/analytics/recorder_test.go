@@ -0,0 +1,184 @@
+package analytics
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/model"
+)
+
+type fakeStore struct {
+	mu       sync.Mutex
+	batches  [][]model.Click
+	sketches []model.VisitorSketch
+}
+
+func (s *fakeStore) PutClicks(clicks []model.Click) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.batches = append(s.batches, append([]model.Click(nil), clicks...))
+
+	return nil
+}
+
+func (s *fakeStore) MergeVisitors(sketches []model.VisitorSketch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sketches = append(s.sketches, sketches...)
+
+	return nil
+}
+
+func TestRecorder_WritesQueuedClicks(t *testing.T) {
+	store := &fakeStore{}
+	r := NewRecorder(store, config.AnalyticsConfig{BatchSize: 2, IPSalt: "salt"}, zaptest.NewLogger(t))
+
+	ctx := WithVisitor(context.Background(), Visitor{
+		IP:        "203.0.113.7",
+		Referrer:  "https://news.example/item?id=42#top",
+		UserAgent: "Mozilla/5.0",
+	})
+	key := model.LinkKey{Tenant: "acme", Domain: "go.acme.com", ShortURL: "promo"}
+	for range 3 {
+		r.Record(ctx, key)
+	}
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r.Run(runCtx)
+
+	var clicks []model.Click
+	for _, batch := range store.batches {
+		assert.LessOrEqual(t, len(batch), 2)
+		clicks = append(clicks, batch...)
+	}
+
+	if assert.Len(t, clicks, 3) {
+		click := clicks[0]
+		assert.Equal(t, key, click.Key())
+		assert.Equal(t, "https://news.example/item", click.Referrer)
+		assert.Equal(t, "Mozilla/5.0", click.UserAgent)
+		assert.Equal(t, HashIP([]byte("salt"), "203.0.113.7"), click.IPHash)
+		assert.NotContains(t, click.IPHash, "203.0.113.7")
+		assert.False(t, click.At.IsZero())
+	}
+}
+
+func TestRecorder_ParsesClient(t *testing.T) {
+	store := &fakeStore{}
+	r := NewRecorder(store, config.AnalyticsConfig{}, zaptest.NewLogger(t))
+
+	r.Record(WithVisitor(context.Background(), Visitor{
+		IP:        "203.0.113.7",
+		UserAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1",
+	}), model.LinkKey{ShortURL: "promo"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r.Run(ctx)
+
+	if assert.Len(t, store.batches, 1) && assert.Len(t, store.batches[0], 1) {
+		click := store.batches[0][0]
+		assert.Equal(t, "mobile", click.Device)
+		assert.Equal(t, "iOS", click.OS)
+		assert.Equal(t, "Safari", click.Browser)
+		// Without a GeoIP database the location stays unknown.
+		assert.Empty(t, click.Country)
+		assert.Empty(t, click.City)
+	}
+}
+
+func TestRecorder_SketchesVisitorsPerLinkAndDay(t *testing.T) {
+	store := &fakeStore{}
+	r := NewRecorder(store, config.AnalyticsConfig{}, zaptest.NewLogger(t))
+
+	key := model.LinkKey{ShortURL: "promo"}
+	for _, ip := range []string{"198.51.100.1", "198.51.100.2", "198.51.100.1", ""} {
+		r.Record(WithVisitor(context.Background(), Visitor{IP: ip}), key)
+	}
+	r.Record(WithVisitor(context.Background(), Visitor{IP: "198.51.100.1"}), model.LinkKey{ShortURL: "other"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r.Run(ctx)
+
+	if assert.Len(t, store.sketches, 2) {
+		v := store.sketches[0]
+		assert.Equal(t, key, v.Key())
+		assert.Equal(t, time.Now().UTC().Truncate(24*time.Hour), v.Day)
+		assert.Equal(t, uint64(2), v.Sketch.Estimate())
+		assert.Equal(t, uint64(1), store.sketches[1].Sketch.Estimate())
+	}
+}
+
+func TestRecorder_DropsWhenFull(t *testing.T) {
+	store := &fakeStore{}
+	r := NewRecorder(store, config.AnalyticsConfig{BufferSize: 1}, zaptest.NewLogger(t))
+
+	// Nothing drains the buffer, so the second click must not block.
+	r.Record(context.Background(), model.LinkKey{ShortURL: "a"})
+	r.Record(context.Background(), model.LinkKey{ShortURL: "b"})
+	assert.Equal(t, int64(1), r.dropped.Load())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r.Run(ctx)
+
+	if assert.Len(t, store.batches, 1) && assert.Len(t, store.batches[0], 1) {
+		assert.Equal(t, "a", store.batches[0][0].ShortURL)
+	}
+	assert.Zero(t, r.dropped.Load())
+}
+
+func TestHashIP(t *testing.T) {
+	a := HashIP([]byte("one"), "198.51.100.1")
+	assert.Len(t, a, 2*ipHashBytes)
+	assert.Equal(t, a, HashIP([]byte("one"), "198.51.100.1"))
+	assert.NotEqual(t, a, HashIP([]byte("two"), "198.51.100.1"))
+	assert.NotEqual(t, a, HashIP([]byte("one"), "198.51.100.2"))
+}
+
+// saltStore keeps the first salt it is given, like urlshortener_settings.
+type saltStore struct{ salt string }
+
+func (s *saltStore) IPSalt(salt string) (string, error) {
+	if s.salt == "" {
+		s.salt = salt
+	}
+
+	return s.salt, nil
+}
+
+func TestSharedSalt(t *testing.T) {
+	store := &saltStore{}
+
+	first, err := SharedSalt(store)
+	require.NoError(t, err)
+	assert.Len(t, first, 64)
+
+	second, err := SharedSalt(store)
+	require.NoError(t, err)
+	assert.Equal(t, first, second, "later instances reuse the stored salt")
+}
+
+func TestCleanReferrer(t *testing.T) {
+	for ref, want := range map[string]string{
+		"":                                  "",
+		"android-app://com.slack":           "android-app://com.slack",
+		"/relative/path":                    "",
+		"https://t.me/":                     "https://t.me/",
+		"https://user:pw@example.com/a?b=c": "https://example.com/a",
+		"http://example.com/page#section":   "http://example.com/page",
+	} {
+		assert.Equal(t, want, cleanReferrer(ref), ref)
+	}
+}
@@ -0,0 +1,82 @@
+package analytics
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/model"
+)
+
+const defaultRollupInterval = 10 * time.Minute
+
+// RollupStore aggregates stored clicks into rollups and deletes data past
+// retention. postgres.Storage implements it.
+type RollupStore interface {
+	// RollupClicks rolls up the clicks of every whole hour and day before now
+	// that are not rolled up yet, then deletes what is past retention. It must
+	// be safe to run from several instances at once and to stop at any point.
+	RollupClicks(ctx context.Context, now time.Time, retention model.Retention) (model.RollupResult, error)
+}
+
+// Rollup runs the click rollup in the background, so raw clicks can be
+// deleted while their counts stay in the stats.
+type Rollup struct {
+	store     RollupStore
+	interval  time.Duration
+	retention model.Retention
+	log       *zap.Logger
+}
+
+func NewRollup(store RollupStore, cfg config.RollupConfig, log *zap.Logger) *Rollup {
+	r := &Rollup{
+		store:    store,
+		interval: cfg.Interval,
+		retention: model.Retention{
+			Raw:    cfg.RawRetention,
+			Hourly: cfg.HourlyRetention,
+			Daily:  cfg.DailyRetention,
+		},
+		log: log,
+	}
+
+	if r.interval <= 0 {
+		r.interval = defaultRollupInterval
+	}
+
+	return r
+}
+
+// Run rolls clicks up right away and then every interval until ctx is done.
+func (r *Rollup) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.run(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Rollup) run(ctx context.Context) {
+	result, err := r.store.RollupClicks(ctx, time.Now().UTC(), r.retention)
+	switch {
+	case ctx.Err() != nil:
+		// Stopped half-way; the next run resumes where this one ended.
+		return
+	case err != nil:
+		r.log.Error("failed to roll up clicks", zap.Error(err))
+	case !result.Ran:
+		r.log.Debug("click rollup is running on another instance")
+	default:
+		r.log.Info("clicks rolled up", zap.Int("hours", result.Hours), zap.Int("days", result.Days),
+			zap.Int64("deleted", result.Deleted))
+	}
+}
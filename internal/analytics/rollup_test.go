@@ -0,0 +1,78 @@
+package analytics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/model"
+)
+
+// fakeRollupStore records the runs of the rollup and cancels it after
+// cancelAfter of them.
+type fakeRollupStore struct {
+	nows        []time.Time
+	retentions  []model.Retention
+	err         error
+	cancelAfter int
+	cancel      context.CancelFunc
+}
+
+func (s *fakeRollupStore) RollupClicks(_ context.Context, now time.Time, retention model.Retention) (model.RollupResult, error) {
+	s.nows = append(s.nows, now)
+	s.retentions = append(s.retentions, retention)
+	if len(s.nows) == s.cancelAfter {
+		s.cancel()
+	}
+
+	return model.RollupResult{Ran: true, Hours: 1}, s.err
+}
+
+func TestRollup_RunsUntilCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := &fakeRollupStore{cancelAfter: 3, cancel: cancel}
+	r := NewRollup(store, config.RollupConfig{
+		Interval:        time.Millisecond,
+		RawRetention:    7 * 24 * time.Hour,
+		HourlyRetention: 90 * 24 * time.Hour,
+		DailyRetention:  2 * 365 * 24 * time.Hour,
+	}, zaptest.NewLogger(t))
+
+	r.Run(ctx)
+
+	require.Len(t, store.nows, 3)
+	assert.Equal(t, model.Retention{
+		Raw:    7 * 24 * time.Hour,
+		Hourly: 90 * 24 * time.Hour,
+		Daily:  2 * 365 * 24 * time.Hour,
+	}, store.retentions[0])
+	assert.Equal(t, time.UTC, store.nows[0].Location())
+	assert.False(t, store.nows[1].Before(store.nows[0]))
+}
+
+func TestRollup_KeepsRunningAfterErrors(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store := &fakeRollupStore{err: errors.New("connection refused"), cancelAfter: 2, cancel: cancel}
+	r := NewRollup(store, config.RollupConfig{Interval: time.Millisecond}, zaptest.NewLogger(t))
+
+	r.Run(ctx)
+
+	assert.Len(t, store.nows, 2)
+}
+
+func TestNewRollup_DefaultInterval(t *testing.T) {
+	t.Parallel()
+
+	r := NewRollup(&fakeRollupStore{}, config.RollupConfig{}, zaptest.NewLogger(t))
+	assert.Equal(t, defaultRollupInterval, r.interval)
+}
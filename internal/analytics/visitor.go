@@ -0,0 +1,27 @@
+package analytics
+
+import "context"
+
+// Visitor is the client behind a request, as far as analytics cares.
+type Visitor struct {
+	IP        string
+	Referrer  string
+	UserAgent string
+	// Class is one of the model Class constants; empty means human.
+	Class string
+	// Bot names the bot of bot traffic.
+	Bot string
+}
+
+type ctxKey struct{}
+
+// WithVisitor returns a copy of ctx carrying the visitor making the request.
+func WithVisitor(ctx context.Context, v Visitor) context.Context {
+	return context.WithValue(ctx, ctxKey{}, v)
+}
+
+// VisitorFromContext returns the visitor stored by WithVisitor.
+func VisitorFromContext(ctx context.Context) (Visitor, bool) {
+	v, ok := ctx.Value(ctxKey{}).(Visitor)
+	return v, ok
+}
@@ -0,0 +1,270 @@
+package audit
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"url-shortener/internal/auth"
+	"url-shortener/internal/config"
+	"url-shortener/internal/model"
+	"url-shortener/internal/tenant"
+)
+
+// verifyPageSize is how many entries Verify reads at once.
+const verifyPageSize = 1000
+
+// maxRequestIDLength bounds the request IDs taken from clients.
+const maxRequestIDLength = 64
+
+// Store keeps the audit log. Entries are only ever appended.
+type Store interface {
+	// AppendAuditEntry assigns the entry the next ID and stores it. If seal
+	// is not nil, the entry is chained: PrevHash is set to the hash of the
+	// last entry and seal is called before the entry is stored, with no
+	// other entry appended in between.
+	AppendAuditEntry(entry model.AuditEntry, seal func(*model.AuditEntry)) (model.AuditEntry, error)
+	// ListAuditEntries returns up to limit entries matching q, newest first.
+	ListAuditEntries(q model.AuditQuery, limit int) ([]model.AuditEntry, error)
+}
+
+// Source is where a request came from, as far as the audit log cares.
+type Source struct {
+	RequestID string
+	IP        string
+}
+
+type ctxKey struct{}
+
+// WithSource returns a copy of ctx carrying the source of the request.
+func WithSource(ctx context.Context, s Source) context.Context {
+	return context.WithValue(ctx, ctxKey{}, s)
+}
+
+// SourceFromContext returns the source stored by WithSource.
+func SourceFromContext(ctx context.Context) (Source, bool) {
+	s, ok := ctx.Value(ctxKey{}).(Source)
+	return s, ok
+}
+
+// RequestID returns id if a client may choose it as the ID of its request:
+// up to 64 letters, digits, dots, dashes and underscores. Otherwise it
+// returns a new random ID.
+func RequestID(id string) string {
+	if id != "" && len(id) <= maxRequestIDLength && validRequestID(id) {
+		return id
+	}
+
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+
+	return hex.EncodeToString(b[:])
+}
+
+func validRequestID(id string) bool {
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// Log records changes in the audit log. Writing an entry never fails the
+// change it describes, which has already been made; failures are logged.
+type Log struct {
+	store Store
+	chain bool
+	log   *zap.Logger
+	now   func() time.Time
+}
+
+func New(store Store, cfg config.AuditConfig, log *zap.Logger) *Log {
+	return &Log{store: store, chain: cfg.HashChain, log: log.With(zap.String("op", "audit")), now: time.Now}
+}
+
+// Record appends an entry for action on target, made by the principal in
+// ctx from the source in ctx. before and after are the target around the
+// change, nil if it did not exist; links are recorded by code, domain, URL,
+// owner and creation time, anything else as its JSON.
+func (l *Log) Record(ctx context.Context, action, target string, before, after any) {
+	// Postgres keeps microseconds; the hash must survive the round trip.
+	entry := model.AuditEntry{
+		At:     l.now().UTC().Truncate(time.Microsecond),
+		Tenant: tenant.FromContext(ctx),
+		Action: action,
+		Target: target,
+	}
+	if principal, ok := auth.FromContext(ctx); ok {
+		entry.Actor, entry.Tenant = principal.Subject, principal.Tenant
+	}
+	if source, ok := SourceFromContext(ctx); ok {
+		entry.RequestID, entry.IP = source.RequestID, source.IP
+	}
+
+	err := l.write(entry, before, after)
+	if err != nil {
+		l.log.Error("failed to write audit entry", zap.String("action", action), zap.String("target", target),
+			zap.String("actor", entry.Actor), zap.Error(err))
+	}
+}
+
+func (l *Log) write(entry model.AuditEntry, before, after any) error {
+	var err error
+	if entry.Before, err = snapshot(before); err != nil {
+		return err
+	}
+	if entry.After, err = snapshot(after); err != nil {
+		return err
+	}
+
+	var seal func(*model.AuditEntry)
+	if l.chain {
+		seal = Seal
+	}
+	_, err = l.store.AppendAuditEntry(entry, seal)
+
+	return err
+}
+
+type linkSnapshot struct {
+	Code      string    `json:"code"`
+	Domain    string    `json:"domain,omitempty"`
+	URL       string    `json:"url"`
+	Owner     string    `json:"owner,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func snapshot(v any) (json.RawMessage, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case model.Link:
+		return json.Marshal(linkSnapshot{Code: v.ShortURL, Domain: v.Domain, URL: v.URL, Owner: v.Owner, CreatedAt: v.CreatedAt})
+	default:
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding audit snapshot: %w", err)
+		}
+		return raw, nil
+	}
+}
+
+// Query returns up to limit entries matching q, newest first.
+func (l *Log) Query(q model.AuditQuery, limit int) ([]model.AuditEntry, error) {
+	return l.store.ListAuditEntries(q, limit)
+}
+
+// Verification is the outcome of checking the hash chain of the audit log.
+type Verification struct {
+	// Entries is how many entries were checked.
+	Entries int
+	// Head is the hash of the newest entry. Keeping it elsewhere and passing
+	// it to a later Verify lets the removal of the newest entries be
+	// detected too.
+	Head string
+	// BrokenAt is the ID of the entry where the chain breaks, if it does:
+	// the entry was changed or has lost its hash, or the one before it was
+	// changed or removed.
+	BrokenAt int64
+	// AnchorMissing is set if no entry has the hash Verify was given: the
+	// entry it was taken from, or the chain up to it, was removed or changed.
+	AnchorMissing bool
+}
+
+// Verify walks the audit log from the newest entry to the oldest and checks
+// that every hash matches its entry and that every entry refers to the hash
+// of the one before it. Entries written before hash chaining was turned on
+// have no hash and are skipped; an entry without a hash after one with a hash
+// breaks the chain, as that is what blanking a hash looks like. If anchor is
+// not empty, it is a Head kept from an earlier Verify, and an entry with that
+// hash must still be in the log.
+func (l *Log) Verify(anchor string) (Verification, error) {
+	v := Verification{AnchorMissing: anchor != ""}
+	var newer *model.AuditEntry
+	q := model.AuditQuery{}
+	for {
+		entries, err := l.store.ListAuditEntries(q, verifyPageSize)
+		if err != nil {
+			return Verification{}, err
+		}
+
+		for i := range entries {
+			e := &entries[i]
+			v.Entries++
+			if v.Head == "" && newer == nil {
+				v.Head = e.Hash
+			}
+
+			if e.Hash != "" && e.Hash != Hash(*e) {
+				v.BrokenAt = e.ID
+				return v, nil
+			}
+			if newer != nil && (newer.Hash != "" && newer.PrevHash != e.Hash || newer.Hash == "" && e.Hash != "") {
+				v.BrokenAt = newer.ID
+				return v, nil
+			}
+			if e.Hash == anchor {
+				v.AnchorMissing = false
+			}
+			newer = e
+		}
+
+		if len(entries) < verifyPageSize {
+			break
+		}
+		q.BeforeID = entries[len(entries)-1].ID
+	}
+
+	// The oldest chained entry starts the chain, so it refers to no other.
+	if newer != nil && newer.Hash != "" && newer.PrevHash != "" {
+		v.BrokenAt = newer.ID
+	}
+
+	return v, nil
+}
+
+// Seal sets the hash of an entry whose ID and PrevHash are assigned.
+func Seal(e *model.AuditEntry) {
+	e.Hash = Hash(*e)
+}
+
+// Hash returns the hex SHA-256 of the previous hash and the JSON of every
+// other field of the entry.
+func Hash(e model.AuditEntry) string {
+	// Marshalling cannot fail: the snapshots are valid JSON or empty, and
+	// empty ones are hashed as null however they were stored.
+	before, after := e.Before, e.After
+	if len(before) == 0 {
+		before = nil
+	}
+	if len(after) == 0 {
+		after = nil
+	}
+	payload, _ := json.Marshal(struct {
+		ID        int64           `json:"id"`
+		At        string          `json:"at"`
+		Actor     string          `json:"actor"`
+		Tenant    string          `json:"tenant"`
+		Action    string          `json:"action"`
+		Target    string          `json:"target"`
+		Before    json.RawMessage `json:"before"`
+		After     json.RawMessage `json:"after"`
+		RequestID string          `json:"request_id"`
+		IP        string          `json:"ip"`
+	}{e.ID, e.At.UTC().Format(time.RFC3339Nano), e.Actor, e.Tenant, e.Action, e.Target, before, after,
+		e.RequestID, e.IP})
+
+	sum := sha256.Sum256(append([]byte(e.PrevHash+"\n"), payload...))
+
+	return hex.EncodeToString(sum[:])
+}
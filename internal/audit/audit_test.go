@@ -0,0 +1,250 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"url-shortener/internal/auth"
+	"url-shortener/internal/config"
+	"url-shortener/internal/model"
+	"url-shortener/internal/tenant"
+)
+
+var at = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func newLog(t *testing.T, path string, chain bool) (*Log, *FileStore) {
+	t.Helper()
+
+	store, err := OpenFile(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = store.Close() })
+
+	log := New(store, config.AuditConfig{HashChain: chain}, zaptest.NewLogger(t))
+	log.now = func() time.Time { return at }
+
+	return log, store
+}
+
+func TestRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.ndjson")
+	log, _ := newLog(t, path, true)
+
+	ctx := auth.WithPrincipal(context.Background(), auth.Principal{Subject: "alice", Tenant: "acme"})
+	ctx = WithSource(ctx, Source{RequestID: "req-1", IP: "203.0.113.7"})
+	link := model.Link{ShortURL: "promo", URL: "https://acme.com/sale", Owner: "alice", Tenant: "acme", CreatedAt: at}
+	log.Record(ctx, model.EventLinkCreated, "promo", nil, link)
+
+	updated := link
+	updated.URL = "https://acme.com/new"
+	log.Record(ctx, model.EventLinkUpdated, "promo", link, updated)
+
+	anonymous := tenant.WithTenant(context.Background(), "globex")
+	log.Record(anonymous, "POST /admin/keys", "", nil, map[string]int{"status": 401})
+
+	entries, err := log.Query(model.AuditQuery{}, 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+
+	assert.Equal(t, []int64{3, 2, 1}, []int64{entries[0].ID, entries[1].ID, entries[2].ID}, "newest first")
+	assert.Equal(t, model.AuditEntry{
+		ID:        2,
+		At:        at,
+		Actor:     "alice",
+		Tenant:    "acme",
+		Action:    model.EventLinkUpdated,
+		Target:    "promo",
+		Before:    json.RawMessage(`{"code":"promo","url":"https://acme.com/sale","owner":"alice","created_at":"2026-03-01T12:00:00Z"}`),
+		After:     json.RawMessage(`{"code":"promo","url":"https://acme.com/new","owner":"alice","created_at":"2026-03-01T12:00:00Z"}`),
+		RequestID: "req-1",
+		IP:        "203.0.113.7",
+		PrevHash:  entries[2].Hash,
+		Hash:      entries[1].Hash,
+	}, entries[1])
+	assert.Empty(t, entries[2].Before)
+	assert.Empty(t, entries[2].PrevHash, "the first entry starts the chain")
+	assert.Equal(t, "globex", entries[0].Tenant)
+	assert.Empty(t, entries[0].Actor)
+	assert.JSONEq(t, `{"status":401}`, string(entries[0].After))
+
+	v, err := log.Verify("")
+	require.NoError(t, err)
+	assert.Equal(t, Verification{Entries: 3, Head: entries[0].Hash}, v)
+}
+
+func TestQuery(t *testing.T) {
+	log, _ := newLog(t, filepath.Join(t.TempDir(), "audit.ndjson"), false)
+
+	for i, actor := range []string{"alice", "bob", "alice", "alice"} {
+		ctx := auth.WithPrincipal(context.Background(), auth.Principal{Subject: actor})
+		log.now = func() time.Time { return at.Add(time.Duration(i) * time.Hour) }
+		log.Record(ctx, model.EventLinkDeleted, "promo", nil, nil)
+	}
+
+	ids := func(q model.AuditQuery, limit int) []int64 {
+		entries, err := log.Query(q, limit)
+		require.NoError(t, err)
+		var ids []int64
+		for _, e := range entries {
+			ids = append(ids, e.ID)
+		}
+		return ids
+	}
+
+	assert.Equal(t, []int64{4, 3, 1}, ids(model.AuditQuery{Actor: "alice"}, 10))
+	assert.Equal(t, []int64{4, 3}, ids(model.AuditQuery{Actor: "alice"}, 2))
+	assert.Equal(t, []int64{1}, ids(model.AuditQuery{Actor: "alice", BeforeID: 3}, 2))
+	assert.Equal(t, []int64{3, 2}, ids(model.AuditQuery{From: at.Add(time.Hour), To: at.Add(3 * time.Hour)}, 10))
+	assert.Empty(t, ids(model.AuditQuery{Action: model.EventLinkCreated}, 10))
+}
+
+func TestFileStore_Reopens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.ndjson")
+	log, store := newLog(t, path, true)
+	log.Record(context.Background(), model.EventLinkCreated, "promo", nil, nil)
+	require.NoError(t, store.Close())
+
+	log, _ = newLog(t, path, true)
+	log.Record(context.Background(), model.EventLinkDeleted, "promo", nil, nil)
+
+	entries, err := log.Query(model.AuditQuery{}, 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, int64(2), entries[0].ID)
+	assert.Equal(t, entries[1].Hash, entries[0].PrevHash, "the chain continues")
+
+	_, err = store.AppendAuditEntry(model.AuditEntry{}, nil)
+	assert.Error(t, err, "a closed store is not written to")
+}
+
+func TestMemoryStore(t *testing.T) {
+	log := New(NewMemoryStore(), config.AuditConfig{HashChain: true}, zaptest.NewLogger(t))
+	for _, target := range []string{"a", "b", "c"} {
+		log.Record(context.Background(), model.EventLinkCreated, target, nil, nil)
+	}
+
+	entries, err := log.Query(model.AuditQuery{BeforeID: 3}, 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "b", entries[0].Target)
+	assert.Equal(t, entries[1].Hash, entries[0].PrevHash)
+
+	v, err := log.Verify("")
+	require.NoError(t, err)
+	assert.Equal(t, 3, v.Entries)
+	assert.Zero(t, v.BrokenAt)
+}
+
+func TestVerify_DetectsTampering(t *testing.T) {
+	record := func(t *testing.T, path string) *Log {
+		log, _ := newLog(t, path, true)
+		for _, target := range []string{"a", "b", "c", "d"} {
+			log.Record(context.Background(), model.EventLinkCreated, target, nil, nil)
+		}
+		return log
+	}
+	rewrite := func(t *testing.T, path string, edit func(lines []string) []string) {
+		raw, err := os.ReadFile(path)
+		require.NoError(t, err)
+		lines := edit(strings.Split(strings.TrimSuffix(string(raw), "\n"), "\n"))
+		require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600))
+	}
+
+	for name, tc := range map[string]struct {
+		edit     func(lines []string) []string
+		brokenAt int64
+	}{
+		"changed": {func(lines []string) []string {
+			lines[1] = strings.Replace(lines[1], `"target":"b"`, `"target":"x"`, 1)
+			return lines
+		}, 2},
+		"removed": {func(lines []string) []string {
+			return append(lines[:1], lines[2:]...)
+		}, 3},
+		"oldest removed": {func(lines []string) []string {
+			return lines[1:]
+		}, 2},
+		"newest unchained": {func(lines []string) []string {
+			lines[3] = regexp.MustCompile(`,"(prev_hash|hash)":"[0-9a-f]+"`).ReplaceAllString(lines[3], "")
+			return lines
+		}, 4},
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.ndjson")
+			log := record(t, path)
+
+			v, err := log.Verify("")
+			require.NoError(t, err)
+			require.Zero(t, v.BrokenAt)
+
+			rewrite(t, path, tc.edit)
+			v, err = log.Verify("")
+			require.NoError(t, err)
+			assert.Equal(t, tc.brokenAt, v.BrokenAt)
+		})
+	}
+}
+
+func TestVerify_Anchor(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.ndjson")
+	log, _ := newLog(t, path, true)
+	for _, target := range []string{"a", "b", "c"} {
+		log.Record(context.Background(), model.EventLinkCreated, target, nil, nil)
+	}
+
+	v, err := log.Verify("")
+	require.NoError(t, err)
+	head := v.Head
+
+	v, err = log.Verify(head)
+	require.NoError(t, err)
+	assert.False(t, v.AnchorMissing)
+
+	// Cutting off the newest entry leaves a valid chain, but not the head
+	// kept from before.
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.SplitAfter(string(raw), "\n")
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines[:2], "")), 0o600))
+
+	v, err = log.Verify(head)
+	require.NoError(t, err)
+	assert.Zero(t, v.BrokenAt)
+	assert.True(t, v.AnchorMissing)
+	assert.NotEqual(t, head, v.Head)
+}
+
+func TestVerify_UnchainedEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.ndjson")
+	log, store := newLog(t, path, false)
+	log.Record(context.Background(), model.EventLinkCreated, "a", nil, nil)
+	require.NoError(t, store.Close())
+
+	log, _ = newLog(t, path, true)
+	log.Record(context.Background(), model.EventLinkCreated, "b", nil, nil)
+	log.Record(context.Background(), model.EventLinkCreated, "c", nil, nil)
+
+	v, err := log.Verify("")
+	require.NoError(t, err)
+	assert.Zero(t, v.BrokenAt, "the chain starts after entries written without it")
+	assert.Equal(t, 3, v.Entries)
+}
+
+func TestRequestID(t *testing.T) {
+	assert.Equal(t, "3f2c-9a.b_1", RequestID("3f2c-9a.b_1"))
+
+	for _, id := range []string{"", "a b", "ünïcode", strings.Repeat("a", 65)} {
+		got := RequestID(id)
+		assert.Len(t, got, 32, id)
+		assert.NotEqual(t, got, RequestID(id))
+	}
+}
@@ -0,0 +1,156 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"url-shortener/internal/model"
+)
+
+// maxLineSize bounds the entries FileStore reads back.
+const maxLineSize = 1 << 20
+
+var errClosed = errors.New("audit log is closed")
+
+// FileStore keeps the audit log in an NDJSON file, one entry per line. It is
+// the store of the memory storage backend; the file is only ever appended to
+// and synced after every entry.
+type FileStore struct {
+	mu       sync.Mutex
+	path     string
+	file     *os.File
+	lastID   int64
+	lastHash string
+}
+
+type fileEntry struct {
+	ID        int64           `json:"id"`
+	At        time.Time       `json:"at"`
+	Actor     string          `json:"actor,omitempty"`
+	Tenant    string          `json:"tenant,omitempty"`
+	Action    string          `json:"action"`
+	Target    string          `json:"target,omitempty"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	RequestID string          `json:"request_id,omitempty"`
+	IP        string          `json:"ip,omitempty"`
+	PrevHash  string          `json:"prev_hash,omitempty"`
+	Hash      string          `json:"hash,omitempty"`
+}
+
+// OpenFile opens the audit log at path, creating it if needed, and reads it
+// to continue its IDs and hash chain.
+func OpenFile(path string) (*FileStore, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	s := &FileStore{path: path, file: file}
+	err = s.scan(func(e model.AuditEntry) {
+		s.lastID, s.lastHash = e.ID, e.Hash
+	})
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *FileStore) AppendAuditEntry(entry model.AuditEntry, seal func(*model.AuditEntry)) (model.AuditEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return model.AuditEntry{}, errClosed
+	}
+
+	entry.ID = s.lastID + 1
+	if seal != nil {
+		entry.PrevHash = s.lastHash
+		seal(&entry)
+	}
+
+	line, err := json.Marshal(fileEntry(entry))
+	if err != nil {
+		return model.AuditEntry{}, fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return model.AuditEntry{}, fmt.Errorf("failed to write audit entry: %w", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return model.AuditEntry{}, fmt.Errorf("failed to sync audit log: %w", err)
+	}
+
+	s.lastID, s.lastHash = entry.ID, entry.Hash
+
+	return entry, nil
+}
+
+// ListAuditEntries reads the whole file, keeping the newest matches.
+func (s *FileStore) ListAuditEntries(q model.AuditQuery, limit int) ([]model.AuditEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matched []model.AuditEntry
+	err := s.scan(func(e model.AuditEntry) {
+		if !q.Matches(e) {
+			return
+		}
+		matched = append(matched, e)
+		if len(matched) > limit {
+			matched = matched[1:]
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(matched)-1; i < j; i, j = i+1, j-1 {
+		matched[i], matched[j] = matched[j], matched[i]
+	}
+
+	return matched, nil
+}
+
+func (s *FileStore) scan(fn func(model.AuditEntry)) error {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		var e fileEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return fmt.Errorf("failed to decode audit log line %d: %w", line, err)
+		}
+		fn(model.AuditEntry(e))
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	return nil
+}
+
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+
+	return err
+}
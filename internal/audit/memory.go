@@ -0,0 +1,49 @@
+package audit
+
+import (
+	"sync"
+
+	"url-shortener/internal/model"
+)
+
+// MemoryStore keeps the audit log in memory. It is the store of the memory
+// storage backend when no audit file is set, and is lost on restart like the
+// rest of that backend.
+type MemoryStore struct {
+	mu      sync.RWMutex
+	entries []model.AuditEntry
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (s *MemoryStore) AppendAuditEntry(entry model.AuditEntry, seal func(*model.AuditEntry)) (model.AuditEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry.ID = int64(len(s.entries)) + 1
+	if seal != nil {
+		if len(s.entries) > 0 {
+			entry.PrevHash = s.entries[len(s.entries)-1].Hash
+		}
+		seal(&entry)
+	}
+	s.entries = append(s.entries, entry)
+
+	return entry, nil
+}
+
+func (s *MemoryStore) ListAuditEntries(q model.AuditQuery, limit int) ([]model.AuditEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var matched []model.AuditEntry
+	for i := len(s.entries) - 1; i >= 0 && len(matched) < limit; i-- {
+		if q.Matches(s.entries[i]) {
+			matched = append(matched, s.entries[i])
+		}
+	}
+
+	return matched, nil
+}
@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"url-shortener/internal/model"
+	"url-shortener/internal/storage/errs"
+	"url-shortener/pkg/util/random"
+)
+
+const (
+	keyPrefix    = "usk"
+	keyIDLength  = 12
+	secretLength = 32
+	keyAlphabet  = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890"
+
+	// lastUsedResolution limits how often a busy key's last-used time is
+	// written back to storage.
+	lastUsedResolution = time.Minute
+)
+
+var ErrKeyRevoked = errors.New("API key is revoked")
+
+// KeyStore keeps API keys. storage.Storage implements it.
+type KeyStore interface {
+	PutAPIKey(key model.APIKey) error
+	GetAPIKey(id string) (model.APIKey, error)
+	ListAPIKeys() ([]model.APIKey, error)
+	RevokeAPIKey(id string, at time.Time) error
+	TouchAPIKey(id string, at time.Time) error
+}
+
+// Keys issues and checks API keys of the form usk_<id>_<secret>. The id is
+// stored in the clear to find the key; the whole key is stored as SHA-256.
+type Keys struct {
+	store KeyStore
+	log   *zap.Logger
+	now   func() time.Time
+}
+
+func NewKeys(store KeyStore, log *zap.Logger) *Keys {
+	return &Keys{store: store, log: log, now: time.Now}
+}
+
+// Create issues a new key and returns it in plain text together with the
+// stored record. The plain text is not kept anywhere.
+func (k *Keys) Create(name, tenant string, scopes []string) (string, model.APIKey, error) {
+	if err := ValidateScopes(scopes); err != nil {
+		return "", model.APIKey{}, err
+	}
+
+	id, err := random.NewRandomStringFromAlphabet(keyAlphabet, keyIDLength)
+	if err != nil {
+		return "", model.APIKey{}, fmt.Errorf("failed to generate key id: %w", err)
+	}
+
+	secret, err := random.NewRandomStringFromAlphabet(keyAlphabet, secretLength)
+	if err != nil {
+		return "", model.APIKey{}, fmt.Errorf("failed to generate key secret: %w", err)
+	}
+
+	plain := keyPrefix + "_" + id + "_" + secret
+	key := model.APIKey{
+		ID:        id,
+		Name:      name,
+		Hash:      hashKey(plain),
+		Scopes:    scopes,
+		Tenant:    tenant,
+		CreatedAt: k.now().UTC(),
+	}
+
+	if err := k.store.PutAPIKey(key); err != nil {
+		return "", model.APIKey{}, fmt.Errorf("failed to store API key: %w", err)
+	}
+
+	return plain, key, nil
+}
+
+// Authenticate checks a plain-text key and returns its principal.
+func (k *Keys) Authenticate(_ context.Context, plain string) (Principal, error) {
+	if plain == "" {
+		return Principal{}, ErrMissingCredentials
+	}
+
+	id, ok := parseKey(plain)
+	if !ok {
+		return Principal{}, ErrInvalidCredentials
+	}
+
+	key, err := k.store.GetAPIKey(id)
+	if errors.Is(err, errs.ErrAPIKeyIsNotExist) {
+		return Principal{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return Principal{}, fmt.Errorf("failed to load API key: %w", err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(key.Hash), []byte(hashKey(plain))) != 1 {
+		return Principal{}, ErrInvalidCredentials
+	}
+
+	now := k.now().UTC()
+	if !key.Active(now) {
+		return Principal{}, fmt.Errorf("%w: %w", ErrInvalidCredentials, ErrKeyRevoked)
+	}
+
+	if now.Sub(key.LastUsedAt) >= lastUsedResolution {
+		if err := k.store.TouchAPIKey(key.ID, now); err != nil {
+			k.log.Warn("failed to record API key use", zap.String("key", key.ID), zap.Error(err))
+		}
+	}
+
+	return Principal{Subject: "key:" + key.ID, Name: key.Name, Tenant: key.Tenant, Scopes: key.Scopes}, nil
+}
+
+func (k *Keys) List() ([]model.APIKey, error) {
+	return k.store.ListAPIKeys()
+}
+
+// Rotate issues a key with the same name, tenant and scopes as id and revokes the old
+// key once grace has passed, so clients can switch over without downtime.
+func (k *Keys) Rotate(id string, grace time.Duration) (string, model.APIKey, error) {
+	old, err := k.store.GetAPIKey(id)
+	if err != nil {
+		return "", model.APIKey{}, err
+	}
+
+	now := k.now().UTC()
+	if !old.Active(now) {
+		return "", model.APIKey{}, ErrKeyRevoked
+	}
+
+	plain, key, err := k.Create(old.Name, old.Tenant, old.Scopes)
+	if err != nil {
+		return "", model.APIKey{}, err
+	}
+
+	if err := k.store.RevokeAPIKey(old.ID, now.Add(grace)); err != nil {
+		return "", model.APIKey{}, fmt.Errorf("failed to revoke rotated API key: %w", err)
+	}
+
+	return plain, key, nil
+}
+
+// Revoke disables a key immediately.
+func (k *Keys) Revoke(id string) error {
+	return k.store.RevokeAPIKey(id, k.now().UTC())
+}
+
+func parseKey(plain string) (string, bool) {
+	parts := strings.Split(plain, "_")
+	if len(parts) != 3 || parts[0] != keyPrefix || len(parts[1]) != keyIDLength || len(parts[2]) != secretLength {
+		return "", false
+	}
+
+	return parts[1], true
+}
+
+func hashKey(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
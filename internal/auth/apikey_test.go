@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"url-shortener/internal/storage/errs"
+	"url-shortener/internal/storage/memory"
+)
+
+func newKeys(t *testing.T) (*Keys, *memory.StorageInMemory, *time.Time) {
+	logger := zaptest.NewLogger(t)
+	store := memory.NewStorageInMemory(logger)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	keys := NewKeys(store, logger)
+	keys.now = func() time.Time { return now }
+
+	return keys, store, &now
+}
+
+func TestKeys_CreateAndAuthenticate(t *testing.T) {
+	keys, store, _ := newKeys(t)
+
+	plain, key, err := keys.Create("ci", "", []string{ScopeLinksCreate})
+	require.NoError(t, err)
+	assert.Contains(t, plain, key.ID)
+	assert.NotContains(t, key.Hash, plain)
+
+	p, err := keys.Authenticate(context.Background(), plain)
+	require.NoError(t, err)
+	assert.Equal(t, "key:"+key.ID, p.Subject)
+	assert.True(t, p.HasScope(ScopeLinksCreate))
+	assert.False(t, p.HasScope(ScopeLinksDelete))
+
+	stored, err := store.GetAPIKey(key.ID)
+	require.NoError(t, err)
+	assert.False(t, stored.LastUsedAt.IsZero(), "last use is recorded")
+
+	_, err = keys.Authenticate(context.Background(), plain[:len(plain)-1]+"x")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	_, err = keys.Authenticate(context.Background(), "garbage")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	_, err = keys.Authenticate(context.Background(), "")
+	assert.ErrorIs(t, err, ErrMissingCredentials)
+}
+
+func TestKeys_CreateUnknownScope(t *testing.T) {
+	keys, _, _ := newKeys(t)
+
+	_, _, err := keys.Create("ci", "", []string{"links:everything"})
+	assert.ErrorIs(t, err, ErrUnknownScope)
+}
+
+func TestKeys_AdminHasEveryScope(t *testing.T) {
+	p := Principal{Scopes: []string{ScopeAdmin}}
+
+	for _, scope := range Scopes {
+		assert.Equal(t, scope != ScopeSuperAdmin, p.HasScope(scope), scope)
+	}
+
+	p = Principal{Scopes: []string{ScopeSuperAdmin}}
+	for _, scope := range Scopes {
+		assert.True(t, p.HasScope(scope), scope)
+	}
+}
+
+func TestTenantBinding(t *testing.T) {
+	admin := Principal{Tenant: "acme", Scopes: []string{ScopeAdmin}}
+	super := Principal{Tenant: "acme", Scopes: []string{ScopeSuperAdmin}}
+
+	assert.True(t, Manages(admin, "acme"))
+	assert.False(t, Manages(admin, "globex"))
+	assert.True(t, Manages(super, "globex"))
+
+	for named, want := range map[string]string{"": "acme", "acme": "acme"} {
+		tenant, err := TenantFor(admin, named)
+		require.NoError(t, err)
+		assert.Equal(t, want, tenant, named)
+	}
+	_, err := TenantFor(admin, "globex")
+	assert.ErrorIs(t, err, ErrOtherTenant)
+
+	tenant, err := TenantFor(super, "")
+	require.NoError(t, err)
+	assert.Empty(t, tenant, "a superadmin names the default tenant")
+
+	assert.NoError(t, Covers(admin, []string{ScopeLinksRead, ScopeAdmin}))
+	assert.ErrorIs(t, Covers(admin, []string{ScopeLinksRead, ScopeSuperAdmin}), ErrForbidden)
+}
+
+func TestKeys_Revoke(t *testing.T) {
+	keys, _, _ := newKeys(t)
+
+	plain, key, err := keys.Create("ci", "", []string{ScopeLinksRead})
+	require.NoError(t, err)
+	require.NoError(t, keys.Revoke(key.ID))
+
+	_, err = keys.Authenticate(context.Background(), plain)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	assert.ErrorIs(t, err, ErrKeyRevoked)
+
+	assert.ErrorIs(t, keys.Revoke("missing"), errs.ErrAPIKeyIsNotExist)
+}
+
+func TestKeys_RotateWithGrace(t *testing.T) {
+	keys, _, now := newKeys(t)
+
+	oldPlain, oldKey, err := keys.Create("ci", "", []string{ScopeLinksCreate})
+	require.NoError(t, err)
+
+	newPlain, newKey, err := keys.Rotate(oldKey.ID, time.Hour)
+	require.NoError(t, err)
+	assert.NotEqual(t, oldKey.ID, newKey.ID)
+	assert.Equal(t, oldKey.Scopes, newKey.Scopes)
+
+	_, err = keys.Authenticate(context.Background(), oldPlain)
+	assert.NoError(t, err, "old key works during the grace period")
+
+	*now = now.Add(time.Hour)
+
+	_, err = keys.Authenticate(context.Background(), oldPlain)
+	assert.ErrorIs(t, err, ErrKeyRevoked)
+
+	_, err = keys.Authenticate(context.Background(), newPlain)
+	assert.NoError(t, err)
+
+	_, _, err = keys.Rotate(oldKey.ID, 0)
+	assert.ErrorIs(t, err, ErrKeyRevoked)
+}
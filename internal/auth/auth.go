@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+const (
+	ScopeLinksCreate = "links:create"
+	ScopeLinksRead   = "links:read"
+	ScopeLinksDelete = "links:delete"
+	// ScopeAdmin grants every other scope as well as key management, except
+	// ScopeSuperAdmin.
+	ScopeAdmin = "admin"
+	// ScopeSuperAdmin grants every scope and lets the admin API reach every
+	// tenant, e.g. to export the clicks of all of them.
+	ScopeSuperAdmin = "superadmin"
+)
+
+// Scopes lists every scope a credential may carry.
+var Scopes = []string{ScopeLinksCreate, ScopeLinksRead, ScopeLinksDelete, ScopeAdmin, ScopeSuperAdmin}
+
+var (
+	ErrMissingCredentials = errors.New("missing credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrForbidden          = errors.New("insufficient scope")
+	ErrUnknownScope       = errors.New("unknown scope")
+	ErrOtherTenant        = errors.New("cannot act for another tenant")
+)
+
+// Principal is the authenticated caller.
+type Principal struct {
+	// Subject identifies the caller, e.g. "key:<id>".
+	Subject string
+	Name    string
+	// Tenant is the tenant the caller acts for, if the credential names one.
+	Tenant string
+	Scopes []string
+}
+
+// HasScope reports whether the principal may act with scope.
+func (p Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope) || slices.Contains(p.Scopes, ScopeSuperAdmin) ||
+		scope != ScopeSuperAdmin && slices.Contains(p.Scopes, ScopeAdmin)
+}
+
+// Manages reports whether p manages what belongs to tenant, such as its API
+// keys and webhooks: p's own tenant, or every tenant with ScopeSuperAdmin.
+func Manages(p Principal, tenant string) bool {
+	return tenant == p.Tenant || p.HasScope(ScopeSuperAdmin)
+}
+
+// TenantFor returns the tenant p acts for when a request names tenant. With
+// ScopeSuperAdmin that is tenant itself, empty being the default tenant;
+// otherwise it is p's own tenant, which an empty tenant stands for, and any
+// other tenant is ErrOtherTenant.
+func TenantFor(p Principal, tenant string) (string, error) {
+	if p.HasScope(ScopeSuperAdmin) {
+		return tenant, nil
+	}
+	if tenant != "" && tenant != p.Tenant {
+		return "", fmt.Errorf("%w: %q", ErrOtherTenant, tenant)
+	}
+
+	return p.Tenant, nil
+}
+
+// Covers returns an error wrapping ErrForbidden for the first of scopes p does
+// not hold, so that p cannot hand out, or take over, more than it has.
+func Covers(p Principal, scopes []string) error {
+	for _, scope := range scopes {
+		if !p.HasScope(scope) {
+			return fmt.Errorf("%w: %q", ErrForbidden, scope)
+		}
+	}
+
+	return nil
+}
+
+// ValidateScopes returns ErrUnknownScope for the first scope that is not in
+// Scopes.
+func ValidateScopes(scopes []string) error {
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, scope) {
+			return fmt.Errorf("%w: %q", ErrUnknownScope, scope)
+		}
+	}
+
+	return nil
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal stored by WithPrincipal, if any.
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
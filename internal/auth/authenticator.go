@@ -0,0 +1,40 @@
+package auth
+
+import (
+	"context"
+	"strings"
+)
+
+// Credentials are what a request presented.
+type Credentials struct {
+	APIKey      string
+	BearerToken string
+}
+
+// Authenticator accepts API keys, bearer tokens or both, depending on which
+// of Keys and Tokens are set. A bearer token takes precedence over an API key.
+type Authenticator struct {
+	Keys   *Keys
+	Tokens *TokenVerifier
+}
+
+func (a *Authenticator) Authenticate(ctx context.Context, creds Credentials) (Principal, error) {
+	switch {
+	case creds.BearerToken != "" && a.Tokens != nil:
+		return a.Tokens.Verify(ctx, creds.BearerToken)
+	case creds.APIKey != "" && a.Keys != nil:
+		return a.Keys.Authenticate(ctx, creds.APIKey)
+	default:
+		return Principal{}, ErrMissingCredentials
+	}
+}
+
+// BearerToken extracts the token from an Authorization header value.
+func BearerToken(authorization string) string {
+	scheme, token, ok := strings.Cut(authorization, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+
+	return strings.TrimSpace(token)
+}
@@ -0,0 +1,288 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultJWKSCacheTTL = 10 * time.Minute
+
+	// minJWKSRefresh bounds how often an unknown key id can force a reload,
+	// so tokens with made-up key ids cannot hammer the identity provider.
+	minJWKSRefresh = 30 * time.Second
+
+	maxJWKSSize = 1 << 20
+
+	// jwksFetchTimeout bounds a reload, which does not depend on the request
+	// that triggered it.
+	jwksFetchTimeout = 10 * time.Second
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// JWKS serves public keys from a JSON Web Key Set read from a file or URL.
+// The set is cached for ttl and reloaded early when a token names a key id
+// it does not know. If a reload fails the previous keys stay in use. One
+// reload runs at a time, in the background; the requests that need it wait
+// for it without holding up the others.
+type JWKS struct {
+	file   string
+	url    string
+	ttl    time.Duration
+	client *http.Client
+	log    *zap.Logger
+	now    func() time.Time
+
+	mu       sync.Mutex
+	keys     map[string]publicKey
+	loadedAt time.Time
+	// loading is closed when the reload in progress, if any, ends.
+	loading chan struct{}
+	// loadErr is why the last reload failed.
+	loadErr error
+}
+
+type publicKey struct {
+	key crypto.PublicKey
+	alg string
+}
+
+// NewJWKS reads keys from file if set, otherwise from url.
+func NewJWKS(file, url string, ttl time.Duration, log *zap.Logger) *JWKS {
+	if ttl <= 0 {
+		ttl = DefaultJWKSCacheTTL
+	}
+
+	return &JWKS{
+		file:   file,
+		url:    url,
+		ttl:    ttl,
+		client: &http.Client{Timeout: 10 * time.Second},
+		log:    log,
+		now:    time.Now,
+	}
+}
+
+// Key returns the public key with id kid and the algorithm it is restricted
+// to, if the set names one.
+func (j *JWKS) Key(ctx context.Context, kid string) (crypto.PublicKey, string, error) {
+	j.mu.Lock()
+	now := j.now()
+	stale := j.keys == nil || now.Sub(j.loadedAt) >= j.ttl
+	_, known := j.keys[kid]
+	if (stale || (!known && now.Sub(j.loadedAt) >= minJWKSRefresh)) && j.loading == nil {
+		// A failed reload is not retried until the next refresh window.
+		j.loadedAt = now
+		j.loading = make(chan struct{})
+		go j.reload(j.loading)
+	}
+	loading := j.loading
+	j.mu.Unlock()
+
+	// Requests wait for a reload only when their key may depend on it.
+	if loading != nil && (stale || !known) {
+		select {
+		case <-loading:
+		case <-ctx.Done():
+			return nil, "", ctx.Err()
+		}
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.keys == nil {
+		return nil, "", j.loadErr
+	}
+
+	key, ok := j.keys[kid]
+	if !ok && kid == "" && len(j.keys) == 1 {
+		for _, only := range j.keys {
+			key, ok = only, true
+		}
+	}
+	if !ok {
+		return nil, "", fmt.Errorf("%w %q", ErrUnknownKey, kid)
+	}
+
+	return key.key, key.alg, nil
+}
+
+// reload replaces the keys and closes done.
+func (j *JWKS) reload(done chan struct{}) {
+	ctx, cancel := context.WithTimeout(context.Background(), jwksFetchTimeout)
+	defer cancel()
+
+	keys, err := j.load(ctx)
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	switch {
+	case err == nil:
+		j.keys, j.loadErr = keys, nil
+		j.log.Info("loaded JWKS", zap.Int("keys", len(keys)))
+	case j.keys != nil:
+		j.log.Warn("failed to reload JWKS, using cached keys", zap.Error(err))
+	default:
+		j.loadErr = err
+	}
+
+	j.loading = nil
+	close(done)
+}
+
+func (j *JWKS) load(ctx context.Context) (map[string]publicKey, error) {
+	data, err := j.fetch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseJWKS(data)
+}
+
+func (j *JWKS) fetch(ctx context.Context) ([]byte, error) {
+	if j.file != "" {
+		data, err := os.ReadFile(j.file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWKS file: %w", err)
+		}
+		return data, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build JWKS request: %w", err)
+	}
+
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS: %w", err)
+	}
+
+	return data, nil
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS keeps the RSA and EC signing keys of a set and skips the rest.
+func parseJWKS(data []byte) (map[string]publicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	keys := make(map[string]publicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		var key crypto.PublicKey
+		var err error
+		switch k.Kty {
+		case "RSA":
+			key, err = rsaKey(k)
+		case "EC":
+			key, err = ecKey(k)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWK %q: %w", k.Kid, err)
+		}
+
+		keys[k.Kid] = publicKey{key: key, alg: k.Alg}
+	}
+
+	return keys, nil
+}
+
+func rsaKey(k jwk) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("modulus: %w", err)
+	}
+
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, fmt.Errorf("exponent: %w", err)
+	}
+
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+		return nil, errors.New("unsupported exponent")
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
+
+func ecKey(k jwk) (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch k.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+	}
+
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, fmt.Errorf("x: %w", err)
+	}
+
+	y, err := base64.RawURLEncoding.DecodeString(k.Y)
+	if err != nil {
+		return nil, fmt.Errorf("y: %w", err)
+	}
+
+	key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+	// ECDH fails for points that are not on the curve.
+	if _, err := key.ECDH(); err != nil {
+		return nil, fmt.Errorf("invalid point: %w", err)
+	}
+
+	return key, nil
+}
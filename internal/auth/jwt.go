@@ -0,0 +1,271 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"url-shortener/internal/config"
+)
+
+const (
+	DefaultUserClaim   = "sub"
+	DefaultTenantClaim = "tenant"
+	DefaultScopeClaim  = "scope"
+)
+
+// KeySource looks up token signing keys. JWKS implements it.
+type KeySource interface {
+	Key(ctx context.Context, kid string) (crypto.PublicKey, string, error)
+}
+
+// TokenVerifier checks JWT bearer tokens: the signature against keys, the
+// issuer, the audience and the validity period.
+type TokenVerifier struct {
+	keys          KeySource
+	issuer        string
+	audience      string
+	leeway        time.Duration
+	userClaim     string
+	tenantClaim   string
+	scopeClaim    string
+	defaultScopes []string
+	now           func() time.Time
+}
+
+func NewTokenVerifier(cfg config.JWTConfig, keys KeySource) (*TokenVerifier, error) {
+	if cfg.Issuer == "" || cfg.Audience == "" {
+		return nil, errors.New("jwt issuer and audience must be set")
+	}
+
+	if err := ValidateScopes(cfg.DefaultScopes); err != nil {
+		return nil, err
+	}
+
+	v := &TokenVerifier{
+		keys:          keys,
+		issuer:        cfg.Issuer,
+		audience:      cfg.Audience,
+		leeway:        cfg.Leeway,
+		userClaim:     orDefault(cfg.UserClaim, DefaultUserClaim),
+		tenantClaim:   orDefault(cfg.TenantClaim, DefaultTenantClaim),
+		scopeClaim:    orDefault(cfg.ScopeClaim, DefaultScopeClaim),
+		defaultScopes: cfg.DefaultScopes,
+		now:           time.Now,
+	}
+
+	return v, nil
+}
+
+// Verify checks token and maps its claims to a principal. Every rejection
+// wraps ErrInvalidCredentials.
+func (v *TokenVerifier) Verify(ctx context.Context, token string) (Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Principal{}, invalidToken("malformed token")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Principal{}, invalidToken("malformed header")
+	}
+
+	key, keyAlg, err := v.keys.Key(ctx, header.Kid)
+	if errors.Is(err, ErrUnknownKey) {
+		return Principal{}, invalidToken(err.Error())
+	}
+	if err != nil {
+		return Principal{}, fmt.Errorf("failed to load signing key: %w", err)
+	}
+
+	if keyAlg != "" && keyAlg != header.Alg {
+		return Principal{}, invalidToken("algorithm does not match the key")
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Principal{}, invalidToken("malformed signature")
+	}
+
+	if err := verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return Principal{}, invalidToken(err.Error())
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Principal{}, invalidToken("malformed claims")
+	}
+
+	if err := v.validate(claims); err != nil {
+		return Principal{}, err
+	}
+
+	user, _ := claims[v.userClaim].(string)
+	if user == "" {
+		return Principal{}, invalidToken("missing " + v.userClaim + " claim")
+	}
+	tenant, _ := claims[v.tenantClaim].(string)
+
+	// The prefix keeps token users apart from API keys, whose subjects are
+	// "key:<id>", so a token cannot claim the links of a key.
+	return Principal{Subject: "jwt:" + user, Name: user, Tenant: tenant, Scopes: v.scopes(claims)}, nil
+}
+
+func (v *TokenVerifier) validate(claims map[string]any) error {
+	if iss, _ := claims["iss"].(string); iss != v.issuer {
+		return invalidToken("unexpected issuer")
+	}
+
+	if !audienceContains(claims["aud"], v.audience) {
+		return invalidToken("unexpected audience")
+	}
+
+	now := v.now()
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return invalidToken("missing exp claim")
+	}
+	if !now.Before(unixTime(exp).Add(v.leeway)) {
+		return invalidToken("token expired")
+	}
+
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(v.leeway).Before(unixTime(nbf)) {
+		return invalidToken("token not valid yet")
+	}
+
+	return nil
+}
+
+// scopes reads a space-separated string or a list of scopes and keeps the
+// ones this service knows. Tokens without the claim get the default scopes.
+func (v *TokenVerifier) scopes(claims map[string]any) []string {
+	var raw []string
+	switch value := claims[v.scopeClaim].(type) {
+	case nil:
+		return v.defaultScopes
+	case string:
+		raw = strings.Fields(value)
+	case []any:
+		for _, s := range value {
+			if str, ok := s.(string); ok {
+				raw = append(raw, str)
+			}
+		}
+	}
+
+	scopes := make([]string, 0, len(raw))
+	for _, scope := range raw {
+		if slices.Contains(Scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return scopes
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed, signature []byte) error {
+	hashes := map[string]crypto.Hash{"256": crypto.SHA256, "384": crypto.SHA384, "512": crypto.SHA512}
+	// ES512 uses P-521, the others use the curve named after the hash size.
+	curves := map[string]int{"ES256": 256, "ES384": 384, "ES512": 521}
+
+	hash, ok := hashes[alg[min(2, len(alg)):]]
+	if !ok {
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch alg[:2] {
+	case "RS", "PS":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("algorithm does not match the key")
+		}
+
+		var err error
+		if alg[0] == 'R' {
+			err = rsa.VerifyPKCS1v15(pub, hash, digest, signature)
+		} else {
+			err = rsa.VerifyPSS(pub, hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+		if err != nil {
+			return errors.New("invalid signature")
+		}
+	case "ES":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || pub.Curve.Params().BitSize != curves[alg] {
+			return errors.New("algorithm does not match the key")
+		}
+
+		// JWS encodes ECDSA signatures as fixed-size r || s.
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("invalid signature")
+		}
+
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+
+	return nil
+}
+
+func audienceContains(aud any, audience string) bool {
+	switch value := aud.(type) {
+	case string:
+		return value == audience
+	case []any:
+		for _, a := range value {
+			if a == audience {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
+
+func unixTime(seconds float64) time.Time {
+	return time.Unix(0, int64(seconds*float64(time.Second)))
+}
+
+func invalidToken(reason string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidCredentials, reason)
+}
+
+func orDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+
+	return value
+}
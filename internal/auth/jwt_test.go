@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"url-shortener/internal/config"
+)
+
+const (
+	issuer   = "https://id.example.com"
+	audience = "url-shortener"
+)
+
+var b64 = base64.RawURLEncoding
+
+type testKeys struct {
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+}
+
+func newTestKeys(t *testing.T) testKeys {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	return testKeys{rsa: rsaKey, ec: ecKey}
+}
+
+func (k testKeys) jwks() []byte {
+	data, _ := json.Marshal(map[string]any{"keys": []map[string]string{
+		{
+			"kty": "RSA", "kid": "rsa", "use": "sig", "alg": "RS256",
+			"n": b64.EncodeToString(k.rsa.N.Bytes()),
+			"e": b64.EncodeToString(big.NewInt(int64(k.rsa.E)).Bytes()),
+		},
+		{
+			"kty": "EC", "kid": "ec", "crv": "P-256",
+			"x": b64.EncodeToString(k.ec.X.FillBytes(make([]byte, 32))),
+			"y": b64.EncodeToString(k.ec.Y.FillBytes(make([]byte, 32))),
+		},
+		{"kty": "oct", "kid": "hmac", "k": "c2VjcmV0"},
+	}})
+
+	return data
+}
+
+func sign(t *testing.T, keys testKeys, alg, kid string, claims map[string]any) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64.EncodeToString(header) + "." + b64.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	var err error
+	switch alg {
+	case "RS256":
+		sig, err = rsa.SignPKCS1v15(rand.Reader, keys.rsa, crypto.SHA256, digest[:])
+	case "PS256":
+		sig, err = rsa.SignPSS(rand.Reader, keys.rsa, crypto.SHA256, digest[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	case "ES256":
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, keys.ec, digest[:])
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	case "HS256", "none":
+		sig = []byte("forged")
+	}
+	require.NoError(t, err)
+
+	return signed + "." + b64.EncodeToString(sig)
+}
+
+func validClaims(now time.Time) map[string]any {
+	return map[string]any{
+		"iss":    issuer,
+		"aud":    []string{"other", audience},
+		"sub":    "alice",
+		"tenant": "acme",
+		"scope":  "links:create links:read openid",
+		"exp":    now.Add(time.Hour).Unix(),
+	}
+}
+
+func newVerifier(t *testing.T, keys testKeys, now time.Time) *TokenVerifier {
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, keys.jwks(), 0o600))
+
+	v, err := NewTokenVerifier(config.JWTConfig{Issuer: issuer, Audience: audience, Leeway: time.Minute},
+		NewJWKS(path, "", 0, zaptest.NewLogger(t)))
+	require.NoError(t, err)
+	v.now = func() time.Time { return now }
+
+	return v
+}
+
+func TestTokenVerifier_Verify(t *testing.T) {
+	keys := newTestKeys(t)
+	now := time.Now()
+	v := newVerifier(t, keys, now)
+
+	for _, alg := range []struct{ alg, kid string }{{"RS256", "rsa"}, {"ES256", "ec"}} {
+		p, err := v.Verify(context.Background(), sign(t, keys, alg.alg, alg.kid, validClaims(now)))
+		require.NoError(t, err, alg.alg)
+		assert.Equal(t, "jwt:alice", p.Subject)
+		assert.Equal(t, "alice", p.Name)
+		assert.Equal(t, "acme", p.Tenant)
+		assert.Equal(t, []string{ScopeLinksCreate, ScopeLinksRead}, p.Scopes)
+	}
+}
+
+func TestTokenVerifier_Rejects(t *testing.T) {
+	keys := newTestKeys(t)
+	now := time.Now()
+	v := newVerifier(t, keys, now)
+
+	with := func(key string, value any) map[string]any {
+		claims := validClaims(now)
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "wrong issuer", token: sign(t, keys, "RS256", "rsa", with("iss", "https://evil.example.com"))},
+		{name: "wrong audience", token: sign(t, keys, "RS256", "rsa", with("aud", "other"))},
+		{name: "expired", token: sign(t, keys, "RS256", "rsa", with("exp", now.Add(-2*time.Minute).Unix()))},
+		{name: "no expiry", token: sign(t, keys, "RS256", "rsa", with("exp", nil))},
+		{name: "not yet valid", token: sign(t, keys, "RS256", "rsa", with("nbf", now.Add(time.Hour).Unix()))},
+		{name: "no subject", token: sign(t, keys, "RS256", "rsa", with("sub", nil))},
+		{name: "unknown key", token: sign(t, keys, "RS256", "other", validClaims(now))},
+		{name: "algorithm pinned by key", token: sign(t, keys, "PS256", "rsa", validClaims(now))},
+		{name: "algorithm of another key type", token: sign(t, keys, "RS256", "ec", validClaims(now))},
+		{name: "hmac", token: sign(t, keys, "HS256", "rsa", validClaims(now))},
+		{name: "none", token: sign(t, keys, "none", "rsa", validClaims(now))},
+		{name: "malformed", token: "not-a-token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := v.Verify(context.Background(), tt.token)
+			assert.ErrorIs(t, err, ErrInvalidCredentials)
+		})
+	}
+
+	tampered := sign(t, keys, "RS256", "rsa", validClaims(now))
+	forged, _ := json.Marshal(with("sub", "mallory"))
+	parts := strings.Split(tampered, ".")
+	_, err := v.Verify(context.Background(), parts[0]+"."+b64.EncodeToString(forged)+"."+parts[2])
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+}
+
+func TestTokenVerifier_DefaultScopes(t *testing.T) {
+	keys := newTestKeys(t)
+	now := time.Now()
+	v := newVerifier(t, keys, now)
+	v.defaultScopes = []string{ScopeLinksRead}
+
+	claims := validClaims(now)
+	delete(claims, "scope")
+
+	p, err := v.Verify(context.Background(), sign(t, keys, "ES256", "ec", claims))
+	require.NoError(t, err)
+	assert.Equal(t, []string{ScopeLinksRead}, p.Scopes)
+}
+
+func TestJWKS_CachesURL(t *testing.T) {
+	keys := newTestKeys(t)
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		fetches.Add(1)
+		_, _ = w.Write(keys.jwks())
+	}))
+	defer srv.Close()
+
+	now := time.Now()
+	jwks := NewJWKS("", srv.URL, time.Hour, zaptest.NewLogger(t))
+	jwks.now = func() time.Time { return now }
+
+	for range 3 {
+		_, _, err := jwks.Key(context.Background(), "rsa")
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int32(1), fetches.Load())
+
+	_, _, err := jwks.Key(context.Background(), "rotated")
+	assert.ErrorIs(t, err, ErrUnknownKey)
+	assert.Equal(t, int32(1), fetches.Load(), "unknown key ids do not force a reload right away")
+
+	now = now.Add(minJWKSRefresh)
+	_, _, _ = jwks.Key(context.Background(), "rotated")
+	assert.Equal(t, int32(2), fetches.Load())
+
+	srv.Close()
+	now = now.Add(2 * time.Hour)
+	_, _, err = jwks.Key(context.Background(), "ec")
+	assert.NoError(t, err, "stale keys are used when the reload fails")
+}
+
+func TestJWKS_ReloadOutlivesCancelledRequest(t *testing.T) {
+	keys := newTestKeys(t)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		<-release
+		_, _ = w.Write(keys.jwks())
+	}))
+	defer srv.Close()
+
+	jwks := NewJWKS("", srv.URL, time.Hour, zaptest.NewLogger(t))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, _, err := jwks.Key(ctx, "rsa")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// The reload started by the cancelled request carries on for the next.
+	close(release)
+	_, _, err = jwks.Key(context.Background(), "rsa")
+	assert.NoError(t, err)
+}
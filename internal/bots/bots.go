@@ -0,0 +1,175 @@
+// Package bots tells crawlers and link preview bots apart from people.
+package bots
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/model"
+)
+
+// Verdict is the class of a request and, for known bots, the bot name.
+type Verdict struct {
+	Class string
+	Name  string
+}
+
+var human = Verdict{Class: model.ClassHuman}
+
+// automatedTokens mark user agents of crawlers and HTTP libraries that no
+// signature matched.
+var automatedTokens = []string{
+	"bot", "crawl", "spider", "scrape", "slurp", "headless", "phantomjs", "selenium", "puppeteer",
+	"curl/", "wget/", "httpie/", "python-", "python/", "go-http-client", "okhttp", "java/", "libwww",
+	"axios/", "node-fetch", "undici", "http-client", "httpclient",
+}
+
+type signature struct {
+	pattern string
+	name    string
+}
+
+// Detector classifies requests by their user agent and headers.
+//
+// Signature files hold one case-insensitive user agent substring per line,
+// optionally followed by the bot name, which defaults to the substring. The
+// first matching line wins, so specific patterns go before general ones.
+// Requests that match no signature are suspicious when they have no user
+// agent, one of an HTTP library or a generic crawler, or claim to be a
+// browser but send no Accept-Language.
+//
+// A nil Detector classifies every request as human.
+type Detector struct {
+	files    []string
+	interval time.Duration
+	log      *zap.Logger
+
+	mu         sync.RWMutex
+	signatures []signature
+}
+
+func NewDetector(cfg config.BotsConfig, log *zap.Logger) (*Detector, error) {
+	d := &Detector{files: cfg.SignatureFiles, interval: cfg.ReloadInterval, log: log}
+
+	if err := d.Reload(); err != nil {
+		return nil, err
+	}
+
+	return d, nil
+}
+
+// Reload reads the signature files again and swaps them in atomically. On
+// error the previously loaded signatures stay in use.
+func (d *Detector) Reload() error {
+	var signatures []signature
+	for _, path := range d.files {
+		loaded, err := readSignatures(path)
+		if err != nil {
+			return err
+		}
+		signatures = append(signatures, loaded...)
+	}
+
+	d.mu.Lock()
+	d.signatures = signatures
+	d.mu.Unlock()
+
+	d.log.Info("bot signatures loaded", zap.Int("signatures", len(signatures)))
+
+	return nil
+}
+
+// Run reloads the signature files every configured interval until ctx is
+// done.
+func (d *Detector) Run(ctx context.Context) {
+	if d.interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := d.Reload(); err != nil {
+				d.log.Error("failed to reload bot signatures", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Classify labels a request with userAgent. header holds the other request
+// headers; it is nil for gRPC calls, which are not checked for browser
+// headers.
+func (d *Detector) Classify(userAgent string, header http.Header) Verdict {
+	if d == nil {
+		return human
+	}
+
+	ua := strings.ToLower(strings.TrimSpace(userAgent))
+	if ua == "" {
+		return Verdict{Class: model.ClassSuspicious}
+	}
+
+	d.mu.RLock()
+	for _, s := range d.signatures {
+		if strings.Contains(ua, s.pattern) {
+			d.mu.RUnlock()
+			return Verdict{Class: model.ClassBot, Name: s.name}
+		}
+	}
+	d.mu.RUnlock()
+
+	for _, token := range automatedTokens {
+		if strings.Contains(ua, token) {
+			return Verdict{Class: model.ClassSuspicious}
+		}
+	}
+
+	if header != nil && strings.HasPrefix(ua, "mozilla/") && header.Get("Accept-Language") == "" {
+		return Verdict{Class: model.ClassSuspicious}
+	}
+
+	return human
+}
+
+func readSignatures(path string) ([]signature, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bot signatures: %w", err)
+	}
+	defer f.Close()
+
+	var signatures []signature
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		s := signature{pattern: strings.ToLower(fields[0]), name: fields[0]}
+		if len(fields) > 1 {
+			s.name = strings.Join(fields[1:], " ")
+		}
+		signatures = append(signatures, s)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read bot signatures: %w", err)
+	}
+
+	return signatures, nil
+}
@@ -0,0 +1,100 @@
+package bots
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/model"
+)
+
+const chrome = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Safari/537.36"
+
+func writeSignatures(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "bots.txt")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	return path
+}
+
+func TestDetector_Classify(t *testing.T) {
+	t.Parallel()
+
+	path := writeSignatures(t, "# previews\nSlackbot-LinkExpanding Slack\nTwitterbot\nGooglebot Google Search\n")
+	detector, err := NewDetector(config.BotsConfig{SignatureFiles: []string{path}}, zaptest.NewLogger(t))
+	require.NoError(t, err)
+
+	browser := http.Header{"Accept-Language": {"en-US,en;q=0.9"}}
+	tests := []struct {
+		userAgent string
+		header    http.Header
+		want      Verdict
+	}{
+		{userAgent: chrome, header: browser, want: Verdict{Class: model.ClassHuman}},
+		{userAgent: "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", want: Verdict{Class: model.ClassBot, Name: "Slack"}},
+		{userAgent: "twitterbot/1.0", want: Verdict{Class: model.ClassBot, Name: "Twitterbot"}},
+		{
+			userAgent: "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", header: browser,
+			want: Verdict{Class: model.ClassBot, Name: "Google Search"},
+		},
+		{userAgent: "", header: browser, want: Verdict{Class: model.ClassSuspicious}},
+		{userAgent: "curl/8.4.0", want: Verdict{Class: model.ClassSuspicious}},
+		{userAgent: "python-requests/2.31", want: Verdict{Class: model.ClassSuspicious}},
+		{userAgent: "Mozilla/5.0 (compatible; UnknownCrawler/1.0)", header: browser, want: Verdict{Class: model.ClassSuspicious}},
+		{userAgent: chrome, header: http.Header{}, want: Verdict{Class: model.ClassSuspicious}},
+		// gRPC calls carry no browser headers to check.
+		{userAgent: chrome, want: Verdict{Class: model.ClassHuman}},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, detector.Classify(tt.userAgent, tt.header), tt.userAgent)
+	}
+}
+
+func TestDetector_Reload(t *testing.T) {
+	t.Parallel()
+
+	path := writeSignatures(t, "Twitterbot Twitter\n")
+	detector, err := NewDetector(config.BotsConfig{SignatureFiles: []string{path}}, zaptest.NewLogger(t))
+	require.NoError(t, err)
+
+	const preview = "NewPreviewer/1.0"
+	assert.Equal(t, model.ClassHuman, detector.Classify(preview, nil).Class)
+
+	require.NoError(t, os.WriteFile(path, []byte("Twitterbot Twitter\nNewPreviewer New\n"), 0o600))
+	require.NoError(t, detector.Reload())
+	assert.Equal(t, Verdict{Class: model.ClassBot, Name: "New"}, detector.Classify(preview, nil))
+
+	require.NoError(t, os.Remove(path))
+	assert.Error(t, detector.Reload())
+	assert.Equal(t, model.ClassBot, detector.Classify(preview, nil).Class, "a failed reload keeps the signatures")
+}
+
+func TestDetector_Nil(t *testing.T) {
+	t.Parallel()
+
+	var detector *Detector
+	assert.Equal(t, Verdict{Class: model.ClassHuman}, detector.Classify("curl/8.4.0", nil))
+}
+
+func TestDetector_ShippedSignatures(t *testing.T) {
+	t.Parallel()
+
+	detector, err := NewDetector(config.BotsConfig{SignatureFiles: []string{"../../config/bots.txt"}}, zaptest.NewLogger(t))
+	require.NoError(t, err)
+
+	assert.Equal(t, Verdict{Class: model.ClassBot, Name: "Facebook"},
+		detector.Classify("facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)", nil))
+	assert.Equal(t, Verdict{Class: model.ClassBot, Name: "Slack"},
+		detector.Classify("Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)", nil))
+	assert.Equal(t, Verdict{Class: model.ClassBot, Name: "Microsoft Teams"},
+		detector.Classify("Mozilla/5.0 (Windows NT 10.0; Win64; x64) MicrosoftPreview/2.0", nil))
+}
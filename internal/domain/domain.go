@@ -0,0 +1,127 @@
+package domain
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"url-shortener/internal/config"
+)
+
+// Default is the domain of links when no short domains are configured. In a
+// request it stands for the primary domain.
+const Default = ""
+
+var ErrUnknownDomain = errors.New("unknown short domain")
+
+type (
+	ctxKey    struct{}
+	originKey struct{}
+)
+
+// WithDomain returns a copy of ctx carrying the short domain a request is for.
+func WithDomain(ctx context.Context, host string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, host)
+}
+
+// FromContext returns the domain stored by WithDomain, or Default.
+func FromContext(ctx context.Context) string {
+	host, _ := ctx.Value(ctxKey{}).(string)
+	return host
+}
+
+// WithOrigin returns a copy of ctx carrying the public scheme and host a
+// request was sent to, e.g. "https://sho.rt".
+func WithOrigin(ctx context.Context, origin string) context.Context {
+	return context.WithValue(ctx, originKey{}, origin)
+}
+
+// OriginFromContext returns the origin stored by WithOrigin, or "".
+func OriginFromContext(ctx context.Context) string {
+	origin, _ := ctx.Value(originKey{}).(string)
+	return origin
+}
+
+// Registry holds the short domains of the deployment. The first configured
+// domain is the primary one.
+type Registry struct {
+	schemes map[string]string
+	primary string
+}
+
+func NewRegistry(cfgs []config.DomainConfig) *Registry {
+	r := &Registry{schemes: make(map[string]string, len(cfgs))}
+
+	for i, cfg := range cfgs {
+		host := strings.ToLower(cfg.Host)
+		if i == 0 {
+			r.primary = host
+		}
+
+		scheme := cfg.Scheme
+		if scheme == "" {
+			scheme = "https"
+		}
+		r.schemes[host] = scheme
+	}
+
+	return r
+}
+
+// Hosts returns the configured domains.
+func (r *Registry) Hosts() []string {
+	hosts := make([]string, 0, len(r.schemes))
+	for host := range r.schemes {
+		hosts = append(hosts, host)
+	}
+
+	return hosts
+}
+
+// Primary returns the primary domain, or Default if none are configured.
+func (r *Registry) Primary() string {
+	return r.primary
+}
+
+// ForHost returns the short domain a request to host, which may include a
+// port, is for: the host itself if it is configured, otherwise the primary
+// domain.
+func (r *Registry) ForHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	host = strings.ToLower(host)
+	if _, ok := r.schemes[host]; ok {
+		return host
+	}
+
+	return r.primary
+}
+
+// Canonical returns the configured spelling of host, or ErrUnknownDomain.
+// Default stands for the primary domain.
+func (r *Registry) Canonical(host string) (string, error) {
+	if host == Default {
+		return r.primary, nil
+	}
+
+	host = strings.ToLower(host)
+	if _, ok := r.schemes[host]; !ok {
+		return "", ErrUnknownDomain
+	}
+
+	return host, nil
+}
+
+// URL returns the fully qualified short URL of code on host, or code itself
+// on the Default domain.
+func (r *Registry) URL(host, code string) string {
+	scheme, ok := r.schemes[host]
+	if !ok {
+		return code
+	}
+
+	return scheme + "://" + host + "/" + code
+}
@@ -0,0 +1,45 @@
+package domain
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"url-shortener/internal/config"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry([]config.DomainConfig{{Host: "Go.Brand-A.com"}, {Host: "l.brand-b.io", Scheme: "http"}})
+
+	assert.Equal(t, "l.brand-b.io", r.ForHost("l.brand-b.io:8080"))
+	assert.Equal(t, "go.brand-a.com", r.ForHost("localhost"), "unknown hosts get the primary domain")
+
+	host, err := r.Canonical("L.BRAND-B.IO")
+	assert.NoError(t, err)
+	assert.Equal(t, "l.brand-b.io", host)
+
+	host, err = r.Canonical(Default)
+	assert.NoError(t, err)
+	assert.Equal(t, "go.brand-a.com", host)
+
+	_, err = r.Canonical("evil.example")
+	assert.ErrorIs(t, err, ErrUnknownDomain)
+
+	assert.Equal(t, "https://go.brand-a.com/abc", r.URL("go.brand-a.com", "abc"))
+	assert.Equal(t, "http://l.brand-b.io/abc", r.URL("l.brand-b.io", "abc"))
+}
+
+func TestRegistry_NoDomains(t *testing.T) {
+	r := NewRegistry(nil)
+
+	assert.Equal(t, Default, r.ForHost("localhost:8080"))
+
+	host, err := r.Canonical(Default)
+	assert.NoError(t, err)
+	assert.Equal(t, Default, host)
+
+	_, err = r.Canonical("go.brand-a.com")
+	assert.ErrorIs(t, err, ErrUnknownDomain)
+
+	assert.Equal(t, "abc", r.URL(Default, "abc"))
+}
@@ -0,0 +1,182 @@
+// Package events relays the link events of the outbox to a message bus or
+// file.
+//
+// Storage writes an event to the outbox in the same transaction as the change
+// it describes, so no change goes unannounced and no event announces a change
+// that was rolled back. The relay publishes the outbox through a Publisher and
+// only then removes the events: they are published at least once, and
+// consumers drop duplicates by event ID.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/model"
+)
+
+const (
+	defaultPollInterval = time.Second
+	defaultBatchSize    = 100
+	defaultTimeout      = 5 * time.Second
+
+	// drainTimeout bounds the last relay once the relay is stopped.
+	drainTimeout = 10 * time.Second
+)
+
+// Publisher sends events on. Publish returns nil only once all of the events
+// have been accepted; they are published again after an error.
+type Publisher interface {
+	Publish(ctx context.Context, events []model.OutboxEvent) error
+	Close() error
+}
+
+// Store is the outbox. storage.Storage implements it.
+type Store interface {
+	// RelayEvents passes up to limit of the oldest events to publish and
+	// removes them once it succeeds.
+	RelayEvents(limit int, publish func([]model.OutboxEvent) error) (int, error)
+}
+
+// Message is how an event is published: one JSON object per event.
+type Message struct {
+	// ID identifies the event; it is the same when the event is published
+	// again.
+	ID         int64     `json:"id"`
+	Type       string    `json:"type"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Link       Link      `json:"link"`
+	// Class is the traffic class of the visitor of a link.resolved event.
+	Class string `json:"class,omitempty"`
+}
+
+type Link struct {
+	Tenant    string     `json:"tenant,omitempty"`
+	Domain    string     `json:"domain,omitempty"`
+	Code      string     `json:"code"`
+	URL       string     `json:"url,omitempty"`
+	Owner     string     `json:"owner,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+}
+
+// Encode returns the message of the event as JSON.
+func Encode(event model.OutboxEvent) ([]byte, error) {
+	msg := Message{
+		ID:         event.ID,
+		Type:       event.Type,
+		OccurredAt: event.At.UTC(),
+		Link: Link{
+			Tenant: event.Link.Tenant,
+			Domain: event.Link.Domain,
+			Code:   event.Link.ShortURL,
+			URL:    event.Link.URL,
+			Owner:  event.Link.Owner,
+		},
+		Class: event.Class,
+	}
+	if !event.Link.CreatedAt.IsZero() {
+		createdAt := event.Link.CreatedAt.UTC()
+		msg.Link.CreatedAt = &createdAt
+	}
+
+	return json.Marshal(msg)
+}
+
+// NewPublisher returns the publisher chosen in cfg.
+func NewPublisher(cfg config.EventsConfig, log *zap.Logger) (Publisher, error) {
+	switch cfg.Publisher {
+	case "", "stdout":
+		return NewWriter(os.Stdout), nil
+	case "file":
+		return OpenFile(cfg.File)
+	case "nats":
+		return NewNATS(cfg.NATS, log)
+	case "kafka":
+		return NewKafka(cfg.Kafka)
+	default:
+		return nil, fmt.Errorf("unknown events publisher %q", cfg.Publisher)
+	}
+}
+
+// Relay publishes the events of the outbox.
+type Relay struct {
+	store     Store
+	publisher Publisher
+	interval  time.Duration
+	batch     int
+	log       *zap.Logger
+}
+
+func NewRelay(store Store, publisher Publisher, cfg config.EventsConfig, log *zap.Logger) *Relay {
+	return &Relay{
+		store:     store,
+		publisher: publisher,
+		interval:  orDefault(cfg.PollInterval, defaultPollInterval),
+		batch:     orDefault(cfg.BatchSize, defaultBatchSize),
+		log:       log.With(zap.String("op", "events")),
+	}
+}
+
+func orDefault[T int | time.Duration](v, def T) T {
+	if v <= 0 {
+		return def
+	}
+
+	return v
+}
+
+// Run relays the outbox every poll interval until ctx is done, then relays it
+// once more and closes the publisher. Events that fail to publish stay in the
+// outbox and are tried again on the next poll.
+func (r *Relay) Run(ctx context.Context) {
+	defer func() {
+		if err := r.publisher.Close(); err != nil {
+			r.log.Error("failed to close events publisher", zap.Error(err))
+		}
+	}()
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			drain, cancel := context.WithTimeout(context.WithoutCancel(ctx), drainTimeout)
+			defer cancel()
+			r.relay(drain)
+			return
+		case <-ticker.C:
+			r.relay(ctx)
+		}
+	}
+}
+
+// relay publishes the outbox a batch at a time until it is empty or
+// publishing fails.
+func (r *Relay) relay(ctx context.Context) {
+	for ctx.Err() == nil {
+		n, err := r.store.RelayEvents(r.batch, func(events []model.OutboxEvent) error {
+			return r.publisher.Publish(ctx, events)
+		})
+		if err != nil {
+			r.log.Error("failed to relay events, retrying", zap.Error(err))
+			return
+		}
+		if n > 0 {
+			r.log.Debug("events relayed", zap.Int("events", n))
+		}
+		if n < r.batch {
+			return
+		}
+	}
+}
+
+// errClosed is returned by publishers used after Close.
+var errClosed = errors.New("events publisher is closed")
@@ -0,0 +1,158 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/model"
+	"url-shortener/internal/storage/memory"
+)
+
+// recorder is a publisher keeping what it is given, failing while fail is
+// set.
+type recorder struct {
+	mu     sync.Mutex
+	fail   bool
+	events []model.OutboxEvent
+	closed bool
+}
+
+func (r *recorder) Publish(_ context.Context, events []model.OutboxEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.fail {
+		return errors.New("bus is down")
+	}
+	r.events = append(r.events, events...)
+
+	return nil
+}
+
+func (r *recorder) Close() error {
+	r.closed = true
+
+	return nil
+}
+
+func (r *recorder) types() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var types []string
+	for _, e := range r.events {
+		types = append(types, e.Type+" "+e.Link.ShortURL)
+	}
+
+	return types
+}
+
+func TestRelay(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	store := memory.NewStorageInMemory(logger)
+	store.Outbox = true
+
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	link := model.Link{ShortURL: "promo", URL: "https://acme.com/sale", Tenant: "acme", Owner: "alice", CreatedAt: at}
+	require.NoError(t, store.Put(link))
+	require.NoError(t, store.PutClicks([]model.Click{
+		{Tenant: "acme", ShortURL: "promo", At: at.Add(time.Minute)},
+		{Tenant: "acme", ShortURL: "promo", At: at.Add(2 * time.Minute), Class: model.ClassBot},
+	}))
+	require.NoError(t, store.Delete(link.Key()))
+	// A change that fails writes no event.
+	require.Error(t, store.Delete(link.Key()))
+
+	publisher := &recorder{fail: true}
+	relay := NewRelay(store, publisher, config.EventsConfig{BatchSize: 3}, logger)
+
+	relay.relay(context.Background())
+	assert.Empty(t, publisher.types())
+
+	publisher.fail = false
+	relay.relay(context.Background())
+	assert.Equal(t, []string{
+		model.EventLinkCreated + " promo",
+		model.EventLinkResolved + " promo",
+		model.EventLinkResolved + " promo",
+		model.EventLinkDeleted + " promo",
+	}, publisher.types())
+
+	events := publisher.events
+	assert.Equal(t, []int64{1, 2, 3, 4}, []int64{events[0].ID, events[1].ID, events[2].ID, events[3].ID})
+	assert.Equal(t, link, events[0].Link)
+	assert.Equal(t, at, events[0].At)
+	assert.Equal(t, model.ClassHuman, events[1].Class)
+	assert.Equal(t, model.ClassBot, events[2].Class)
+	assert.Equal(t, "https://acme.com/sale", events[3].Link.URL)
+
+	// Relayed events leave the outbox.
+	relay.relay(context.Background())
+	assert.Len(t, publisher.types(), 4)
+
+	// Run relays once more when stopped, then closes the publisher.
+	require.NoError(t, store.Put(model.Link{ShortURL: "docs", URL: "https://acme.com/docs"}))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	relay.Run(ctx)
+	assert.Len(t, publisher.types(), 5)
+	assert.True(t, publisher.closed)
+}
+
+func TestRelay_OutboxDisabled(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	store := memory.NewStorageInMemory(logger)
+	require.NoError(t, store.Put(model.Link{ShortURL: "promo", URL: "https://acme.com"}))
+
+	publisher := &recorder{}
+	NewRelay(store, publisher, config.EventsConfig{}, logger).relay(context.Background())
+	assert.Empty(t, publisher.types())
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.ndjson")
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, id := range []int64{1, 2} {
+		publisher, err := OpenFile(path)
+		require.NoError(t, err)
+		require.NoError(t, publisher.Publish(context.Background(), []model.OutboxEvent{{ID: id, LinkEvent: model.LinkEvent{
+			Type: model.EventLinkCreated,
+			Link: model.Link{ShortURL: "promo", URL: "https://acme.com", Tenant: "acme", CreatedAt: at},
+			At:   at,
+		}}}))
+		require.NoError(t, publisher.Close())
+		assert.Error(t, publisher.Publish(context.Background(), nil))
+	}
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer func() { _ = file.Close() }()
+
+	var messages []Message
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var msg Message
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &msg))
+		messages = append(messages, msg)
+	}
+	require.Len(t, messages, 2, "the file is appended to")
+	assert.Equal(t, Message{
+		ID:         2,
+		Type:       model.EventLinkCreated,
+		OccurredAt: at,
+		Link:       Link{Tenant: "acme", Code: "promo", URL: "https://acme.com", CreatedAt: &at},
+	}, messages[1])
+}
@@ -0,0 +1,83 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"url-shortener/internal/model"
+)
+
+// Writer publishes events as NDJSON, one message per line.
+type Writer struct {
+	mu sync.Mutex
+	w  io.Writer
+	// file is synced after every batch and closed with the writer, when the
+	// writer owns it.
+	file *os.File
+}
+
+// NewWriter returns a publisher writing to w, such as os.Stdout. Closing it
+// does not close w.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// OpenFile returns a publisher appending to the file at path, which is
+// created if needed.
+func OpenFile(path string) (*Writer, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open events file: %w", err)
+	}
+
+	return &Writer{w: file, file: file}, nil
+}
+
+// Publish writes the events and, for a file, syncs it, so a batch is only
+// reported published once it is on disk.
+func (p *Writer) Publish(_ context.Context, events []model.OutboxEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.w == nil {
+		return errClosed
+	}
+
+	buf := bufio.NewWriterSize(p.w, 64<<10)
+	for _, event := range events {
+		line, err := Encode(event)
+		if err != nil {
+			return fmt.Errorf("failed to encode event %d: %w", event.ID, err)
+		}
+		_, _ = buf.Write(line)
+		_ = buf.WriteByte('\n')
+	}
+
+	if err := buf.Flush(); err != nil {
+		return fmt.Errorf("failed to write events: %w", err)
+	}
+
+	if p.file != nil {
+		if err := p.file.Sync(); err != nil {
+			return fmt.Errorf("failed to sync events file: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (p *Writer) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.w = nil
+	if p.file == nil {
+		return nil
+	}
+
+	return p.file.Close()
+}
@@ -0,0 +1,129 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/model"
+)
+
+const (
+	kafkaContentType = "application/vnd.kafka.json.v2+json"
+	kafkaAccept      = "application/vnd.kafka.v2+json"
+
+	defaultKafkaTopic = "urlshortener-links"
+)
+
+// Kafka publishes events to a topic through the v2 API of a Kafka REST proxy,
+// such as the Confluent REST Proxy or the Redpanda HTTP proxy. Events are
+// keyed by their link, so the events of a link stay in one partition, in
+// order.
+type Kafka struct {
+	endpoint string
+	client   *http.Client
+}
+
+func NewKafka(cfg config.KafkaConfig) (*Kafka, error) {
+	if cfg.URL == "" {
+		return nil, errors.New("events.kafka.url is required")
+	}
+
+	topic := cfg.Topic
+	if topic == "" {
+		topic = defaultKafkaTopic
+	}
+
+	return &Kafka{
+		endpoint: strings.TrimSuffix(cfg.URL, "/") + "/topics/" + url.PathEscape(topic),
+		client:   &http.Client{Timeout: orDefault(cfg.Timeout, defaultTimeout)},
+	}, nil
+}
+
+type kafkaRecord struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+type kafkaResponse struct {
+	Offsets []struct {
+		Partition int     `json:"partition"`
+		Offset    int64   `json:"offset"`
+		ErrorCode *int    `json:"error_code"`
+		Error     *string `json:"error"`
+	} `json:"offsets"`
+	// ErrorCode and Message describe a request the proxy rejected.
+	ErrorCode int    `json:"error_code"`
+	Message   string `json:"message"`
+}
+
+// Publish produces the events in one request and fails if any of them was
+// not written.
+func (p *Kafka) Publish(ctx context.Context, events []model.OutboxEvent) error {
+	records := make([]kafkaRecord, 0, len(events))
+	for _, event := range events {
+		value, err := Encode(event)
+		if err != nil {
+			return fmt.Errorf("failed to encode event %d: %w", event.ID, err)
+		}
+		key := event.Link.Key()
+		records = append(records, kafkaRecord{Key: key.Tenant + "/" + key.Domain + "/" + key.ShortURL, Value: value})
+	}
+
+	body, err := json.Marshal(struct {
+		Records []kafkaRecord `json:"records"`
+	}{records})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", kafkaContentType)
+	req.Header.Set("Accept", kafkaAccept)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to produce events: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var produced kafkaResponse
+	err = json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&produced)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("kafka proxy answered %s: %s", resp.Status, produced.Message)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to decode produce response: %w", err)
+	}
+
+	if len(produced.Offsets) != len(events) {
+		return fmt.Errorf("kafka proxy acknowledged %d of %d events", len(produced.Offsets), len(events))
+	}
+	for i, offset := range produced.Offsets {
+		if offset.ErrorCode != nil || offset.Error != nil {
+			var msg string
+			if offset.Error != nil {
+				msg = *offset.Error
+			}
+			return fmt.Errorf("failed to produce event %d: %s", events[i].ID, msg)
+		}
+	}
+
+	return nil
+}
+
+func (p *Kafka) Close() error {
+	p.client.CloseIdleConnections()
+
+	return nil
+}
@@ -0,0 +1,72 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"url-shortener/internal/config"
+)
+
+func TestKafka(t *testing.T) {
+	var records []kafkaRecord
+	failRecord := -1
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/topics/links", r.URL.Path)
+		assert.Equal(t, kafkaContentType, r.Header.Get("Content-Type"))
+
+		var req struct {
+			Records []kafkaRecord `json:"records"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			_, _ = w.Write([]byte(`{"error_code":42201,"message":"bad records"}`))
+			return
+		}
+		records = append(records, req.Records...)
+
+		w.Header().Set("Content-Type", kafkaAccept)
+		resp := `{"offsets":[`
+		for i := range req.Records {
+			if i > 0 {
+				resp += ","
+			}
+			if i == failRecord {
+				resp += `{"partition":null,"offset":null,"error_code":50002,"error":"leader not available"}`
+			} else {
+				resp += `{"partition":0,"offset":1,"error_code":null,"error":null}`
+			}
+		}
+		_, _ = w.Write([]byte(resp + `]}`))
+	}))
+	defer proxy.Close()
+
+	publisher, err := NewKafka(config.KafkaConfig{URL: proxy.URL + "/", Topic: "links"})
+	require.NoError(t, err)
+	defer func() { _ = publisher.Close() }()
+
+	events := outboxEvents(1, 2)
+	events[1].Link.Tenant = "acme"
+	require.NoError(t, publisher.Publish(context.Background(), events))
+
+	require.Len(t, records, 2)
+	assert.Equal(t, "//promo1", records[0].Key)
+	assert.Equal(t, "acme//promo2", records[1].Key)
+	var msg Message
+	require.NoError(t, json.Unmarshal(records[1].Value, &msg))
+	assert.Equal(t, int64(2), msg.ID)
+
+	failRecord = 1
+	err = publisher.Publish(context.Background(), outboxEvents(3, 4))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "event 4: leader not available")
+	}
+
+	_, err = NewKafka(config.KafkaConfig{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,412 @@
+package events
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/model"
+)
+
+const (
+	defaultNATSURL     = "nats://127.0.0.1:4222"
+	defaultNATSPort    = "4222"
+	defaultNATSSubject = "urlshortener"
+
+	// natsMsgIDHeader lets JetStream drop events published again.
+	natsMsgIDHeader = "Nats-Msg-Id"
+)
+
+// NATS publishes every event to the subject "<subject>.<type>" of a NATS
+// server, speaking the client protocol directly. A batch is published once
+// the server has answered a PING sent after it, so it has received every
+// event; with JetStream, once a stream has stored every event. Events carry
+// their ID in the Nats-Msg-Id header, so JetStream drops those published
+// again. The connection is opened on the first batch and again after any
+// error.
+type NATS struct {
+	mu        sync.Mutex
+	addr      string
+	user      string
+	pass      string
+	token     string
+	subject   string
+	jetstream bool
+	timeout   time.Duration
+	log       *zap.Logger
+
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+	// headers reports whether the server accepts messages with headers.
+	headers    bool
+	maxPayload int
+	// inbox prefixes the reply subjects of JetStream acknowledgements.
+	inbox  string
+	closed bool
+}
+
+func NewNATS(cfg config.NATSConfig, log *zap.Logger) (*NATS, error) {
+	raw := cmp.Or(cfg.URL, defaultNATSURL)
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "nats" || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid NATS URL %q, want nats://host:port", raw)
+	}
+
+	p := &NATS{
+		addr:      net.JoinHostPort(u.Hostname(), cmp.Or(u.Port(), defaultNATSPort)),
+		subject:   cmp.Or(cfg.Subject, defaultNATSSubject),
+		jetstream: cfg.JetStream,
+		timeout:   orDefault(cfg.Timeout, defaultTimeout),
+		log:       log.With(zap.String("op", "events-nats")),
+	}
+	if u.User != nil {
+		if pass, ok := u.User.Password(); ok {
+			p.user, p.pass = u.User.Username(), pass
+		} else {
+			p.token = u.User.Username()
+		}
+	}
+
+	return p, nil
+}
+
+func (p *NATS) Publish(ctx context.Context, events []model.OutboxEvent) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return errClosed
+	}
+
+	if err := p.publish(ctx, events); err != nil {
+		// What the server got is unknown; start over on a new connection.
+		p.disconnect()
+		return err
+	}
+
+	return nil
+}
+
+func (p *NATS) publish(ctx context.Context, events []model.OutboxEvent) error {
+	if p.conn == nil {
+		if err := p.connect(ctx); err != nil {
+			return err
+		}
+	}
+	if err := p.conn.SetDeadline(p.deadline(ctx)); err != nil {
+		return err
+	}
+
+	for i, event := range events {
+		payload, err := Encode(event)
+		if err != nil {
+			return fmt.Errorf("failed to encode event %d: %w", event.ID, err)
+		}
+		if p.maxPayload > 0 && len(payload) > p.maxPayload {
+			return fmt.Errorf("event %d is larger than the NATS maximum payload of %d bytes", event.ID, p.maxPayload)
+		}
+
+		subject := p.subject + "." + event.Type
+		if p.jetstream {
+			// The index in the reply subject tells the acknowledgements apart.
+			subject += " " + p.inbox + "." + strconv.Itoa(i)
+		}
+
+		if p.headers {
+			header := "NATS/1.0\r\n" + natsMsgIDHeader + ": " + strconv.FormatInt(event.ID, 10) + "\r\n\r\n"
+			_, _ = fmt.Fprintf(p.w, "HPUB %s %d %d\r\n%s", subject, len(header), len(header)+len(payload), header)
+		} else {
+			_, _ = fmt.Fprintf(p.w, "PUB %s %d\r\n", subject, len(payload))
+		}
+		_, _ = p.w.Write(payload)
+		_, _ = p.w.WriteString("\r\n")
+	}
+
+	_, _ = p.w.WriteString("PING\r\n")
+	if err := p.w.Flush(); err != nil {
+		return fmt.Errorf("failed to send events to NATS: %w", err)
+	}
+
+	acks := 0
+	if !p.jetstream {
+		acks = len(events)
+	}
+	for pong := false; !pong || acks < len(events); {
+		op, err := p.read()
+		if err != nil {
+			return err
+		}
+
+		switch op.kind {
+		case "PONG":
+			pong = true
+		case "MSG", "HMSG":
+			if err := ackError(op, events); err != nil {
+				return err
+			}
+			acks++
+		}
+	}
+
+	return nil
+}
+
+// deadline is when the current batch must be done: the timeout from now, or
+// the deadline of ctx if that is sooner.
+func (p *NATS) deadline(ctx context.Context) time.Time {
+	deadline := time.Now().Add(p.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		return d
+	}
+
+	return deadline
+}
+
+type natsInfo struct {
+	Headers     bool `json:"headers"`
+	MaxPayload  int  `json:"max_payload"`
+	TLSRequired bool `json:"tls_required"`
+}
+
+type natsConnect struct {
+	Verbose      bool   `json:"verbose"`
+	Pedantic     bool   `json:"pedantic"`
+	Name         string `json:"name"`
+	Lang         string `json:"lang"`
+	Version      string `json:"version"`
+	Protocol     int    `json:"protocol"`
+	Headers      bool   `json:"headers"`
+	NoResponders bool   `json:"no_responders"`
+	User         string `json:"user,omitempty"`
+	Pass         string `json:"pass,omitempty"`
+	AuthToken    string `json:"auth_token,omitempty"`
+}
+
+// connect opens a connection, reads the INFO of the server, identifies
+// itself and, with JetStream, subscribes to its acknowledgements. It returns
+// once the server has answered a PING, so the credentials were accepted.
+func (p *NATS) connect(ctx context.Context) error {
+	dialer := net.Dialer{Timeout: p.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", p.addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	p.conn, p.r, p.w = conn, bufio.NewReader(conn), bufio.NewWriter(conn)
+	if err := conn.SetDeadline(p.deadline(ctx)); err != nil {
+		return err
+	}
+
+	line, err := p.readLine()
+	if err != nil {
+		return err
+	}
+	rawInfo, ok := strings.CutPrefix(line, "INFO ")
+	if !ok {
+		return fmt.Errorf("unexpected NATS greeting %q", line)
+	}
+
+	var info natsInfo
+	if err := json.Unmarshal([]byte(rawInfo), &info); err != nil {
+		return fmt.Errorf("failed to decode NATS server info: %w", err)
+	}
+	if info.TLSRequired {
+		return errors.New("the NATS server requires TLS, which is not supported")
+	}
+	p.headers, p.maxPayload = info.Headers, info.MaxPayload
+
+	connect, err := json.Marshal(natsConnect{
+		Name:     "url-shortener",
+		Lang:     "go",
+		Version:  "1.0.0",
+		Protocol: 1,
+		Headers:  info.Headers,
+		// A publish without a stream to store it is then answered with a
+		// 503 status instead of timing out.
+		NoResponders: info.Headers,
+		User:         p.user,
+		Pass:         p.pass,
+		AuthToken:    p.token,
+	})
+	if err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintf(p.w, "CONNECT %s\r\n", connect)
+
+	if p.jetstream {
+		var id [8]byte
+		if _, err := rand.Read(id[:]); err != nil {
+			return err
+		}
+		p.inbox = "_INBOX." + hex.EncodeToString(id[:])
+		_, _ = fmt.Fprintf(p.w, "SUB %s.* 1\r\n", p.inbox)
+	}
+
+	_, _ = p.w.WriteString("PING\r\n")
+	if err := p.w.Flush(); err != nil {
+		return fmt.Errorf("failed to send NATS handshake: %w", err)
+	}
+
+	for {
+		op, err := p.read()
+		if err != nil {
+			return err
+		}
+		if op.kind == "PONG" {
+			p.log.Info("connected to NATS", zap.String("addr", p.addr), zap.Bool("jetstream", p.jetstream))
+			return nil
+		}
+	}
+}
+
+// natsOp is a protocol message from the server.
+type natsOp struct {
+	kind string
+	args []string
+	// header and payload are those of MSG and HMSG.
+	header  string
+	payload []byte
+}
+
+// read returns the next message from the server that needs handling. It
+// answers PINGs and skips +OK and INFO, and turns -ERR into an error.
+func (p *NATS) read() (natsOp, error) {
+	for {
+		line, err := p.readLine()
+		if err != nil {
+			return natsOp{}, err
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		op := natsOp{kind: strings.ToUpper(fields[0]), args: fields[1:]}
+
+		switch op.kind {
+		case "PING":
+			_, _ = p.w.WriteString("PONG\r\n")
+			if err := p.w.Flush(); err != nil {
+				return natsOp{}, err
+			}
+		case "+OK", "INFO":
+		case "-ERR":
+			return natsOp{}, fmt.Errorf("NATS error: %s", strings.TrimSpace(strings.TrimPrefix(line, fields[0])))
+		case "MSG", "HMSG":
+			if err := p.readPayload(&op); err != nil {
+				return natsOp{}, err
+			}
+			return op, nil
+		default:
+			return op, nil
+		}
+	}
+}
+
+// readPayload reads the header and payload announced by a MSG ("MSG
+// <subject> <sid> [reply] <size>") or HMSG ("HMSG <subject> <sid> [reply]
+// <header size> <total size>").
+func (p *NATS) readPayload(op *natsOp) error {
+	sizes := 1
+	if op.kind == "HMSG" {
+		sizes = 2
+	}
+	if len(op.args) < 2+sizes {
+		return fmt.Errorf("malformed NATS %s", op.kind)
+	}
+
+	total, err := strconv.Atoi(op.args[len(op.args)-1])
+	if err != nil || total < 0 {
+		return fmt.Errorf("malformed NATS %s size", op.kind)
+	}
+	headerSize := 0
+	if sizes == 2 {
+		if headerSize, err = strconv.Atoi(op.args[len(op.args)-2]); err != nil || headerSize < 0 || headerSize > total {
+			return fmt.Errorf("malformed NATS %s header size", op.kind)
+		}
+	}
+
+	buf := make([]byte, total+2)
+	if _, err := io.ReadFull(p.r, buf); err != nil {
+		return fmt.Errorf("failed to read NATS message: %w", err)
+	}
+	op.header, op.payload = string(buf[:headerSize]), buf[headerSize:total]
+
+	return nil
+}
+
+func (p *NATS) readLine() (string, error) {
+	line, err := p.r.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("failed to read from NATS: %w", err)
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// ackError returns the error of a JetStream acknowledgement of one of the
+// events, if it is not a success.
+func ackError(op natsOp, events []model.OutboxEvent) error {
+	// The acknowledgement is sent to the reply subject, which ends with the
+	// index of the event.
+	event := "an event"
+	subject := op.args[0]
+	if i, err := strconv.Atoi(subject[strings.LastIndexByte(subject, '.')+1:]); err == nil && i >= 0 && i < len(events) {
+		event = "event " + strconv.FormatInt(events[i].ID, 10)
+	}
+
+	// A status in the header line, such as "NATS/1.0 503", means no stream
+	// stored the event.
+	line, _, _ := strings.Cut(op.header, "\r\n")
+	if status := strings.TrimSpace(strings.TrimPrefix(line, "NATS/1.0")); status != "" {
+		return fmt.Errorf("JetStream did not store %s: %s", event, status)
+	}
+
+	var ack struct {
+		Error *struct {
+			Code        int    `json:"code"`
+			Description string `json:"description"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(op.payload, &ack); err != nil {
+		return fmt.Errorf("failed to decode JetStream acknowledgement of %s: %w", event, err)
+	}
+	if ack.Error != nil {
+		return fmt.Errorf("JetStream did not store %s: %d %s", event, ack.Error.Code, ack.Error.Description)
+	}
+
+	return nil
+}
+
+func (p *NATS) disconnect() {
+	if p.conn != nil {
+		_ = p.conn.Close()
+	}
+	p.conn, p.r, p.w = nil, nil, nil
+}
+
+func (p *NATS) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	p.disconnect()
+
+	return nil
+}
@@ -0,0 +1,251 @@
+package events
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/model"
+)
+
+type natsMsg struct {
+	subject string
+	header  string
+	payload string
+}
+
+// standIn is a local stand-in for a NATS server. It records CONNECTs and
+// published messages and, like JetStream, acknowledges those with a reply
+// subject; rejectSubject makes it answer those to a subject as no stream
+// would.
+type standIn struct {
+	ln net.Listener
+
+	mu            sync.Mutex
+	rejectSubject string
+	connects      []natsConnect
+	msgs          []natsMsg
+	// dropAfter closes the next connection after that many messages.
+	dropAfter int
+}
+
+func newStandIn(t *testing.T) *standIn {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+
+	s := &standIn{ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	return s
+}
+
+func (s *standIn) url(userinfo string) string {
+	return "nats://" + userinfo + s.ln.Addr().String()
+}
+
+func (s *standIn) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+
+	r := bufio.NewReader(conn)
+	_, _ = fmt.Fprint(conn, `INFO {"server_id":"stand-in","headers":true,"max_payload":1048576}`+"\r\n")
+
+	s.mu.Lock()
+	dropAfter := s.dropAfter
+	s.dropAfter = 0
+	s.mu.Unlock()
+
+	var sid string
+	var seq, received int
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "CONNECT":
+			var c natsConnect
+			_ = json.Unmarshal([]byte(strings.TrimPrefix(strings.TrimSpace(line), "CONNECT ")), &c)
+			s.mu.Lock()
+			s.connects = append(s.connects, c)
+			s.mu.Unlock()
+		case "SUB":
+			sid = fields[len(fields)-1]
+		case "PING":
+			_, _ = fmt.Fprint(conn, "PONG\r\n")
+		case "HPUB", "PUB":
+			total, _ := strconv.Atoi(fields[len(fields)-1])
+			headerSize := 0
+			if fields[0] == "HPUB" {
+				headerSize, _ = strconv.Atoi(fields[len(fields)-2])
+			}
+			buf := make([]byte, total+2)
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return
+			}
+
+			received++
+			if dropAfter > 0 && received > dropAfter {
+				return
+			}
+
+			msg := natsMsg{subject: fields[1], header: string(buf[:headerSize]), payload: string(buf[headerSize:total])}
+			s.mu.Lock()
+			s.msgs = append(s.msgs, msg)
+			reject := msg.subject == s.rejectSubject
+			s.mu.Unlock()
+
+			// A reply subject is the argument before the sizes.
+			if len(fields) == 3+strings.Count(fields[0], "H") {
+				continue
+			}
+			reply := fields[2]
+			if reject {
+				status := "NATS/1.0 503\r\n\r\n"
+				_, _ = fmt.Fprintf(conn, "HMSG %s %s %d %d\r\n%s\r\n", reply, sid, len(status), len(status), status)
+				continue
+			}
+			seq++
+			ack := fmt.Sprintf(`{"stream":"LINKS","seq":%d}`, seq)
+			_, _ = fmt.Fprintf(conn, "MSG %s %s %d\r\n%s\r\n", reply, sid, len(ack), ack)
+		}
+	}
+}
+
+func (s *standIn) received() []natsMsg {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]natsMsg(nil), s.msgs...)
+}
+
+func outboxEvents(ids ...int64) []model.OutboxEvent {
+	events := make([]model.OutboxEvent, 0, len(ids))
+	for _, id := range ids {
+		events = append(events, model.OutboxEvent{ID: id, LinkEvent: model.LinkEvent{
+			Type: model.EventLinkCreated,
+			Link: model.Link{ShortURL: "promo" + strconv.FormatInt(id, 10), URL: "https://acme.com"},
+			At:   time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+		}})
+	}
+
+	return events
+}
+
+func TestNATS(t *testing.T) {
+	server := newStandIn(t)
+
+	publisher, err := NewNATS(config.NATSConfig{URL: server.url("alice:secret@"), Subject: "links"},
+		zaptest.NewLogger(t))
+	require.NoError(t, err)
+	defer func() { _ = publisher.Close() }()
+
+	require.NoError(t, publisher.Publish(context.Background(), outboxEvents(1, 2)))
+
+	msgs := server.received()
+	require.Len(t, msgs, 2)
+	assert.Equal(t, "links.link.created", msgs[0].subject)
+	assert.Contains(t, msgs[1].header, "Nats-Msg-Id: 2\r\n")
+
+	var msg Message
+	require.NoError(t, json.Unmarshal([]byte(msgs[1].payload), &msg))
+	assert.Equal(t, int64(2), msg.ID)
+	assert.Equal(t, "promo2", msg.Link.Code)
+
+	server.mu.Lock()
+	require.Len(t, server.connects, 1)
+	assert.Equal(t, "alice", server.connects[0].User)
+	assert.Equal(t, "secret", server.connects[0].Pass)
+	assert.True(t, server.connects[0].Headers)
+	server.mu.Unlock()
+}
+
+func TestNATS_Reconnects(t *testing.T) {
+	server := newStandIn(t)
+	server.mu.Lock()
+	server.dropAfter = 1
+	server.mu.Unlock()
+
+	publisher, err := NewNATS(config.NATSConfig{URL: server.url("token@"), Timeout: time.Second}, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	defer func() { _ = publisher.Close() }()
+
+	// The connection breaks after the first event; the batch is not
+	// confirmed, so it is published again in full.
+	assert.Error(t, publisher.Publish(context.Background(), outboxEvents(1, 2)))
+	require.NoError(t, publisher.Publish(context.Background(), outboxEvents(1, 2)))
+
+	msgs := server.received()
+	require.Len(t, msgs, 3)
+	assert.Equal(t, "urlshortener.link.created", msgs[0].subject)
+	assert.Contains(t, msgs[0].header, "Nats-Msg-Id: 1\r\n")
+	assert.Contains(t, msgs[1].header, "Nats-Msg-Id: 1\r\n", "duplicates share the message ID")
+
+	server.mu.Lock()
+	require.Len(t, server.connects, 2)
+	assert.Equal(t, "token", server.connects[1].AuthToken)
+	server.mu.Unlock()
+
+	require.NoError(t, publisher.Close())
+	assert.Error(t, publisher.Publish(context.Background(), outboxEvents(3)))
+}
+
+func TestNATS_JetStream(t *testing.T) {
+	server := newStandIn(t)
+
+	publisher, err := NewNATS(config.NATSConfig{URL: server.url(""), JetStream: true}, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	defer func() { _ = publisher.Close() }()
+
+	require.NoError(t, publisher.Publish(context.Background(), outboxEvents(1, 2, 3)))
+	assert.Len(t, server.received(), 3)
+
+	server.mu.Lock()
+	server.rejectSubject = "urlshortener.link.deleted"
+	server.mu.Unlock()
+	events := outboxEvents(4, 5)
+	events[1].Type = model.EventLinkDeleted
+	err = publisher.Publish(context.Background(), events)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "event 5: 503")
+	}
+}
+
+func TestNewNATS(t *testing.T) {
+	for _, url := range []string{"http://nats:4222", "nats://", "::"} {
+		_, err := NewNATS(config.NATSConfig{URL: url}, zaptest.NewLogger(t))
+		assert.Error(t, err, url)
+	}
+
+	p, err := NewNATS(config.NATSConfig{URL: "nats://nats"}, zaptest.NewLogger(t))
+	require.NoError(t, err)
+	assert.Equal(t, "nats:4222", p.addr)
+}
@@ -0,0 +1,309 @@
+// Package export writes stored clicks and click rollups as CSV or Parquet
+// files for data warehouses. Exports are read from storage page by page and
+// written as they are read, so their size is not bounded by memory.
+package export
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"go.uber.org/zap"
+
+	"url-shortener/internal/model"
+)
+
+// Sources of exported data.
+const (
+	SourceClicks = "clicks"
+	SourceHourly = "hourly"
+	SourceDaily  = "daily"
+)
+
+// Formats of exports.
+const (
+	FormatCSV     = "csv"
+	FormatParquet = "parquet"
+)
+
+// DefaultRange is how far back an export goes when no start is given.
+const DefaultRange = 24 * time.Hour
+
+// pageSize is how many rows are read from storage at once.
+const pageSize = 1000
+
+var (
+	ErrInvalidRequest = errors.New("export source must be clicks, hourly or daily, format csv or parquet, " +
+		"the range non-empty and the limit not negative")
+	ErrInvalidCursor = errors.New("invalid export cursor")
+)
+
+type Store interface {
+	// ExportClicks returns up to limit clicks of q ordered by time and ID,
+	// starting after the time and ID of after.
+	ExportClicks(q model.ExportQuery, after model.Click, limit int) ([]model.Click, error)
+	// ExportRollups returns up to limit rollups of the granularity and q
+	// ordered by bucket and key, starting after the bucket and key of after.
+	ExportRollups(granularity string, q model.ExportQuery, after model.ClickRollup, limit int) ([]model.ClickRollup, error)
+}
+
+// Request describes an export.
+type Request struct {
+	// Source is the data exported: raw clicks or hourly or daily rollups.
+	Source string
+	Format string
+	// Gzip compresses a CSV file as a whole and the pages of a Parquet file
+	// with its GZIP codec, so that it stays a valid Parquet file.
+	Gzip  bool
+	Query model.ExportQuery
+	// Cursor resumes an export after the row it was taken from; empty
+	// starts at Query.From.
+	Cursor string
+	// Limit caps the rows exported; 0 exports all.
+	Limit int
+}
+
+// Normalize fills the zero fields of r with defaults, clicks as CSV for the
+// last DefaultRange before now, and validates it.
+func (r Request) Normalize(now time.Time) (Request, error) {
+	if r.Source == "" {
+		r.Source = SourceClicks
+	}
+	if r.Format == "" {
+		r.Format = FormatCSV
+	}
+	if r.Query.To.IsZero() {
+		r.Query.To = now
+	}
+	if r.Query.From.IsZero() {
+		r.Query.From = r.Query.To.Add(-DefaultRange)
+	}
+
+	switch {
+	case r.Source != SourceClicks && r.Source != SourceHourly && r.Source != SourceDaily,
+		r.Format != FormatCSV && r.Format != FormatParquet,
+		!r.Query.From.Before(r.Query.To), r.Limit < 0:
+		return Request{}, ErrInvalidRequest
+	}
+
+	if _, err := decodeCursor(r.Source, r.Cursor); err != nil {
+		return Request{}, err
+	}
+
+	return r, nil
+}
+
+// FileName names the file of the export, such as
+// "clicks-20260301T000000Z-20260302T000000Z.csv.gz".
+func (r Request) FileName() string {
+	const layout = "20060102T150405Z"
+
+	ext := "." + r.Format
+	if r.Gzip && r.Format == FormatCSV {
+		ext += ".gz"
+	}
+
+	return fmt.Sprintf("%s-%s-%s%s", r.Source, r.Query.From.UTC().Format(layout), r.Query.To.UTC().Format(layout), ext)
+}
+
+// ContentType is the media type of the export file.
+func (r Request) ContentType() string {
+	switch {
+	case r.Format == FormatParquet:
+		return "application/vnd.apache.parquet"
+	case r.Gzip:
+		return "application/gzip"
+	default:
+		return "text/csv; charset=utf-8"
+	}
+}
+
+// Result tells how far an export got.
+type Result struct {
+	Rows int64
+	// Cursor resumes the export after the last row written. It is the
+	// cursor of the request if no row was written.
+	Cursor string
+}
+
+type Exporter struct {
+	store Store
+	log   *zap.Logger
+}
+
+func New(store Store, log *zap.Logger) *Exporter {
+	return &Exporter{store: store, log: log}
+}
+
+// Export writes the rows of req to w until they or its limit run out, ctx is
+// done or writing fails. Every row carries the cursor that resumes the export
+// after it, so an export that breaks off can be continued from the last row
+// received.
+func (e *Exporter) Export(ctx context.Context, w io.Writer, req Request) (Result, error) {
+	req, err := req.Normalize(time.Now().UTC())
+	if err != nil {
+		return Result{}, err
+	}
+	after, _ := decodeCursor(req.Source, req.Cursor)
+
+	result := Result{Cursor: req.Cursor}
+
+	out := w
+	var zw *gzip.Writer
+	if req.Gzip && req.Format == FormatCSV {
+		zw = gzip.NewWriter(w)
+		out = zw
+	}
+
+	columns := clickColumns
+	if req.Source != SourceClicks {
+		columns = rollupColumns
+	}
+
+	var table tableWriter
+	if req.Format == FormatParquet {
+		table, err = newParquetWriter(out, columns, req.Gzip)
+	} else {
+		table, err = newCSVWriter(out, columns)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	for req.Limit == 0 || result.Rows < int64(req.Limit) {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		limit := pageSize
+		if req.Limit > 0 {
+			limit = min(limit, req.Limit-int(result.Rows))
+		}
+
+		rows, cursors, err := e.page(req, after, limit)
+		if err != nil {
+			return result, err
+		}
+
+		for i, row := range rows {
+			token, err := encodeCursor(cursors[i])
+			if err != nil {
+				return result, err
+			}
+			if err := table.WriteRow(append(row, token)); err != nil {
+				return result, fmt.Errorf("error writing export: %w", err)
+			}
+			result.Rows++
+			result.Cursor = token
+		}
+
+		if len(rows) < limit {
+			break
+		}
+		after = cursors[len(cursors)-1]
+	}
+
+	if err := table.Close(); err != nil {
+		return result, fmt.Errorf("error writing export: %w", err)
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return result, fmt.Errorf("error writing export: %w", err)
+		}
+	}
+
+	e.log.Info("export written", zap.String("source", req.Source), zap.String("format", req.Format),
+		zap.Int64("rows", result.Rows))
+
+	return result, nil
+}
+
+// page reads up to limit rows after the cursor and returns them with the
+// cursor of each.
+func (e *Exporter) page(req Request, after cursor, limit int) ([][]any, []cursor, error) {
+	if req.Source == SourceClicks {
+		clicks, err := e.store.ExportClicks(req.Query, model.Click{At: after.At, ID: after.ID}, limit)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		rows, cursors := make([][]any, 0, len(clicks)), make([]cursor, 0, len(clicks))
+		for _, c := range clicks {
+			rows = append(rows, []any{c.ID, c.Tenant, c.Domain, c.ShortURL, c.At, c.Referrer, c.UserAgent, c.IPHash,
+				c.Class, c.Bot, c.Country, c.City, c.Device, c.OS, c.Browser})
+			cursors = append(cursors, cursor{Source: req.Source, At: c.At, ID: c.ID})
+		}
+
+		return rows, cursors, nil
+	}
+
+	granularity := model.RollupHourly
+	if req.Source == SourceDaily {
+		granularity = model.RollupDaily
+	}
+
+	rollups, err := e.store.ExportRollups(granularity, req.Query, model.ClickRollup{
+		Tenant: after.Tenant, Domain: after.Domain, ShortURL: after.ShortURL, Bucket: after.At,
+		Dimension: after.Dimension, Class: after.Class, Value: after.Value,
+	}, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, cursors := make([][]any, 0, len(rollups)), make([]cursor, 0, len(rollups))
+	for _, r := range rollups {
+		rows = append(rows, []any{r.Tenant, r.Domain, r.ShortURL, r.Granularity, r.Bucket, r.Class, r.Dimension,
+			r.Value, r.Clicks})
+		cursors = append(cursors, cursor{Source: req.Source, At: r.Bucket, Tenant: r.Tenant, Domain: r.Domain,
+			ShortURL: r.ShortURL, Dimension: r.Dimension, Class: r.Class, Value: r.Value})
+	}
+
+	return rows, cursors, nil
+}
+
+// cursor is the position of a row: the time and ID of a click or the bucket
+// and key of a rollup.
+type cursor struct {
+	Source    string    `json:"src"`
+	At        time.Time `json:"at"`
+	ID        int64     `json:"id,omitempty"`
+	Tenant    string    `json:"tn,omitempty"`
+	Domain    string    `json:"dm,omitempty"`
+	ShortURL  string    `json:"su,omitempty"`
+	Dimension string    `json:"dim,omitempty"`
+	Class     string    `json:"cl,omitempty"`
+	Value     string    `json:"v,omitempty"`
+}
+
+func encodeCursor(c cursor) (string, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor decodes a cursor of source; empty is the start.
+func decodeCursor(source, token string) (cursor, error) {
+	if token == "" {
+		return cursor{}, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Source != source {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	return c, nil
+}
@@ -0,0 +1,200 @@
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"url-shortener/internal/model"
+	"url-shortener/internal/storage/memory"
+)
+
+var (
+	promo = model.LinkKey{Tenant: "acme", Domain: "go.acme.com", ShortURL: "promo"}
+	docs  = model.LinkKey{ShortURL: "docs"}
+	start = time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// newStore stores n clicks on promo and docs, alternating, one a minute.
+func newStore(t *testing.T, n int) *memory.StorageInMemory {
+	t.Helper()
+
+	store := memory.NewStorageInMemory(zaptest.NewLogger(t))
+	clicks := make([]model.Click, 0, n)
+	for i := range n {
+		key := promo
+		if i%2 == 1 {
+			key = docs
+		}
+		clicks = append(clicks, model.Click{Tenant: key.Tenant, Domain: key.Domain, ShortURL: key.ShortURL,
+			At: start.Add(time.Duration(i) * time.Minute), Referrer: "https://news.example", Class: model.ClassHuman,
+			Country: "DE", Browser: "Firefox"})
+	}
+	require.NoError(t, store.PutClicks(clicks))
+
+	return store
+}
+
+func readCSV(t *testing.T, r io.Reader) [][]string {
+	t.Helper()
+
+	records, err := csv.NewReader(r).ReadAll()
+	require.NoError(t, err)
+
+	return records
+}
+
+func TestExport_CSV(t *testing.T) {
+	t.Parallel()
+
+	e := New(newStore(t, 4), zaptest.NewLogger(t))
+
+	var buf bytes.Buffer
+	result, err := e.Export(context.Background(), &buf, Request{
+		Query: model.ExportQuery{From: start, To: start.Add(time.Hour), Links: []model.LinkKey{promo}},
+	})
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, result.Rows)
+
+	records := readCSV(t, &buf)
+	require.Len(t, records, 3)
+	assert.Equal(t, []string{"id", "tenant", "domain", "short_url", "at", "referrer", "user_agent", "ip_hash", "class",
+		"bot", "country", "city", "device", "os", "browser", "cursor"}, records[0])
+	assert.Equal(t, []string{"1", "acme", "go.acme.com", "promo", "2026-03-01T00:00:00Z", "https://news.example", "", "",
+		"human", "", "DE", "", "", "", "Firefox"}, records[1][:15])
+	assert.Equal(t, "2026-03-01T00:02:00Z", records[2][4])
+	assert.Equal(t, result.Cursor, records[2][15])
+}
+
+func TestExport_ResumesFromCursor(t *testing.T) {
+	t.Parallel()
+
+	e := New(newStore(t, 2500), zaptest.NewLogger(t))
+	query := model.ExportQuery{From: start, To: start.Add(48 * time.Hour)}
+
+	var ids []string
+	cursor := ""
+	for range 10 {
+		var buf bytes.Buffer
+		result, err := e.Export(context.Background(), &buf, Request{Query: query, Cursor: cursor, Limit: 1000})
+		require.NoError(t, err)
+
+		records := readCSV(t, &buf)
+		for _, r := range records[1:] {
+			ids = append(ids, r[0])
+		}
+		if result.Rows == 0 {
+			break
+		}
+		assert.Equal(t, records[len(records)-1][15], result.Cursor)
+		cursor = result.Cursor
+	}
+
+	require.Len(t, ids, 2500)
+	assert.Equal(t, "1", ids[0])
+	assert.Equal(t, "1001", ids[1000])
+	assert.Equal(t, "2500", ids[2499])
+}
+
+func TestExport_Gzip(t *testing.T) {
+	t.Parallel()
+
+	e := New(newStore(t, 3), zaptest.NewLogger(t))
+
+	var buf bytes.Buffer
+	_, err := e.Export(context.Background(), &buf, Request{
+		Gzip:  true,
+		Query: model.ExportQuery{From: start, To: start.Add(time.Hour)},
+	})
+	require.NoError(t, err)
+
+	zr, err := gzip.NewReader(&buf)
+	require.NoError(t, err)
+	assert.Len(t, readCSV(t, zr), 4)
+}
+
+type rollupStore struct {
+	memory.StorageInMemory
+	rollups []model.ClickRollup
+}
+
+func (s *rollupStore) ExportRollups(granularity string, _ model.ExportQuery, after model.ClickRollup,
+	limit int) ([]model.ClickRollup, error) {
+	var page []model.ClickRollup
+	for _, r := range s.rollups {
+		if r.Granularity == granularity && r.Bucket.After(after.Bucket) && len(page) < limit {
+			page = append(page, r)
+		}
+	}
+
+	return page, nil
+}
+
+func TestExport_Rollups(t *testing.T) {
+	t.Parallel()
+
+	store := &rollupStore{rollups: []model.ClickRollup{
+		{Tenant: "acme", Domain: "go.acme.com", ShortURL: "promo", Granularity: model.RollupDaily, Bucket: start,
+			Class: model.ClassHuman, Dimension: "country", Value: "DE", Clicks: 42},
+		{ShortURL: "docs", Granularity: model.RollupHourly, Bucket: start, Class: model.ClassBot,
+			Dimension: "class", Value: model.ClassBot, Clicks: 7},
+	}}
+	e := New(store, zaptest.NewLogger(t))
+
+	var buf bytes.Buffer
+	result, err := e.Export(context.Background(), &buf, Request{
+		Source: SourceDaily,
+		Query:  model.ExportQuery{From: start, To: start.Add(24 * time.Hour)},
+	})
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, result.Rows)
+
+	records := readCSV(t, &buf)
+	require.Len(t, records, 2)
+	assert.Equal(t, []string{"tenant", "domain", "short_url", "granularity", "bucket", "class", "dimension", "value",
+		"clicks", "cursor"}, records[0])
+	assert.Equal(t, []string{"acme", "go.acme.com", "promo", "day", "2026-03-01T00:00:00Z", "human", "country", "DE",
+		"42"}, records[1][:9])
+
+	_, err = e.Export(context.Background(), io.Discard, Request{Source: SourceHourly, Cursor: result.Cursor})
+	assert.ErrorIs(t, err, ErrInvalidCursor, "a cursor only resumes its own source")
+}
+
+func TestRequest_Normalize(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+
+	req, err := Request{}.Normalize(now)
+	require.NoError(t, err)
+	assert.Equal(t, SourceClicks, req.Source)
+	assert.Equal(t, FormatCSV, req.Format)
+	assert.Equal(t, now.Add(-DefaultRange), req.Query.From)
+	assert.Equal(t, "clicks-20260301T120000Z-20260302T120000Z.csv", req.FileName())
+	assert.Equal(t, "text/csv; charset=utf-8", req.ContentType())
+
+	req.Gzip = true
+	assert.Equal(t, "clicks-20260301T120000Z-20260302T120000Z.csv.gz", req.FileName())
+	req.Format = FormatParquet
+	assert.Equal(t, "clicks-20260301T120000Z-20260302T120000Z.parquet", req.FileName())
+
+	invalid := []Request{
+		{Source: "links"},
+		{Format: "xlsx"},
+		{Query: model.ExportQuery{From: now, To: now}},
+		{Limit: -1},
+		{Cursor: "not a cursor"},
+	}
+	for _, req := range invalid {
+		_, err := req.Normalize(now)
+		assert.Error(t, err, "%+v", req)
+	}
+}
@@ -0,0 +1,335 @@
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// rowGroupRows is how many rows a Parquet row group holds. A row group is
+// buffered in memory until it is complete.
+const rowGroupRows = 10000
+
+var parquetMagic = []byte("PAR1")
+
+// Values of the Parquet format enums.
+const (
+	typeInt64     = 2
+	typeByteArray = 6
+
+	repetitionRequired = 0
+
+	convertedUTF8            = 0
+	convertedTimestampMicros = 10
+
+	encodingPlain = 0
+	encodingRLE   = 3
+
+	codecUncompressed = 0
+	codecGzip         = 2
+
+	pageTypeData = 0
+)
+
+// parquetWriter writes a Parquet file of required, PLAIN-encoded columns
+// with one data page per column chunk. Strings are UTF8 byte arrays and times
+// are INT64 timestamps in microseconds.
+type parquetWriter struct {
+	w       io.Writer
+	offset  int64
+	columns []column
+	gzip    bool
+
+	// values are the encoded values of the current row group by column.
+	values []bytes.Buffer
+	rows   int
+
+	groups  []rowGroup
+	numRows int64
+}
+
+type rowGroup struct {
+	chunks []columnChunk
+	rows   int64
+	size   int64
+}
+
+type columnChunk struct {
+	offset       int64
+	uncompressed int64
+	compressed   int64
+}
+
+func newParquetWriter(w io.Writer, columns []column, gzip bool) (*parquetWriter, error) {
+	pw := &parquetWriter{w: w, columns: columns, gzip: gzip, values: make([]bytes.Buffer, len(columns))}
+	if err := pw.write(parquetMagic); err != nil {
+		return nil, err
+	}
+
+	return pw, nil
+}
+
+func (pw *parquetWriter) write(b []byte) error {
+	n, err := pw.w.Write(b)
+	pw.offset += int64(n)
+
+	return err
+}
+
+func (pw *parquetWriter) WriteRow(row []any) error {
+	var scratch [8]byte
+	for i, v := range row {
+		buf := &pw.values[i]
+		switch v := v.(type) {
+		case string:
+			binary.LittleEndian.PutUint32(scratch[:4], uint32(len(v)))
+			buf.Write(scratch[:4])
+			buf.WriteString(v)
+		case int64:
+			binary.LittleEndian.PutUint64(scratch[:], uint64(v))
+			buf.Write(scratch[:])
+		case time.Time:
+			binary.LittleEndian.PutUint64(scratch[:], uint64(v.UnixMicro()))
+			buf.Write(scratch[:])
+		default:
+			return fmt.Errorf("unsupported value %T", v)
+		}
+	}
+
+	pw.rows++
+	if pw.rows == rowGroupRows {
+		return pw.flush()
+	}
+
+	return nil
+}
+
+// flush writes the buffered rows as a row group.
+func (pw *parquetWriter) flush() error {
+	if pw.rows == 0 {
+		return nil
+	}
+
+	group := rowGroup{rows: int64(pw.rows)}
+	for i := range pw.columns {
+		page := pw.values[i].Bytes()
+		data := page
+		if pw.gzip {
+			var compressed bytes.Buffer
+			zw := gzip.NewWriter(&compressed)
+			if _, err := zw.Write(page); err != nil {
+				return err
+			}
+			if err := zw.Close(); err != nil {
+				return err
+			}
+			data = compressed.Bytes()
+		}
+
+		var header compact
+		header.structBody(func() {
+			header.i32(1, pageTypeData)
+			header.i32(2, int32(len(page)))
+			header.i32(3, int32(len(data)))
+			header.strct(5, func() {
+				header.i32(1, int32(pw.rows))
+				header.i32(2, encodingPlain)
+				header.i32(3, encodingRLE)
+				header.i32(4, encodingRLE)
+			})
+		})
+
+		chunk := columnChunk{
+			offset:       pw.offset,
+			uncompressed: int64(len(header.b) + len(page)),
+			compressed:   int64(len(header.b) + len(data)),
+		}
+		if err := pw.write(header.b); err != nil {
+			return err
+		}
+		if err := pw.write(data); err != nil {
+			return err
+		}
+
+		pw.values[i].Reset()
+		group.chunks = append(group.chunks, chunk)
+		group.size += chunk.uncompressed
+	}
+
+	pw.groups = append(pw.groups, group)
+	pw.numRows += group.rows
+	pw.rows = 0
+
+	return nil
+}
+
+// Close writes the last row group and the footer.
+func (pw *parquetWriter) Close() error {
+	if err := pw.flush(); err != nil {
+		return err
+	}
+
+	codec := int32(codecUncompressed)
+	if pw.gzip {
+		codec = codecGzip
+	}
+
+	encodings := []int32{encodingPlain, encodingRLE}
+
+	var meta compact
+	meta.structBody(func() {
+		meta.i32(1, 1)
+		meta.list(2, ctStruct, len(pw.columns)+1, func(i int) {
+			meta.structBody(func() {
+				if i == 0 {
+					meta.binary(4, "schema")
+					meta.i32(5, int32(len(pw.columns)))
+					return
+				}
+
+				c := pw.columns[i-1]
+				meta.i32(1, parquetType(c))
+				meta.i32(3, repetitionRequired)
+				meta.binary(4, c.name)
+				switch c.kind {
+				case kindString:
+					meta.i32(6, convertedUTF8)
+				case kindTime:
+					meta.i32(6, convertedTimestampMicros)
+				}
+			})
+		})
+		meta.i64(3, pw.numRows)
+		meta.list(4, ctStruct, len(pw.groups), func(g int) {
+			group := pw.groups[g]
+			meta.structBody(func() {
+				meta.list(1, ctStruct, len(group.chunks), func(i int) {
+					chunk := group.chunks[i]
+					meta.structBody(func() {
+						meta.i64(2, chunk.offset)
+						meta.strct(3, func() {
+							meta.i32(1, parquetType(pw.columns[i]))
+							meta.list(2, ctI32, len(encodings), func(e int) {
+								meta.element(encodings[e])
+							})
+							meta.list(3, ctBinary, 1, func(int) {
+								meta.str(pw.columns[i].name)
+							})
+							meta.i32(4, codec)
+							meta.i64(5, group.rows)
+							meta.i64(6, chunk.uncompressed)
+							meta.i64(7, chunk.compressed)
+							meta.i64(9, chunk.offset)
+						})
+					})
+				})
+				meta.i64(2, group.size)
+				meta.i64(3, group.rows)
+			})
+		})
+		meta.binary(6, "url-shortener")
+	})
+
+	if err := pw.write(meta.b); err != nil {
+		return err
+	}
+	if err := pw.write(binary.LittleEndian.AppendUint32(nil, uint32(len(meta.b)))); err != nil {
+		return err
+	}
+
+	return pw.write(parquetMagic)
+}
+
+func parquetType(c column) int32 {
+	if c.kind == kindString {
+		return typeByteArray
+	}
+
+	return typeInt64
+}
+
+// Thrift compact protocol types.
+const (
+	ctI32    = 5
+	ctI64    = 6
+	ctBinary = 8
+	ctList   = 9
+	ctStruct = 12
+)
+
+// compact encodes Thrift structs with the compact protocol, which Parquet
+// metadata uses. Fields must be written in increasing order of their IDs.
+type compact struct {
+	b []byte
+	// last is the ID of the last field written in the current struct.
+	last int16
+}
+
+func (c *compact) field(id int16, typ byte) {
+	if delta := id - c.last; delta > 0 && delta <= 15 {
+		c.b = append(c.b, byte(delta)<<4|typ)
+	} else {
+		c.b = append(c.b, typ)
+		c.b = binary.AppendVarint(c.b, int64(id))
+	}
+	c.last = id
+}
+
+// structBody writes the fields of body and the stop byte ending a struct.
+func (c *compact) structBody(body func()) {
+	last := c.last
+	c.last = 0
+	body()
+	c.b = append(c.b, 0)
+	c.last = last
+}
+
+func (c *compact) i32(id int16, v int32) {
+	c.field(id, ctI32)
+	c.element(v)
+}
+
+func (c *compact) i64(id int16, v int64) {
+	c.field(id, ctI64)
+	c.b = binary.AppendVarint(c.b, v)
+}
+
+func (c *compact) binary(id int16, s string) {
+	c.field(id, ctBinary)
+	c.str(s)
+}
+
+func (c *compact) strct(id int16, body func()) {
+	c.field(id, ctStruct)
+	c.structBody(body)
+}
+
+// list writes the header of a list of n elements of type elem; each writes
+// the elements with element, str or structBody.
+func (c *compact) list(id int16, elem byte, n int, each func(i int)) {
+	c.field(id, ctList)
+	if n < 15 {
+		c.b = append(c.b, byte(n)<<4|elem)
+	} else {
+		c.b = append(c.b, 0xf0|elem)
+		c.b = binary.AppendUvarint(c.b, uint64(n))
+	}
+
+	for i := range n {
+		each(i)
+	}
+}
+
+// element writes an i32 value without a field header. Varints of
+// encoding/binary are zigzag-encoded, as the protocol wants.
+func (c *compact) element(v int32) {
+	c.b = binary.AppendVarint(c.b, int64(v))
+}
+
+func (c *compact) str(s string) {
+	c.b = binary.AppendUvarint(c.b, uint64(len(s)))
+	c.b = append(c.b, s...)
+}
@@ -0,0 +1,141 @@
+package export
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// thriftReader decodes compact protocol structs into maps of field IDs to
+// int64, string, []any or nested structs.
+type thriftReader struct {
+	t *testing.T
+	r *bytes.Reader
+}
+
+func (tr thriftReader) uvarint() uint64 {
+	v, err := binary.ReadUvarint(tr.r)
+	require.NoError(tr.t, err)
+	return v
+}
+
+func (tr thriftReader) value(typ byte) any {
+	switch typ {
+	case ctI32, ctI64:
+		v, err := binary.ReadVarint(tr.r)
+		require.NoError(tr.t, err)
+		return v
+	case ctBinary:
+		b := make([]byte, tr.uvarint())
+		_, err := io.ReadFull(tr.r, b)
+		require.NoError(tr.t, err)
+		return string(b)
+	case ctList:
+		header, err := tr.r.ReadByte()
+		require.NoError(tr.t, err)
+		n := int(header >> 4)
+		if n == 15 {
+			n = int(tr.uvarint())
+		}
+		list := make([]any, n)
+		for i := range list {
+			list[i] = tr.value(header & 0x0f)
+		}
+		return list
+	case ctStruct:
+		return tr.strct()
+	}
+
+	tr.t.Fatalf("unexpected thrift type %d", typ)
+	return nil
+}
+
+func (tr thriftReader) strct() map[int16]any {
+	fields := map[int16]any{}
+	var id int16
+	for {
+		header, err := tr.r.ReadByte()
+		require.NoError(tr.t, err)
+		if header == 0 {
+			return fields
+		}
+		if delta := int16(header >> 4); delta != 0 {
+			id += delta
+		} else {
+			v, err := binary.ReadVarint(tr.r)
+			require.NoError(tr.t, err)
+			id = int16(v)
+		}
+		fields[id] = tr.value(header & 0x0f)
+	}
+}
+
+// readParquet decodes a file written by parquetWriter into its row count and
+// the raw PLAIN values of each column.
+func readParquet(t *testing.T, file []byte) (int64, map[string][]byte) {
+	t.Helper()
+
+	require.Equal(t, parquetMagic, file[:4])
+	require.Equal(t, parquetMagic, file[len(file)-4:])
+	size := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	meta := thriftReader{t: t, r: bytes.NewReader(file[len(file)-8-size : len(file)-8])}.strct()
+
+	values := map[string][]byte{}
+	for _, g := range meta[4].([]any) {
+		for _, c := range g.(map[int16]any)[1].([]any) {
+			chunk := c.(map[int16]any)[3].(map[int16]any)
+			name := chunk[3].([]any)[0].(string)
+
+			r := bytes.NewReader(file[chunk[9].(int64):])
+			header := thriftReader{t: t, r: r}.strct()
+			page := make([]byte, header[3].(int64))
+			_, err := io.ReadFull(r, page)
+			require.NoError(t, err)
+
+			if chunk[4].(int64) == codecGzip {
+				zr, err := gzip.NewReader(bytes.NewReader(page))
+				require.NoError(t, err)
+				page, err = io.ReadAll(zr)
+				require.NoError(t, err)
+			}
+			require.Len(t, page, int(header[2].(int64)))
+			values[name] = append(values[name], page...)
+		}
+	}
+
+	return meta[3].(int64), values
+}
+
+func TestParquetWriter(t *testing.T) {
+	t.Parallel()
+
+	columns := []column{{name: "n", kind: kindInt}, {name: "s", kind: kindString}, {name: "at", kind: kindTime}}
+	at := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	rows := rowGroupRows + 5
+
+	for _, compressed := range []bool{false, true} {
+		var buf bytes.Buffer
+		pw, err := newParquetWriter(&buf, columns, compressed)
+		require.NoError(t, err)
+		for i := range rows {
+			require.NoError(t, pw.WriteRow([]any{int64(i), "ab", at}))
+		}
+		require.NoError(t, pw.Close())
+		assert.Len(t, pw.groups, 2)
+
+		numRows, values := readParquet(t, buf.Bytes())
+		assert.EqualValues(t, rows, numRows)
+
+		require.Len(t, values["n"], rows*8)
+		assert.EqualValues(t, rowGroupRows+4, binary.LittleEndian.Uint64(values["n"][(rows-1)*8:]))
+		require.Len(t, values["s"], rows*6)
+		assert.Equal(t, []byte{2, 0, 0, 0, 'a', 'b'}, values["s"][:6])
+		assert.EqualValues(t, at.UnixMicro(), binary.LittleEndian.Uint64(values["at"][:8]))
+	}
+}
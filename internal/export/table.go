@@ -0,0 +1,104 @@
+package export
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Kinds of column values: string, int64 and time.Time.
+const (
+	kindString = iota
+	kindInt
+	kindTime
+)
+
+type column struct {
+	name string
+	kind int
+}
+
+var (
+	clickColumns = []column{
+		{name: "id", kind: kindInt},
+		{name: "tenant", kind: kindString},
+		{name: "domain", kind: kindString},
+		{name: "short_url", kind: kindString},
+		{name: "at", kind: kindTime},
+		{name: "referrer", kind: kindString},
+		{name: "user_agent", kind: kindString},
+		{name: "ip_hash", kind: kindString},
+		{name: "class", kind: kindString},
+		{name: "bot", kind: kindString},
+		{name: "country", kind: kindString},
+		{name: "city", kind: kindString},
+		{name: "device", kind: kindString},
+		{name: "os", kind: kindString},
+		{name: "browser", kind: kindString},
+		{name: "cursor", kind: kindString},
+	}
+
+	rollupColumns = []column{
+		{name: "tenant", kind: kindString},
+		{name: "domain", kind: kindString},
+		{name: "short_url", kind: kindString},
+		{name: "granularity", kind: kindString},
+		{name: "bucket", kind: kindTime},
+		{name: "class", kind: kindString},
+		{name: "dimension", kind: kindString},
+		{name: "value", kind: kindString},
+		{name: "clicks", kind: kindInt},
+		{name: "cursor", kind: kindString},
+	}
+)
+
+// tableWriter writes rows with one value per column, of the column's kind.
+type tableWriter interface {
+	WriteRow(row []any) error
+	// Close finishes the file. It does not close the underlying writer.
+	Close() error
+}
+
+// csvWriter writes a header and then one record per row. Times are RFC 3339
+// in UTC.
+type csvWriter struct {
+	w      *csv.Writer
+	record []string
+}
+
+func newCSVWriter(w io.Writer, columns []column) (*csvWriter, error) {
+	cw := &csvWriter{w: csv.NewWriter(w), record: make([]string, len(columns))}
+
+	for i, c := range columns {
+		cw.record[i] = c.name
+	}
+	if err := cw.w.Write(cw.record); err != nil {
+		return nil, err
+	}
+
+	return cw, nil
+}
+
+func (cw *csvWriter) WriteRow(row []any) error {
+	for i, v := range row {
+		switch v := v.(type) {
+		case string:
+			cw.record[i] = v
+		case int64:
+			cw.record[i] = strconv.FormatInt(v, 10)
+		case time.Time:
+			cw.record[i] = v.UTC().Format(time.RFC3339Nano)
+		default:
+			return fmt.Errorf("unsupported value %T", v)
+		}
+	}
+
+	return cw.w.Write(cw.record)
+}
+
+func (cw *csvWriter) Close() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
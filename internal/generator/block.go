@@ -0,0 +1,106 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// DefaultBlockSize is the number of IDs leased at once when none is configured.
+const DefaultBlockSize = 1000
+
+// BlockSequence is the name of the shared ID sequence used for short codes.
+const BlockSequence = "short_url"
+
+// BlockSource leases disjoint ranges of IDs from a store shared by every
+// instance of the service.
+type BlockSource interface {
+	// NextBlock reserves size IDs of the named sequence and returns the first
+	// one. The range [start, start+size) belongs to the caller only.
+	NextBlock(name string, size uint64) (start uint64, err error)
+	// ReleaseBlock gives back the unused tail [start, end) of a block. The
+	// source reclaims it only if nothing was leased after it; otherwise the
+	// IDs are abandoned.
+	ReleaseBlock(name string, start, end uint64) error
+}
+
+var ErrNoBlockSource = errors.New("sequence, obfuscated and block strategies require a block source")
+
+// Block hands out IDs from a locally held block and only talks to the
+// BlockSource when the block runs out, so instances do not contend for every
+// code. IDs left in a block when the process dies are simply never used.
+type Block struct {
+	enc     *Encoding
+	source  BlockSource
+	name    string
+	size    uint64
+	permute func(uint64) uint64
+
+	mu   sync.Mutex
+	next uint64
+	end  uint64
+}
+
+// NewBlock creates a block generator. If obfuscate is set, IDs are passed
+// through the same reversible permutation as the obfuscated strategy.
+func NewBlock(enc *Encoding, source BlockSource, size, key uint64, obfuscate bool) *Block {
+	if size == 0 {
+		size = DefaultBlockSize
+	}
+
+	g := &Block{enc: enc, source: source, name: BlockSequence, size: size}
+	if obfuscate {
+		g.permute = NewObfuscated(enc, nil, 0, key).permute
+	}
+
+	return g
+}
+
+func (g *Block) Generate(_ string, _ int) (string, error) {
+	id, err := g.nextID()
+	if err != nil {
+		return "", err
+	}
+
+	id %= g.enc.space
+	if g.permute != nil {
+		id = g.permute(id)
+	}
+
+	return g.enc.encode(id), nil
+}
+
+func (g *Block) nextID() (uint64, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.next == g.end {
+		start, err := g.source.NextBlock(g.name, g.size)
+		if err != nil {
+			return 0, fmt.Errorf("failed to lease id block: %w", err)
+		}
+		g.next, g.end = start, start+g.size
+	}
+
+	id := g.next
+	g.next++
+
+	return id, nil
+}
+
+// Close returns the unused part of the current block to the source.
+func (g *Block) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.next == g.end {
+		return nil
+	}
+
+	if err := g.source.ReleaseBlock(g.name, g.next, g.end); err != nil {
+		return fmt.Errorf("failed to release id block: %w", err)
+	}
+	g.next = g.end
+
+	return nil
+}
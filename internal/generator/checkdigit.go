@@ -0,0 +1,187 @@
+package generator
+
+import "strings"
+
+// lookAlikeGroups lists characters that are commonly typed in place of each
+// other. Suggestions try these substitutions before any others.
+var lookAlikeGroups = []string{"0Oo", "1lI", "5S", "2Z", "8B", "6G", "9g", "uv", "_-"}
+
+// CheckDigit appends and verifies a check character computed over the
+// alphabet. Both algorithms catch every single-character typo.
+//
+// For alphabets of odd size (the default one has 63 characters) it uses the
+// Damm algorithm over the quasigroup x*y = 2x+y mod N, which is totally
+// anti-symmetric because 2 and 2-1 are both invertible mod N, so every swap
+// of adjacent characters is caught as well. No such linear quasigroup exists
+// for even N, so even-sized alphabets fall back to Luhn mod N, which misses a
+// few adjacent swaps.
+type CheckDigit struct {
+	alphabet string
+	length   int
+	index    [256]int
+}
+
+// NewCheckDigit creates a check digit for codes of length characters, the
+// last of which is the check character.
+func NewCheckDigit(alphabet string, length int) *CheckDigit {
+	c := &CheckDigit{alphabet: alphabet, length: length}
+	for i := range c.index {
+		c.index[i] = -1
+	}
+	for i := range len(alphabet) {
+		c.index[alphabet[i]] = i
+	}
+
+	return c
+}
+
+// Applies reports whether code is expected to carry a check character, which
+// is the case for every code of the generated length.
+func (c *CheckDigit) Applies(code string) bool {
+	return len(code) == c.length
+}
+
+// Append returns payload followed by its check character.
+func (c *CheckDigit) Append(payload string) string {
+	n := len(c.alphabet)
+
+	var check int
+	if n%2 == 1 {
+		check = (n - 2*c.damm(payload)%n) % n
+	} else {
+		check = (n - c.luhn(payload, 2)%n) % n
+	}
+
+	return payload + string(c.alphabet[check])
+}
+
+// Valid reports whether the last character of code is the check character of
+// the rest.
+func (c *CheckDigit) Valid(code string) bool {
+	if len(code) < 2 {
+		return false
+	}
+
+	for i := range len(code) {
+		if c.index[code[i]] < 0 {
+			return false
+		}
+	}
+
+	n := len(c.alphabet)
+	if n%2 == 1 {
+		return c.damm(code) == 0
+	}
+
+	return c.luhn(code, 1)%n == 0
+}
+
+func (c *CheckDigit) damm(s string) int {
+	n := len(c.alphabet)
+
+	interim := 0
+	for i := range len(s) {
+		interim = (2*interim + c.index[s[i]]) % n
+	}
+
+	return interim
+}
+
+func (c *CheckDigit) luhn(s string, factor int) int {
+	n := len(c.alphabet)
+
+	sum := 0
+	for i := len(s) - 1; i >= 0; i-- {
+		addend := factor * c.index[s[i]]
+		if factor == 2 {
+			factor = 1
+		} else {
+			factor = 2
+		}
+		sum += addend/n + addend%n
+	}
+
+	return sum
+}
+
+// Candidates returns codes with a valid check character that differ from code
+// by one typo, most likely first: swapped neighbours, then look-alike
+// substitutions, then any other single substitution.
+func (c *CheckDigit) Candidates(code string) []string {
+	if !c.Applies(code) {
+		return nil
+	}
+
+	seen := map[string]struct{}{code: {}}
+	var candidates []string
+	add := func(candidate string) {
+		if _, ok := seen[candidate]; ok {
+			return
+		}
+		seen[candidate] = struct{}{}
+		if c.Valid(candidate) {
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	b := []byte(code)
+	for i := 0; i+1 < len(b); i++ {
+		b[i], b[i+1] = b[i+1], b[i]
+		add(string(b))
+		b[i], b[i+1] = b[i+1], b[i]
+	}
+
+	for i := range len(b) {
+		orig := b[i]
+		for _, group := range lookAlikeGroups {
+			if strings.IndexByte(group, orig) < 0 {
+				continue
+			}
+			for j := range len(group) {
+				b[i] = group[j]
+				add(string(b))
+			}
+		}
+		b[i] = orig
+	}
+
+	for i := range len(b) {
+		orig := b[i]
+		for j := range len(c.alphabet) {
+			b[i] = c.alphabet[j]
+			add(string(b))
+		}
+		b[i] = orig
+	}
+
+	return candidates
+}
+
+// WithCheckDigit wraps gen, whose codes must be one character shorter than the
+// configured length, and appends a check character to every code.
+func WithCheckDigit(gen CodeGenerator, check *CheckDigit) CodeGenerator {
+	return &checkDigitGenerator{gen: gen, check: check}
+}
+
+type checkDigitGenerator struct {
+	gen   CodeGenerator
+	check *CheckDigit
+}
+
+func (g *checkDigitGenerator) Generate(url string, attempt int) (string, error) {
+	payload, err := g.gen.Generate(url, attempt)
+	if err != nil {
+		return "", err
+	}
+
+	return g.check.Append(payload), nil
+}
+
+// Close releases the wrapped generator's resources, if it holds any.
+func (g *checkDigitGenerator) Close() error {
+	if closer, ok := g.gen.(interface{ Close() error }); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package generator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/storage/memory"
+	"url-shortener/pkg/util/random"
+)
+
+func TestCheckDigit_DetectsSingleSubstitutions(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		alphabet string
+	}{
+		{name: "damm", alphabet: random.DefaultAlphabet},
+		{name: "luhn", alphabet: random.ExcludeLookAlikes(random.DefaultAlphabet)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			check := NewCheckDigit(tt.alphabet, DefaultLength)
+			code := check.Append("abcXYZ_23")
+			require.True(t, check.Valid(code))
+
+			b := []byte(code)
+			for i := range len(b) {
+				orig := b[i]
+				for j := range len(tt.alphabet) {
+					if tt.alphabet[j] == orig {
+						continue
+					}
+					b[i] = tt.alphabet[j]
+					assert.False(t, check.Valid(string(b)), "substitution %q not detected", string(b))
+				}
+				b[i] = orig
+			}
+		})
+	}
+}
+
+func TestCheckDigit_DammDetectsAdjacentSwaps(t *testing.T) {
+	t.Parallel()
+
+	alphabet := random.DefaultAlphabet
+	check := NewCheckDigit(alphabet, 3)
+
+	for i := range len(alphabet) {
+		for j := range len(alphabet) {
+			if i == j {
+				continue
+			}
+			code := check.Append(string([]byte{alphabet[i], alphabet[j]}))
+			swapped := string([]byte{code[1], code[0], code[2]})
+			assert.False(t, check.Valid(swapped), "swap %q -> %q not detected", code, swapped)
+		}
+	}
+}
+
+func TestCheckDigit_RejectsForeignCharacters(t *testing.T) {
+	t.Parallel()
+
+	check := NewCheckDigit(random.DefaultAlphabet, DefaultLength)
+
+	assert.False(t, check.Valid("abc-efghij"))
+	assert.False(t, check.Valid("a"))
+}
+
+func TestCheckDigit_Candidates(t *testing.T) {
+	t.Parallel()
+
+	check := NewCheckDigit(random.DefaultAlphabet, DefaultLength)
+	code := check.Append("Ab0lXyZ_q")
+
+	typo := []byte(code)
+	typo[2] = 'O'
+	candidates := check.Candidates(string(typo))
+	require.NotEmpty(t, candidates)
+	assert.Contains(t, candidates, code)
+
+	for _, candidate := range candidates {
+		assert.True(t, check.Valid(candidate))
+	}
+}
+
+func TestNew_WithChecksum(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.GeneratorConfig{Strategy: StrategySequence, Checksum: true}
+	gen, err := New(cfg, memory.NewStorageInMemory(zaptest.NewLogger(t)))
+	require.NoError(t, err)
+
+	enc, err := EncodingFromConfig(cfg)
+	require.NoError(t, err)
+	check := CheckDigitFromConfig(cfg, enc)
+	require.NotNil(t, check)
+
+	for range 1000 {
+		code, err := gen.Generate("", 0)
+		require.NoError(t, err)
+		assertValidCode(t, code)
+		assert.True(t, check.Valid(code))
+	}
+
+	assert.Nil(t, CheckDigitFromConfig(config.GeneratorConfig{}, enc))
+}
@@ -0,0 +1,114 @@
+package generator
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// CodeFilter decides whether a code may be handed out. Generated codes that
+// are rejected are regenerated; rejected custom aliases are refused.
+type CodeFilter interface {
+	Allowed(code string) bool
+}
+
+// leet maps digits and symbols to the letters they are commonly used for.
+var leet = map[rune]rune{
+	'0': 'o',
+	'1': 'i',
+	'!': 'i',
+	'|': 'i',
+	'l': 'i',
+	'2': 'z',
+	'3': 'e',
+	'4': 'a',
+	'@': 'a',
+	'5': 's',
+	'$': 's',
+	'6': 'g',
+	'9': 'g',
+	'7': 't',
+	'+': 't',
+	'8': 'b',
+}
+
+// confusables are letter sequences that read like a single other letter.
+var confusables = strings.NewReplacer("rn", "m", "vv", "w", "cl", "d")
+
+// skeleton reduces s to a form where leetspeak and look-alike spellings of the
+// same word are equal: it lowercases, replaces look-alike letter sequences,
+// maps digits and symbols to letters and drops everything that is not a
+// letter, such as the "_" in "b_a_d". Look-alikes go first, as leet rewrites
+// letters they consist of, such as the "l" of "cl".
+func skeleton(s string) string {
+	s = confusables.Replace(strings.ToLower(s))
+
+	var b strings.Builder
+	b.Grow(len(s))
+
+	for _, r := range s {
+		if mapped, ok := leet[r]; ok {
+			r = mapped
+		}
+		if r >= 'a' && r <= 'z' {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// DenyList rejects codes that contain any of its words, including leetspeak
+// and look-alike variants of them.
+type DenyList struct {
+	words []string
+}
+
+func NewDenyList(words []string) *DenyList {
+	d := &DenyList{}
+	for _, w := range words {
+		if sk := skeleton(w); sk != "" {
+			d.words = append(d.words, sk)
+		}
+	}
+
+	return d
+}
+
+// LoadDenyList reads one word per line from path. Empty lines and lines
+// starting with "#" are ignored.
+func LoadDenyList(path string) (*DenyList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open deny list: %w", err)
+	}
+	defer f.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read deny list: %w", err)
+	}
+
+	return NewDenyList(words), nil
+}
+
+func (d *DenyList) Allowed(code string) bool {
+	sk := skeleton(code)
+	for _, w := range d.words {
+		if strings.Contains(sk, w) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,59 @@
+package generator
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDenyList_Allowed(t *testing.T) {
+	t.Parallel()
+
+	filter := NewDenyList([]string{"bad", "Hell", "moron"})
+
+	tests := []struct {
+		code    string
+		allowed bool
+	}{
+		{code: "xyzBADxyz1", allowed: false},
+		{code: "xyzb4dxyz1", allowed: false},
+		{code: "xyzb_a_dz1", allowed: false},
+		{code: "aaH3LLaaaa", allowed: false},
+		{code: "aah3110aaa", allowed: false},
+		{code: "qqm0r0nqqq", allowed: false},
+		{code: "qqrnoronqq", allowed: false},
+		{code: "xxbaclxxxx", allowed: false},
+		{code: "xxBAClxxxx", allowed: false},
+		{code: "goodcode12", allowed: true},
+		{code: "bxaxdxxxxx", allowed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tt.allowed, filter.Allowed(tt.code))
+		})
+	}
+}
+
+func TestLoadDenyList(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "deny.txt")
+	content := "# comment\n\nbad\n  worse  \n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	filter, err := LoadDenyList(path)
+	require.NoError(t, err)
+
+	assert.False(t, filter.Allowed("aaaw0rs3aa"))
+	assert.False(t, filter.Allowed("aaab4daaaa"))
+	assert.True(t, filter.Allowed("commentaaa"))
+
+	_, err = LoadDenyList(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
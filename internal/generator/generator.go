@@ -0,0 +1,215 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"url-shortener/internal/config"
+	"url-shortener/pkg/util/random"
+)
+
+// DefaultLength is the code length used when none is configured.
+const DefaultLength = 10
+
+const (
+	StrategyRandom     = "random"
+	StrategySequence   = "sequence"
+	StrategyHash       = "hash"
+	StrategyObfuscated = "obfuscated"
+	StrategyBlock      = "block"
+)
+
+var (
+	ErrUnknownStrategy = errors.New("unknown generator strategy")
+	ErrSpaceTooLarge   = errors.New("alphabet size to the power of code length must fit in 64 bits")
+)
+
+// CodeGenerator produces short codes for URLs. Attempt starts at 0 and is
+// increased by the caller every time the previous code turned out to be taken.
+type CodeGenerator interface {
+	Generate(url string, attempt int) (string, error)
+}
+
+// New builds the generator selected in cfg. blocks keeps the counter of the
+// sequence, obfuscated and block strategies and may be nil for the others.
+func New(cfg config.GeneratorConfig, blocks BlockSource) (CodeGenerator, error) {
+	enc, err := EncodingFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	check := CheckDigitFromConfig(cfg, enc)
+	if check != nil {
+		// The check character takes the last position of the code.
+		if enc, err = NewEncoding(enc.alphabet, enc.length-1); err != nil {
+			return nil, err
+		}
+	}
+
+	gen, err := newStrategy(cfg, enc, blocks)
+	if err != nil {
+		return nil, err
+	}
+
+	if check != nil {
+		return WithCheckDigit(gen, check), nil
+	}
+
+	return gen, nil
+}
+
+func newStrategy(cfg config.GeneratorConfig, enc *Encoding, blocks BlockSource) (CodeGenerator, error) {
+	if cfg.Strategy != "" && cfg.Strategy != StrategyRandom && enc.space == 0 {
+		return nil, ErrSpaceTooLarge
+	}
+
+	switch cfg.Strategy {
+	case StrategySequence, StrategyObfuscated, StrategyBlock:
+		if blocks == nil {
+			return nil, ErrNoBlockSource
+		}
+	}
+
+	switch cfg.Strategy {
+	case "", StrategyRandom:
+		return NewRandom(enc), nil
+	case StrategySequence:
+		return NewSequence(enc, blocks, cfg.Start), nil
+	case StrategyHash:
+		return NewHash(enc), nil
+	case StrategyObfuscated:
+		return NewObfuscated(enc, blocks, cfg.Start, cfg.Key), nil
+	case StrategyBlock:
+		return NewBlock(enc, blocks, cfg.BlockSize, cfg.Key, cfg.Obfuscate), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownStrategy, cfg.Strategy)
+	}
+}
+
+// CheckDigitFromConfig returns the check digit for codes of enc, or nil if
+// check characters are disabled.
+func CheckDigitFromConfig(cfg config.GeneratorConfig, enc *Encoding) *CheckDigit {
+	if !cfg.Checksum {
+		return nil
+	}
+
+	return NewCheckDigit(enc.alphabet, enc.length)
+}
+
+// Encoding describes the shape of short codes: which characters they consist
+// of and how long they are.
+type Encoding struct {
+	alphabet string
+	length   int
+	// space is the number of distinct codes, len(alphabet)^length, or 0 if
+	// that does not fit in a uint64.
+	space uint64
+}
+
+func NewEncoding(alphabet string, length int) (*Encoding, error) {
+	if err := random.ValidateAlphabet(alphabet); err != nil {
+		return nil, err
+	}
+
+	if length <= 0 {
+		return nil, random.ErrInvalidLength
+	}
+
+	return &Encoding{alphabet: alphabet, length: length, space: pow(uint64(len(alphabet)), length)}, nil
+}
+
+// EncodingFromConfig applies the defaults and the look-alike filter to the
+// configured alphabet and length.
+func EncodingFromConfig(cfg config.GeneratorConfig) (*Encoding, error) {
+	alphabet := cfg.Alphabet
+	if alphabet == "" {
+		alphabet = random.DefaultAlphabet
+	}
+
+	if cfg.ExcludeLookAlikes {
+		alphabet = random.ExcludeLookAlikes(alphabet)
+	}
+
+	length := cfg.Length
+	if length == 0 {
+		length = DefaultLength
+	}
+
+	return NewEncoding(alphabet, length)
+}
+
+// DefaultEncoding is the encoding described in the README: 10 characters
+// from latin letters, digits and underscore.
+func DefaultEncoding() *Encoding {
+	enc, _ := NewEncoding(random.DefaultAlphabet, DefaultLength)
+	return enc
+}
+
+func (e *Encoding) Alphabet() string {
+	return e.alphabet
+}
+
+func (e *Encoding) Length() int {
+	return e.length
+}
+
+// Valid reports whether code has the right length and uses only characters
+// from the alphabet.
+func (e *Encoding) Valid(code string) bool {
+	if len(code) != e.length {
+		return false
+	}
+
+	for i := range len(code) {
+		if strings.IndexByte(e.alphabet, code[i]) < 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// pow returns base^exp, or 0 on overflow.
+func pow(base uint64, exp int) uint64 {
+	result := uint64(1)
+	for range exp {
+		if result > ^uint64(0)/base {
+			return 0
+		}
+		result *= base
+	}
+
+	return result
+}
+
+// encode writes n in base len(alphabet), left-padded to the code length.
+func (e *Encoding) encode(n uint64) string {
+	base := uint64(len(e.alphabet))
+	code := make([]byte, e.length)
+
+	for i := e.length - 1; i >= 0; i-- {
+		code[i] = e.alphabet[n%base]
+		n /= base
+	}
+
+	return string(code)
+}
+
+// decode is the inverse of encode.
+func (e *Encoding) decode(code string) (uint64, error) {
+	if len(code) != e.length {
+		return 0, fmt.Errorf("code must be %d characters long", e.length)
+	}
+
+	var n uint64
+	for i := range len(code) {
+		idx := strings.IndexByte(e.alphabet, code[i])
+		if idx < 0 {
+			return 0, fmt.Errorf("invalid character %q in code", code[i])
+		}
+		n = n*uint64(len(e.alphabet)) + uint64(idx)
+	}
+
+	return n, nil
+}
@@ -0,0 +1,307 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/storage/memory"
+	"url-shortener/pkg/util/random"
+)
+
+const codesCount = 10000
+
+func assertValidCode(t *testing.T, code string) {
+	t.Helper()
+
+	assert.Len(t, code, DefaultLength)
+	for _, c := range code {
+		assert.True(t, strings.ContainsRune(random.DefaultAlphabet, c), "unexpected character %q in %q", c, code)
+	}
+}
+
+func TestGenerators_UniqueAndWithinAlphabet(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		strategy string
+	}{
+		{name: "random", strategy: StrategyRandom},
+		{name: "sequence", strategy: StrategySequence},
+		{name: "hash", strategy: StrategyHash},
+		{name: "obfuscated", strategy: StrategyObfuscated},
+		{name: "block", strategy: StrategyBlock},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			gen, err := New(config.GeneratorConfig{Strategy: tt.strategy, Key: 42}, memory.NewStorageInMemory(zaptest.NewLogger(t)))
+			require.NoError(t, err)
+
+			seen := make(map[string]struct{}, codesCount)
+			for i := range codesCount {
+				code, err := gen.Generate(fmt.Sprintf("https://example.com/%d", i), 0)
+				require.NoError(t, err)
+				assertValidCode(t, code)
+
+				_, dup := seen[code]
+				require.False(t, dup, "duplicate code %q", code)
+				seen[code] = struct{}{}
+			}
+		})
+	}
+}
+
+func TestNew_UnknownStrategy(t *testing.T) {
+	t.Parallel()
+
+	_, err := New(config.GeneratorConfig{Strategy: "nope"}, nil)
+	assert.ErrorIs(t, err, ErrUnknownStrategy)
+}
+
+func TestSequence_Wraps(t *testing.T) {
+	t.Parallel()
+
+	enc := DefaultEncoding()
+	gen := NewSequence(enc, memory.NewStorageInMemory(zaptest.NewLogger(t)), enc.space-1)
+
+	last, err := gen.Generate("", 0)
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("_", DefaultLength), last)
+
+	first, err := gen.Generate("", 0)
+	require.NoError(t, err)
+	assert.Equal(t, strings.Repeat("a", DefaultLength), first)
+}
+
+func TestSequence_StartsAtStart(t *testing.T) {
+	t.Parallel()
+
+	enc := DefaultEncoding()
+	for _, start := range []uint64{0, 42} {
+		code, err := NewSequence(enc, memory.NewStorageInMemory(zaptest.NewLogger(t)), start).Generate("", 0)
+		require.NoError(t, err)
+		assert.Equal(t, enc.encode(start), code)
+
+		obfuscated := NewObfuscated(enc, memory.NewStorageInMemory(zaptest.NewLogger(t)), start, 12345)
+		code, err = obfuscated.Generate("", 0)
+		require.NoError(t, err)
+		id, err := obfuscated.Decode(code)
+		require.NoError(t, err)
+		assert.Equal(t, start, id, "the first code is that of the start value")
+	}
+}
+
+func TestSequence_CounterIsShared(t *testing.T) {
+	t.Parallel()
+
+	enc := DefaultEncoding()
+	source := memory.NewStorageInMemory(zaptest.NewLogger(t))
+	first, err := NewSequence(enc, source, 0).Generate("", 0)
+	require.NoError(t, err)
+
+	// Another instance, or the same one after a restart, continues the count.
+	next, err := NewSequence(enc, source, 0).Generate("", 0)
+	require.NoError(t, err)
+	assert.Equal(t, enc.encode(0), first)
+	assert.Equal(t, enc.encode(1), next)
+}
+
+func TestHash_Deterministic(t *testing.T) {
+	t.Parallel()
+
+	gen := NewHash(DefaultEncoding())
+
+	a, err := gen.Generate("https://example.com/path", 0)
+	require.NoError(t, err)
+	b, err := gen.Generate("https://example.com/path", 0)
+	require.NoError(t, err)
+	assert.Equal(t, a, b)
+
+	extended, err := gen.Generate("https://example.com/path", 1)
+	require.NoError(t, err)
+	assertValidCode(t, extended)
+	assert.NotEqual(t, a, extended)
+}
+
+func TestObfuscated_Reversible(t *testing.T) {
+	t.Parallel()
+
+	gen := NewObfuscated(DefaultEncoding(), memory.NewStorageInMemory(zaptest.NewLogger(t)), 1000, 12345)
+
+	for id := uint64(1000); id < 2000; id++ {
+		code, err := gen.Generate("", 0)
+		require.NoError(t, err)
+
+		decoded, err := gen.Decode(code)
+		require.NoError(t, err)
+		assert.Equal(t, id, decoded)
+	}
+}
+
+func TestObfuscated_DecodeInvalid(t *testing.T) {
+	t.Parallel()
+
+	gen := NewObfuscated(DefaultEncoding(), nil, 0, 0)
+
+	_, err := gen.Decode("short")
+	assert.Error(t, err)
+
+	_, err = gen.Decode("abc-defghi")
+	assert.Error(t, err)
+}
+
+func TestNew_CustomEncoding(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.GeneratorConfig{Strategy: StrategyObfuscated, Length: 6, ExcludeLookAlikes: true}
+	gen, err := New(cfg, memory.NewStorageInMemory(zaptest.NewLogger(t)))
+	require.NoError(t, err)
+
+	for range 1000 {
+		code, err := gen.Generate("", 0)
+		require.NoError(t, err)
+		assert.Len(t, code, 6)
+		assert.NotContains(t, code, "0")
+		assert.NotContains(t, code, "O")
+		assert.NotContains(t, code, "l")
+		assert.NotContains(t, code, "1")
+		assert.NotContains(t, code, "I")
+	}
+}
+
+func TestNew_InvalidEncoding(t *testing.T) {
+	t.Parallel()
+
+	_, err := New(config.GeneratorConfig{Alphabet: "abca"}, nil)
+	assert.ErrorIs(t, err, random.ErrDuplicateChar)
+
+	_, err = New(config.GeneratorConfig{Strategy: StrategySequence, Length: 20}, nil)
+	assert.ErrorIs(t, err, ErrSpaceTooLarge)
+
+	_, err = New(config.GeneratorConfig{Strategy: StrategyObfuscated}, nil)
+	assert.ErrorIs(t, err, ErrNoBlockSource)
+
+	_, err = New(config.GeneratorConfig{Strategy: StrategyRandom, Length: 20}, nil)
+	assert.NoError(t, err)
+}
+
+func TestObfuscated_SmallSpaceIsPermutation(t *testing.T) {
+	t.Parallel()
+
+	enc, err := NewEncoding("abc", 4)
+	require.NoError(t, err)
+	gen := NewObfuscated(enc, memory.NewStorageInMemory(zaptest.NewLogger(t)), 0, 7)
+
+	seen := make(map[string]struct{})
+	for range enc.space {
+		code, err := gen.Generate("", 0)
+		require.NoError(t, err)
+		seen[code] = struct{}{}
+	}
+	assert.Len(t, seen, int(enc.space))
+}
+
+func TestBlock_InstancesShareSource(t *testing.T) {
+	t.Parallel()
+
+	source := memory.NewStorageInMemory(zaptest.NewLogger(t))
+	first := NewBlock(DefaultEncoding(), source, 10, 0, false)
+	second := NewBlock(DefaultEncoding(), source, 10, 0, true)
+
+	var mu sync.Mutex
+	seen := make(map[uint64]struct{})
+	decode := NewObfuscated(DefaultEncoding(), nil, 0, 0)
+
+	var wg sync.WaitGroup
+	for _, gen := range []*Block{first, second} {
+		wg.Add(1)
+		go func(gen *Block) {
+			defer wg.Done()
+			for range 500 {
+				code, err := gen.Generate("", 0)
+				assert.NoError(t, err)
+				assertValidCode(t, code)
+
+				id, err := DefaultEncoding().decode(code)
+				assert.NoError(t, err)
+				if gen.permute != nil {
+					id, err = decode.Decode(code)
+					assert.NoError(t, err)
+				}
+
+				mu.Lock()
+				_, dup := seen[id]
+				seen[id] = struct{}{}
+				mu.Unlock()
+				assert.False(t, dup, "id %d handed out twice", id)
+			}
+		}(gen)
+	}
+	wg.Wait()
+
+	assert.Len(t, seen, 1000)
+}
+
+func TestBlock_CloseReclaimsUnusedTail(t *testing.T) {
+	t.Parallel()
+
+	source := memory.NewStorageInMemory(zaptest.NewLogger(t))
+
+	gen := NewBlock(DefaultEncoding(), source, 100, 0, false)
+	for range 3 {
+		_, err := gen.Generate("", 0)
+		require.NoError(t, err)
+	}
+	require.NoError(t, gen.Close())
+
+	restarted := NewBlock(DefaultEncoding(), source, 100, 0, false)
+	code, err := restarted.Generate("", 0)
+	require.NoError(t, err)
+
+	id, err := DefaultEncoding().decode(code)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), id)
+}
+
+func TestBlock_AbandonedBlockIsSkipped(t *testing.T) {
+	t.Parallel()
+
+	source := memory.NewStorageInMemory(zaptest.NewLogger(t))
+
+	crashed := NewBlock(DefaultEncoding(), source, 100, 0, false)
+	_, err := crashed.Generate("", 0)
+	require.NoError(t, err)
+
+	other := NewBlock(DefaultEncoding(), source, 100, 0, false)
+	_, err = other.Generate("", 0)
+	require.NoError(t, err)
+
+	// The crashed instance cannot give its block back once another block was
+	// leased after it, so its remaining IDs are abandoned rather than reused.
+	require.NoError(t, crashed.Close())
+
+	restarted := NewBlock(DefaultEncoding(), source, 100, 0, false)
+	code, err := restarted.Generate("", 0)
+	require.NoError(t, err)
+
+	id, err := DefaultEncoding().decode(code)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(200), id)
+}
+
+func TestNew_BlockRequiresSource(t *testing.T) {
+	t.Parallel()
+
+	_, err := New(config.GeneratorConfig{Strategy: StrategyBlock}, nil)
+	assert.ErrorIs(t, err, ErrNoBlockSource)
+}
@@ -0,0 +1,30 @@
+package generator
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"strconv"
+)
+
+// Hash derives the code from the SHA-256 of the URL, so the same URL always
+// gets the same code; the service passes it normalized URLs, so equivalent
+// spellings do too. On collision the attempt number is appended to the hashed
+// input, which moves the URL to a different code.
+type Hash struct {
+	enc *Encoding
+}
+
+func NewHash(enc *Encoding) *Hash {
+	return &Hash{enc: enc}
+}
+
+func (g *Hash) Generate(url string, attempt int) (string, error) {
+	input := url
+	if attempt > 0 {
+		input += "#" + strconv.Itoa(attempt)
+	}
+
+	sum := sha256.Sum256([]byte(input))
+
+	return g.enc.encode(binary.BigEndian.Uint64(sum[:8]) % g.enc.space), nil
+}
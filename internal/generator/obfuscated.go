@@ -0,0 +1,82 @@
+package generator
+
+import (
+	"math/big"
+	"math/bits"
+)
+
+// seedMultiplier is the 64-bit golden ratio constant. The actual multiplier is
+// the first value from here on that is coprime with the code space, which makes
+// id*multiplier mod space a bijection.
+const seedMultiplier uint64 = 0x9E3779B97F4A7C15
+
+// Obfuscated hands out sequential IDs but permutes them before encoding, so
+// consecutive codes look unrelated. The permutation is reversible with Decode.
+// The first code is that of the start value.
+type Obfuscated struct {
+	enc        *Encoding
+	counter    counter
+	key        uint64
+	multiplier uint64
+	inverse    uint64
+}
+
+func NewObfuscated(enc *Encoding, source BlockSource, start, key uint64) *Obfuscated {
+	space := new(big.Int).SetUint64(enc.space)
+
+	m := new(big.Int).SetUint64(seedMultiplier % enc.space)
+	one := big.NewInt(1)
+	for new(big.Int).GCD(nil, nil, m, space).Cmp(one) != 0 {
+		m.Add(m, one).Mod(m, space)
+	}
+
+	g := &Obfuscated{
+		enc:        enc,
+		counter:    counter{source: source, start: start},
+		key:        key % enc.space,
+		multiplier: m.Uint64(),
+		inverse:    new(big.Int).ModInverse(m, space).Uint64(),
+	}
+
+	return g
+}
+
+func (g *Obfuscated) Generate(_ string, _ int) (string, error) {
+	id, err := g.counter.next()
+	if err != nil {
+		return "", err
+	}
+
+	return g.enc.encode(g.permute(id % g.enc.space)), nil
+}
+
+// Decode returns the sequential ID a code was generated from.
+func (g *Obfuscated) Decode(code string) (uint64, error) {
+	n, err := g.enc.decode(code)
+	if err != nil {
+		return 0, err
+	}
+
+	space := g.enc.space
+	unkeyed := n - g.key
+	if n < g.key {
+		unkeyed = space - (g.key - n)
+	}
+
+	return mulMod(unkeyed, g.inverse, space), nil
+}
+
+func (g *Obfuscated) permute(id uint64) uint64 {
+	p := mulMod(id, g.multiplier, g.enc.space)
+	if p >= g.enc.space-g.key {
+		return p - (g.enc.space - g.key)
+	}
+
+	return p + g.key
+}
+
+func mulMod(a, b, m uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+
+	return bits.Rem64(hi, lo, m)
+}
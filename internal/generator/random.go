@@ -0,0 +1,16 @@
+package generator
+
+import "url-shortener/pkg/util/random"
+
+// Random draws every character of the code from crypto/rand.
+type Random struct {
+	enc *Encoding
+}
+
+func NewRandom(enc *Encoding) *Random {
+	return &Random{enc: enc}
+}
+
+func (g *Random) Generate(_ string, _ int) (string, error) {
+	return random.NewRandomStringFromAlphabet(g.enc.alphabet, g.enc.length)
+}
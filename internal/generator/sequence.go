@@ -0,0 +1,40 @@
+package generator
+
+import "fmt"
+
+// Sequence encodes a monotonically increasing counter in base len(alphabet).
+// The first code is that of the start value.
+type Sequence struct {
+	enc     *Encoding
+	counter counter
+}
+
+func NewSequence(enc *Encoding, source BlockSource, start uint64) *Sequence {
+	return &Sequence{enc: enc, counter: counter{source: source, start: start}}
+}
+
+func (g *Sequence) Generate(_ string, _ int) (string, error) {
+	id, err := g.counter.next()
+	if err != nil {
+		return "", err
+	}
+
+	return g.enc.encode(id % g.enc.space), nil
+}
+
+// counter hands out consecutive IDs from start on. The count is kept by the
+// BlockSource, one ID per lease, so it survives restarts and is shared by
+// every instance.
+type counter struct {
+	source BlockSource
+	start  uint64
+}
+
+func (c counter) next() (uint64, error) {
+	id, err := c.source.NextBlock(BlockSequence, 1)
+	if err != nil {
+		return 0, fmt.Errorf("failed to lease id: %w", err)
+	}
+
+	return c.start + id, nil
+}
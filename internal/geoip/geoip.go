@@ -0,0 +1,150 @@
+// Package geoip resolves client addresses to countries and cities offline,
+// from a local database in the MaxMind DB format.
+package geoip
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"url-shortener/internal/config"
+)
+
+// Location is where an address is, as coarse as analytics needs it.
+type Location struct {
+	// Country is the ISO 3166-1 alpha-2 code, such as "DE".
+	Country string
+	// City is the English name of the city, if the database has cities.
+	City string
+}
+
+// Locator looks addresses up in a GeoLite2/GeoIP2 Country or City database
+// and picks up a replaced file without a restart.
+//
+// A nil Locator knows no locations.
+type Locator struct {
+	path     string
+	interval time.Duration
+	log      *zap.Logger
+
+	mu      sync.RWMutex
+	reader  *Reader
+	modTime time.Time
+	size    int64
+}
+
+func NewLocator(cfg config.GeoIPConfig, log *zap.Logger) (*Locator, error) {
+	l := &Locator{path: cfg.Database, interval: cfg.ReloadInterval, log: log}
+
+	if err := l.Reload(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Reload reads the database again if the file changed since it was last
+// read. On error the previously loaded database stays in use.
+func (l *Locator) Reload() error {
+	info, err := os.Stat(l.path)
+	if err != nil {
+		return fmt.Errorf("failed to stat GeoIP database: %w", err)
+	}
+
+	l.mu.RLock()
+	unchanged := l.reader != nil && info.ModTime().Equal(l.modTime) && info.Size() == l.size
+	l.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	buf, err := os.ReadFile(l.path)
+	if err != nil {
+		return fmt.Errorf("failed to read GeoIP database: %w", err)
+	}
+
+	reader, err := NewReader(buf)
+	if err != nil {
+		return fmt.Errorf("failed to load GeoIP database %s: %w", l.path, err)
+	}
+
+	l.mu.Lock()
+	l.reader, l.modTime, l.size = reader, info.ModTime(), info.Size()
+	l.mu.Unlock()
+
+	l.log.Info("GeoIP database loaded", zap.String("path", l.path), zap.Int64("bytes", info.Size()))
+
+	return nil
+}
+
+// Run checks the database for changes every configured interval until ctx is
+// done.
+func (l *Locator) Run(ctx context.Context) {
+	if l.interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := l.Reload(); err != nil {
+				l.log.Error("failed to reload GeoIP database", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Locate returns the location of ip, or the zero Location if ip is invalid or
+// not in the database.
+func (l *Locator) Locate(ip string) Location {
+	if l == nil {
+		return Location{}
+	}
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return Location{}
+	}
+
+	l.mu.RLock()
+	reader := l.reader
+	l.mu.RUnlock()
+
+	record, err := reader.Lookup(addr)
+	if err != nil {
+		l.log.Debug("GeoIP lookup failed", zap.Error(err))
+		return Location{}
+	}
+
+	// Some networks, such as anycast ones, only have a registered country.
+	country, _ := lookup(record, "country", "iso_code").(string)
+	if country == "" {
+		country, _ = lookup(record, "registered_country", "iso_code").(string)
+	}
+	city, _ := lookup(record, "city", "names", "en").(string)
+
+	return Location{Country: country, City: city}
+}
+
+// lookup follows path through nested maps of a decoded record.
+func lookup(record any, path ...string) any {
+	for _, key := range path {
+		m, ok := record.(map[string]any)
+		if !ok {
+			return nil
+		}
+		record = m[key]
+	}
+
+	return record
+}
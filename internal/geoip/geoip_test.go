@@ -0,0 +1,260 @@
+package geoip
+
+import (
+	"bytes"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"url-shortener/internal/config"
+)
+
+// pointer encodes as a pointer to the data section offset.
+type pointer int
+
+type dataWriter struct {
+	bytes.Buffer
+}
+
+func (w *dataWriter) control(typ, size int) {
+	var ext []byte
+	switch {
+	case size >= 285:
+		ext, size = []byte{byte((size - 285) >> 8), byte(size - 285)}, 30
+	case size >= 29:
+		ext, size = []byte{byte(size - 29)}, 29
+	}
+
+	if typ < 8 {
+		w.WriteByte(byte(typ<<5 | size))
+	} else {
+		w.WriteByte(byte(size))
+		w.WriteByte(byte(typ - 7))
+	}
+	w.Write(ext)
+}
+
+// value encodes v and returns its offset.
+func (w *dataWriter) value(v any) int {
+	offset := w.Len()
+
+	switch v := v.(type) {
+	case pointer:
+		w.WriteByte(byte(typePointer<<5 | int(v)>>8))
+		w.WriteByte(byte(v))
+	case string:
+		w.control(typeString, len(v))
+		w.WriteString(v)
+	case int:
+		var b []byte
+		for n := v; n > 0; n >>= 8 {
+			b = append([]byte{byte(n)}, b...)
+		}
+		w.control(typeUint32, len(b))
+		w.Write(b)
+	case []any:
+		w.control(typeArray, len(v))
+		for _, e := range v {
+			w.value(e)
+		}
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+
+		w.control(typeMap, len(v))
+		for _, k := range keys {
+			w.value(k)
+			w.value(v[k])
+		}
+	default:
+		panic("unsupported test value")
+	}
+
+	return offset
+}
+
+type record struct {
+	node   int
+	data   int
+	isNode bool
+	isData bool
+}
+
+type network struct {
+	prefix string
+	data   any
+}
+
+// buildDB writes an IPv6 database with the given record size. IPv4 networks
+// go under ::/96, as in MaxMind databases.
+func buildDB(t *testing.T, recordSize int, networks []network) []byte {
+	t.Helper()
+
+	var data dataWriter
+	nodes := [][2]record{{}}
+	for _, n := range networks {
+		prefix := netip.MustParsePrefix(n.prefix)
+		offset := data.value(n.data)
+
+		raw, bits := prefix.Addr().As16(), prefix.Bits()
+		if prefix.Addr().Is4() {
+			bits += 96
+			raw = [16]byte{}
+			copy(raw[12:], prefix.Addr().AsSlice())
+		}
+
+		node := 0
+		for i := range bits {
+			bit := raw[i/8] >> (7 - i%8) & 1
+			if i == bits-1 {
+				nodes[node][bit] = record{data: offset, isData: true}
+				break
+			}
+			if !nodes[node][bit].isNode {
+				nodes = append(nodes, [2]record{})
+				nodes[node][bit] = record{node: len(nodes) - 1, isNode: true}
+			}
+			node = nodes[node][bit].node
+		}
+	}
+
+	count := len(nodes)
+	value := func(r record) uint32 {
+		switch {
+		case r.isNode:
+			return uint32(r.node)
+		case r.isData:
+			return uint32(count + dataSeparator + r.data)
+		default:
+			return uint32(count)
+		}
+	}
+
+	var db bytes.Buffer
+	for _, n := range nodes {
+		left, right := value(n[0]), value(n[1])
+		switch recordSize {
+		case 24:
+			db.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left), byte(right >> 16), byte(right >> 8), byte(right)})
+		case 28:
+			db.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left), byte(left>>24<<4) | byte(right>>24&0x0f),
+				byte(right >> 16), byte(right >> 8), byte(right)})
+		case 32:
+			db.Write([]byte{byte(left >> 24), byte(left >> 16), byte(left >> 8), byte(left),
+				byte(right >> 24), byte(right >> 16), byte(right >> 8), byte(right)})
+		}
+	}
+	db.Write(make([]byte, dataSeparator))
+	db.Write(data.Bytes())
+
+	var meta dataWriter
+	meta.value(map[string]any{
+		"binary_format_major_version": 2,
+		"database_type":               "Test-City",
+		"ip_version":                  6,
+		"languages":                   []any{"en"},
+		"node_count":                  count,
+		"record_size":                 recordSize,
+	})
+	db.Write(metadataMarker)
+	db.Write(meta.Bytes())
+
+	return db.Bytes()
+}
+
+func cityRecord(country, city string) map[string]any {
+	return map[string]any{
+		"city":    map[string]any{"names": map[string]any{"en": city, "de": city + "-de"}},
+		"country": map[string]any{"iso_code": country},
+	}
+}
+
+var testNetworks = []network{
+	{prefix: "81.2.69.0/24", data: cityRecord("GB", "London")},
+	{prefix: "2001:db8::/32", data: map[string]any{"country": map[string]any{"iso_code": "DE"}}},
+	{prefix: "89.160.20.0/22", data: map[string]any{"registered_country": map[string]any{"iso_code": "SE"}}},
+	// A deduplicated record, as real databases store them.
+	{prefix: "81.2.80.0/24", data: pointer(0)},
+}
+
+func TestReader_Lookup(t *testing.T) {
+	t.Parallel()
+
+	for _, size := range []int{24, 28, 32} {
+		reader, err := NewReader(buildDB(t, size, testNetworks))
+		require.NoError(t, err, size)
+
+		record, err := reader.Lookup(netip.MustParseAddr("81.2.69.142"))
+		require.NoError(t, err)
+		assert.Equal(t, "London", lookup(record, "city", "names", "en"), size)
+
+		record, err = reader.Lookup(netip.MustParseAddr("81.2.80.7"))
+		require.NoError(t, err)
+		assert.Equal(t, "GB", lookup(record, "country", "iso_code"), size)
+
+		record, err = reader.Lookup(netip.MustParseAddr("81.2.70.1"))
+		require.NoError(t, err)
+		assert.Nil(t, record, size)
+
+		record, err = reader.Lookup(netip.MustParseAddr("2001:db8:1::1"))
+		require.NoError(t, err)
+		assert.Equal(t, "DE", lookup(record, "country", "iso_code"), size)
+	}
+}
+
+func TestReader_Invalid(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewReader([]byte("not a database"))
+	assert.ErrorIs(t, err, ErrInvalidDatabase)
+
+	db := buildDB(t, 24, testNetworks)
+	_, err = NewReader(db[len(db)/2:])
+	assert.ErrorIs(t, err, ErrInvalidDatabase)
+}
+
+func writeDB(t *testing.T, path string, networks []network, modTime time.Time) {
+	t.Helper()
+
+	require.NoError(t, os.WriteFile(path, buildDB(t, 24, networks), 0o600))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestLocator(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "GeoLite2-City.mmdb")
+	modTime := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	writeDB(t, path, testNetworks, modTime)
+
+	locator, err := NewLocator(config.GeoIPConfig{Database: path}, zaptest.NewLogger(t))
+	require.NoError(t, err)
+
+	assert.Equal(t, Location{Country: "GB", City: "London"}, locator.Locate("81.2.69.142"))
+	assert.Equal(t, Location{Country: "GB", City: "London"}, locator.Locate("::ffff:81.2.69.142"))
+	assert.Equal(t, Location{Country: "SE"}, locator.Locate("89.160.20.5"))
+	assert.Equal(t, Location{Country: "DE"}, locator.Locate("2001:db8::7"))
+	assert.Equal(t, Location{}, locator.Locate("192.0.2.1"))
+	assert.Equal(t, Location{}, locator.Locate("not an address"))
+
+	writeDB(t, path, []network{{prefix: "81.2.69.0/24", data: cityRecord("GB", "Manchester")}}, modTime.Add(time.Hour))
+	require.NoError(t, locator.Reload())
+	assert.Equal(t, Location{Country: "GB", City: "Manchester"}, locator.Locate("81.2.69.142"))
+
+	require.NoError(t, os.WriteFile(path, []byte("truncated"), 0o600))
+	assert.Error(t, locator.Reload())
+	assert.Equal(t, "Manchester", locator.Locate("81.2.69.142").City, "a failed reload keeps the database")
+
+	var none *Locator
+	assert.Equal(t, Location{}, none.Locate("81.2.69.142"))
+}
@@ -0,0 +1,324 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+)
+
+// metadataMarker precedes the metadata map at the end of a database.
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+var ErrInvalidDatabase = errors.New("invalid MaxMind database")
+
+// dataSeparator is the run of zero bytes between the search tree and the
+// data section.
+const dataSeparator = 16
+
+// maxDepth bounds the nesting of decoded values, so a crafted file cannot
+// exhaust the stack.
+const maxDepth = 32
+
+// Data types of the MaxMind DB format.
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEndMarker
+	typeBool
+	typeFloat
+)
+
+// Reader looks addresses up in a database in the MaxMind DB format, such as
+// GeoLite2-City.mmdb. It holds the whole file in memory and is safe for
+// concurrent use.
+type Reader struct {
+	buf        []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	// data is the data section, which pointers are relative to.
+	data      []byte
+	ipv4Start uint
+}
+
+// NewReader parses the database in buf.
+func NewReader(buf []byte) (*Reader, error) {
+	start := bytes.LastIndex(buf, metadataMarker)
+	if start < 0 {
+		return nil, fmt.Errorf("%w: no metadata", ErrInvalidDatabase)
+	}
+
+	raw, _, err := decode(buf[start+len(metadataMarker):], 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("%w: metadata: %w", ErrInvalidDatabase, err)
+	}
+	meta, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: metadata is not a map", ErrInvalidDatabase)
+	}
+
+	r := &Reader{buf: buf}
+	r.nodeCount, _ = toUint(meta["node_count"])
+	r.recordSize, _ = toUint(meta["record_size"])
+	r.ipVersion, _ = toUint(meta["ip_version"])
+
+	if r.recordSize != 24 && r.recordSize != 28 && r.recordSize != 32 {
+		return nil, fmt.Errorf("%w: unsupported record size %d", ErrInvalidDatabase, r.recordSize)
+	}
+	if r.ipVersion != 4 && r.ipVersion != 6 {
+		return nil, fmt.Errorf("%w: unsupported IP version %d", ErrInvalidDatabase, r.ipVersion)
+	}
+
+	treeSize := r.nodeCount * r.recordSize / 4
+	if treeSize+dataSeparator > uint(start) {
+		return nil, fmt.Errorf("%w: search tree exceeds the file", ErrInvalidDatabase)
+	}
+	r.data = buf[treeSize+dataSeparator : start]
+
+	// IPv4 addresses live under ::/96 of an IPv6 tree.
+	if r.ipVersion == 6 {
+		for i := 0; i < 96 && r.ipv4Start < r.nodeCount; i++ {
+			r.ipv4Start = r.record(r.ipv4Start, 0)
+		}
+	}
+
+	return r, nil
+}
+
+// Lookup returns the record of the network containing addr, or nil if there
+// is none.
+func (r *Reader) Lookup(addr netip.Addr) (any, error) {
+	addr = addr.Unmap()
+
+	node, bits := uint(0), 128
+	if addr.Is4() {
+		node, bits = r.ipv4Start, 32
+	} else if r.ipVersion == 4 {
+		return nil, nil
+	}
+
+	raw := addr.AsSlice()
+	for i := 0; i < bits && node < r.nodeCount; i++ {
+		bit := raw[i/8] >> (7 - i%8) & 1
+		node = r.record(node, uint(bit))
+	}
+
+	if node <= r.nodeCount {
+		return nil, nil
+	}
+
+	offset := node - r.nodeCount - dataSeparator
+	if offset >= uint(len(r.data)) {
+		return nil, fmt.Errorf("%w: record points outside the data section", ErrInvalidDatabase)
+	}
+
+	value, _, err := decode(r.data, offset, 0)
+
+	return value, err
+}
+
+// record returns the left (bit 0) or right (bit 1) record of node.
+func (r *Reader) record(node, bit uint) uint {
+	b := r.buf[node*r.recordSize/4:]
+
+	switch r.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		return uint(binary.BigEndian.Uint32(b[bit*4:]))
+	}
+}
+
+// decode decodes the value at offset of section and returns it with the
+// offset following it. Pointers are relative to section.
+func decode(section []byte, offset uint, depth int) (any, uint, error) {
+	if depth > maxDepth {
+		return nil, 0, errors.New("values nested too deeply")
+	}
+
+	typ, size, offset, err := control(section, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if typ == typePointer {
+		value, _, err := decode(section, size, depth+1)
+		return value, offset, err
+	}
+
+	switch typ {
+	case typeMap:
+		m := make(map[string]any, min(size, 64))
+		for range size {
+			var key, value any
+			if key, offset, err = decode(section, offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, 0, errors.New("map key is not a string")
+			}
+			if value, offset, err = decode(section, offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			m[k] = value
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]any, 0, min(size, 64))
+		for range size {
+			var value any
+			if value, offset, err = decode(section, offset, depth+1); err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+		}
+		return a, offset, nil
+	case typeBool:
+		return size != 0, offset, nil
+	}
+
+	if offset+size > uint(len(section)) {
+		return nil, 0, errors.New("value exceeds the section")
+	}
+	b := section[offset : offset+size]
+	offset += size
+
+	switch typ {
+	case typeString:
+		return string(b), offset, nil
+	case typeBytes, typeUint128:
+		return bytes.Clone(b), offset, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, errors.New("invalid double size")
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, errors.New("invalid float size")
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), offset, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, errors.New("invalid integer size")
+		}
+		var n uint64
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		return n, offset, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, errors.New("invalid integer size")
+		}
+		var n uint32
+		for _, c := range b {
+			n = n<<8 | uint32(c)
+		}
+		return int64(int32(n)), offset, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported data type %d", typ)
+	}
+}
+
+// control reads the control byte at offset and returns the type and size of
+// the value and the offset of its payload. For pointers the size is the
+// offset pointed to.
+func control(section []byte, offset uint) (typ, size, next uint, err error) {
+	read := func(n uint) ([]byte, error) {
+		if offset+n > uint(len(section)) {
+			return nil, errors.New("value exceeds the section")
+		}
+		b := section[offset : offset+n]
+		offset += n
+		return b, nil
+	}
+
+	b, err := read(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	ctrl := b[0]
+	typ = uint(ctrl >> 5)
+
+	if typ == typePointer {
+		n := uint(ctrl>>3&3) + 1
+		if b, err = read(n); err != nil {
+			return 0, 0, 0, err
+		}
+
+		var p uint
+		if n < 4 {
+			p = uint(ctrl & 7)
+		}
+		for _, c := range b {
+			p = p<<8 | uint(c)
+		}
+		switch n {
+		case 2:
+			p += 2048
+		case 3:
+			p += 526336
+		}
+		if p >= uint(len(section)) {
+			return 0, 0, 0, errors.New("pointer outside the section")
+		}
+		return typePointer, p, offset, nil
+	}
+
+	if typ == typeExtended {
+		if b, err = read(1); err != nil {
+			return 0, 0, 0, err
+		}
+		typ = 7 + uint(b[0])
+	}
+
+	size = uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if b, err = read(n); err != nil {
+			return 0, 0, 0, err
+		}
+		var extra uint
+		for _, c := range b {
+			extra = extra<<8 | uint(c)
+		}
+		switch n {
+		case 1:
+			size = 29 + extra
+		case 2:
+			size = 285 + extra
+		default:
+			size = 65821 + extra
+		}
+	}
+
+	return typ, size, offset, nil
+}
+
+// toUint converts a decoded unsigned integer.
+func toUint(v any) (uint, bool) {
+	n, ok := v.(uint64)
+	return uint(n), ok
+}
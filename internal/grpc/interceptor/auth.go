@@ -0,0 +1,100 @@
+package interceptor
+
+import (
+	"context"
+	"errors"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"url-shortener/internal/auth"
+)
+
+type Authenticator interface {
+	Authenticate(ctx context.Context, creds auth.Credentials) (auth.Principal, error)
+}
+
+// Auth authenticates unary calls to the methods in scopes by the bearer token
+// in the authorization metadata or the API key in the apiKeyMetadata metadata
+// and requires the scope given for the method.
+// Other methods are not authenticated.
+func Auth(authn Authenticator, scopes map[string]string, apiKeyMetadata string, log *zap.Logger) grpc.UnaryServerInterceptor {
+	if apiKeyMetadata == "" {
+		apiKeyMetadata = DefaultAPIKeyMetadata
+	}
+
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		scope, ok := scopes[info.FullMethod]
+		if !ok {
+			return handler(ctx, req)
+		}
+
+		ctx, err := authenticate(ctx, authn, scope, info.FullMethod, apiKeyMetadata, log)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamAuth is Auth for streaming calls.
+func StreamAuth(authn Authenticator, scopes map[string]string, apiKeyMetadata string, log *zap.Logger) grpc.StreamServerInterceptor {
+	if apiKeyMetadata == "" {
+		apiKeyMetadata = DefaultAPIKeyMetadata
+	}
+
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		scope, ok := scopes[info.FullMethod]
+		if !ok {
+			return handler(srv, ss)
+		}
+
+		ctx, err := authenticate(ss.Context(), authn, scope, info.FullMethod, apiKeyMetadata, log)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authenticate returns ctx with the principal of the call, which must have
+// scope.
+func authenticate(ctx context.Context, authn Authenticator, scope, method, apiKeyMetadata string, log *zap.Logger) (context.Context, error) {
+	creds := auth.Credentials{
+		APIKey:      metadataValue(ctx, apiKeyMetadata),
+		BearerToken: auth.BearerToken(metadataValue(ctx, "authorization")),
+	}
+
+	principal, err := authn.Authenticate(ctx, creds)
+	if err != nil {
+		log.Info("authentication failed", zap.String("method", method), zap.Error(err))
+		switch {
+		case errors.Is(err, auth.ErrMissingCredentials):
+			return nil, status.Error(codes.Unauthenticated, auth.ErrMissingCredentials.Error())
+		case errors.Is(err, auth.ErrInvalidCredentials):
+			return nil, status.Error(codes.Unauthenticated, auth.ErrInvalidCredentials.Error())
+		}
+		return nil, status.Error(codes.Internal, "authentication failed")
+	}
+
+	if !principal.HasScope(scope) {
+		log.Info("insufficient scope", zap.String("subject", principal.Subject), zap.String("scope", scope))
+		return nil, status.Error(codes.PermissionDenied, auth.ErrForbidden.Error())
+	}
+
+	return auth.WithPrincipal(ctx, principal), nil
+}
+
+// contextStream is a server stream with a context carrying more values.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
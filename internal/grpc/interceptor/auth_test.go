@@ -0,0 +1,81 @@
+package interceptor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"url-shortener/internal/auth"
+	"url-shortener/internal/storage/memory"
+)
+
+func TestAuth(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	keys := auth.NewKeys(memory.NewStorageInMemory(logger), logger)
+	authn := &auth.Authenticator{Keys: keys}
+
+	creator, _, err := keys.Create("creator", "", []string{auth.ScopeLinksCreate})
+	require.NoError(t, err)
+	reader, _, err := keys.Create("reader", "", []string{auth.ScopeLinksRead})
+	require.NoError(t, err)
+
+	i := Auth(authn, map[string]string{method: auth.ScopeLinksCreate}, "", logger)
+
+	withKey := func(key string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs(DefaultAPIKeyMetadata, key))
+	}
+
+	assert.Equal(t, codes.Unauthenticated, status.Code(call(i, context.Background(), method)))
+	assert.Equal(t, codes.Unauthenticated, status.Code(call(i, withKey("usk_nope"), method)))
+	assert.Equal(t, codes.PermissionDenied, status.Code(call(i, withKey(reader), method)))
+	assert.NoError(t, call(i, context.Background(), "/urlshortener.URLShortener/Resolve"))
+
+	_, err = i(withKey(creator), nil, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, _ any) (any, error) {
+		p, ok := auth.FromContext(ctx)
+		assert.True(t, ok)
+		assert.Equal(t, "creator", p.Name)
+		return nil, nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestStreamAuth(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	keys := auth.NewKeys(memory.NewStorageInMemory(logger), logger)
+	authn := &auth.Authenticator{Keys: keys}
+
+	admin, _, err := keys.Create("admin", "", []string{auth.ScopeAdmin})
+	require.NoError(t, err)
+	reader, _, err := keys.Create("reader", "", []string{auth.ScopeLinksRead})
+	require.NoError(t, err)
+
+	i := StreamAuth(authn, map[string]string{method: auth.ScopeAdmin}, "", logger)
+
+	stream := func(key string) grpc.ServerStream {
+		ctx := context.Background()
+		if key != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(DefaultAPIKeyMetadata, key))
+		}
+		return &contextStream{ctx: ctx}
+	}
+	info := &grpc.StreamServerInfo{FullMethod: method, IsServerStream: true}
+	noop := func(any, grpc.ServerStream) error { return nil }
+
+	assert.Equal(t, codes.Unauthenticated, status.Code(i(nil, stream(""), info, noop)))
+	assert.Equal(t, codes.PermissionDenied, status.Code(i(nil, stream(reader), info, noop)))
+
+	err = i(nil, stream(admin), info, func(_ any, ss grpc.ServerStream) error {
+		p, ok := auth.FromContext(ss.Context())
+		assert.True(t, ok)
+		assert.Equal(t, "admin", p.Name)
+		return nil
+	})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,42 @@
+package interceptor
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+
+	"url-shortener/internal/domain"
+)
+
+type DomainResolver interface {
+	ForHost(host string) string
+}
+
+// Domain stores the short domain the :authority of the call stands for and
+// the origin of the call in the context. Requests may override the domain
+// with a domain field. The server does not terminate TLS, so the origin is
+// always plain http.
+func Domain(domains DomainResolver) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		return handler(withDomain(ctx, domains), req)
+	}
+}
+
+// StreamDomain is Domain for streaming calls.
+func StreamDomain(domains DomainResolver) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &contextStream{ServerStream: ss, ctx: withDomain(ss.Context(), domains)})
+	}
+}
+
+func withDomain(ctx context.Context, domains DomainResolver) context.Context {
+	authority := metadataValue(ctx, ":authority")
+	if host := domains.ForHost(authority); host != domain.Default {
+		ctx = domain.WithDomain(ctx, host)
+	}
+	if authority != "" {
+		ctx = domain.WithOrigin(ctx, "http://"+authority)
+	}
+
+	return ctx
+}
@@ -0,0 +1,78 @@
+package interceptor
+
+import (
+	"context"
+	"math"
+	"net"
+	"strconv"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"url-shortener/internal/ratelimit"
+)
+
+const DefaultAPIKeyMetadata = "x-api-key"
+
+// RateLimit limits unary calls by the rule registered for their full method
+// name; methods without a rule are not limited. Rejected calls fail with
+// ResourceExhausted and carry a retry-after trailer in seconds.
+func RateLimit(limiter ratelimit.Limiter, rules map[string]ratelimit.Rule, apiKeyMetadata string, log *zap.Logger) grpc.UnaryServerInterceptor {
+	if apiKeyMetadata == "" {
+		apiKeyMetadata = DefaultAPIKeyMetadata
+	}
+
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		rule, ok := rules[info.FullMethod]
+		if !ok || !rule.Enabled() {
+			return handler(ctx, req)
+		}
+
+		key := rule.BucketKey(clientIP(ctx), metadataValue(ctx, apiKeyMetadata))
+		res, err := limiter.Allow(ctx, key, rule)
+		if err != nil {
+			log.Error("rate limiter failed", zap.String("rule", rule.Name), zap.Error(err))
+			return handler(ctx, req)
+		}
+
+		if !res.Allowed {
+			log.Info("rate limit exceeded", zap.String("rule", rule.Name), zap.String("key", key))
+			retryAfter := strconv.Itoa(int(math.Ceil(res.RetryAfter.Seconds())))
+			_ = grpc.SetTrailer(ctx, metadata.Pairs("retry-after", retryAfter))
+			return nil, status.Error(codes.ResourceExhausted, "rate limit exceeded, retry after "+retryAfter+"s")
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func clientIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
+
+func metadataValue(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+
+	return ""
+}
@@ -0,0 +1,57 @@
+package interceptor
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"url-shortener/internal/ratelimit"
+)
+
+const method = "/urlshortener.URLShortener/Shorten"
+
+func call(i grpc.UnaryServerInterceptor, ctx context.Context, fullMethod string) error {
+	_, err := i(ctx, nil, &grpc.UnaryServerInfo{FullMethod: fullMethod}, func(context.Context, any) (any, error) {
+		return "ok", nil
+	})
+
+	return err
+}
+
+func fromIP(ip string) context.Context {
+	return peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 4321}})
+}
+
+func TestRateLimit_ResourceExhausted(t *testing.T) {
+	rules := map[string]ratelimit.Rule{method: {Name: "shorten", Rate: 1, Burst: 1, Key: ratelimit.KeyIP}}
+	i := RateLimit(ratelimit.NewMemory(), rules, "", zap.NewNop())
+
+	assert.NoError(t, call(i, fromIP("10.0.0.1"), method))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(call(i, fromIP("10.0.0.1"), method)))
+	assert.NoError(t, call(i, fromIP("10.0.0.2"), method))
+
+	for n := 0; n < 3; n++ {
+		assert.NoError(t, call(i, fromIP("10.0.0.1"), "/urlshortener.URLShortener/Other"), "methods without a rule are not limited")
+	}
+}
+
+func TestRateLimit_ByAPIKey(t *testing.T) {
+	rules := map[string]ratelimit.Rule{method: {Name: "shorten", Rate: 1, Burst: 1, Key: ratelimit.KeyAPIKey}}
+	i := RateLimit(ratelimit.NewMemory(), rules, "", zap.NewNop())
+
+	withKey := func(ip, key string) context.Context {
+		return metadata.NewIncomingContext(fromIP(ip), metadata.Pairs(DefaultAPIKeyMetadata, key))
+	}
+
+	assert.NoError(t, call(i, withKey("10.0.0.1", "a"), method))
+	assert.Equal(t, codes.ResourceExhausted, status.Code(call(i, withKey("10.0.0.2", "a"), method)))
+	assert.NoError(t, call(i, withKey("10.0.0.1", "b"), method))
+}
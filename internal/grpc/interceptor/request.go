@@ -0,0 +1,26 @@
+package interceptor
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"url-shortener/internal/audit"
+)
+
+const requestIDKey = "x-request-id"
+
+// Request gives every call an ID: the one in its x-request-id metadata if it
+// is usable, otherwise a random one. The ID is sent back in the header
+// metadata and stored in the context together with the peer address for the
+// audit log.
+func Request() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		id := audit.RequestID(metadataValue(ctx, requestIDKey))
+		_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDKey, id))
+		ctx = audit.WithSource(ctx, audit.Source{RequestID: id, IP: clientIP(ctx)})
+
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,25 @@
+package interceptor
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+
+	"url-shortener/internal/tenant"
+)
+
+type TenantResolver interface {
+	ForHost(host string) string
+}
+
+// Tenant stores the tenant owning the :authority of the call in the context.
+// Authenticated calls act in the tenant of their principal instead.
+func Tenant(tenants TenantResolver) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if id := tenants.ForHost(metadataValue(ctx, ":authority")); id != tenant.Default {
+			ctx = tenant.WithTenant(ctx, id)
+		}
+
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,29 @@
+package interceptor
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+
+	"url-shortener/internal/analytics"
+	"url-shortener/internal/bots"
+)
+
+// Visitor stores the peer address, the user-agent and referer metadata and
+// the traffic class of the call in the context for click analytics. bots may
+// be nil.
+func Visitor(bots *bots.Detector) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		userAgent := metadataValue(ctx, "user-agent")
+		verdict := bots.Classify(userAgent, nil)
+		ctx = analytics.WithVisitor(ctx, analytics.Visitor{
+			IP:        clientIP(ctx),
+			Referrer:  metadataValue(ctx, "referer"),
+			UserAgent: userAgent,
+			Class:     verdict.Class,
+			Bot:       verdict.Name,
+		})
+
+		return handler(ctx, req)
+	}
+}
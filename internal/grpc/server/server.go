@@ -1,49 +1,330 @@
 package server
 
 import (
+	"cmp"
 	"context"
 	"errors"
+	"time"
 
 	"github.com/go-playground/validator/v10"
 	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
+	"url-shortener/internal/auth"
+	"url-shortener/internal/domain"
 	"url-shortener/internal/grpc/urlshortener"
+	"url-shortener/internal/model"
+	"url-shortener/internal/normalize"
+	"url-shortener/internal/policy"
+	"url-shortener/internal/service"
+	"url-shortener/internal/tenant"
+	"url-shortener/internal/threat"
+	"url-shortener/internal/trending"
 )
 
 type Service interface {
-	Resolve(url string) (string, error)
-	Shorten(url string) (string, error)
+	LookupContext(ctx context.Context, url string) (service.Resolution, error)
+	ShortenContext(ctx context.Context, url, alias string) (string, error)
+	ShortURL(ctx context.Context, code string) string
+	LinkURL(ctx context.Context, link model.Link) string
+	ListMine(ctx context.Context, after string, limit int) (service.LinkPage, error)
+	Update(ctx context.Context, code, url string) (model.Link, error)
+	Delete(ctx context.Context, code string) error
+	Stats(ctx context.Context, code string, q model.ClickQuery) (model.ClickStats, error)
 }
 
+// TrendingSource ranks the links resolved most in each trending window.
+type TrendingSource interface {
+	Top(limit int) []trending.Top
+	TopOf(tenant string, limit int) []trending.Top
+}
+
+const (
+	defaultTrendingInterval = 5 * time.Second
+	minTrendingInterval     = time.Second
+)
+
 type GRPCServer struct {
 	urlshortener.UnimplementedURLShortenerServer
 	Service Service
-	Log     *zap.Logger
+	// Trending is nil when trending links are not tracked.
+	Trending TrendingSource
+	Log      *zap.Logger
 }
 
-func (s *GRPCServer) Shorten(_ context.Context, req *urlshortener.ShortenRequest) (*urlshortener.ShortenResponse, error) {
-	s.Log.Info("Shorten request", zap.String("url", req.GetUrl()))
+func (s *GRPCServer) Shorten(ctx context.Context, req *urlshortener.ShortenRequest) (*urlshortener.ShortenResponse, error) {
+	s.Log.Info("Shorten request", zap.String("url", req.GetUrl()), zap.String("alias", req.GetAlias()))
 
 	if err := validator.New().Var(req.Url, "required,url"); err != nil {
 		s.Log.Error("Validation failed", zap.Error(err))
 		return nil, errors.New("invalid URL format")
 	}
 
-	shortURL, err := s.Service.Shorten(req.Url)
+	ctx = onDomain(ctx, req.GetDomain())
+	shortURL, err := s.Service.ShortenContext(ctx, req.Url, req.Alias)
 	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidAlias), errors.Is(err, service.ErrAliasNotAllowed),
+			errors.Is(err, service.ErrAliasCheckDigit), errors.Is(err, policy.ErrForbiddenDestination),
+			errors.Is(err, normalize.ErrInvalidURL), errors.Is(err, threat.ErrMalicious),
+			errors.Is(err, domain.ErrUnknownDomain):
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		case errors.Is(err, service.ErrAliasTaken):
+			return nil, status.Error(codes.AlreadyExists, err.Error())
+		case errors.Is(err, tenant.ErrLinkQuotaExceeded), errors.Is(err, tenant.ErrCreateRateExceeded):
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
 		return nil, err
 	}
 
-	return &urlshortener.ShortenResponse{ShortUrl: shortURL}, nil
+	return &urlshortener.ShortenResponse{ShortUrl: s.Service.ShortURL(ctx, shortURL), Code: shortURL}, nil
 }
 
-func (s *GRPCServer) Resolve(_ context.Context, req *urlshortener.ResolveRequest) (*urlshortener.ResolveResponse, error) {
+func (s *GRPCServer) Resolve(ctx context.Context, req *urlshortener.ResolveRequest) (*urlshortener.ResolveResponse, error) {
 	s.Log.Info("Resolve request", zap.String("short-URL", req.ShortUrl))
 
-	url, err := s.Service.Resolve(req.ShortUrl)
+	ctx = onDomain(ctx, req.GetDomain())
+	res, err := s.Service.LookupContext(ctx, req.ShortUrl)
 	if err != nil {
+		var mistyped *service.MistypedError
+		if errors.As(err, &mistyped) {
+			return nil, mistypedStatus(mistyped)
+		}
+		if errors.Is(err, domain.ErrUnknownDomain) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
 		return nil, err
 	}
 
-	return &urlshortener.ResolveResponse{OriginalUrl: url}, nil
+	resp := &urlshortener.ResolveResponse{
+		OriginalUrl: res.URL,
+		Code:        req.ShortUrl,
+		ShortUrl:    s.Service.ShortURL(ctx, req.ShortUrl),
+	}
+	if res.Threat != nil {
+		resp.Warning = "destination reported as " + res.Threat.Threat
+	}
+
+	return resp, nil
+}
+
+func (s *GRPCServer) ListMyLinks(ctx context.Context, req *urlshortener.ListMyLinksRequest) (*urlshortener.ListMyLinksResponse, error) {
+	page, err := s.Service.ListMine(ctx, req.GetPageToken(), int(req.GetPageSize()))
+	if err != nil {
+		s.Log.Error("ListMyLinks failed", zap.Error(err))
+		return nil, linkStatus(err)
+	}
+
+	resp := &urlshortener.ListMyLinksResponse{NextPageToken: page.Next}
+	for _, link := range page.Links {
+		resp.Links = append(resp.Links, s.toLink(ctx, link))
+	}
+
+	return resp, nil
+}
+
+func (s *GRPCServer) UpdateLink(ctx context.Context, req *urlshortener.UpdateLinkRequest) (*urlshortener.Link, error) {
+	s.Log.Info("UpdateLink request", zap.String("short-URL", req.GetShortUrl()), zap.String("url", req.GetUrl()))
+
+	if err := validator.New().Var(req.GetUrl(), "required,url"); err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid URL format")
+	}
+
+	link, err := s.Service.Update(onDomain(ctx, req.GetDomain()), req.GetShortUrl(), req.GetUrl())
+	if err != nil {
+		s.Log.Error("UpdateLink failed", zap.Error(err))
+		return nil, linkStatus(err)
+	}
+
+	return s.toLink(ctx, link), nil
+}
+
+func (s *GRPCServer) DeleteLink(ctx context.Context, req *urlshortener.DeleteLinkRequest) (*urlshortener.DeleteLinkResponse, error) {
+	s.Log.Info("DeleteLink request", zap.String("short-URL", req.GetShortUrl()))
+
+	if err := s.Service.Delete(onDomain(ctx, req.GetDomain()), req.GetShortUrl()); err != nil {
+		s.Log.Error("DeleteLink failed", zap.Error(err))
+		return nil, linkStatus(err)
+	}
+
+	return &urlshortener.DeleteLinkResponse{}, nil
+}
+
+func (s *GRPCServer) GetLinkStats(ctx context.Context, req *urlshortener.GetLinkStatsRequest) (*urlshortener.LinkStats, error) {
+	s.Log.Info("GetLinkStats request", zap.String("short-URL", req.GetShortUrl()))
+
+	interval, err := service.ParseStatsInterval(req.GetInterval())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	q := model.ClickQuery{Interval: interval, Top: int(req.GetTop()), Traffic: req.GetTraffic()}
+	if req.GetFrom() != nil {
+		q.From = req.GetFrom().AsTime()
+	}
+	if req.GetTo() != nil {
+		q.To = req.GetTo().AsTime()
+	}
+
+	stats, err := s.Service.Stats(onDomain(ctx, req.GetDomain()), req.GetShortUrl(), q)
+	if err != nil {
+		s.Log.Error("GetLinkStats failed", zap.Error(err))
+		return nil, linkStatus(err)
+	}
+
+	resp := &urlshortener.LinkStats{
+		Total:          stats.Total,
+		UniqueVisitors: stats.UniqueVisitors,
+		Traffic:        cmp.Or(q.Traffic, model.ClassHuman),
+	}
+	for _, b := range stats.Series {
+		resp.Series = append(resp.Series, &urlshortener.StatsBucket{Start: timestamppb.New(b.Start), Clicks: b.Clicks})
+	}
+	resp.TopReferrers = toCounts(stats.TopReferrers)
+	resp.TopUserAgents = toCounts(stats.TopUserAgents)
+	resp.ByClass = toCounts(stats.ByClass)
+	resp.TopBots = toCounts(stats.TopBots)
+	resp.TopCountries = toCounts(stats.TopCountries)
+	resp.TopCities = toCounts(stats.TopCities)
+	resp.TopDevices = toCounts(stats.TopDevices)
+	resp.TopOs = toCounts(stats.TopOS)
+	resp.TopBrowsers = toCounts(stats.TopBrowsers)
+
+	return resp, nil
+}
+
+// WatchTrending sends a snapshot of the trending links of the caller's tenant,
+// or of all tenants to a superadmin, right away and then every interval until
+// the client goes away.
+func (s *GRPCServer) WatchTrending(req *urlshortener.WatchTrendingRequest, stream grpc.ServerStreamingServer[urlshortener.TrendingSnapshot]) error {
+	if s.Trending == nil {
+		return status.Error(codes.Unimplemented, "trending links are not tracked")
+	}
+
+	principal, ok := auth.FromContext(stream.Context())
+	if !ok {
+		return status.Error(codes.Unauthenticated, auth.ErrMissingCredentials.Error())
+	}
+
+	tops := s.Trending.Top
+	if !principal.HasScope(auth.ScopeSuperAdmin) {
+		tops = func(limit int) []trending.Top { return s.Trending.TopOf(principal.Tenant, limit) }
+	}
+
+	window, err := trending.ParseWindow(req.GetWindow())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	interval := defaultTrendingInterval
+	if req.GetInterval() != nil {
+		interval = max(req.GetInterval().AsDuration(), minTrendingInterval)
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	ctx := stream.Context()
+	for {
+		if err := stream.Send(s.trendingSnapshot(ctx, tops(int(req.GetLimit())), window)); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// trendingSnapshot returns the rankings of window among tops, or all of them if
+// window is zero.
+func (s *GRPCServer) trendingSnapshot(ctx context.Context, tops []trending.Top, window time.Duration) *urlshortener.TrendingSnapshot {
+	snapshot := &urlshortener.TrendingSnapshot{At: timestamppb.Now()}
+	for _, top := range tops {
+		if window != 0 && top.Window != window {
+			continue
+		}
+
+		w := &urlshortener.TrendingWindow{Window: trending.WindowName(top.Window)}
+		for _, e := range top.Entries {
+			w.Links = append(w.Links, &urlshortener.TrendingLink{
+				Tenant:   e.Key.Tenant,
+				Domain:   e.Key.Domain,
+				Code:     e.Key.ShortURL,
+				ShortUrl: s.Service.LinkURL(ctx, model.Link{Domain: e.Key.Domain, ShortURL: e.Key.ShortURL}),
+				Count:    e.Count,
+			})
+		}
+		snapshot.Windows = append(snapshot.Windows, w)
+	}
+
+	return snapshot
+}
+
+func toCounts(counts []model.ClickCount) []*urlshortener.StatsCount {
+	out := make([]*urlshortener.StatsCount, 0, len(counts))
+	for _, c := range counts {
+		out = append(out, &urlshortener.StatsCount{Value: c.Value, Clicks: c.Clicks})
+	}
+
+	return out
+}
+
+// onDomain returns ctx with the short domain named in a request, if any.
+func onDomain(ctx context.Context, host string) context.Context {
+	if host == "" {
+		return ctx
+	}
+
+	return domain.WithDomain(ctx, host)
+}
+
+func linkStatus(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrMissingCredentials):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, service.ErrNotOwner):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, service.ErrLinkNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, policy.ErrForbiddenDestination), errors.Is(err, normalize.ErrInvalidURL),
+		errors.Is(err, threat.ErrMalicious), errors.Is(err, domain.ErrUnknownDomain),
+		errors.Is(err, service.ErrInvalidStatsQuery):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return err
+}
+
+func (s *GRPCServer) toLink(ctx context.Context, link model.Link) *urlshortener.Link {
+	return &urlshortener.Link{
+		ShortUrl:  s.Service.LinkURL(ctx, link),
+		Code:      link.ShortURL,
+		Url:       link.URL,
+		CreatedAt: timestamppb.New(link.CreatedAt),
+		Domain:    link.Domain,
+	}
+}
+
+// mistypedStatus reports a bad check character as NotFound and passes the
+// suggested code, if any, in an ErrorInfo detail.
+func mistypedStatus(err *service.MistypedError) error {
+	st := status.New(codes.NotFound, err.Error())
+
+	info := &errdetails.ErrorInfo{Reason: "INVALID_CHECK_DIGIT", Domain: "urlshortener"}
+	if err.Suggestion != "" {
+		info.Metadata = map[string]string{"suggestion": err.Suggestion}
+	}
+
+	if detailed, detailErr := st.WithDetails(info); detailErr == nil {
+		st = detailed
+	}
+
+	return st.Err()
 }
@@ -3,13 +3,27 @@ package server
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
+	"url-shortener/internal/auth"
+	"url-shortener/internal/config"
+	"url-shortener/internal/domain"
+	"url-shortener/internal/generator"
 	"url-shortener/internal/grpc/urlshortener"
+	"url-shortener/internal/model"
+	"url-shortener/internal/policy"
 	"url-shortener/internal/service"
 	"url-shortener/internal/storage/memory"
+	"url-shortener/internal/trending"
+	"url-shortener/pkg/util/random"
 )
 
 const (
@@ -71,3 +85,280 @@ func TestGRPCServer_Resolve_NotFound(t *testing.T) {
 	assert.Error(t, err)
 	assert.Nil(t, resp)
 }
+
+func TestGRPCServer_Shorten_AliasTaken(t *testing.T) {
+	logger, _ := zap.NewProduction()
+	storage := memory.NewStorageInMemory(logger)
+	shortenerService := service.NewShortener(storage, logger)
+	grpcServer := &GRPCServer{Service: shortenerService, Log: logger}
+
+	resp, err := grpcServer.Shorten(context.Background(), &urlshortener.ShortenRequest{Url: originalURL, Alias: "promo"})
+	assert.NoError(t, err)
+	assert.Equal(t, "promo", resp.ShortUrl)
+
+	_, err = grpcServer.Shorten(context.Background(), &urlshortener.ShortenRequest{Url: "https://other.com", Alias: "promo"})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+}
+
+func TestGRPCServer_Resolve_Mistyped(t *testing.T) {
+	logger, _ := zap.NewProduction()
+
+	check := generator.NewCheckDigit(random.DefaultAlphabet, 10)
+	code := check.Append("abcdefghi")
+
+	storage := memory.NewStorageInMemory(logger)
+	assert.NoError(t, storage.Put(model.Link{URL: originalURL, ShortURL: code}))
+
+	shortenerService := service.NewShortener(storage, logger)
+	shortenerService.CheckDigit = check
+	grpcServer := &GRPCServer{Service: shortenerService, Log: logger}
+
+	_, err := grpcServer.Resolve(context.Background(), &urlshortener.ResolveRequest{ShortUrl: "bacdefghi" + code[9:]})
+
+	st := status.Convert(err)
+	assert.Equal(t, codes.NotFound, st.Code())
+	if assert.Len(t, st.Details(), 1) {
+		info, ok := st.Details()[0].(*errdetails.ErrorInfo)
+		assert.True(t, ok)
+		assert.Equal(t, code, info.GetMetadata()["suggestion"])
+	}
+}
+
+func TestGRPCServer_Shorten_ForbiddenDestination(t *testing.T) {
+	logger, _ := zap.NewProduction()
+	storage := memory.NewStorageInMemory(logger)
+	shortenerService := service.NewShortener(storage, logger)
+	shortenerService.Policy = policy.New(config.PolicyConfig{BlockPrivateIPs: true}, nil)
+	grpcServer := &GRPCServer{Service: shortenerService, Log: logger}
+
+	_, err := grpcServer.Shorten(context.Background(), &urlshortener.ShortenRequest{Url: "http://127.0.0.1:6379/"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestGRPCServer_LinkOwnership(t *testing.T) {
+	logger, _ := zap.NewProduction()
+	storage := memory.NewStorageInMemory(logger)
+	shortenerService := service.NewShortener(storage, logger)
+	grpcServer := &GRPCServer{Service: shortenerService, Log: logger}
+
+	alice := auth.WithPrincipal(context.Background(), auth.Principal{Subject: "alice"})
+	bob := auth.WithPrincipal(context.Background(), auth.Principal{Subject: "bob"})
+
+	created, err := grpcServer.Shorten(alice, &urlshortener.ShortenRequest{Url: originalURL})
+	assert.NoError(t, err)
+
+	list, err := grpcServer.ListMyLinks(alice, &urlshortener.ListMyLinksRequest{})
+	assert.NoError(t, err)
+	if assert.Len(t, list.GetLinks(), 1) {
+		assert.Equal(t, created.GetCode(), list.GetLinks()[0].GetCode())
+	}
+
+	list, err = grpcServer.ListMyLinks(bob, &urlshortener.ListMyLinksRequest{})
+	assert.NoError(t, err)
+	assert.Empty(t, list.GetLinks())
+
+	_, err = grpcServer.ListMyLinks(context.Background(), &urlshortener.ListMyLinksRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = grpcServer.UpdateLink(bob, &urlshortener.UpdateLinkRequest{ShortUrl: created.GetCode(), Url: "https://bob.com"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	updated, err := grpcServer.UpdateLink(alice, &urlshortener.UpdateLinkRequest{ShortUrl: created.GetCode(), Url: "https://alice.com"})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://alice.com", updated.GetUrl())
+
+	_, err = grpcServer.DeleteLink(bob, &urlshortener.DeleteLinkRequest{ShortUrl: created.GetCode()})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = grpcServer.DeleteLink(alice, &urlshortener.DeleteLinkRequest{ShortUrl: created.GetCode()})
+	assert.NoError(t, err)
+
+	_, err = grpcServer.DeleteLink(alice, &urlshortener.DeleteLinkRequest{ShortUrl: created.GetCode()})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestGRPCServer_Shorten_Domains(t *testing.T) {
+	logger, _ := zap.NewProduction()
+	storage := memory.NewStorageInMemory(logger)
+	shortenerService := service.NewShortener(storage, logger)
+	shortenerService.Domains = domain.NewRegistry([]config.DomainConfig{{Host: "go.brand-a.com"}, {Host: "l.brand-b.io"}})
+	grpcServer := &GRPCServer{Service: shortenerService, Log: logger}
+
+	resp, err := grpcServer.Shorten(context.Background(), &urlshortener.ShortenRequest{Url: originalURL, Alias: "promo", Domain: "l.brand-b.io"})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://l.brand-b.io/promo", resp.GetShortUrl())
+
+	resp, err = grpcServer.Shorten(context.Background(), &urlshortener.ShortenRequest{Url: originalURL, Alias: "promo"})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://go.brand-a.com/promo", resp.GetShortUrl())
+
+	_, err = grpcServer.Shorten(context.Background(), &urlshortener.ShortenRequest{Url: originalURL, Domain: "evil.example"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	res, err := grpcServer.Resolve(context.Background(), &urlshortener.ResolveRequest{ShortUrl: "promo", Domain: "l.brand-b.io"})
+	assert.NoError(t, err)
+	assert.Equal(t, originalURL, res.GetOriginalUrl())
+	assert.Equal(t, "promo", res.GetCode())
+	assert.Equal(t, "https://l.brand-b.io/promo", res.GetShortUrl())
+}
+
+func TestGRPCServer_Shorten_BaseURL(t *testing.T) {
+	logger, _ := zap.NewProduction()
+	storage := memory.NewStorageInMemory(logger)
+	shortenerService := service.NewShortener(storage, logger)
+	shortenerService.BaseURL = "https://sho.rt/"
+	grpcServer := &GRPCServer{Service: shortenerService, Log: logger}
+
+	resp, err := grpcServer.Shorten(context.Background(), &urlshortener.ShortenRequest{Url: originalURL, Alias: "promo"})
+	assert.NoError(t, err)
+	assert.Equal(t, "promo", resp.GetCode())
+	assert.Equal(t, "https://sho.rt/promo", resp.GetShortUrl())
+
+	alice := auth.WithPrincipal(context.Background(), auth.Principal{Subject: "alice"})
+	_, err = grpcServer.Shorten(alice, &urlshortener.ShortenRequest{Url: "https://alice.com", Alias: "alice"})
+	assert.NoError(t, err)
+
+	list, err := grpcServer.ListMyLinks(alice, &urlshortener.ListMyLinksRequest{})
+	assert.NoError(t, err)
+	if assert.Len(t, list.GetLinks(), 1) {
+		assert.Equal(t, "alice", list.GetLinks()[0].GetCode())
+		assert.Equal(t, "https://sho.rt/alice", list.GetLinks()[0].GetShortUrl())
+	}
+}
+
+func TestGRPCServer_GetLinkStats(t *testing.T) {
+	logger, _ := zap.NewProduction()
+	storage := memory.NewStorageInMemory(logger)
+	shortenerService := service.NewShortener(storage, logger)
+	grpcServer := &GRPCServer{Service: shortenerService, Log: logger}
+
+	alice := auth.WithPrincipal(context.Background(), auth.Principal{Subject: "alice"})
+	_, err := grpcServer.Shorten(alice, &urlshortener.ShortenRequest{Url: originalURL, Alias: "promo"})
+	assert.NoError(t, err)
+
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, storage.PutClicks([]model.Click{
+		{ShortURL: "promo", At: day.Add(time.Hour), UserAgent: "grpc-go"},
+		{ShortURL: "promo", At: day.Add(time.Hour), UserAgent: "Twitterbot", Class: model.ClassBot, Bot: "Twitter"},
+	}))
+
+	stats, err := grpcServer.GetLinkStats(alice, &urlshortener.GetLinkStatsRequest{
+		ShortUrl: "promo",
+		From:     timestamppb.New(day),
+		To:       timestamppb.New(day.Add(2 * time.Hour)),
+		Interval: "hour",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), stats.GetTotal())
+	if assert.Len(t, stats.GetSeries(), 2) {
+		assert.Equal(t, int64(1), stats.GetSeries()[1].GetClicks())
+	}
+	if assert.Len(t, stats.GetTopUserAgents(), 1) {
+		assert.Equal(t, "grpc-go", stats.GetTopUserAgents()[0].GetValue())
+	}
+	assert.Equal(t, "human", stats.GetTraffic())
+	assert.Len(t, stats.GetByClass(), 2)
+	if assert.Len(t, stats.GetTopBots(), 1) {
+		assert.Equal(t, "Twitter", stats.GetTopBots()[0].GetValue())
+	}
+
+	stats, err = grpcServer.GetLinkStats(alice, &urlshortener.GetLinkStatsRequest{
+		ShortUrl: "promo",
+		From:     timestamppb.New(day),
+		To:       timestamppb.New(day.Add(2 * time.Hour)),
+		Traffic:  "all",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), stats.GetTotal())
+
+	_, err = grpcServer.GetLinkStats(alice, &urlshortener.GetLinkStatsRequest{ShortUrl: "promo", Interval: "fortnight"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	bob := auth.WithPrincipal(context.Background(), auth.Principal{Subject: "bob"})
+	_, err = grpcServer.GetLinkStats(bob, &urlshortener.GetLinkStatsRequest{ShortUrl: "promo"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+// trendingStream collects the snapshots sent to it and ends the stream after
+// the first.
+type trendingStream struct {
+	grpc.ServerStream
+	ctx       context.Context
+	cancel    context.CancelFunc
+	snapshots []*urlshortener.TrendingSnapshot
+}
+
+func (s *trendingStream) Context() context.Context { return s.ctx }
+
+func (s *trendingStream) Send(snapshot *urlshortener.TrendingSnapshot) error {
+	s.snapshots = append(s.snapshots, snapshot)
+	s.cancel()
+	return nil
+}
+
+func TestGRPCServer_WatchTrending(t *testing.T) {
+	logger, _ := zap.NewProduction()
+	storage := memory.NewStorageInMemory(logger)
+	shortenerService := service.NewShortener(storage, logger)
+	shortenerService.BaseURL = "https://sho.rt"
+
+	tracker := trending.NewTracker(10)
+	shortenerService.Trending = tracker
+	grpcServer := &GRPCServer{Service: shortenerService, Log: logger}
+
+	_, err := grpcServer.Shorten(context.Background(), &urlshortener.ShortenRequest{Url: originalURL, Alias: "hot"})
+	assert.NoError(t, err)
+	for range 2 {
+		_, err = grpcServer.Resolve(context.Background(), &urlshortener.ResolveRequest{ShortUrl: "hot"})
+		assert.NoError(t, err)
+	}
+
+	tracker.Record(context.Background(), model.LinkKey{ShortURL: "cold"})
+	tracker.Record(context.Background(), model.LinkKey{Tenant: "acme", ShortURL: "warm"})
+
+	root := auth.Principal{Subject: "root", Scopes: []string{auth.ScopeSuperAdmin}}
+	ops := auth.Principal{Subject: "ops", Scopes: []string{auth.ScopeAdmin}}
+	newStream := func(p auth.Principal) *trendingStream {
+		ctx, cancel := context.WithCancel(auth.WithPrincipal(context.Background(), p))
+		return &trendingStream{ctx: ctx, cancel: cancel}
+	}
+
+	stream := newStream(ops)
+	err = grpcServer.WatchTrending(&urlshortener.WatchTrendingRequest{Window: "1h"}, stream)
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+
+	grpcServer.Trending = tracker
+	err = grpcServer.WatchTrending(&urlshortener.WatchTrendingRequest{Window: "1h", Limit: 1}, stream)
+	assert.NoError(t, err)
+	if assert.Len(t, stream.snapshots, 1) && assert.Len(t, stream.snapshots[0].GetWindows(), 1) {
+		window := stream.snapshots[0].GetWindows()[0]
+		assert.Equal(t, "1h", window.GetWindow())
+		if assert.Len(t, window.GetLinks(), 1) {
+			assert.Equal(t, "hot", window.GetLinks()[0].GetCode())
+			assert.Equal(t, "https://sho.rt/hot", window.GetLinks()[0].GetShortUrl())
+			assert.Equal(t, uint64(2), window.GetLinks()[0].GetCount())
+		}
+	}
+
+	// Links of other tenants are only streamed to a superadmin.
+	linkCodes := func(p auth.Principal) []string {
+		stream := newStream(p)
+		assert.NoError(t, grpcServer.WatchTrending(&urlshortener.WatchTrendingRequest{Window: "1h"}, stream))
+
+		var got []string
+		for _, link := range stream.snapshots[0].GetWindows()[0].GetLinks() {
+			got = append(got, link.GetCode())
+		}
+		return got
+	}
+	assert.Equal(t, []string{"hot", "cold"}, linkCodes(ops))
+	assert.Equal(t, []string{"warm"}, linkCodes(auth.Principal{Subject: "acme-ops", Tenant: "acme", Scopes: []string{auth.ScopeAdmin}}))
+	assert.Equal(t, []string{"hot", "cold", "warm"}, linkCodes(root))
+
+	err = grpcServer.WatchTrending(&urlshortener.WatchTrendingRequest{Window: "2h"}, newStream(root))
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err = grpcServer.WatchTrending(&urlshortener.WatchTrendingRequest{}, &trendingStream{ctx: ctx, cancel: cancel})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
@@ -19,8 +19,13 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	URLShortener_Shorten_FullMethodName = "/urlshortener.URLShortener/Shorten"
-	URLShortener_Resolve_FullMethodName = "/urlshortener.URLShortener/Resolve"
+	URLShortener_Shorten_FullMethodName       = "/urlshortener.URLShortener/Shorten"
+	URLShortener_Resolve_FullMethodName       = "/urlshortener.URLShortener/Resolve"
+	URLShortener_ListMyLinks_FullMethodName   = "/urlshortener.URLShortener/ListMyLinks"
+	URLShortener_UpdateLink_FullMethodName    = "/urlshortener.URLShortener/UpdateLink"
+	URLShortener_DeleteLink_FullMethodName    = "/urlshortener.URLShortener/DeleteLink"
+	URLShortener_GetLinkStats_FullMethodName  = "/urlshortener.URLShortener/GetLinkStats"
+	URLShortener_WatchTrending_FullMethodName = "/urlshortener.URLShortener/WatchTrending"
 )
 
 // URLShortenerClient is the client API for URLShortener service.
@@ -29,6 +34,17 @@ const (
 type URLShortenerClient interface {
 	Shorten(ctx context.Context, in *ShortenRequest, opts ...grpc.CallOption) (*ShortenResponse, error)
 	Resolve(ctx context.Context, in *ResolveRequest, opts ...grpc.CallOption) (*ResolveResponse, error)
+	// Lists the links created by the caller, newest first.
+	ListMyLinks(ctx context.Context, in *ListMyLinksRequest, opts ...grpc.CallOption) (*ListMyLinksResponse, error)
+	// Changes the destination of a link. Only its owner or an admin may.
+	UpdateLink(ctx context.Context, in *UpdateLinkRequest, opts ...grpc.CallOption) (*Link, error)
+	// Deletes a link. Only its owner or an admin may.
+	DeleteLink(ctx context.Context, in *DeleteLinkRequest, opts ...grpc.CallOption) (*DeleteLinkResponse, error)
+	// Returns click statistics of a link. Only its owner or an admin may.
+	GetLinkStats(ctx context.Context, in *GetLinkStatsRequest, opts ...grpc.CallOption) (*LinkStats, error)
+	// Streams the most resolved links of the last minute, 15 minutes and hour
+	// until the call is cancelled. Admin only.
+	WatchTrending(ctx context.Context, in *WatchTrendingRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TrendingSnapshot], error)
 }
 
 type uRLShortenerClient struct {
@@ -59,12 +75,82 @@ func (c *uRLShortenerClient) Resolve(ctx context.Context, in *ResolveRequest, op
 	return out, nil
 }
 
+func (c *uRLShortenerClient) ListMyLinks(ctx context.Context, in *ListMyLinksRequest, opts ...grpc.CallOption) (*ListMyLinksResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListMyLinksResponse)
+	err := c.cc.Invoke(ctx, URLShortener_ListMyLinks_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *uRLShortenerClient) UpdateLink(ctx context.Context, in *UpdateLinkRequest, opts ...grpc.CallOption) (*Link, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Link)
+	err := c.cc.Invoke(ctx, URLShortener_UpdateLink_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *uRLShortenerClient) DeleteLink(ctx context.Context, in *DeleteLinkRequest, opts ...grpc.CallOption) (*DeleteLinkResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteLinkResponse)
+	err := c.cc.Invoke(ctx, URLShortener_DeleteLink_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *uRLShortenerClient) GetLinkStats(ctx context.Context, in *GetLinkStatsRequest, opts ...grpc.CallOption) (*LinkStats, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(LinkStats)
+	err := c.cc.Invoke(ctx, URLShortener_GetLinkStats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *uRLShortenerClient) WatchTrending(ctx context.Context, in *WatchTrendingRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TrendingSnapshot], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &URLShortener_ServiceDesc.Streams[0], URLShortener_WatchTrending_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchTrendingRequest, TrendingSnapshot]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type URLShortener_WatchTrendingClient = grpc.ServerStreamingClient[TrendingSnapshot]
+
 // URLShortenerServer is the server API for URLShortener service.
 // All implementations must embed UnimplementedURLShortenerServer
 // for forward compatibility.
 type URLShortenerServer interface {
 	Shorten(context.Context, *ShortenRequest) (*ShortenResponse, error)
 	Resolve(context.Context, *ResolveRequest) (*ResolveResponse, error)
+	// Lists the links created by the caller, newest first.
+	ListMyLinks(context.Context, *ListMyLinksRequest) (*ListMyLinksResponse, error)
+	// Changes the destination of a link. Only its owner or an admin may.
+	UpdateLink(context.Context, *UpdateLinkRequest) (*Link, error)
+	// Deletes a link. Only its owner or an admin may.
+	DeleteLink(context.Context, *DeleteLinkRequest) (*DeleteLinkResponse, error)
+	// Returns click statistics of a link. Only its owner or an admin may.
+	GetLinkStats(context.Context, *GetLinkStatsRequest) (*LinkStats, error)
+	// Streams the most resolved links of the last minute, 15 minutes and hour
+	// until the call is cancelled. Admin only.
+	WatchTrending(*WatchTrendingRequest, grpc.ServerStreamingServer[TrendingSnapshot]) error
 	mustEmbedUnimplementedURLShortenerServer()
 }
 
@@ -81,6 +167,21 @@ func (UnimplementedURLShortenerServer) Shorten(context.Context, *ShortenRequest)
 func (UnimplementedURLShortenerServer) Resolve(context.Context, *ResolveRequest) (*ResolveResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Resolve not implemented")
 }
+func (UnimplementedURLShortenerServer) ListMyLinks(context.Context, *ListMyLinksRequest) (*ListMyLinksResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListMyLinks not implemented")
+}
+func (UnimplementedURLShortenerServer) UpdateLink(context.Context, *UpdateLinkRequest) (*Link, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateLink not implemented")
+}
+func (UnimplementedURLShortenerServer) DeleteLink(context.Context, *DeleteLinkRequest) (*DeleteLinkResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteLink not implemented")
+}
+func (UnimplementedURLShortenerServer) GetLinkStats(context.Context, *GetLinkStatsRequest) (*LinkStats, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetLinkStats not implemented")
+}
+func (UnimplementedURLShortenerServer) WatchTrending(*WatchTrendingRequest, grpc.ServerStreamingServer[TrendingSnapshot]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchTrending not implemented")
+}
 func (UnimplementedURLShortenerServer) mustEmbedUnimplementedURLShortenerServer() {}
 func (UnimplementedURLShortenerServer) testEmbeddedByValue()                      {}
 
@@ -138,6 +239,89 @@ func _URLShortener_Resolve_Handler(srv interface{}, ctx context.Context, dec fun
 	return interceptor(ctx, in, info, handler)
 }
 
+func _URLShortener_ListMyLinks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListMyLinksRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(URLShortenerServer).ListMyLinks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: URLShortener_ListMyLinks_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(URLShortenerServer).ListMyLinks(ctx, req.(*ListMyLinksRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _URLShortener_UpdateLink_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateLinkRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(URLShortenerServer).UpdateLink(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: URLShortener_UpdateLink_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(URLShortenerServer).UpdateLink(ctx, req.(*UpdateLinkRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _URLShortener_DeleteLink_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteLinkRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(URLShortenerServer).DeleteLink(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: URLShortener_DeleteLink_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(URLShortenerServer).DeleteLink(ctx, req.(*DeleteLinkRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _URLShortener_GetLinkStats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetLinkStatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(URLShortenerServer).GetLinkStats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: URLShortener_GetLinkStats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(URLShortenerServer).GetLinkStats(ctx, req.(*GetLinkStatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _URLShortener_WatchTrending_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchTrendingRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(URLShortenerServer).WatchTrending(m, &grpc.GenericServerStream[WatchTrendingRequest, TrendingSnapshot]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type URLShortener_WatchTrendingServer = grpc.ServerStreamingServer[TrendingSnapshot]
+
 // URLShortener_ServiceDesc is the grpc.ServiceDesc for URLShortener service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -153,7 +337,29 @@ var URLShortener_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Resolve",
 			Handler:    _URLShortener_Resolve_Handler,
 		},
+		{
+			MethodName: "ListMyLinks",
+			Handler:    _URLShortener_ListMyLinks_Handler,
+		},
+		{
+			MethodName: "UpdateLink",
+			Handler:    _URLShortener_UpdateLink_Handler,
+		},
+		{
+			MethodName: "DeleteLink",
+			Handler:    _URLShortener_DeleteLink_Handler,
+		},
+		{
+			MethodName: "GetLinkStats",
+			Handler:    _URLShortener_GetLinkStats_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchTrending",
+			Handler:       _URLShortener_WatchTrending_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "urlshortener.proto",
 }
@@ -0,0 +1,251 @@
+package apikeys
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+
+	"url-shortener/internal/auth"
+	"url-shortener/internal/model"
+	"url-shortener/internal/storage/errs"
+)
+
+type CreateRequest struct {
+	Name   string   `json:"name" validate:"required"`
+	Scopes []string `json:"scopes" validate:"required,min=1"`
+	// Tenant is the workspace the key acts for. Callers with the superadmin
+	// scope may name any tenant, empty being the default one; others only
+	// issue keys for their own tenant, which an empty tenant stands for.
+	Tenant string `json:"tenant,omitempty"`
+}
+
+type RotateRequest struct {
+	// Grace is how long the old key keeps working, e.g. "24h".
+	Grace string `json:"grace,omitempty"`
+}
+
+type Key struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	Tenant     string     `json:"tenant,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+type Response struct {
+	// Key is the plain-text key. It is only returned when a key is issued.
+	Key    string `json:"key,omitempty"`
+	APIKey *Key   `json:"api_key,omitempty"`
+	Keys   []Key  `json:"api_keys,omitempty"`
+	Error  string `json:"error,omitempty"`
+	Status string `json:"status"`
+}
+
+type Manager interface {
+	Create(name, tenant string, scopes []string) (string, model.APIKey, error)
+	List() ([]model.APIKey, error)
+	Rotate(id string, grace time.Duration) (string, model.APIKey, error)
+	Revoke(id string) error
+}
+
+// Register adds the key management routes to an admin route group.
+func Register(r gin.IRoutes, keys Manager, log *zap.Logger) {
+	log = log.With(zap.String("op", "api-keys"))
+
+	r.POST("/keys", create(keys, log))
+	r.GET("/keys", list(keys, log))
+	r.POST("/keys/:id/rotate", rotate(keys, log))
+	r.DELETE("/keys/:id", revoke(keys, log))
+}
+
+func create(keys Manager, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CreateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			log.Error("invalid request", zap.Error(err))
+			c.JSON(http.StatusBadRequest, Response{Error: "invalid request", Status: "Error"})
+			return
+		}
+
+		if err := validator.New().Struct(req); err != nil {
+			log.Error("validation failed", zap.Error(err))
+			c.JSON(http.StatusBadRequest, Response{Error: "name and at least one scope are required", Status: "Error"})
+			return
+		}
+
+		principal, ok := caller(c)
+		if !ok {
+			return
+		}
+		tenant, err := auth.TenantFor(principal, req.Tenant)
+		if err == nil {
+			err = auth.Covers(principal, req.Scopes)
+		}
+		if err != nil {
+			c.JSON(http.StatusForbidden, Response{Error: err.Error(), Status: "Error"})
+			return
+		}
+
+		plain, key, err := keys.Create(req.Name, tenant, req.Scopes)
+		if err != nil {
+			log.Error("failed to create API key", zap.Error(err))
+			c.JSON(statusFor(err), Response{Error: err.Error(), Status: "Error"})
+			return
+		}
+
+		log.Info("API key created", zap.String("id", key.ID), zap.String("tenant", key.Tenant), zap.Strings("scopes", key.Scopes))
+		c.JSON(http.StatusCreated, Response{Key: plain, APIKey: toKey(key), Status: "OK"})
+	}
+}
+
+func list(keys Manager, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := caller(c)
+		if !ok {
+			return
+		}
+
+		stored, err := keys.List()
+		if err != nil {
+			log.Error("failed to list API keys", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, Response{Error: err.Error(), Status: "Error"})
+			return
+		}
+
+		resp := Response{Keys: make([]Key, 0, len(stored)), Status: "OK"}
+		for _, key := range stored {
+			if auth.Manages(principal, key.Tenant) {
+				resp.Keys = append(resp.Keys, *toKey(key))
+			}
+		}
+
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+func rotate(keys Manager, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req RotateRequest
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				log.Error("invalid request", zap.Error(err))
+				c.JSON(http.StatusBadRequest, Response{Error: "invalid request", Status: "Error"})
+				return
+			}
+		}
+
+		var grace time.Duration
+		if req.Grace != "" {
+			var err error
+			if grace, err = time.ParseDuration(req.Grace); err != nil || grace < 0 {
+				c.JSON(http.StatusBadRequest, Response{Error: "invalid grace period", Status: "Error"})
+				return
+			}
+		}
+
+		principal, ok := caller(c)
+		if !ok {
+			return
+		}
+
+		err := owned(keys, principal, c.Param("id"))
+		var plain string
+		var key model.APIKey
+		if err == nil {
+			plain, key, err = keys.Rotate(c.Param("id"), grace)
+		}
+		if err != nil {
+			log.Error("failed to rotate API key", zap.String("id", c.Param("id")), zap.Error(err))
+			c.JSON(statusFor(err), Response{Error: err.Error(), Status: "Error"})
+			return
+		}
+
+		log.Info("API key rotated", zap.String("old", c.Param("id")), zap.String("new", key.ID))
+		c.JSON(http.StatusCreated, Response{Key: plain, APIKey: toKey(key), Status: "OK"})
+	}
+}
+
+func revoke(keys Manager, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := caller(c)
+		if !ok {
+			return
+		}
+
+		err := owned(keys, principal, c.Param("id"))
+		if err == nil {
+			err = keys.Revoke(c.Param("id"))
+		}
+		if err != nil {
+			log.Error("failed to revoke API key", zap.String("id", c.Param("id")), zap.Error(err))
+			c.JSON(statusFor(err), Response{Error: err.Error(), Status: "Error"})
+			return
+		}
+
+		log.Info("API key revoked", zap.String("id", c.Param("id")))
+		c.JSON(http.StatusOK, Response{Status: "OK"})
+	}
+}
+
+// caller returns the principal of the request, or responds with 401 if there
+// is none: keys are managed on behalf of the caller.
+func caller(c *gin.Context) (auth.Principal, bool) {
+	principal, ok := auth.FromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, Response{Error: auth.ErrMissingCredentials.Error(), Status: "Error"})
+	}
+
+	return principal, ok
+}
+
+// owned returns errs.ErrAPIKeyIsNotExist unless the principal manages the key
+// with id, so keys of other tenants look like missing ones, and an error
+// wrapping auth.ErrForbidden unless it holds every scope of the key: rotating
+// a key hands out its scopes, and revoking it locks out a stronger caller.
+func owned(keys Manager, principal auth.Principal, id string) error {
+	stored, err := keys.List()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range stored {
+		if key.ID == id && auth.Manages(principal, key.Tenant) {
+			return auth.Covers(principal, key.Scopes)
+		}
+	}
+
+	return errs.ErrAPIKeyIsNotExist
+}
+
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, auth.ErrUnknownScope):
+		return http.StatusBadRequest
+	case errors.Is(err, auth.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, errs.ErrAPIKeyIsNotExist):
+		return http.StatusNotFound
+	case errors.Is(err, auth.ErrKeyRevoked):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func toKey(key model.APIKey) *Key {
+	k := &Key{ID: key.ID, Name: key.Name, Scopes: key.Scopes, Tenant: key.Tenant, CreatedAt: key.CreatedAt}
+	if !key.LastUsedAt.IsZero() {
+		k.LastUsedAt = &key.LastUsedAt
+	}
+	if !key.RevokedAt.IsZero() {
+		k.RevokedAt = &key.RevokedAt
+	}
+
+	return k
+}
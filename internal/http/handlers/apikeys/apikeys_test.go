@@ -0,0 +1,138 @@
+package apikeys
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"url-shortener/internal/auth"
+	"url-shortener/internal/storage/memory"
+)
+
+func do(r http.Handler, method, path, body string) (int, Response) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	var resp Response
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+
+	return w.Code, resp
+}
+
+// as authenticates every request as p.
+func as(p auth.Principal) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(auth.WithPrincipal(c.Request.Context(), p))
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	keys := auth.NewKeys(memory.NewStorageInMemory(logger), logger)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	Register(r.Group("/admin", as(auth.Principal{Subject: "key:boot", Scopes: []string{auth.ScopeAdmin}})), keys, logger)
+	r.GET("/:code", func(c *gin.Context) { c.Status(http.StatusFound) })
+
+	code, resp := do(r, http.MethodPost, "/admin/keys", `{"name":"ci","scopes":["links:create"]}`)
+	require.Equal(t, http.StatusCreated, code)
+	require.NotNil(t, resp.APIKey)
+	assert.NotEmpty(t, resp.Key)
+	id := resp.APIKey.ID
+
+	code, _ = do(r, http.MethodPost, "/admin/keys", `{"name":"ci","scopes":["root"]}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = do(r, http.MethodPost, "/admin/keys", `{"name":"ci"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = do(r, http.MethodPost, "/admin/keys", `{"name":"ci","scopes":["superadmin"]}`)
+	assert.Equal(t, http.StatusForbidden, code, "admin does not include superadmin")
+
+	code, resp = do(r, http.MethodPost, "/admin/keys/"+id+"/rotate", `{"grace":"1h"}`)
+	require.Equal(t, http.StatusCreated, code)
+	assert.NotEqual(t, id, resp.APIKey.ID)
+
+	code, resp = do(r, http.MethodGet, "/admin/keys", "")
+	assert.Equal(t, http.StatusOK, code)
+	if assert.Len(t, resp.Keys, 2) {
+		assert.NotNil(t, resp.Keys[0].RevokedAt)
+		assert.Nil(t, resp.Keys[1].RevokedAt)
+	}
+
+	code, _ = do(r, http.MethodDelete, "/admin/keys/"+resp.Keys[1].ID, "")
+	assert.Equal(t, http.StatusOK, code)
+
+	code, _ = do(r, http.MethodDelete, "/admin/keys/missing", "")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, _ = do(r, http.MethodGet, "/promo", "")
+	assert.Equal(t, http.StatusFound, code, "short codes still resolve next to /admin")
+}
+
+func TestAPIKeys_BoundToCaller(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	keys := auth.NewKeys(memory.NewStorageInMemory(logger), logger)
+	_, other, err := keys.Create("globex", "globex", []string{auth.ScopeLinksRead})
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	Register(r.Group("/acme", as(auth.Principal{Subject: "key:acme", Tenant: "acme", Scopes: []string{auth.ScopeLinksCreate, auth.ScopeLinksRead}})), keys, logger)
+	Register(r.Group("/anonymous"), keys, logger)
+
+	code, resp := do(r, http.MethodPost, "/acme/keys", `{"name":"ci","scopes":["links:create"]}`)
+	require.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, "acme", resp.APIKey.Tenant, "keys are issued for the tenant of the caller")
+
+	code, _ = do(r, http.MethodPost, "/acme/keys", `{"name":"ci","scopes":["links:create"],"tenant":"globex"}`)
+	assert.Equal(t, http.StatusForbidden, code)
+
+	code, _ = do(r, http.MethodPost, "/acme/keys", `{"name":"ci","scopes":["links:create","admin"]}`)
+	assert.Equal(t, http.StatusForbidden, code, "scopes the caller lacks are not granted")
+
+	code, resp = do(r, http.MethodGet, "/acme/keys", "")
+	assert.Equal(t, http.StatusOK, code)
+	if assert.Len(t, resp.Keys, 1) {
+		assert.Equal(t, "acme", resp.Keys[0].Tenant)
+	}
+
+	code, _ = do(r, http.MethodPost, "/acme/keys/"+other.ID+"/rotate", "")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, _ = do(r, http.MethodDelete, "/acme/keys/"+other.ID, "")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	Register(r.Group("/root", as(auth.Principal{Subject: "key:root", Scopes: []string{auth.ScopeSuperAdmin}})), keys, logger)
+	code, resp = do(r, http.MethodPost, "/root/keys", `{"name":"ci","scopes":["links:read"],"tenant":"globex"}`)
+	require.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, "globex", resp.APIKey.Tenant, "a superadmin issues keys for any tenant")
+
+	code, resp = do(r, http.MethodGet, "/root/keys", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, resp.Keys, 3)
+
+	_, root, err := keys.Create("root", "acme", []string{auth.ScopeSuperAdmin})
+	require.NoError(t, err)
+	Register(r.Group("/acme-admin", as(auth.Principal{Subject: "key:admin", Tenant: "acme", Scopes: []string{auth.ScopeAdmin}})), keys, logger)
+
+	code, resp = do(r, http.MethodPost, "/acme-admin/keys/"+root.ID+"/rotate", "")
+	assert.Equal(t, http.StatusForbidden, code, "rotating would hand an admin superadmin")
+	assert.Empty(t, resp.Key)
+
+	code, _ = do(r, http.MethodDelete, "/acme-admin/keys/"+root.ID, "")
+	assert.Equal(t, http.StatusForbidden, code)
+
+	code, _ = do(r, http.MethodPost, "/anonymous/keys", `{"name":"ci","scopes":["links:create"]}`)
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
@@ -0,0 +1,188 @@
+package audit
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	auditlog "url-shortener/internal/audit"
+	"url-shortener/internal/auth"
+	"url-shortener/internal/model"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+type Entry struct {
+	ID        int64           `json:"id"`
+	At        time.Time       `json:"at"`
+	Actor     string          `json:"actor,omitempty"`
+	Tenant    string          `json:"tenant,omitempty"`
+	Action    string          `json:"action"`
+	Target    string          `json:"target,omitempty"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	RequestID string          `json:"request_id,omitempty"`
+	IP        string          `json:"ip,omitempty"`
+	PrevHash  string          `json:"prev_hash,omitempty"`
+	Hash      string          `json:"hash,omitempty"`
+}
+
+type Verification struct {
+	Entries int    `json:"entries"`
+	Head    string `json:"head,omitempty"`
+	// BrokenAt is the ID of the entry where the hash chain breaks.
+	BrokenAt int64 `json:"broken_at,omitempty"`
+	// AnchorMissing is set if no entry has the head given to verify against.
+	AnchorMissing bool `json:"anchor_missing,omitempty"`
+}
+
+type Response struct {
+	Entries []Entry `json:"entries,omitempty"`
+	// Next is the cursor of the following, older page; empty on the last
+	// page.
+	Next         string        `json:"next,omitempty"`
+	Verification *Verification `json:"verification,omitempty"`
+	Error        string        `json:"error,omitempty"`
+	Status       string        `json:"status"`
+}
+
+type Log interface {
+	Query(q model.AuditQuery, limit int) ([]model.AuditEntry, error)
+	Verify(anchor string) (auditlog.Verification, error)
+}
+
+// Register adds the audit log routes to an admin route group. Callers see
+// the entries of their own tenant; only a superadmin may name another tenant,
+// or none to see every tenant, and verify the chain, which spans all tenants.
+func Register(r gin.IRoutes, log Log, logger *zap.Logger) {
+	logger = logger.With(zap.String("op", "audit"))
+
+	r.GET("/audit", list(log, logger))
+	r.GET("/audit/verify", verify(log, logger))
+}
+
+func list(log Log, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := auth.FromContext(c.Request.Context())
+		if !ok {
+			c.JSON(http.StatusUnauthorized, Response{Error: auth.ErrMissingCredentials.Error(), Status: "Error"})
+			return
+		}
+
+		q, limit, err := parseQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, Response{Error: err.Error(), Status: "Error"})
+			return
+		}
+
+		tenant, named := c.GetQuery("tenant")
+		if named || !principal.HasScope(auth.ScopeSuperAdmin) {
+			if tenant, err = auth.TenantFor(principal, tenant); err != nil {
+				c.JSON(http.StatusForbidden, Response{Error: err.Error(), Status: "Error"})
+				return
+			}
+			q.Tenants = []string{tenant}
+		}
+
+		// One extra entry tells whether there is a next page.
+		entries, err := log.Query(q, limit+1)
+		if err != nil {
+			logger.Error("failed to query audit log", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, Response{Error: err.Error(), Status: "Error"})
+			return
+		}
+
+		resp := Response{Status: "OK"}
+		if len(entries) > limit {
+			entries = entries[:limit]
+			resp.Next = strconv.FormatInt(entries[limit-1].ID, 10)
+		}
+		resp.Entries = make([]Entry, 0, len(entries))
+		for _, e := range entries {
+			resp.Entries = append(resp.Entries, Entry(e))
+		}
+
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+func verify(log Log, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := auth.FromContext(c.Request.Context())
+		if !ok || !principal.HasScope(auth.ScopeSuperAdmin) {
+			c.JSON(http.StatusForbidden, Response{Error: auth.ErrForbidden.Error(), Status: "Error"})
+			return
+		}
+
+		v, err := log.Verify(c.Query("head"))
+		if err != nil {
+			logger.Error("failed to verify audit log", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, Response{Error: err.Error(), Status: "Error"})
+			return
+		}
+
+		resp := Response{Verification: &Verification{Entries: v.Entries, Head: v.Head, BrokenAt: v.BrokenAt,
+			AnchorMissing: v.AnchorMissing}, Status: "OK"}
+		switch {
+		case v.BrokenAt != 0:
+			logger.Warn("audit log hash chain is broken", zap.Int64("id", v.BrokenAt))
+			resp.Error, resp.Status = "hash chain is broken", "Error"
+			c.JSON(http.StatusConflict, resp)
+			return
+		case v.AnchorMissing:
+			logger.Warn("audit log lost the entry of the anchored head", zap.String("head", c.Query("head")))
+			resp.Error, resp.Status = "no entry has the given head", "Error"
+			c.JSON(http.StatusConflict, resp)
+			return
+		}
+
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+func parseQuery(c *gin.Context) (model.AuditQuery, int, error) {
+	q := model.AuditQuery{
+		Actor:     c.Query("actor"),
+		Action:    c.Query("action"),
+		Target:    c.Query("target"),
+		RequestID: c.Query("request_id"),
+	}
+	var err error
+
+	if raw := c.Query("from"); raw != "" {
+		if q.From, err = time.Parse(time.RFC3339, raw); err != nil {
+			return q, 0, errors.New("invalid from")
+		}
+	}
+
+	if raw := c.Query("to"); raw != "" {
+		if q.To, err = time.Parse(time.RFC3339, raw); err != nil {
+			return q, 0, errors.New("invalid to")
+		}
+	}
+
+	if raw := c.Query("cursor"); raw != "" {
+		if q.BeforeID, err = strconv.ParseInt(raw, 10, 64); err != nil || q.BeforeID <= 0 {
+			return q, 0, errors.New("invalid cursor")
+		}
+	}
+
+	limit := defaultLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n <= 0 {
+			return q, 0, errors.New("invalid limit")
+		}
+		limit = min(n, maxLimit)
+	}
+
+	return q, limit, nil
+}
@@ -0,0 +1,125 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	auditlog "url-shortener/internal/audit"
+	"url-shortener/internal/auth"
+	"url-shortener/internal/config"
+	"url-shortener/internal/model"
+)
+
+func do(r http.Handler, path string) (int, Response) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, path, nil)
+	r.ServeHTTP(w, req)
+
+	var resp Response
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+
+	return w.Code, resp
+}
+
+// as authenticates every request as p.
+func as(p auth.Principal) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(auth.WithPrincipal(c.Request.Context(), p))
+	}
+}
+
+func TestAudit(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	path := filepath.Join(t.TempDir(), "audit.ndjson")
+	store, err := auditlog.OpenFile(path)
+	require.NoError(t, err)
+	defer func() { _ = store.Close() }()
+	log := auditlog.New(store, config.AuditConfig{HashChain: true}, logger)
+
+	for _, actor := range []string{"alice", "bob", "alice"} {
+		ctx := auth.WithPrincipal(context.Background(), auth.Principal{Subject: actor, Tenant: "acme"})
+		log.Record(ctx, model.EventLinkDeleted, "promo", model.Link{ShortURL: "promo", URL: "https://acme.com"}, nil)
+	}
+	globex := auth.WithPrincipal(context.Background(), auth.Principal{Subject: "carol", Tenant: "globex"})
+	log.Record(globex, model.EventLinkCreated, "sale", nil, model.Link{ShortURL: "sale", URL: "https://globex.com"})
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	Register(r.Group("/admin", as(auth.Principal{Subject: "key:root", Scopes: []string{auth.ScopeSuperAdmin}})), log, logger)
+	Register(r.Group("/acme", as(auth.Principal{Subject: "key:acme", Tenant: "acme", Scopes: []string{auth.ScopeAdmin}})), log, logger)
+
+	code, resp := do(r, "/admin/audit?actor=alice&limit=1")
+	assert.Equal(t, http.StatusOK, code)
+	require.Len(t, resp.Entries, 1)
+	assert.Equal(t, int64(3), resp.Entries[0].ID)
+	assert.JSONEq(t, `{"code":"promo","url":"https://acme.com","created_at":"0001-01-01T00:00:00Z"}`,
+		string(resp.Entries[0].Before))
+	assert.Equal(t, "3", resp.Next)
+
+	code, resp = do(r, "/admin/audit?actor=alice&limit=1&cursor="+resp.Next)
+	assert.Equal(t, http.StatusOK, code)
+	require.Len(t, resp.Entries, 1)
+	assert.Equal(t, int64(1), resp.Entries[0].ID)
+	assert.Empty(t, resp.Next)
+
+	code, resp = do(r, "/admin/audit?tenant=acme&action=link.deleted&target=promo&from=2020-01-01T00:00:00Z")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, resp.Entries, 3)
+
+	code, resp = do(r, "/admin/audit")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, resp.Entries, 4, "a superadmin sees every tenant")
+
+	code, resp = do(r, "/acme/audit")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, resp.Entries, 3)
+	for _, e := range resp.Entries {
+		assert.Equal(t, "acme", e.Tenant)
+	}
+
+	code, _ = do(r, "/acme/audit?tenant=globex")
+	assert.Equal(t, http.StatusForbidden, code)
+
+	code, _ = do(r, "/acme/audit/verify")
+	assert.Equal(t, http.StatusForbidden, code, "the chain spans every tenant")
+
+	for _, query := range []string{"from=yesterday", "to=1", "cursor=x", "cursor=-1", "limit=0"} {
+		code, _ = do(r, "/admin/audit?"+query)
+		assert.Equal(t, http.StatusBadRequest, code, query)
+	}
+
+	code, resp = do(r, "/admin/audit/verify")
+	assert.Equal(t, http.StatusOK, code)
+	require.NotNil(t, resp.Verification)
+	assert.Equal(t, 4, resp.Verification.Entries)
+	assert.NotEmpty(t, resp.Verification.Head)
+	head := resp.Verification.Head
+
+	code, resp = do(r, "/admin/audit/verify?head="+head)
+	assert.Equal(t, http.StatusOK, code)
+	assert.False(t, resp.Verification.AnchorMissing)
+
+	code, resp = do(r, "/admin/audit/verify?head=0badc0de")
+	assert.Equal(t, http.StatusConflict, code)
+	assert.True(t, resp.Verification.AnchorMissing)
+
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, []byte(strings.Replace(string(raw), `"actor":"bob"`, `"actor":"eve"`, 1)), 0o600))
+
+	code, resp = do(r, "/admin/audit/verify")
+	assert.Equal(t, http.StatusConflict, code)
+	require.NotNil(t, resp.Verification)
+	assert.Equal(t, int64(2), resp.Verification.BrokenAt)
+}
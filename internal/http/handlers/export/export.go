@@ -0,0 +1,157 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"url-shortener/internal/auth"
+	exp "url-shortener/internal/export"
+	"url-shortener/internal/model"
+)
+
+// CursorTrailer is the HTTP trailer carrying the cursor that resumes an
+// export after its last row, also when the export broke off.
+const CursorTrailer = "X-Export-Cursor"
+
+type Response struct {
+	Error  string `json:"error,omitempty"`
+	Status string `json:"status"`
+}
+
+type Exporter interface {
+	Export(ctx context.Context, w io.Writer, req exp.Request) (exp.Result, error)
+}
+
+// New streams clicks or rollups of the tenant of the caller as a file; only a
+// caller with the superadmin scope may name another tenant, or none to export
+// every tenant. Query parameters: source ("clicks", "hourly" or "daily"),
+// format ("csv" or "parquet"), gzip, from and to as RFC 3339 timestamps,
+// tenant, code (repeated) with the domain of those codes, cursor and limit.
+//
+// The server write timeout applies to every write instead of the whole
+// response, as exports may take longer than any request.
+func New(exporter Exporter, timeout time.Duration, log *zap.Logger) gin.HandlerFunc {
+	log = log.With(zap.String("op", "export"))
+
+	return func(c *gin.Context) {
+		principal, ok := auth.FromContext(c.Request.Context())
+		if !ok {
+			c.JSON(http.StatusUnauthorized, Response{Error: auth.ErrMissingCredentials.Error(), Status: "Error"})
+			return
+		}
+
+		// Without a tenant, a superadmin exports every tenant.
+		tenant, named := c.GetQuery("tenant")
+		if named || !principal.HasScope(auth.ScopeSuperAdmin) {
+			var err error
+			if tenant, err = auth.TenantFor(principal, tenant); err != nil {
+				c.JSON(http.StatusForbidden, Response{Error: err.Error(), Status: "Error"})
+				return
+			}
+			named = true
+		}
+
+		req, err := parseRequest(c, tenant)
+		if named {
+			req.Query.Tenants = []string{tenant}
+		}
+		if err == nil {
+			req, err = req.Normalize(time.Now().UTC())
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, Response{Error: err.Error(), Status: "Error"})
+			return
+		}
+
+		c.Header("Content-Type", req.ContentType())
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": req.FileName()}))
+		c.Header("Trailer", CursorTrailer)
+
+		w := &deadlineWriter{w: c.Writer, rc: http.NewResponseController(c.Writer), timeout: timeout}
+		result, err := exporter.Export(c.Request.Context(), w, req)
+		if err != nil {
+			log.Error("failed to export", zap.String("source", req.Source), zap.Int64("rows", result.Rows),
+				zap.String("cursor", result.Cursor), zap.Error(err))
+
+			if !c.Writer.Written() {
+				c.Header("Content-Disposition", "")
+				c.Header("Content-Type", "")
+				c.Header("Trailer", "")
+				c.JSON(http.StatusInternalServerError, Response{Error: "export failed", Status: "Error"})
+				return
+			}
+		}
+
+		c.Writer.Header().Set(CursorTrailer, result.Cursor)
+	}
+}
+
+// parseRequest reads the export request, taking the links of code from
+// tenant.
+func parseRequest(c *gin.Context, tenant string) (exp.Request, error) {
+	req := exp.Request{
+		Source: c.Query("source"),
+		Format: c.Query("format"),
+		Cursor: c.Query("cursor"),
+	}
+	var err error
+
+	if raw := c.Query("gzip"); raw != "" {
+		if req.Gzip, err = strconv.ParseBool(raw); err != nil {
+			return req, errors.New("invalid gzip")
+		}
+	}
+
+	if raw := c.Query("from"); raw != "" {
+		if req.Query.From, err = time.Parse(time.RFC3339, raw); err != nil {
+			return req, errors.New("invalid from")
+		}
+	}
+
+	if raw := c.Query("to"); raw != "" {
+		if req.Query.To, err = time.Parse(time.RFC3339, raw); err != nil {
+			return req, errors.New("invalid to")
+		}
+	}
+
+	if raw := c.Query("limit"); raw != "" {
+		if req.Limit, err = strconv.Atoi(raw); err != nil || req.Limit < 1 {
+			return req, errors.New("invalid limit")
+		}
+	}
+
+	for _, code := range c.QueryArray("code") {
+		req.Query.Links = append(req.Query.Links, model.LinkKey{
+			Tenant:   tenant,
+			Domain:   c.Query("domain"),
+			ShortURL: code,
+		})
+	}
+
+	return req, nil
+}
+
+// deadlineWriter moves the write deadline of the response timeout ahead of
+// every write, so that only a stalled client runs into it.
+type deadlineWriter struct {
+	w       io.Writer
+	rc      *http.ResponseController
+	timeout time.Duration
+}
+
+func (d *deadlineWriter) Write(p []byte) (int, error) {
+	if d.timeout > 0 {
+		// Recorders in tests do not support deadlines; there is none to move.
+		_ = d.rc.SetWriteDeadline(time.Now().Add(d.timeout))
+	}
+
+	return d.w.Write(p)
+}
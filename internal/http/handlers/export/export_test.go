@@ -0,0 +1,123 @@
+package export
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"url-shortener/internal/auth"
+	exp "url-shortener/internal/export"
+	"url-shortener/internal/model"
+	"url-shortener/internal/storage/memory"
+)
+
+type failingStore struct {
+	memory.StorageInMemory
+}
+
+func (*failingStore) ExportClicks(model.ExportQuery, model.Click, int) ([]model.Click, error) {
+	return nil, errors.New("connection refused")
+}
+
+// as authenticates every request as p.
+func as(p auth.Principal) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(auth.WithPrincipal(c.Request.Context(), p))
+	}
+}
+
+func TestExport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := zaptest.NewLogger(t)
+
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	store := memory.NewStorageInMemory(logger)
+	require.NoError(t, store.PutClicks([]model.Click{
+		{Tenant: "acme", ShortURL: "promo", At: start, Class: model.ClassHuman},
+		{ShortURL: "promo", At: start.Add(time.Minute), Class: model.ClassHuman},
+		{Tenant: "acme", ShortURL: "docs", At: start.Add(2 * time.Minute), Class: model.ClassBot},
+		{Tenant: "acme", ShortURL: "promo", At: start.Add(3 * time.Minute), Class: model.ClassHuman},
+	}))
+
+	r := gin.New()
+	super := as(auth.Principal{Subject: "key:root", Scopes: []string{auth.ScopeSuperAdmin}})
+	r.GET("/admin/export", super, New(exp.New(store, logger), time.Second, logger))
+	r.GET("/failing/export", super, New(exp.New(&failingStore{}, logger), time.Second, logger))
+	r.GET("/acme/export", as(auth.Principal{Subject: "key:acme", Tenant: "acme", Scopes: []string{auth.ScopeAdmin}}),
+		New(exp.New(store, logger), time.Second, logger))
+	r.GET("/anonymous/export", New(exp.New(store, logger), time.Second, logger))
+
+	get := func(path string) *http.Response {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		r.ServeHTTP(w, req)
+
+		return w.Result()
+	}
+
+	resp := get("/admin/export?from=2026-03-01T00:00:00Z&to=2026-03-02T00:00:00Z&tenant=acme&code=promo&code=docs&limit=2")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/csv; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Equal(t, `attachment; filename=clicks-20260301T000000Z-20260302T000000Z.csv`,
+		resp.Header.Get("Content-Disposition"))
+
+	records, err := csv.NewReader(resp.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, "promo", records[1][3])
+	assert.Equal(t, "docs", records[2][3])
+	assert.Equal(t, records[2][15], resp.Trailer.Get(CursorTrailer))
+
+	resp = get("/admin/export?from=2026-03-01T00:00:00Z&to=2026-03-02T00:00:00Z&tenant=acme&code=promo&code=docs" +
+		"&cursor=" + records[2][15])
+	records, err = csv.NewReader(resp.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, "2026-03-01T00:03:00Z", records[1][4])
+
+	resp = get("/admin/export?format=parquet&gzip=true")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/vnd.apache.parquet", resp.Header.Get("Content-Type"))
+	body, _ := io.ReadAll(resp.Body)
+	assert.True(t, strings.HasPrefix(string(body), "PAR1"))
+
+	for _, query := range []string{"source=links", "format=json", "gzip=maybe", "from=yesterday", "limit=0",
+		"cursor=abc", "from=2026-03-02T00:00:00Z&to=2026-03-01T00:00:00Z"} {
+		resp = get("/admin/export?" + query)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+	}
+
+	resp = get("/admin/export?from=2026-03-01T00:00:00Z&to=2026-03-02T00:00:00Z")
+	records, err = csv.NewReader(resp.Body).ReadAll()
+	require.NoError(t, err)
+	assert.Len(t, records, 5, "a superadmin exports every tenant")
+
+	resp = get("/acme/export?from=2026-03-01T00:00:00Z&to=2026-03-02T00:00:00Z")
+	records, err = csv.NewReader(resp.Body).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 4, "an admin exports their own tenant")
+	for _, record := range records[1:] {
+		assert.Equal(t, "acme", record[1])
+	}
+
+	resp = get("/acme/export?tenant=globex&code=promo")
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp = get("/anonymous/export")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp = get("/failing/export")
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, "application/json; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Empty(t, resp.Header.Get("Content-Disposition"))
+}
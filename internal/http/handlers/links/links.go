@@ -0,0 +1,160 @@
+package links
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+
+	"url-shortener/internal/auth"
+	"url-shortener/internal/domain"
+	"url-shortener/internal/model"
+	"url-shortener/internal/normalize"
+	"url-shortener/internal/policy"
+	svc "url-shortener/internal/service"
+	"url-shortener/internal/threat"
+)
+
+type UpdateRequest struct {
+	URL string `json:"url" validate:"required,url"`
+}
+
+type Link struct {
+	Code string `json:"code"`
+	// ShortURL is the fully qualified short URL.
+	ShortURL  string    `json:"short_url"`
+	Domain    string    `json:"domain,omitempty"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Response struct {
+	Link   *Link  `json:"link,omitempty"`
+	Links  []Link `json:"links,omitempty"`
+	Next   string `json:"next,omitempty"`
+	Error  string `json:"error,omitempty"`
+	Status string `json:"status"`
+}
+
+type Lister interface {
+	ListMine(ctx context.Context, after string, limit int) (svc.LinkPage, error)
+	LinkURL(ctx context.Context, link model.Link) string
+}
+
+type Updater interface {
+	Update(ctx context.Context, code, url string) (model.Link, error)
+	LinkURL(ctx context.Context, link model.Link) string
+}
+
+type Deleter interface {
+	Delete(ctx context.Context, code string) error
+}
+
+// NewList returns the caller's links. Query parameters: limit and after, the
+// next cursor of the previous page.
+func NewList(service Lister, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		log := log.With(zap.String("op", "list-links"))
+
+		limit := 0
+		if raw := c.Query("limit"); raw != "" {
+			var err error
+			if limit, err = strconv.Atoi(raw); err != nil || limit < 1 {
+				c.JSON(http.StatusBadRequest, Response{Error: "invalid limit", Status: "Error"})
+				return
+			}
+		}
+
+		page, err := service.ListMine(c.Request.Context(), c.Query("after"), limit)
+		if err != nil {
+			log.Error("failed to list links", zap.Error(err))
+			c.JSON(statusFor(err), Response{Error: err.Error(), Status: "Error"})
+			return
+		}
+
+		resp := Response{Links: make([]Link, 0, len(page.Links)), Next: page.Next, Status: "OK"}
+		for _, link := range page.Links {
+			resp.Links = append(resp.Links, toLink(link, service.LinkURL(c.Request.Context(), link)))
+		}
+
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+func NewUpdate(service Updater, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		log := log.With(zap.String("op", "update-link"), zap.String("code", c.Param("code")))
+
+		var req UpdateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			log.Error("invalid request", zap.Error(err))
+			c.JSON(http.StatusBadRequest, Response{Error: "invalid request", Status: "Error"})
+			return
+		}
+
+		if err := validator.New().Struct(req); err != nil {
+			log.Error("validation failed", zap.Error(err))
+			c.JSON(http.StatusBadRequest, Response{Error: "invalid URL format", Status: "Error"})
+			return
+		}
+
+		link, err := service.Update(onDomain(c), c.Param("code"), req.URL)
+		if err != nil {
+			log.Error("failed to update link", zap.Error(err))
+			c.JSON(statusFor(err), Response{Error: err.Error(), Status: "Error"})
+			return
+		}
+
+		updated := toLink(link, service.LinkURL(c.Request.Context(), link))
+		c.JSON(http.StatusOK, Response{Link: &updated, Status: "OK"})
+	}
+}
+
+func NewDelete(service Deleter, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		log := log.With(zap.String("op", "delete-link"), zap.String("code", c.Param("code")))
+
+		if err := service.Delete(onDomain(c), c.Param("code")); err != nil {
+			log.Error("failed to delete link", zap.Error(err))
+			c.JSON(statusFor(err), Response{Error: err.Error(), Status: "Error"})
+			return
+		}
+
+		c.JSON(http.StatusOK, Response{Status: "OK"})
+	}
+}
+
+// onDomain returns the request context with the short domain named by the
+// domain query parameter, if any.
+func onDomain(c *gin.Context) context.Context {
+	if host := c.Query("domain"); host != "" {
+		return domain.WithDomain(c.Request.Context(), host)
+	}
+
+	return c.Request.Context()
+}
+
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, auth.ErrMissingCredentials):
+		return http.StatusUnauthorized
+	case errors.Is(err, svc.ErrNotOwner):
+		return http.StatusForbidden
+	case errors.Is(err, svc.ErrLinkNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, policy.ErrForbiddenDestination), errors.Is(err, normalize.ErrInvalidURL),
+		errors.Is(err, threat.ErrMalicious), errors.Is(err, domain.ErrUnknownDomain):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func toLink(link model.Link, shortURL string) Link {
+	return Link{Code: link.ShortURL, ShortURL: shortURL, Domain: link.Domain, URL: link.URL, CreatedAt: link.CreatedAt}
+}
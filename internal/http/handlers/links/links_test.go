@@ -0,0 +1,103 @@
+package links
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"url-shortener/internal/auth"
+	"url-shortener/internal/domain"
+	"url-shortener/internal/service"
+	"url-shortener/internal/storage/memory"
+)
+
+func newRouter(shortener *service.Shortener, t *testing.T) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	log := zaptest.NewLogger(t)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Request = c.Request.WithContext(domain.WithOrigin(c.Request.Context(), "https://sho.rt"))
+		if user := c.GetHeader("X-User"); user != "" {
+			c.Request = c.Request.WithContext(auth.WithPrincipal(c.Request.Context(), auth.Principal{Subject: user}))
+		}
+	})
+	r.GET("/links", NewList(shortener, log))
+	r.PATCH("/links/:code", NewUpdate(shortener, log))
+	r.DELETE("/links/:code", NewDelete(shortener, log))
+
+	return r
+}
+
+func do(r http.Handler, method, path, user, body string) (int, Response) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	if user != "" {
+		req.Header.Set("X-User", user)
+	}
+	r.ServeHTTP(w, req)
+
+	var resp Response
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+
+	return w.Code, resp
+}
+
+func TestLinks(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	shortener := service.NewShortener(memory.NewStorageInMemory(logger), logger)
+	r := newRouter(shortener, t)
+
+	alice := auth.WithPrincipal(context.Background(), auth.Principal{Subject: "alice"})
+	for _, alias := range []string{"first", "second", "third"} {
+		_, err := shortener.ShortenContext(alice, "https://example.com/"+alias, alias)
+		require.NoError(t, err)
+	}
+
+	code, resp := do(r, http.MethodGet, "/links?limit=2", "alice", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, resp.Links, 2)
+	assert.NotEmpty(t, resp.Next)
+
+	code, resp = do(r, http.MethodGet, "/links?limit=2&after="+resp.Next, "alice", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, resp.Links, 1)
+	assert.Empty(t, resp.Next)
+
+	code, _ = do(r, http.MethodGet, "/links", "", "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, _ = do(r, http.MethodGet, "/links?limit=zero", "alice", "")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = do(r, http.MethodPatch, "/links/first", "bob", `{"url":"https://bob.com"}`)
+	assert.Equal(t, http.StatusForbidden, code)
+
+	code, resp = do(r, http.MethodPatch, "/links/first", "alice", `{"url":"https://alice.com"}`)
+	assert.Equal(t, http.StatusOK, code)
+	if assert.NotNil(t, resp.Link) {
+		assert.Equal(t, "https://alice.com", resp.Link.URL)
+		assert.Equal(t, "first", resp.Link.Code)
+		assert.Equal(t, "https://sho.rt/first", resp.Link.ShortURL)
+	}
+
+	code, _ = do(r, http.MethodPatch, "/links/first", "alice", `{"url":"not a url"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = do(r, http.MethodDelete, "/links/first", "bob", "")
+	assert.Equal(t, http.StatusForbidden, code)
+
+	code, _ = do(r, http.MethodDelete, "/links/first", "alice", "")
+	assert.Equal(t, http.StatusOK, code)
+
+	code, _ = do(r, http.MethodDelete, "/links/first", "alice", "")
+	assert.Equal(t, http.StatusNotFound, code)
+}
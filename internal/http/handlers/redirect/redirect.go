@@ -0,0 +1,63 @@
+package redirect
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	svc "url-shortener/internal/service"
+)
+
+var warningPage = template.Must(template.New("warning").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="robots" content="noindex"><title>Warning: suspected {{.Threat}}</title></head>
+<body>
+<h1>This link may be unsafe</h1>
+<p>The destination has been reported as <strong>{{.Threat}}</strong>. Visiting it may put your data or device at risk.</p>
+<p>Destination: <code>{{.URL}}</code></p>
+<p><a href="{{.URL}}" rel="noopener noreferrer nofollow">Continue anyway</a></p>
+</body>
+</html>
+`))
+
+type Resolver interface {
+	LookupContext(ctx context.Context, url string) (svc.Resolution, error)
+}
+
+// New redirects GET /:code to the destination of the short URL. Destinations
+// flagged by threat intelligence get an interstitial warning page instead.
+func New(service Resolver, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		log := log.With(zap.String("op", "redirect"))
+
+		code := c.Param("code")
+
+		res, err := service.LookupContext(c.Request.Context(), code)
+		if err != nil {
+			log.Error("failed to resolve URL", zap.Error(err))
+
+			var mistyped *svc.MistypedError
+			if errors.As(err, &mistyped) && mistyped.Suggestion != "" {
+				c.String(http.StatusNotFound, "short URL not found, did you mean /%s?", mistyped.Suggestion)
+				return
+			}
+
+			c.String(http.StatusNotFound, "short URL not found")
+			return
+		}
+
+		if res.Threat != nil {
+			log.Warn("serving warning page", zap.String("code", code), zap.String("threat", res.Threat.Threat))
+			c.Header("Cache-Control", "no-store")
+			c.Status(http.StatusOK)
+			_ = warningPage.Execute(c.Writer, struct{ URL, Threat string }{URL: res.URL, Threat: res.Threat.Threat})
+			return
+		}
+
+		c.Redirect(http.StatusFound, res.URL)
+	}
+}
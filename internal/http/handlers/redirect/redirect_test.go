@@ -0,0 +1,104 @@
+package redirect
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/domain"
+	"url-shortener/internal/http/middleware/mvdomain"
+	"url-shortener/internal/service"
+	"url-shortener/internal/storage/memory"
+	"url-shortener/internal/threat"
+)
+
+func newRouter(shortener *service.Shortener, log *zap.Logger) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.GET("/:code", New(shortener, log))
+
+	return r
+}
+
+func TestRedirectHandler_Redirects(t *testing.T) {
+	logger, _ := zap.NewProduction()
+	storage := memory.NewStorageInMemory(logger)
+	shortener := service.NewShortener(storage, logger)
+
+	code, err := shortener.Shorten("https://example.com/page")
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/"+code, nil)
+	newRouter(shortener, logger).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "https://example.com/page", w.Header().Get("Location"))
+}
+
+func TestRedirectHandler_ByHost(t *testing.T) {
+	logger, _ := zap.NewProduction()
+	storage := memory.NewStorageInMemory(logger)
+	shortener := service.NewShortener(storage, logger)
+	shortener.Domains = domain.NewRegistry([]config.DomainConfig{{Host: "go.brand-a.com"}, {Host: "l.brand-b.io"}})
+
+	for host, url := range map[string]string{"go.brand-a.com": "https://a.example/", "l.brand-b.io": "https://b.example/"} {
+		_, err := shortener.ShortenContext(domain.WithDomain(context.Background(), host), url, "promo")
+		assert.NoError(t, err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/:code", mvdomain.New(shortener.Domains), New(shortener, logger))
+
+	for host, url := range map[string]string{"go.brand-a.com": "https://a.example/", "l.brand-b.io:443": "https://b.example/"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/promo", nil)
+		req.Host = host
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusFound, w.Code, host)
+		assert.Equal(t, url, w.Header().Get("Location"), host)
+	}
+}
+
+func TestRedirectHandler_NotFound(t *testing.T) {
+	logger, _ := zap.NewProduction()
+	storage := memory.NewStorageInMemory(logger)
+	shortener := service.NewShortener(storage, logger)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/nonexistent", nil)
+	newRouter(shortener, logger).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestRedirectHandler_WarningPage(t *testing.T) {
+	logger, _ := zap.NewProduction()
+	storage := memory.NewStorageInMemory(logger)
+	shortener := service.NewShortener(storage, logger)
+
+	code, err := shortener.Shorten("https://later-bad.example/login?a=<b>")
+	assert.NoError(t, err)
+
+	shortener.Threats = &threat.Fake{Hosts: map[string]string{"later-bad.example": "phishing"}}
+	shortener.CheckThreatsOnResolve = true
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/"+code, nil)
+	newRouter(shortener, logger).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Location"))
+	assert.Contains(t, w.Body.String(), "phishing")
+	assert.Contains(t, w.Body.String(), "a=%3cb%3e")
+	assert.NotContains(t, w.Body.String(), "<b>")
+}
@@ -1,25 +1,38 @@
 package resolve
 
 import (
+	"context"
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"go.uber.org/zap"
+
+	"url-shortener/internal/domain"
+	svc "url-shortener/internal/service"
 )
 
 type Request struct {
 	ShortenedURL string `json:"short_url" validate:"required"`
+	// Domain is the short domain of the link; defaults to the one the
+	// request was sent to.
+	Domain string `json:"domain,omitempty"`
 }
 
 type Response struct {
-	URL    string `json:"original_url,omitempty"`
-	Error  string `json:"error,omitempty"`
-	Status string `json:"status"`
+	URL        string `json:"original_url,omitempty"`
+	Code       string `json:"code,omitempty"`
+	ShortURL   string `json:"short_url,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Suggestion string `json:"suggestion,omitempty"`
+	Warning    string `json:"warning,omitempty"`
+	Status     string `json:"status"`
 }
 
 type Resolver interface {
-	Resolve(url string) (string, error)
+	LookupContext(ctx context.Context, url string) (svc.Resolution, error)
+	ShortURL(ctx context.Context, code string) string
 }
 
 func New(service Resolver, log *zap.Logger) gin.HandlerFunc {
@@ -39,13 +52,30 @@ func New(service Resolver, log *zap.Logger) gin.HandlerFunc {
 			return
 		}
 
-		url, err := service.Resolve(req.ShortenedURL)
+		ctx := c.Request.Context()
+		if req.Domain != "" {
+			ctx = domain.WithDomain(ctx, req.Domain)
+		}
+
+		res, err := service.LookupContext(ctx, req.ShortenedURL)
 		if err != nil {
 			log.Error("failed to resolve URL", zap.Error(err))
+
+			var mistyped *svc.MistypedError
+			if errors.As(err, &mistyped) {
+				c.JSON(http.StatusNotFound, Response{Error: "URL not found", Suggestion: mistyped.Suggestion, Status: "Error"})
+				return
+			}
+
 			c.JSON(http.StatusNotFound, Response{Error: "URL not found", Status: "Error"})
 			return
 		}
 
-		c.JSON(http.StatusOK, Response{URL: url, Status: "OK"})
+		resp := Response{URL: res.URL, Code: req.ShortenedURL, ShortURL: service.ShortURL(ctx, req.ShortenedURL), Status: "OK"}
+		if res.Threat != nil {
+			resp.Warning = "destination reported as " + res.Threat.Threat
+		}
+
+		c.JSON(http.StatusOK, resp)
 	}
 }
@@ -11,8 +11,11 @@ import (
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 
+	"url-shortener/internal/generator"
+	"url-shortener/internal/model"
 	"url-shortener/internal/service"
 	"url-shortener/internal/storage/memory"
+	"url-shortener/pkg/util/random"
 )
 
 const (
@@ -115,3 +118,28 @@ func TestResolveHandler_UrlNotFound(t *testing.T) {
 
 	assert.Equal(t, http.StatusNotFound, w.Code)
 }
+
+func TestResolveHandler_Suggestion(t *testing.T) {
+	logger, _ := zap.NewProduction()
+
+	check := generator.NewCheckDigit(random.DefaultAlphabet, 10)
+	code := check.Append("abcdefghi")
+
+	storage := memory.NewStorageInMemory(logger)
+	assert.NoError(t, storage.Put(model.Link{URL: originalURL, ShortURL: code}))
+
+	shortener := service.NewShortener(storage, logger)
+	shortener.CheckDigit = check
+
+	handler := New(shortener, logger)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest(http.MethodPost, "/resolve", nil)
+	c.Request.Body = io.NopCloser(strings.NewReader(`{"short_url": "bacdefghi` + code[9:] + `"}`))
+
+	handler(c)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), `"suggestion":"`+code+`"`)
+}
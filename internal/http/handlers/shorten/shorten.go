@@ -1,25 +1,41 @@
 package shorten
 
 import (
+	"context"
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"go.uber.org/zap"
+
+	"url-shortener/internal/domain"
+	"url-shortener/internal/normalize"
+	"url-shortener/internal/policy"
+	svc "url-shortener/internal/service"
+	"url-shortener/internal/tenant"
+	"url-shortener/internal/threat"
 )
 
 type Request struct {
-	URL string `json:"url" validate:"required,url"`
+	URL   string `json:"url" validate:"required,url"`
+	Alias string `json:"alias,omitempty"`
+	// Domain is the short domain to create the link on; defaults to the one
+	// the request was sent to.
+	Domain string `json:"domain,omitempty" validate:"omitempty,hostname"`
 }
 
 type Response struct {
+	Code string `json:"code,omitempty"`
+	// ShortenedURL is the fully qualified short URL.
 	ShortenedURL string `json:"short_url,omitempty"`
 	Error        string `json:"error,omitempty"`
 	Status       string `json:"status"`
 }
 
 type Shortener interface {
-	Shorten(url string) (string, error)
+	ShortenContext(ctx context.Context, url, alias string) (string, error)
+	ShortURL(ctx context.Context, code string) string
 }
 
 func New(service Shortener, log *zap.Logger) gin.HandlerFunc {
@@ -43,13 +59,35 @@ func New(service Shortener, log *zap.Logger) gin.HandlerFunc {
 			return
 		}
 
-		shortened, err := service.Shorten(req.URL)
+		ctx := c.Request.Context()
+		if req.Domain != "" {
+			ctx = domain.WithDomain(ctx, req.Domain)
+		}
+
+		shortened, err := service.ShortenContext(ctx, req.URL, req.Alias)
 		if err != nil {
 			log.Error("failed to shorten URL", zap.Error(err))
-			c.JSON(http.StatusInternalServerError, Response{Error: err.Error(), Status: "Error"})
+			c.JSON(statusFor(err), Response{Error: err.Error(), Status: "Error"})
 			return
 		}
 
-		c.JSON(http.StatusOK, Response{ShortenedURL: shortened, Status: "OK"})
+		c.JSON(http.StatusOK, Response{Code: shortened, ShortenedURL: service.ShortURL(ctx, shortened), Status: "OK"})
+	}
+}
+
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, svc.ErrInvalidAlias), errors.Is(err, svc.ErrAliasNotAllowed), errors.Is(err, svc.ErrAliasCheckDigit),
+		errors.Is(err, policy.ErrForbiddenDestination), errors.Is(err, normalize.ErrInvalidURL),
+		errors.Is(err, threat.ErrMalicious), errors.Is(err, domain.ErrUnknownDomain):
+		return http.StatusBadRequest
+	case errors.Is(err, svc.ErrAliasTaken):
+		return http.StatusConflict
+	case errors.Is(err, tenant.ErrLinkQuotaExceeded):
+		return http.StatusForbidden
+	case errors.Is(err, tenant.ErrCreateRateExceeded):
+		return http.StatusTooManyRequests
+	default:
+		return http.StatusInternalServerError
 	}
 }
@@ -11,6 +11,9 @@ import (
 	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap"
 
+	"url-shortener/internal/config"
+	"url-shortener/internal/domain"
+	"url-shortener/internal/policy"
 	"url-shortener/internal/service"
 	"url-shortener/internal/storage/memory"
 )
@@ -33,6 +36,35 @@ func TestShortenHandler_Success(t *testing.T) {
 	assert.Contains(t, w.Body.String(), "short_url")
 }
 
+func TestShortenHandler_FullyQualified(t *testing.T) {
+	logger, _ := zap.NewProduction()
+
+	storage := memory.NewStorageInMemory(logger)
+	shortener := service.NewShortener(storage, logger)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest(http.MethodPost, "/shorten", strings.NewReader(`{"url": "https://example.com", "alias": "promo"}`))
+	c.Request = c.Request.WithContext(domain.WithOrigin(c.Request.Context(), "http://localhost:8080"))
+
+	New(shortener, logger)(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"code": "promo", "short_url": "http://localhost:8080/promo", "status": "OK"}`, w.Body.String())
+
+	shortener.BaseURL = "https://sho.rt"
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest(http.MethodPost, "/shorten", strings.NewReader(`{"url": "https://example.org", "alias": "other"}`))
+	c.Request = c.Request.WithContext(domain.WithOrigin(c.Request.Context(), "http://localhost:8080"))
+
+	New(shortener, logger)(c)
+
+	assert.JSONEq(t, `{"code": "other", "short_url": "https://sho.rt/other", "status": "OK"}`, w.Body.String(),
+		"the configured base URL wins over the request")
+}
+
 func TestShortenHandler_InvalidRequest(t *testing.T) {
 	logger, _ := zap.NewProduction()
 
@@ -69,3 +101,52 @@ func TestShortenHandler_InvalidURLFormat(t *testing.T) {
 
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
+
+func TestShortenHandler_Alias(t *testing.T) {
+	logger, _ := zap.NewProduction()
+
+	storage := memory.NewStorageInMemory(logger)
+	shortener := service.NewShortener(storage, logger)
+
+	handler := New(shortener, logger)
+
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{name: "created", body: `{"url": "https://example.com", "alias": "promo"}`, code: http.StatusOK},
+		{name: "taken", body: `{"url": "https://example.org", "alias": "promo"}`, code: http.StatusConflict},
+		{name: "invalid", body: `{"url": "https://example.org", "alias": "a b"}`, code: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest(http.MethodPost, "/shorten", strings.NewReader(tt.body))
+
+		handler(c)
+
+		assert.Equal(t, tt.code, w.Code, tt.name)
+	}
+}
+
+func TestShortenHandler_ForbiddenDestination(t *testing.T) {
+	logger, _ := zap.NewProduction()
+
+	storage := memory.NewStorageInMemory(logger)
+	shortener := service.NewShortener(storage, logger)
+	shortener.Policy = policy.New(config.PolicyConfig{BlockPrivateIPs: true}, nil)
+
+	handler := New(shortener, logger)
+
+	for _, url := range []string{"http://169.254.169.254/latest/meta-data", "javascript:alert(1)"} {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request, _ = http.NewRequest(http.MethodPost, "/shorten", strings.NewReader(`{"url": "`+url+`"}`))
+
+		handler(c)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, url)
+	}
+}
@@ -0,0 +1,161 @@
+package stats
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"url-shortener/internal/auth"
+	"url-shortener/internal/domain"
+	"url-shortener/internal/model"
+	svc "url-shortener/internal/service"
+)
+
+type Bucket struct {
+	Start  time.Time `json:"start"`
+	Clicks int64     `json:"clicks"`
+}
+
+type Count struct {
+	Value  string `json:"value"`
+	Clicks int64  `json:"clicks"`
+}
+
+type Response struct {
+	Code string `json:"code,omitempty"`
+	// Traffic is the class of the clicks counted: human, bot, suspicious or
+	// all.
+	Traffic string `json:"traffic,omitempty"`
+	Total   int64  `json:"total"`
+	// UniqueVisitors is estimated over the whole UTC days of the range.
+	UniqueVisitors int64    `json:"unique_visitors"`
+	Series         []Bucket `json:"series,omitempty"`
+	TopReferrers   []Count  `json:"top_referrers,omitempty"`
+	TopUserAgents  []Count  `json:"top_user_agents,omitempty"`
+	// ByClass and TopBots count all clicks of the range, whatever Traffic.
+	ByClass []Count `json:"by_class,omitempty"`
+	TopBots []Count `json:"top_bots,omitempty"`
+	// TopCities values are "City, CC".
+	TopCountries []Count `json:"top_countries,omitempty"`
+	TopCities    []Count `json:"top_cities,omitempty"`
+	TopDevices   []Count `json:"top_devices,omitempty"`
+	TopOS        []Count `json:"top_os,omitempty"`
+	TopBrowsers  []Count `json:"top_browsers,omitempty"`
+	Error        string  `json:"error,omitempty"`
+	Status       string  `json:"status"`
+}
+
+type Service interface {
+	Stats(ctx context.Context, code string, q model.ClickQuery) (model.ClickStats, error)
+}
+
+// New returns click statistics of a link. Query parameters: from and to as
+// RFC 3339 timestamps, interval ("hour", "day" or a duration such as "15m"),
+// top, traffic ("human" by default, "bot", "suspicious" or "all") and domain.
+func New(service Service, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		log := log.With(zap.String("op", "link-stats"), zap.String("code", c.Param("code")))
+
+		q, err := parseQuery(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, Response{Error: err.Error(), Status: "Error"})
+			return
+		}
+
+		ctx := c.Request.Context()
+		if host := c.Query("domain"); host != "" {
+			ctx = domain.WithDomain(ctx, host)
+		}
+
+		stats, err := service.Stats(ctx, c.Param("code"), q)
+		if err != nil {
+			log.Error("failed to get link stats", zap.Error(err))
+			c.JSON(statusFor(err), Response{Error: err.Error(), Status: "Error"})
+			return
+		}
+
+		resp := Response{
+			Code:           c.Param("code"),
+			Traffic:        cmp.Or(q.Traffic, model.ClassHuman),
+			Total:          stats.Total,
+			UniqueVisitors: stats.UniqueVisitors,
+			Series:         make([]Bucket, 0, len(stats.Series)),
+			TopReferrers:   toCounts(stats.TopReferrers),
+			TopUserAgents:  toCounts(stats.TopUserAgents),
+			ByClass:        toCounts(stats.ByClass),
+			TopBots:        toCounts(stats.TopBots),
+			TopCountries:   toCounts(stats.TopCountries),
+			TopCities:      toCounts(stats.TopCities),
+			TopDevices:     toCounts(stats.TopDevices),
+			TopOS:          toCounts(stats.TopOS),
+			TopBrowsers:    toCounts(stats.TopBrowsers),
+			Status:         "OK",
+		}
+		for _, b := range stats.Series {
+			resp.Series = append(resp.Series, Bucket{Start: b.Start, Clicks: b.Clicks})
+		}
+
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+func parseQuery(c *gin.Context) (model.ClickQuery, error) {
+	var q model.ClickQuery
+	var err error
+
+	if raw := c.Query("from"); raw != "" {
+		if q.From, err = time.Parse(time.RFC3339, raw); err != nil {
+			return q, errors.New("invalid from")
+		}
+	}
+
+	if raw := c.Query("to"); raw != "" {
+		if q.To, err = time.Parse(time.RFC3339, raw); err != nil {
+			return q, errors.New("invalid to")
+		}
+	}
+
+	if q.Interval, err = svc.ParseStatsInterval(c.Query("interval")); err != nil {
+		return q, errors.New("invalid interval")
+	}
+
+	if raw := c.Query("top"); raw != "" {
+		if q.Top, err = strconv.Atoi(raw); err != nil || q.Top < 1 {
+			return q, errors.New("invalid top")
+		}
+	}
+
+	q.Traffic = c.Query("traffic")
+
+	return q, nil
+}
+
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, auth.ErrMissingCredentials):
+		return http.StatusUnauthorized
+	case errors.Is(err, svc.ErrNotOwner):
+		return http.StatusForbidden
+	case errors.Is(err, svc.ErrLinkNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, svc.ErrInvalidStatsQuery), errors.Is(err, domain.ErrUnknownDomain):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func toCounts(counts []model.ClickCount) []Count {
+	out := make([]Count, 0, len(counts))
+	for _, c := range counts {
+		out = append(out, Count{Value: c.Value, Clicks: c.Clicks})
+	}
+
+	return out
+}
@@ -0,0 +1,105 @@
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"url-shortener/internal/auth"
+	"url-shortener/internal/model"
+	"url-shortener/internal/service"
+	"url-shortener/internal/sketch"
+	"url-shortener/internal/storage/memory"
+)
+
+func TestStats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := zaptest.NewLogger(t)
+	storage := memory.NewStorageInMemory(logger)
+	shortener := service.NewShortener(storage, logger)
+
+	alice := auth.WithPrincipal(context.Background(), auth.Principal{Subject: "alice"})
+	_, err := shortener.ShortenContext(alice, "https://example.com", "promo")
+	require.NoError(t, err)
+
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, storage.PutClicks([]model.Click{
+		{
+			ShortURL: "promo", At: day.Add(time.Hour), Referrer: "https://t.me/", UserAgent: "curl",
+			Country: "DE", City: "Berlin", Device: "other",
+		},
+		{ShortURL: "promo", At: day.Add(25 * time.Hour), Referrer: "https://t.me/", UserAgent: "curl"},
+		{ShortURL: "promo", At: day.Add(2 * time.Hour), UserAgent: "Slackbot", Class: model.ClassBot, Bot: "Slack"},
+	}))
+
+	visitors, err := sketch.NewHLL(sketch.HLLPrecision)
+	require.NoError(t, err)
+	visitors.Add([]byte("client-a"))
+	visitors.Add([]byte("client-b"))
+	require.NoError(t, storage.MergeVisitors([]model.VisitorSketch{{ShortURL: "promo", Day: day, Sketch: visitors}}))
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if user := c.GetHeader("X-User"); user != "" {
+			c.Request = c.Request.WithContext(auth.WithPrincipal(c.Request.Context(), auth.Principal{Subject: user}))
+		}
+	})
+	r.GET("/links/:code/stats", New(shortener, logger))
+
+	get := func(path, user string) (int, Response) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-User", user)
+		r.ServeHTTP(w, req)
+
+		var resp Response
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+
+		return w.Code, resp
+	}
+
+	code, resp := get("/links/promo/stats?from=2026-03-01T00:00:00Z&to=2026-03-03T00:00:00Z&interval=day", "alice")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, int64(2), resp.Total)
+	assert.Equal(t, int64(2), resp.UniqueVisitors)
+	assert.Equal(t, []Bucket{{Start: day, Clicks: 1}, {Start: day.Add(24 * time.Hour), Clicks: 1}}, resp.Series)
+	assert.Equal(t, []Count{{Value: "https://t.me/", Clicks: 2}}, resp.TopReferrers)
+	assert.Equal(t, []Count{{Value: "curl", Clicks: 2}}, resp.TopUserAgents)
+	assert.Equal(t, "human", resp.Traffic)
+	assert.Equal(t, []Count{{Value: "human", Clicks: 2}, {Value: "bot", Clicks: 1}}, resp.ByClass)
+	assert.Equal(t, []Count{{Value: "Slack", Clicks: 1}}, resp.TopBots)
+	assert.Equal(t, []Count{{Value: "DE", Clicks: 1}}, resp.TopCountries)
+	assert.Equal(t, []Count{{Value: "Berlin, DE", Clicks: 1}}, resp.TopCities)
+	assert.Equal(t, []Count{{Value: "other", Clicks: 1}}, resp.TopDevices)
+
+	code, resp = get("/links/promo/stats?from=2026-03-01T00:00:00Z&to=2026-03-03T00:00:00Z&traffic=bot", "alice")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, int64(1), resp.Total)
+	assert.Equal(t, []Count{{Value: "Slackbot", Clicks: 1}}, resp.TopUserAgents)
+
+	code, _ = get("/links/promo/stats?traffic=robots", "alice")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = get("/links/promo/stats?from=yesterday", "alice")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = get("/links/promo/stats?interval=7m", "alice")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = get("/links/promo/stats", "bob")
+	assert.Equal(t, http.StatusForbidden, code)
+
+	code, _ = get("/links/promo/stats", "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, _ = get("/links/missing/stats", "alice")
+	assert.Equal(t, http.StatusNotFound, code)
+}
@@ -0,0 +1,104 @@
+package trending
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"url-shortener/internal/auth"
+	"url-shortener/internal/model"
+	"url-shortener/internal/trending"
+)
+
+type Link struct {
+	Tenant   string `json:"tenant,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	Code     string `json:"code"`
+	ShortURL string `json:"short_url"`
+	Count    uint64 `json:"count"`
+}
+
+type Window struct {
+	Window string `json:"window"`
+	Links  []Link `json:"links"`
+}
+
+type Response struct {
+	Windows []Window `json:"windows,omitempty"`
+	Error   string   `json:"error,omitempty"`
+	Status  string   `json:"status"`
+}
+
+type Tracker interface {
+	Top(limit int) []trending.Top
+	TopOf(tenant string, limit int) []trending.Top
+}
+
+type Service interface {
+	LinkURL(ctx context.Context, link model.Link) string
+}
+
+// New returns the links of the caller's tenant resolved most. Query
+// parameters: window ("1m", "15m" or "1h"; all windows if empty), limit and
+// tenant, which only ScopeSuperAdmin may set to another tenant; without it a
+// superadmin gets the ranking across all tenants.
+func New(tracker Tracker, service Service, log *zap.Logger) gin.HandlerFunc {
+	log = log.With(zap.String("op", "trending"))
+
+	return func(c *gin.Context) {
+		window, err := trending.ParseWindow(c.Query("window"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, Response{Error: err.Error(), Status: "Error"})
+			return
+		}
+
+		var limit int
+		if raw := c.Query("limit"); raw != "" {
+			if limit, err = strconv.Atoi(raw); err != nil || limit < 1 {
+				c.JSON(http.StatusBadRequest, Response{Error: "invalid limit", Status: "Error"})
+				return
+			}
+		}
+
+		principal, ok := auth.FromContext(c.Request.Context())
+		if !ok {
+			c.JSON(http.StatusUnauthorized, Response{Error: auth.ErrMissingCredentials.Error(), Status: "Error"})
+			return
+		}
+
+		tops := tracker.Top
+		tenant, named := c.GetQuery("tenant")
+		if named || !principal.HasScope(auth.ScopeSuperAdmin) {
+			if tenant, err = auth.TenantFor(principal, tenant); err != nil {
+				c.JSON(http.StatusForbidden, Response{Error: err.Error(), Status: "Error"})
+				return
+			}
+			tops = func(limit int) []trending.Top { return tracker.TopOf(tenant, limit) }
+		}
+
+		resp := Response{Status: "OK"}
+		for _, top := range tops(limit) {
+			if window != 0 && top.Window != window {
+				continue
+			}
+
+			w := Window{Window: trending.WindowName(top.Window), Links: make([]Link, 0, len(top.Entries))}
+			for _, e := range top.Entries {
+				w.Links = append(w.Links, Link{
+					Tenant:   e.Key.Tenant,
+					Domain:   e.Key.Domain,
+					Code:     e.Key.ShortURL,
+					ShortURL: service.LinkURL(c.Request.Context(), model.Link{Domain: e.Key.Domain, ShortURL: e.Key.ShortURL}),
+					Count:    e.Count,
+				})
+			}
+			resp.Windows = append(resp.Windows, w)
+		}
+
+		log.Debug("trending links listed", zap.Int("windows", len(resp.Windows)))
+		c.JSON(http.StatusOK, resp)
+	}
+}
@@ -0,0 +1,92 @@
+package trending
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+
+	"url-shortener/internal/auth"
+	"url-shortener/internal/model"
+	"url-shortener/internal/service"
+	"url-shortener/internal/storage/memory"
+	"url-shortener/internal/trending"
+)
+
+func TestTrending(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := zaptest.NewLogger(t)
+	shortener := service.NewShortener(memory.NewStorageInMemory(logger), logger)
+	shortener.BaseURL = "https://sho.rt"
+
+	tracker := trending.NewTracker(10)
+	for range 3 {
+		tracker.Record(context.Background(), model.LinkKey{ShortURL: "hot"})
+	}
+	tracker.Record(context.Background(), model.LinkKey{Tenant: "acme", ShortURL: "warm"})
+
+	as := func(p auth.Principal) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			c.Request = c.Request.WithContext(auth.WithPrincipal(c.Request.Context(), p))
+		}
+	}
+
+	r := gin.New()
+	r.GET("/anonymous/trending", New(tracker, shortener, logger))
+	r.GET("/admin/trending", as(auth.Principal{Subject: "root", Scopes: []string{auth.ScopeSuperAdmin}}), New(tracker, shortener, logger))
+	r.GET("/acme/trending", as(auth.Principal{Subject: "ops", Tenant: "acme", Scopes: []string{auth.ScopeAdmin}}), New(tracker, shortener, logger))
+
+	get := func(path string) (int, Response) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		r.ServeHTTP(w, req)
+
+		var resp Response
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+
+		return w.Code, resp
+	}
+
+	code, resp := get("/admin/trending?window=15m")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []Window{{Window: "15m", Links: []Link{
+		{Code: "hot", ShortURL: "https://sho.rt/hot", Count: 3},
+		{Tenant: "acme", Code: "warm", ShortURL: "https://sho.rt/warm", Count: 1},
+	}}}, resp.Windows)
+
+	code, resp = get("/admin/trending?limit=1")
+	assert.Equal(t, http.StatusOK, code)
+	if assert.Len(t, resp.Windows, 3) {
+		assert.Equal(t, "1m", resp.Windows[0].Window)
+		assert.Len(t, resp.Windows[0].Links, 1)
+	}
+
+	code, resp = get("/admin/trending?window=15m&tenant=")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []Window{{Window: "15m", Links: []Link{
+		{Code: "hot", ShortURL: "https://sho.rt/hot", Count: 3},
+	}}}, resp.Windows)
+
+	code, resp = get("/acme/trending?window=15m")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, []Window{{Window: "15m", Links: []Link{
+		{Tenant: "acme", Code: "warm", ShortURL: "https://sho.rt/warm", Count: 1},
+	}}}, resp.Windows)
+
+	code, _ = get("/acme/trending?tenant=globex")
+	assert.Equal(t, http.StatusForbidden, code)
+
+	code, _ = get("/anonymous/trending")
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, _ = get("/admin/trending?window=5m")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = get("/admin/trending?limit=0")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
@@ -0,0 +1,300 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.uber.org/zap"
+
+	"url-shortener/internal/auth"
+	"url-shortener/internal/model"
+	"url-shortener/internal/policy"
+	"url-shortener/internal/storage/errs"
+	"url-shortener/internal/webhook"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+type CreateRequest struct {
+	URL string `json:"url" validate:"required"`
+	// Events are the event types to deliver; none means all of them.
+	Events []string `json:"events,omitempty"`
+	// Tenant is the workspace whose link events are delivered. Callers with
+	// the superadmin scope may name any tenant, empty being the default one;
+	// others only subscribe to their own tenant, which an empty tenant stands
+	// for.
+	Tenant string `json:"tenant,omitempty"`
+}
+
+type ReplayRequest struct {
+	// IDs are the dead deliveries to replay; none means all of them.
+	IDs []int64 `json:"ids,omitempty"`
+}
+
+type Webhook struct {
+	ID     string   `json:"id"`
+	Tenant string   `json:"tenant,omitempty"`
+	URL    string   `json:"url"`
+	Events []string `json:"events,omitempty"`
+	// Secret signs the deliveries. It is only returned when a webhook is
+	// created.
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Delivery struct {
+	ID        int64     `json:"id"`
+	EventID   string    `json:"event_id"`
+	Event     string    `json:"event"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	DeadAt    time.Time `json:"dead_at"`
+	// Payload is the body that was sent.
+	Payload string `json:"payload"`
+}
+
+type Response struct {
+	Webhook     *Webhook   `json:"webhook,omitempty"`
+	Webhooks    []Webhook  `json:"webhooks,omitempty"`
+	DeadLetters []Delivery `json:"dead_letters,omitempty"`
+	Replayed    int64      `json:"replayed,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	Status      string     `json:"status"`
+}
+
+type Manager interface {
+	Subscribe(ctx context.Context, tenant, url string, events []string) (model.Webhook, error)
+	List() ([]model.Webhook, error)
+	Unsubscribe(id string) error
+	DeadLetters(id string, limit int) ([]model.WebhookDelivery, error)
+	Replay(id string, deliveries []int64) (int64, error)
+}
+
+// Register adds the webhook management routes to an admin route group.
+func Register(r gin.IRoutes, webhooks Manager, log *zap.Logger) {
+	log = log.With(zap.String("op", "webhooks"))
+
+	r.POST("/webhooks", create(webhooks, log))
+	r.GET("/webhooks", list(webhooks, log))
+	r.DELETE("/webhooks/:id", remove(webhooks, log))
+	r.GET("/webhooks/:id/dead-letters", deadLetters(webhooks, log))
+	r.POST("/webhooks/:id/replay", replay(webhooks, log))
+}
+
+func create(webhooks Manager, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req CreateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			log.Error("invalid request", zap.Error(err))
+			c.JSON(http.StatusBadRequest, Response{Error: "invalid request", Status: "Error"})
+			return
+		}
+
+		if err := validator.New().Struct(req); err != nil {
+			log.Error("validation failed", zap.Error(err))
+			c.JSON(http.StatusBadRequest, Response{Error: "url is required", Status: "Error"})
+			return
+		}
+
+		principal, ok := caller(c)
+		if !ok {
+			return
+		}
+		tenant, err := auth.TenantFor(principal, req.Tenant)
+		if err != nil {
+			c.JSON(http.StatusForbidden, Response{Error: err.Error(), Status: "Error"})
+			return
+		}
+
+		hook, err := webhooks.Subscribe(c.Request.Context(), tenant, req.URL, req.Events)
+		if err != nil {
+			log.Error("failed to create webhook", zap.Error(err))
+			c.JSON(statusFor(err), Response{Error: err.Error(), Status: "Error"})
+			return
+		}
+
+		log.Info("webhook created", zap.String("id", hook.ID), zap.String("tenant", hook.Tenant),
+			zap.Strings("events", hook.Events))
+		resp := toWebhook(hook)
+		resp.Secret = hook.Secret
+		c.JSON(http.StatusCreated, Response{Webhook: &resp, Status: "OK"})
+	}
+}
+
+func list(webhooks Manager, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := caller(c)
+		if !ok {
+			return
+		}
+
+		stored, err := webhooks.List()
+		if err != nil {
+			log.Error("failed to list webhooks", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, Response{Error: err.Error(), Status: "Error"})
+			return
+		}
+
+		resp := Response{Webhooks: make([]Webhook, 0, len(stored)), Status: "OK"}
+		for _, hook := range stored {
+			if auth.Manages(principal, hook.Tenant) {
+				resp.Webhooks = append(resp.Webhooks, toWebhook(hook))
+			}
+		}
+
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+func remove(webhooks Manager, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := caller(c)
+		if !ok {
+			return
+		}
+
+		err := owned(webhooks, principal, c.Param("id"))
+		if err == nil {
+			err = webhooks.Unsubscribe(c.Param("id"))
+		}
+		if err != nil {
+			log.Error("failed to delete webhook", zap.String("id", c.Param("id")), zap.Error(err))
+			c.JSON(statusFor(err), Response{Error: err.Error(), Status: "Error"})
+			return
+		}
+
+		log.Info("webhook deleted", zap.String("id", c.Param("id")))
+		c.JSON(http.StatusOK, Response{Status: "OK"})
+	}
+}
+
+func deadLetters(webhooks Manager, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := defaultLimit
+		if raw := c.Query("limit"); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n <= 0 {
+				c.JSON(http.StatusBadRequest, Response{Error: "invalid limit", Status: "Error"})
+				return
+			}
+			limit = min(n, maxLimit)
+		}
+
+		principal, ok := caller(c)
+		if !ok {
+			return
+		}
+
+		err := owned(webhooks, principal, c.Param("id"))
+		var dead []model.WebhookDelivery
+		if err == nil {
+			dead, err = webhooks.DeadLetters(c.Param("id"), limit)
+		}
+		if err != nil {
+			log.Error("failed to list dead letters", zap.String("id", c.Param("id")), zap.Error(err))
+			c.JSON(statusFor(err), Response{Error: err.Error(), Status: "Error"})
+			return
+		}
+
+		resp := Response{DeadLetters: make([]Delivery, 0, len(dead)), Status: "OK"}
+		for _, d := range dead {
+			resp.DeadLetters = append(resp.DeadLetters, Delivery{
+				ID:        d.ID,
+				EventID:   d.EventID,
+				Event:     d.Event,
+				Attempts:  d.Attempts,
+				LastError: d.LastError,
+				CreatedAt: d.CreatedAt,
+				DeadAt:    d.DeadAt,
+				Payload:   string(d.Payload),
+			})
+		}
+
+		c.JSON(http.StatusOK, resp)
+	}
+}
+
+func replay(webhooks Manager, log *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req ReplayRequest
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				log.Error("invalid request", zap.Error(err))
+				c.JSON(http.StatusBadRequest, Response{Error: "invalid request", Status: "Error"})
+				return
+			}
+		}
+
+		principal, ok := caller(c)
+		if !ok {
+			return
+		}
+
+		err := owned(webhooks, principal, c.Param("id"))
+		var replayed int64
+		if err == nil {
+			replayed, err = webhooks.Replay(c.Param("id"), req.IDs)
+		}
+		if err != nil {
+			log.Error("failed to replay dead letters", zap.String("id", c.Param("id")), zap.Error(err))
+			c.JSON(statusFor(err), Response{Error: err.Error(), Status: "Error"})
+			return
+		}
+
+		log.Info("dead letters replayed", zap.String("id", c.Param("id")), zap.Int64("replayed", replayed))
+		c.JSON(http.StatusOK, Response{Replayed: replayed, Status: "OK"})
+	}
+}
+
+// caller returns the principal of the request, or responds with 401 if there
+// is none: webhooks are managed on behalf of the caller.
+func caller(c *gin.Context) (auth.Principal, bool) {
+	principal, ok := auth.FromContext(c.Request.Context())
+	if !ok {
+		c.JSON(http.StatusUnauthorized, Response{Error: auth.ErrMissingCredentials.Error(), Status: "Error"})
+	}
+
+	return principal, ok
+}
+
+// owned returns errs.ErrWebhookIsNotExist unless the principal manages the
+// webhook with id, so webhooks of other tenants look like missing ones.
+func owned(webhooks Manager, principal auth.Principal, id string) error {
+	stored, err := webhooks.List()
+	if err != nil {
+		return err
+	}
+
+	for _, hook := range stored {
+		if hook.ID == id && auth.Manages(principal, hook.Tenant) {
+			return nil
+		}
+	}
+
+	return errs.ErrWebhookIsNotExist
+}
+
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, webhook.ErrInvalidURL), errors.Is(err, webhook.ErrUnknownEvent),
+		errors.Is(err, policy.ErrForbiddenDestination):
+		return http.StatusBadRequest
+	case errors.Is(err, errs.ErrWebhookIsNotExist):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func toWebhook(hook model.Webhook) Webhook {
+	return Webhook{ID: hook.ID, Tenant: hook.Tenant, URL: hook.URL, Events: hook.Events, CreatedAt: hook.CreatedAt}
+}
@@ -0,0 +1,130 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"url-shortener/internal/auth"
+	"url-shortener/internal/config"
+	"url-shortener/internal/model"
+	"url-shortener/internal/storage/memory"
+	"url-shortener/internal/webhook"
+)
+
+func do(r http.Handler, method, path, body string) (int, Response) {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+
+	var resp Response
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+
+	return w.Code, resp
+}
+
+// as authenticates every request as p.
+func as(p auth.Principal) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(auth.WithPrincipal(c.Request.Context(), p))
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	// Host names are not resolved to be checked, as there may be no DNS.
+	dispatcher := webhook.NewDispatcher(memory.NewStorageInMemory(logger), config.WebhooksConfig{AllowPrivateIPs: true}, logger)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	Register(r.Group("/admin", as(auth.Principal{Subject: "key:root", Scopes: []string{auth.ScopeSuperAdmin}})), dispatcher, logger)
+
+	code, resp := do(r, http.MethodPost, "/admin/webhooks",
+		`{"url":"https://hooks.acme.com/links","events":["link.created"],"tenant":"acme"}`)
+	require.Equal(t, http.StatusCreated, code)
+	require.NotNil(t, resp.Webhook)
+	assert.NotEmpty(t, resp.Webhook.Secret)
+	assert.Equal(t, []string{"link.created"}, resp.Webhook.Events)
+	id := resp.Webhook.ID
+
+	code, _ = do(r, http.MethodPost, "/admin/webhooks", `{"url":"ftp://hooks.acme.com"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = do(r, http.MethodPost, "/admin/webhooks", `{"url":"https://hooks.acme.com","events":["link.viewed"]}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, _ = do(r, http.MethodPost, "/admin/webhooks", `{"events":["link.created"]}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, resp = do(r, http.MethodGet, "/admin/webhooks", "")
+	assert.Equal(t, http.StatusOK, code)
+	if assert.Len(t, resp.Webhooks, 1) {
+		assert.Equal(t, id, resp.Webhooks[0].ID)
+		assert.Empty(t, resp.Webhooks[0].Secret, "secrets are only shown once")
+	}
+
+	code, resp = do(r, http.MethodGet, "/admin/webhooks/"+id+"/dead-letters?limit=10", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, resp.DeadLetters)
+
+	code, _ = do(r, http.MethodGet, "/admin/webhooks/"+id+"/dead-letters?limit=x", "")
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, resp = do(r, http.MethodPost, "/admin/webhooks/"+id+"/replay", `{"ids":[1,2]}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Zero(t, resp.Replayed)
+
+	code, _ = do(r, http.MethodPost, "/admin/webhooks/missing/replay", "")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, _ = do(r, http.MethodGet, "/admin/webhooks/missing/dead-letters", "")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, _ = do(r, http.MethodDelete, "/admin/webhooks/"+id, "")
+	assert.Equal(t, http.StatusOK, code)
+
+	code, _ = do(r, http.MethodDelete, "/admin/webhooks/"+id, "")
+	assert.Equal(t, http.StatusNotFound, code)
+}
+
+func TestWebhooks_BoundToCaller(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	store := memory.NewStorageInMemory(logger)
+	require.NoError(t, store.PutWebhook(model.Webhook{ID: "globex", Tenant: "globex", URL: "https://hooks.globex.com"}))
+	dispatcher := webhook.NewDispatcher(store, config.WebhooksConfig{}, logger)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	Register(r.Group("/acme", as(auth.Principal{Subject: "key:acme", Tenant: "acme", Scopes: []string{auth.ScopeAdmin}})), dispatcher, logger)
+	Register(r.Group("/anonymous"), dispatcher, logger)
+
+	code, _ := do(r, http.MethodPost, "/acme/webhooks", `{"url":"http://169.254.169.254/latest/meta-data"}`)
+	assert.Equal(t, http.StatusBadRequest, code, "internal addresses are refused")
+
+	code, _ = do(r, http.MethodPost, "/acme/webhooks", `{"url":"https://hooks.acme.com","tenant":"globex"}`)
+	assert.Equal(t, http.StatusForbidden, code)
+
+	code, resp := do(r, http.MethodGet, "/acme/webhooks", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, resp.Webhooks, "webhooks of other tenants are not listed")
+
+	code, _ = do(r, http.MethodGet, "/acme/webhooks/globex/dead-letters", "")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, _ = do(r, http.MethodPost, "/acme/webhooks/globex/replay", "")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, _ = do(r, http.MethodDelete, "/acme/webhooks/globex", "")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, _ = do(r, http.MethodGet, "/anonymous/webhooks", "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+}
@@ -0,0 +1,37 @@
+package mvaudit
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type Auditor interface {
+	Record(ctx context.Context, action, target string, before, after any)
+}
+
+type outcome struct {
+	Status int `json:"status"`
+}
+
+// New records every request that may change something, that is any but GET,
+// HEAD and OPTIONS, in the audit log once it is answered, including those
+// that failed or were denied. The action is the method and route, the target
+// the :id parameter of the route, if any, and the snapshot after it the
+// response status. It must run before authentication, so denied requests are
+// recorded too, with the caller known if authentication succeeded.
+func New(auditor Auditor) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+
+		c.Next()
+
+		auditor.Record(c.Request.Context(), c.Request.Method+" "+c.FullPath(), c.Param("id"), nil,
+			outcome{Status: c.Writer.Status()})
+	}
+}
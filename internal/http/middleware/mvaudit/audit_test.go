@@ -0,0 +1,57 @@
+package mvaudit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"url-shortener/internal/auth"
+)
+
+type record struct {
+	actor, action, target string
+	after                 any
+}
+
+type recorder []record
+
+func (r *recorder) Record(ctx context.Context, action, target string, _, after any) {
+	principal, _ := auth.FromContext(ctx)
+	*r = append(*r, record{principal.Subject, action, target, after})
+}
+
+func TestAudit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var audit recorder
+	r := gin.New()
+	admin := r.Group("/admin", New(&audit), func(c *gin.Context) {
+		if c.GetHeader("X-API-Key") == "" {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Request = c.Request.WithContext(auth.WithPrincipal(c.Request.Context(), auth.Principal{Subject: "root"}))
+	})
+	admin.GET("/keys", func(c *gin.Context) { c.Status(http.StatusOK) })
+	admin.DELETE("/keys/:id", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	for _, req := range []struct{ method, path, key string }{
+		{http.MethodGet, "/admin/keys", "secret"},
+		{http.MethodDelete, "/admin/keys/k1", "secret"},
+		{http.MethodDelete, "/admin/keys/k2", ""},
+	} {
+		w := httptest.NewRecorder()
+		httpReq, _ := http.NewRequest(req.method, req.path, nil)
+		httpReq.Header.Set("X-API-Key", req.key)
+		r.ServeHTTP(w, httpReq)
+	}
+
+	require.Len(t, audit, 2, "reads are not recorded")
+	assert.Equal(t, record{"root", "DELETE /admin/keys/:id", "k1", outcome{Status: http.StatusNoContent}}, audit[0])
+	assert.Equal(t, record{"", "DELETE /admin/keys/:id", "k2", outcome{Status: http.StatusUnauthorized}}, audit[1])
+}
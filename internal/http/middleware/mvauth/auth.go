@@ -0,0 +1,78 @@
+package mvauth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"url-shortener/internal/auth"
+)
+
+const DefaultAPIKeyHeader = "X-API-Key"
+
+type Authenticator interface {
+	Authenticate(ctx context.Context, creds auth.Credentials) (auth.Principal, error)
+}
+
+type Response struct {
+	Error  string `json:"error"`
+	Status string `json:"status"`
+}
+
+// New authenticates the request by the bearer token in Authorization or the
+// API key in header and requires scope.
+// The principal is stored in the request context for the handlers.
+func New(authn Authenticator, header, scope string, log *zap.Logger) gin.HandlerFunc {
+	if header == "" {
+		header = DefaultAPIKeyHeader
+	}
+
+	return func(c *gin.Context) {
+		creds := auth.Credentials{
+			APIKey:      c.GetHeader(header),
+			BearerToken: auth.BearerToken(c.GetHeader("Authorization")),
+		}
+
+		principal, err := authn.Authenticate(c.Request.Context(), creds)
+		if err != nil {
+			log.Info("authentication failed", zap.String("path", c.Request.URL.Path), zap.Error(err))
+			if statusFor(err) == http.StatusUnauthorized {
+				c.Header("WWW-Authenticate", "Bearer")
+			}
+			c.AbortWithStatusJSON(statusFor(err), Response{Error: publicError(err).Error(), Status: "Error"})
+			return
+		}
+
+		if !principal.HasScope(scope) {
+			log.Info("insufficient scope", zap.String("subject", principal.Subject), zap.String("scope", scope))
+			c.AbortWithStatusJSON(http.StatusForbidden, Response{Error: auth.ErrForbidden.Error(), Status: "Error"})
+			return
+		}
+
+		c.Request = c.Request.WithContext(auth.WithPrincipal(c.Request.Context(), principal))
+		c.Next()
+	}
+}
+
+func statusFor(err error) int {
+	if errors.Is(err, auth.ErrMissingCredentials) || errors.Is(err, auth.ErrInvalidCredentials) {
+		return http.StatusUnauthorized
+	}
+
+	return http.StatusInternalServerError
+}
+
+// publicError hides why a key was rejected and any storage failure details.
+func publicError(err error) error {
+	switch {
+	case errors.Is(err, auth.ErrMissingCredentials):
+		return auth.ErrMissingCredentials
+	case errors.Is(err, auth.ErrInvalidCredentials):
+		return auth.ErrInvalidCredentials
+	default:
+		return errors.New("authentication failed")
+	}
+}
@@ -0,0 +1,58 @@
+package mvauth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"url-shortener/internal/auth"
+	"url-shortener/internal/storage/memory"
+)
+
+func TestAuth(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	keys := auth.NewKeys(memory.NewStorageInMemory(logger), logger)
+	authn := &auth.Authenticator{Keys: keys}
+
+	creator, _, err := keys.Create("creator", "", []string{auth.ScopeLinksCreate})
+	require.NoError(t, err)
+	reader, _, err := keys.Create("reader", "", []string{auth.ScopeLinksRead})
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/shorten", New(authn, "", auth.ScopeLinksCreate, logger), func(c *gin.Context) {
+		p, ok := auth.FromContext(c.Request.Context())
+		assert.True(t, ok)
+		c.String(http.StatusOK, p.Name)
+	})
+
+	tests := []struct {
+		name string
+		key  string
+		code int
+	}{
+		{name: "missing key", key: "", code: http.StatusUnauthorized},
+		{name: "invalid key", key: "usk_nope", code: http.StatusUnauthorized},
+		{name: "missing scope", key: reader, code: http.StatusForbidden},
+		{name: "allowed", key: creator, code: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, "/shorten", nil)
+			if tt.key != "" {
+				req.Header.Set(DefaultAPIKeyHeader, tt.key)
+			}
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.code, w.Code)
+		})
+	}
+}
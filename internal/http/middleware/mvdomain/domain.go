@@ -0,0 +1,23 @@
+package mvdomain
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"url-shortener/internal/domain"
+)
+
+type Resolver interface {
+	ForHost(host string) string
+}
+
+// New stores the short domain the request host stands for in the request
+// context. Handlers may override it with a domain named in the request.
+func New(domains Resolver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if host := domains.ForHost(c.Request.Host); host != domain.Default {
+			c.Request = c.Request.WithContext(domain.WithDomain(c.Request.Context(), host))
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,37 @@
+package mvdomain
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/domain"
+)
+
+func TestDomain_FromHost(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	domains := domain.NewRegistry([]config.DomainConfig{{Host: "go.brand-a.com"}, {Host: "l.brand-b.io"}})
+
+	r := gin.New()
+	r.GET("/", New(domains), func(c *gin.Context) {
+		c.String(http.StatusOK, domain.FromContext(c.Request.Context()))
+	})
+
+	for host, want := range map[string]string{
+		"l.brand-b.io":   "l.brand-b.io",
+		"GO.brand-a.com": "go.brand-a.com",
+		"localhost:8080": "go.brand-a.com",
+	} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.Host = host
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, want, w.Body.String(), host)
+	}
+}
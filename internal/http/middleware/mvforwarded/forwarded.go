@@ -0,0 +1,97 @@
+package mvforwarded
+
+import (
+	"net"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"url-shortener/internal/domain"
+)
+
+// New works out the public origin of the request and stores it in the
+// request context. Requests from trustedProxies, given as addresses or CIDRs,
+// may set it with X-Forwarded-Host and X-Forwarded-Proto; the request Host is
+// rewritten to the forwarded one so that tenants and short domains are looked
+// up by the host the client used.
+func New(trustedProxies []string, log *zap.Logger) gin.HandlerFunc {
+	trusted := parseNetworks(trustedProxies, log)
+
+	return func(c *gin.Context) {
+		scheme := "http"
+		if c.Request.TLS != nil {
+			scheme = "https"
+		}
+
+		if isTrusted(trusted, c.Request.RemoteAddr) {
+			if host := firstValue(c.GetHeader("X-Forwarded-Host")); host != "" {
+				c.Request.Host = host
+			}
+			if proto := strings.ToLower(firstValue(c.GetHeader("X-Forwarded-Proto"))); proto == "http" || proto == "https" {
+				scheme = proto
+			}
+		}
+
+		if c.Request.Host != "" {
+			c.Request = c.Request.WithContext(domain.WithOrigin(c.Request.Context(), scheme+"://"+c.Request.Host))
+		}
+
+		c.Next()
+	}
+}
+
+// firstValue returns the value set by the proxy closest to the client.
+func firstValue(header string) string {
+	value, _, _ := strings.Cut(header, ",")
+	return strings.TrimSpace(value)
+}
+
+func parseNetworks(entries []string, log *zap.Logger) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				log.Error("invalid trusted proxy, ignoring it", zap.String("proxy", entry))
+				continue
+			}
+
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			log.Error("invalid trusted proxy, ignoring it", zap.String("proxy", entry), zap.Error(err))
+			continue
+		}
+		networks = append(networks, network)
+	}
+
+	return networks
+}
+
+func isTrusted(networks []*net.IPNet, remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
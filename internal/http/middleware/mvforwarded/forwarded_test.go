@@ -0,0 +1,48 @@
+package mvforwarded
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+
+	"url-shortener/internal/domain"
+)
+
+func TestForwarded(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.GET("/", New([]string{"10.0.0.0/8", "192.168.1.1", "not-an-ip"}, zaptest.NewLogger(t)), func(c *gin.Context) {
+		c.String(http.StatusOK, domain.OriginFromContext(c.Request.Context()))
+	})
+
+	tests := []struct {
+		name, remoteAddr, host, fwdHost, fwdProto, want string
+	}{
+		{"direct", "203.0.113.7:1234", "sho.rt:8080", "", "", "http://sho.rt:8080"},
+		{"untrusted proxy", "203.0.113.7:1234", "internal:8080", "sho.rt", "https", "http://internal:8080"},
+		{"trusted network", "10.1.2.3:1234", "internal:8080", "sho.rt", "https", "https://sho.rt"},
+		{"trusted address", "192.168.1.1:1234", "internal:8080", "sho.rt, proxy.local", "HTTPS, http", "https://sho.rt"},
+		{"bogus proto", "10.1.2.3:1234", "internal:8080", "", "gopher", "http://internal:8080"},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = tt.remoteAddr
+		req.Host = tt.host
+		if tt.fwdHost != "" {
+			req.Header.Set("X-Forwarded-Host", tt.fwdHost)
+		}
+		if tt.fwdProto != "" {
+			req.Header.Set("X-Forwarded-Proto", tt.fwdProto)
+		}
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, tt.want, w.Body.String(), tt.name)
+	}
+}
@@ -0,0 +1,57 @@
+package mvratelimit
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"url-shortener/internal/ratelimit"
+)
+
+const DefaultAPIKeyHeader = "X-API-Key"
+
+// New limits the routes it is attached to by rule. It sets the RateLimit-Limit,
+// RateLimit-Remaining and RateLimit-Reset headers on every response and
+// answers 429 with Retry-After once the bucket is empty. If the limiter
+// fails the request is let through.
+func New(limiter ratelimit.Limiter, rule ratelimit.Rule, apiKeyHeader string, log *zap.Logger) gin.HandlerFunc {
+	if apiKeyHeader == "" {
+		apiKeyHeader = DefaultAPIKeyHeader
+	}
+
+	return func(c *gin.Context) {
+		if !rule.Enabled() {
+			c.Next()
+			return
+		}
+
+		key := rule.BucketKey(c.ClientIP(), c.GetHeader(apiKeyHeader))
+		res, err := limiter.Allow(c.Request.Context(), key, rule)
+		if err != nil {
+			log.Error("rate limiter failed", zap.String("rule", rule.Name), zap.Error(err))
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(res.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		c.Header("RateLimit-Reset", ceilSeconds(res.Reset))
+
+		if !res.Allowed {
+			log.Info("rate limit exceeded", zap.String("rule", rule.Name), zap.String("key", key))
+			c.Header("Retry-After", ceilSeconds(res.RetryAfter))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
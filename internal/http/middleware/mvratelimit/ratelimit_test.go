@@ -0,0 +1,87 @@
+package mvratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"url-shortener/internal/ratelimit"
+)
+
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(context.Context, string, ratelimit.Rule) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("connection refused")
+}
+
+func newRouter(limiter ratelimit.Limiter, rule ratelimit.Rule) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.GET("/", New(limiter, rule, "", zap.NewNop()), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	return r
+}
+
+func get(r http.Handler, remoteAddr, apiKey string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = remoteAddr
+	if apiKey != "" {
+		req.Header.Set(DefaultAPIKeyHeader, apiKey)
+	}
+	r.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestRateLimit_Headers(t *testing.T) {
+	r := newRouter(ratelimit.NewMemory(), ratelimit.Rule{Name: "test", Rate: 0.5, Burst: 2, Key: ratelimit.KeyIP})
+
+	w := get(r, "10.0.0.1:1234", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "2", w.Header().Get("RateLimit-Reset"))
+
+	get(r, "10.0.0.1:1234", "")
+	w = get(r, "10.0.0.1:1234", "")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+
+	w = get(r, "10.0.0.2:1234", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRateLimit_ByAPIKey(t *testing.T) {
+	r := newRouter(ratelimit.NewMemory(), ratelimit.Rule{Name: "test", Rate: 1, Burst: 1, Key: ratelimit.KeyAPIKey})
+
+	assert.Equal(t, http.StatusOK, get(r, "10.0.0.1:1234", "a").Code)
+	assert.Equal(t, http.StatusTooManyRequests, get(r, "10.0.0.2:1234", "a").Code)
+	assert.Equal(t, http.StatusOK, get(r, "10.0.0.1:1234", "b").Code)
+}
+
+func TestRateLimit_Disabled(t *testing.T) {
+	r := newRouter(ratelimit.NewMemory(), ratelimit.Rule{Name: "test"})
+
+	for i := 0; i < 5; i++ {
+		w := get(r, "10.0.0.1:1234", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+	}
+}
+
+func TestRateLimit_FailsOpen(t *testing.T) {
+	r := newRouter(failingLimiter{}, ratelimit.Rule{Name: "test", Rate: 1, Burst: 1})
+
+	assert.Equal(t, http.StatusOK, get(r, "10.0.0.1:1234", "").Code)
+}
@@ -0,0 +1,27 @@
+package mvrequest
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"url-shortener/internal/audit"
+)
+
+// Header carries the ID of a request, both ways.
+const Header = "X-Request-Id"
+
+// New gives every request an ID: the one in its X-Request-Id header if it is
+// usable, otherwise a random one. The ID is sent back in the same header and
+// stored in the request context together with the client address, which
+// honours the trusted proxies of the engine, for the audit log.
+func New() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := audit.RequestID(c.GetHeader(Header))
+		c.Header(Header, id)
+		c.Request = c.Request.WithContext(audit.WithSource(c.Request.Context(), audit.Source{
+			RequestID: id,
+			IP:        c.ClientIP(),
+		}))
+
+		c.Next()
+	}
+}
@@ -0,0 +1,44 @@
+package mvrequest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"url-shortener/internal/audit"
+)
+
+func request(id string) (audit.Source, string) {
+	var got audit.Source
+	r := gin.New()
+	r.GET("/", New(), func(c *gin.Context) {
+		got, _ = audit.SourceFromContext(c.Request.Context())
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "203.0.113.7:52000"
+	if id != "" {
+		req.Header.Set(Header, id)
+	}
+	r.ServeHTTP(w, req)
+
+	return got, w.Header().Get(Header)
+}
+
+func TestRequest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	got, echoed := request("req-42.a_b")
+	assert.Equal(t, audit.Source{RequestID: "req-42.a_b", IP: "203.0.113.7"}, got)
+	assert.Equal(t, "req-42.a_b", echoed)
+
+	for _, id := range []string{"", "has space", "new\nline", string(make([]byte, 65))} {
+		got, echoed = request(id)
+		assert.Len(t, got.RequestID, 32, "%q is replaced by a random ID", id)
+		assert.Equal(t, got.RequestID, echoed)
+	}
+}
@@ -0,0 +1,23 @@
+package mvtenant
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"url-shortener/internal/tenant"
+)
+
+type Resolver interface {
+	ForHost(host string) string
+}
+
+// New stores the tenant owning the request host in the request context.
+// Authenticated requests act in the tenant of their principal instead.
+func New(tenants Resolver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if id := tenants.ForHost(c.Request.Host); id != tenant.Default {
+			c.Request = c.Request.WithContext(tenant.WithTenant(c.Request.Context(), id))
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,34 @@
+package mvtenant
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/tenant"
+)
+
+func TestTenant_FromHost(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tenants := tenant.NewRegistry([]config.TenantConfig{{ID: "acme", Hosts: []string{"go.acme.com"}}}, nil, zap.NewNop())
+
+	r := gin.New()
+	r.GET("/", New(tenants), func(c *gin.Context) {
+		c.String(http.StatusOK, tenant.FromContext(c.Request.Context()))
+	})
+
+	for host, want := range map[string]string{"go.acme.com:8080": "acme", "localhost:8080": tenant.Default} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.Host = host
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, want, w.Body.String(), host)
+	}
+}
@@ -0,0 +1,26 @@
+package mvvisitor
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"url-shortener/internal/analytics"
+	"url-shortener/internal/bots"
+)
+
+// New stores the client address, referrer, user agent and traffic class of
+// the request in the request context for click analytics. The address honours
+// the trusted proxies of the engine. bots may be nil.
+func New(bots *bots.Detector) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		verdict := bots.Classify(c.Request.UserAgent(), c.Request.Header)
+		c.Request = c.Request.WithContext(analytics.WithVisitor(c.Request.Context(), analytics.Visitor{
+			IP:        c.ClientIP(),
+			Referrer:  c.Request.Referer(),
+			UserAgent: c.Request.UserAgent(),
+			Class:     verdict.Class,
+			Bot:       verdict.Name,
+		}))
+
+		c.Next()
+	}
+}
@@ -0,0 +1,59 @@
+package mvvisitor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"url-shortener/internal/analytics"
+	"url-shortener/internal/bots"
+	"url-shortener/internal/config"
+	"url-shortener/internal/model"
+)
+
+func visit(detector *bots.Detector, userAgent string) analytics.Visitor {
+	var got analytics.Visitor
+	r := gin.New()
+	r.GET("/", New(detector), func(c *gin.Context) {
+		got, _ = analytics.VisitorFromContext(c.Request.Context())
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "203.0.113.7:52000"
+	req.Header.Set("Referer", "https://t.me/")
+	req.Header.Set("User-Agent", userAgent)
+	r.ServeHTTP(w, req)
+
+	return got
+}
+
+func TestVisitor(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	assert.Equal(t, analytics.Visitor{
+		IP: "203.0.113.7", Referrer: "https://t.me/", UserAgent: "curl/8.0", Class: model.ClassHuman,
+	}, visit(nil, "curl/8.0"))
+}
+
+func TestVisitor_Bots(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	path := filepath.Join(t.TempDir(), "bots.txt")
+	require.NoError(t, os.WriteFile(path, []byte("Slackbot Slack\n"), 0o600))
+	detector, err := bots.NewDetector(config.BotsConfig{SignatureFiles: []string{path}}, zaptest.NewLogger(t))
+	require.NoError(t, err)
+
+	got := visit(detector, "Slackbot 1.0 (+https://api.slack.com/robots)")
+	assert.Equal(t, model.ClassBot, got.Class)
+	assert.Equal(t, "Slack", got.Bot)
+
+	assert.Equal(t, model.ClassSuspicious, visit(detector, "curl/8.0").Class)
+}
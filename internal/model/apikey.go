@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// APIKey is a stored API key. Only a hash of the secret is kept.
+type APIKey struct {
+	// ID is the public part of the key, also used to manage it.
+	ID     string
+	Name   string
+	Hash   string
+	Scopes []string
+	// Tenant is the workspace the key acts for. Empty is the default tenant.
+	Tenant string
+
+	CreatedAt time.Time
+	// LastUsedAt is zero if the key has never been used.
+	LastUsedAt time.Time
+	// RevokedAt is zero for an active key. It may lie in the future while a
+	// rotated key is still in its grace period.
+	RevokedAt time.Time
+}
+
+// Active reports whether the key may be used at the given time.
+func (k APIKey) Active(at time.Time) bool {
+	return k.RevokedAt.IsZero() || at.Before(k.RevokedAt)
+}
@@ -0,0 +1,68 @@
+package model
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+)
+
+// AuditEntry is one record of the audit log: a change made to a link, or a
+// mutating admin request.
+type AuditEntry struct {
+	// ID is assigned by the audit store in the order entries are appended.
+	ID int64
+	At time.Time
+	// Actor is the subject of the authenticated caller; empty if there was
+	// none.
+	Actor  string
+	Tenant string
+	// Action is what was done: a link event type such as link.created, or
+	// the method and route of an admin request.
+	Action string
+	// Target identifies what was acted on, e.g. the code of a link.
+	Target string
+	// Before and After are JSON snapshots of the target around the change.
+	// Before is empty for creations and After for deletions.
+	Before    json.RawMessage
+	After     json.RawMessage
+	RequestID string
+	IP        string
+	// PrevHash and Hash chain the entry to the one appended before it when
+	// hash chaining is on; both are empty otherwise.
+	PrevHash string
+	Hash     string
+}
+
+// AuditQuery filters the audit log. Empty fields match every entry.
+type AuditQuery struct {
+	Actor string
+	// Tenants limits the entries to those of these tenants; empty matches
+	// every tenant, so that the default tenant can be asked for too.
+	Tenants   []string
+	Action    string
+	Target    string
+	RequestID string
+	// From is inclusive and To exclusive.
+	From time.Time
+	To   time.Time
+	// BeforeID pages through the log, newest first: only entries with a
+	// smaller ID match.
+	BeforeID int64
+}
+
+// Matches reports whether the entry passes the filters of the query.
+func (q AuditQuery) Matches(e AuditEntry) bool {
+	switch {
+	case q.Actor != "" && e.Actor != q.Actor,
+		len(q.Tenants) > 0 && !slices.Contains(q.Tenants, e.Tenant),
+		q.Action != "" && e.Action != q.Action,
+		q.Target != "" && e.Target != q.Target,
+		q.RequestID != "" && e.RequestID != q.RequestID,
+		!q.From.IsZero() && e.At.Before(q.From),
+		!q.To.IsZero() && !e.At.Before(q.To),
+		q.BeforeID > 0 && e.ID >= q.BeforeID:
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,175 @@
+package model
+
+import (
+	"cmp"
+	"time"
+
+	"url-shortener/internal/sketch"
+)
+
+// Classes of the traffic behind a click.
+const (
+	ClassHuman = "human"
+	// ClassBot is a known crawler or link preview bot.
+	ClassBot = "bot"
+	// ClassSuspicious is automated-looking traffic that is not a known bot.
+	ClassSuspicious = "suspicious"
+
+	// TrafficAll selects the clicks of every class.
+	TrafficAll = "all"
+)
+
+// Click is one successful resolve of a link.
+type Click struct {
+	// ID is assigned by storage in the order clicks are stored.
+	ID       int64
+	Tenant   string
+	Domain   string
+	ShortURL string
+	At       time.Time
+	// Referrer is the referring page without its query and fragment.
+	Referrer  string
+	UserAgent string
+	// IPHash identifies the client without revealing its address.
+	IPHash string
+	// Class is one of the Class constants; empty means ClassHuman.
+	Class string
+	// Bot names the bot of ClassBot clicks.
+	Bot string
+	// Country is the ISO 3166-1 code and City the English name of where the
+	// client is, when known.
+	Country string
+	City    string
+	// Device, OS and Browser are parsed from the user agent, by name only.
+	Device  string
+	OS      string
+	Browser string
+}
+
+func (c Click) Key() LinkKey {
+	return LinkKey{Tenant: c.Tenant, Domain: c.Domain, ShortURL: c.ShortURL}
+}
+
+// ResolvedEvent is the resolve event of the click. Its link only has the key.
+func (c Click) ResolvedEvent() LinkEvent {
+	return LinkEvent{
+		Type:  EventLinkResolved,
+		Link:  Link{Tenant: c.Tenant, Domain: c.Domain, ShortURL: c.ShortURL},
+		At:    c.At,
+		Class: cmp.Or(c.Class, ClassHuman),
+	}
+}
+
+// VisitorSketch estimates the unique visitors of a link on a day, counted by
+// the hashed client identifiers of its clicks.
+type VisitorSketch struct {
+	Tenant   string
+	Domain   string
+	ShortURL string
+	// Day is the UTC midnight the sketch starts at.
+	Day    time.Time
+	Sketch *sketch.HLL
+}
+
+func (v VisitorSketch) Key() LinkKey {
+	return LinkKey{Tenant: v.Tenant, Domain: v.Domain, ShortURL: v.ShortURL}
+}
+
+// ClickQuery selects the clicks of [From, To) and how they are summarized.
+type ClickQuery struct {
+	From time.Time
+	To   time.Time
+	// Interval is the width of the buckets of the time series. Buckets are
+	// aligned to multiples of it since the Unix epoch in UTC.
+	Interval time.Duration
+	// Top is how many values of every breakdown to return.
+	Top int
+	// Traffic is the class of the clicks counted, or TrafficAll; empty means
+	// ClassHuman. The breakdowns by class and bot always cover all clicks.
+	Traffic string
+}
+
+// ClickStats summarizes the clicks of a link.
+type ClickStats struct {
+	Total int64
+	// UniqueVisitors estimates the distinct visitors over the whole UTC days
+	// the query touches.
+	UniqueVisitors int64
+	// Series holds the buckets with at least one click, oldest first.
+	Series        []ClickBucket
+	TopReferrers  []ClickCount
+	TopUserAgents []ClickCount
+	// ByClass counts the clicks of every class, human ones included.
+	ByClass []ClickCount
+	// TopBots counts the clicks of the most active known bots.
+	TopBots []ClickCount
+	// TopCities values are "City, CC".
+	TopCountries []ClickCount
+	TopCities    []ClickCount
+	TopDevices   []ClickCount
+	TopOS        []ClickCount
+	TopBrowsers  []ClickCount
+}
+
+type ClickBucket struct {
+	Start  time.Time
+	Clicks int64
+}
+
+// ClickCount is how many clicks share a value, such as a referrer.
+type ClickCount struct {
+	Value  string
+	Clicks int64
+}
+
+// Granularities of click rollups.
+const (
+	RollupHourly = "hour"
+	RollupDaily  = "day"
+)
+
+// ClickRollup counts the clicks of a link in an hour or a UTC day that share
+// a class and one value of a dimension, such as a referrer.
+type ClickRollup struct {
+	Tenant      string
+	Domain      string
+	ShortURL    string
+	Granularity string
+	Bucket      time.Time
+	Class       string
+	// Dimension is "class", "bot", "referrer", "country", "city", "device",
+	// "os" or "browser".
+	Dimension string
+	Value     string
+	Clicks    int64
+}
+
+// ExportQuery selects the clicks or rollups of [From, To) to export.
+type ExportQuery struct {
+	From time.Time
+	To   time.Time
+	// Links limits the export to these links; empty exports every link.
+	Links []LinkKey
+	// Tenants limits the export to the links of these tenants; empty exports
+	// every tenant.
+	Tenants []string
+}
+
+// Retention is how long analytics data is kept; zero keeps it forever.
+type Retention struct {
+	Raw    time.Duration
+	Hourly time.Duration
+	Daily  time.Duration
+}
+
+// RollupResult is what a run of the click rollup did.
+type RollupResult struct {
+	// Ran is false if another instance was running the rollup.
+	Ran bool
+	// Hours and Days are how many hourly and daily buckets were rolled up.
+	Hours int
+	Days  int
+	// Deleted counts the raw clicks, rollups and visitor sketches removed
+	// past retention.
+	Deleted int64
+}
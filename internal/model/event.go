@@ -0,0 +1,84 @@
+package model
+
+import (
+	"slices"
+	"time"
+)
+
+// Types of link events.
+const (
+	EventLinkCreated = "link.created"
+	EventLinkUpdated = "link.updated"
+	EventLinkDeleted = "link.deleted"
+	// EventLinkExpired is reserved for links that expire; links do not expire
+	// yet.
+	EventLinkExpired = "link.expired"
+	// EventLinkFirstClicked is the first successful resolve of a link.
+	EventLinkFirstClicked = "link.first_clicked"
+	// EventLinkResolved is every successful resolve of a link.
+	EventLinkResolved = "link.resolved"
+)
+
+// LinkEvent is something that happened to a link.
+type LinkEvent struct {
+	Type string
+	// Link is the link after the event, or before it if it was deleted.
+	// Resolve events only carry the key and URL of the link.
+	Link Link
+	At   time.Time
+	// Class is the traffic class of the visitor of a resolve recorded as a
+	// click; see Click.
+	Class string
+}
+
+// Webhook is a subscription of an HTTP endpoint to the link events of a
+// tenant.
+type Webhook struct {
+	ID     string
+	Tenant string
+	URL    string
+	// Secret keys the signature of every delivery.
+	Secret string
+	// Events are the event types delivered; empty delivers all of them.
+	Events    []string
+	CreatedAt time.Time
+}
+
+// Wants reports whether the webhook subscribes to events of the type.
+func (w Webhook) Wants(event string) bool {
+	return len(w.Events) == 0 || slices.Contains(w.Events, event)
+}
+
+// WebhookDelivery is an event waiting in the outbox to be delivered to a
+// webhook, or given up on.
+type WebhookDelivery struct {
+	// ID is assigned by storage in the order deliveries are queued.
+	ID        int64
+	WebhookID string
+	// EventID identifies the event; deliveries of one event to several
+	// webhooks share it, so receivers can drop duplicates.
+	EventID string
+	Event   string
+	// Payload is the request body.
+	Payload       []byte
+	Attempts      int
+	NextAttemptAt time.Time
+	// LastError describes why the last attempt failed.
+	LastError string
+	CreatedAt time.Time
+	// DeadAt is when delivery was given up on; zero while it is retried.
+	DeadAt time.Time
+
+	// URL and Secret are those of the webhook, filled in when deliveries
+	// are claimed.
+	URL    string
+	Secret string
+}
+
+// OutboxEvent is a link event written to the outbox in the same transaction
+// as the change it describes, waiting to be published.
+type OutboxEvent struct {
+	// ID is assigned by storage in the order events are written.
+	ID int64
+	LinkEvent
+}
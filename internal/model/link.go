@@ -0,0 +1,45 @@
+package model
+
+import "time"
+
+// Link is a short URL together with the destination it resolves to.
+type Link struct {
+	ShortURL string
+	// URL is the destination exactly as it was submitted. The short URL
+	// redirects here.
+	URL string
+	// NormalizedURL is the canonical form of URL used for deduplication.
+	NormalizedURL string
+	// Owner is the authenticated user who created the link, if any.
+	Owner string
+	// Tenant is the workspace the link belongs to. Empty is the default
+	// tenant.
+	Tenant string
+	// Domain is the short domain the link is served on. Empty is the
+	// default domain. Short URLs and destinations are unique within a tenant
+	// and domain.
+	Domain    string
+	CreatedAt time.Time
+}
+
+// LinkKey identifies a link: the same short URL may exist in several tenants
+// and on several domains.
+type LinkKey struct {
+	Tenant   string
+	Domain   string
+	ShortURL string
+}
+
+func (l Link) Key() LinkKey {
+	return LinkKey{Tenant: l.Tenant, Domain: l.Domain, ShortURL: l.ShortURL}
+}
+
+// DedupKey returns the value two links must not share: the normalized URL, or
+// the URL itself if it was stored without normalization.
+func (l Link) DedupKey() string {
+	if l.NormalizedURL != "" {
+		return l.NormalizedURL
+	}
+
+	return l.URL
+}
@@ -0,0 +1,168 @@
+package normalize
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/idna"
+
+	"url-shortener/internal/config"
+)
+
+// DefaultTrackingParams are query parameters that only identify where a click
+// came from. A trailing "*" matches any parameter with that prefix.
+var DefaultTrackingParams = []string{"utm_*", "fbclid", "gclid", "yclid", "msclkid", "mc_cid", "mc_eid", "_ga"}
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+var ErrInvalidURL = errors.New("invalid URL")
+
+// Normalizer rewrites URLs to a canonical form so that spellings of the same
+// destination get the same short URL. It always lowercases the scheme and
+// host, converts IDN hosts to punycode, strips default ports and empty
+// queries and replaces an empty path with "/". Sorting query parameters and
+// dropping tracking parameters are optional.
+type Normalizer struct {
+	sortQuery      bool
+	dropTracking   bool
+	trackingExact  map[string]struct{}
+	trackingPrefix []string
+}
+
+func New(cfg config.NormalizeConfig) *Normalizer {
+	n := &Normalizer{
+		sortQuery:     cfg.SortQuery,
+		dropTracking:  cfg.DropTracking,
+		trackingExact: make(map[string]struct{}),
+	}
+
+	params := cfg.TrackingParams
+	if len(params) == 0 {
+		params = DefaultTrackingParams
+	}
+
+	for _, p := range params {
+		p = strings.ToLower(p)
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			n.trackingPrefix = append(n.trackingPrefix, prefix)
+			continue
+		}
+		n.trackingExact[p] = struct{}{}
+	}
+
+	return n
+}
+
+func (n *Normalizer) Normalize(rawURL string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidURL, err)
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+
+	if u.Host != "" {
+		host, err := n.host(u.Scheme, u.Host)
+		if err != nil {
+			return "", err
+		}
+		u.Host = host
+
+		if u.Path == "" {
+			u.Path = "/"
+		}
+	}
+
+	u.RawQuery = n.query(u.RawQuery)
+	u.ForceQuery = false
+
+	return u.String(), nil
+}
+
+func (n *Normalizer) host(scheme, hostport string) (string, error) {
+	host, port := hostport, ""
+	if h, p, err := net.SplitHostPort(hostport); err == nil {
+		host, port = h, p
+	} else if strings.HasPrefix(hostport, "[") {
+		host = strings.Trim(hostport, "[]")
+	}
+
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+
+	if net.ParseIP(host) == nil {
+		ascii, err := idna.Lookup.ToASCII(host)
+		if err != nil {
+			return "", fmt.Errorf("%w: host %q: %w", ErrInvalidURL, host, err)
+		}
+		host = ascii
+	}
+
+	if port == "" || defaultPorts[scheme] == port {
+		if strings.Contains(host, ":") {
+			return "[" + host + "]", nil
+		}
+		return host, nil
+	}
+
+	return net.JoinHostPort(host, port), nil
+}
+
+// query rewrites the raw query without re-encoding the parameters, so values
+// reach the destination exactly as they were submitted.
+func (n *Normalizer) query(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+
+	pairs := strings.Split(rawQuery, "&")
+	kept := pairs[:0]
+	for _, pair := range pairs {
+		if pair == "" {
+			continue
+		}
+		if n.dropTracking && n.isTracking(paramName(pair)) {
+			continue
+		}
+		kept = append(kept, pair)
+	}
+
+	if n.sortQuery {
+		sort.SliceStable(kept, func(i, j int) bool {
+			return paramName(kept[i]) < paramName(kept[j])
+		})
+	}
+
+	return strings.Join(kept, "&")
+}
+
+func (n *Normalizer) isTracking(name string) bool {
+	name = strings.ToLower(name)
+
+	if _, ok := n.trackingExact[name]; ok {
+		return true
+	}
+
+	for _, prefix := range n.trackingPrefix {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func paramName(pair string) string {
+	name, _, _ := strings.Cut(pair, "=")
+	if unescaped, err := url.QueryUnescape(name); err == nil {
+		return unescaped
+	}
+
+	return name
+}
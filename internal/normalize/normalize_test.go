@@ -0,0 +1,90 @@
+package normalize
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"url-shortener/internal/config"
+)
+
+func TestNormalize(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		cfg  config.NormalizeConfig
+		in   string
+		want string
+	}{
+		{name: "lowercase scheme and host", in: "HTTPS://Example.COM/Path", want: "https://example.com/Path"},
+		{name: "empty path", in: "https://example.com", want: "https://example.com/"},
+		{name: "empty query", in: "https://example.com/?", want: "https://example.com/"},
+		{name: "default https port", in: "https://example.com:443/a", want: "https://example.com/a"},
+		{name: "default http port", in: "http://example.com:80/a", want: "http://example.com/a"},
+		{name: "custom port kept", in: "http://example.com:8080/a", want: "http://example.com:8080/a"},
+		{name: "trailing dot", in: "https://example.com./", want: "https://example.com/"},
+		{name: "idn host", in: "https://Пример.рф/путь", want: "https://xn--e1afmkfd.xn--p1ai/%D0%BF%D1%83%D1%82%D1%8C"},
+		{name: "ipv6 default port", in: "http://[::1]:80/", want: "http://[::1]/"},
+		{name: "ipv6 custom port", in: "http://[::1]:8080/", want: "http://[::1]:8080/"},
+		{name: "query kept as is", in: "https://example.com/?b=2&a=1&utm_source=x", want: "https://example.com/?b=2&a=1&utm_source=x"},
+		{
+			name: "sort query",
+			cfg:  config.NormalizeConfig{SortQuery: true},
+			in:   "https://example.com/?b=2&a=1&a=0",
+			want: "https://example.com/?a=1&a=0&b=2",
+		},
+		{
+			name: "drop default tracking params",
+			cfg:  config.NormalizeConfig{DropTracking: true},
+			in:   "https://example.com/?utm_source=x&id=5&UTM_Medium=y&fbclid=abc",
+			want: "https://example.com/?id=5",
+		},
+		{
+			name: "drop only tracking params leaves no query",
+			cfg:  config.NormalizeConfig{DropTracking: true},
+			in:   "https://example.com/a?utm_campaign=x",
+			want: "https://example.com/a",
+		},
+		{
+			name: "custom tracking params",
+			cfg:  config.NormalizeConfig{DropTracking: true, TrackingParams: []string{"ref", "src_*"}},
+			in:   "https://example.com/?ref=1&src_a=2&utm_source=3",
+			want: "https://example.com/?utm_source=3",
+		},
+		{name: "fragment kept", in: "https://Example.com#top", want: "https://example.com/#top"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := New(tt.cfg).Normalize(tt.in)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNormalize_Equivalent(t *testing.T) {
+	t.Parallel()
+
+	n := New(config.NormalizeConfig{})
+
+	a, err := n.Normalize("HTTPS://Example.com/")
+	assert.NoError(t, err)
+	b, err := n.Normalize("https://example.com")
+	assert.NoError(t, err)
+	c, err := n.Normalize("https://example.com/?")
+	assert.NoError(t, err)
+
+	assert.Equal(t, a, b)
+	assert.Equal(t, a, c)
+}
+
+func TestNormalize_Invalid(t *testing.T) {
+	t.Parallel()
+
+	_, err := New(config.NormalizeConfig{}).Normalize("http://exa mple.com/")
+	assert.ErrorIs(t, err, ErrInvalidURL)
+}
@@ -0,0 +1,273 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"url-shortener/internal/config"
+)
+
+// resolveTimeout bounds the DNS lookup made for every checked URL.
+const resolveTimeout = 2 * time.Second
+
+var DefaultSchemes = []string{"http", "https"}
+
+var (
+	// ErrForbiddenDestination is wrapped by every policy violation.
+	ErrForbiddenDestination = errors.New("destination is not allowed")
+
+	ErrSchemeNotAllowed = errors.New("scheme is not allowed")
+	ErrDomainDenied     = errors.New("domain is deny-listed")
+	ErrDomainNotAllowed = errors.New("domain is not in the allow-list")
+	ErrPrivateAddress   = errors.New("destination resolves to a loopback, private or link-local address")
+	ErrUnresolvableHost = errors.New("destination host cannot be resolved")
+	ErrSelfReference    = errors.New("destination points back at the short domain")
+	ErrMissingHost      = errors.New("destination has no host")
+)
+
+// blockedPrefixes are special-purpose ranges not covered by the net.IP
+// helpers used in blockedIP.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// Resolver looks up the addresses of a host. *net.Resolver implements it.
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// Policy decides which destinations may be shortened.
+type Policy struct {
+	schemes      map[string]struct{}
+	allow        []string
+	deny         []string
+	blockPrivate bool
+	shortDomains map[string]struct{}
+	resolver     Resolver
+}
+
+// New builds a policy from cfg. resolver is used to check that hosts do not
+// resolve to internal addresses; nil means net.DefaultResolver.
+func New(cfg config.PolicyConfig, resolver Resolver) *Policy {
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+
+	p := &Policy{
+		schemes:      make(map[string]struct{}),
+		allow:        lower(cfg.AllowDomains),
+		deny:         lower(cfg.DenyDomains),
+		blockPrivate: cfg.BlockPrivateIPs,
+		shortDomains: make(map[string]struct{}),
+		resolver:     resolver,
+	}
+
+	schemes := cfg.AllowedSchemes
+	if len(schemes) == 0 {
+		schemes = DefaultSchemes
+	}
+	for _, s := range schemes {
+		p.schemes[strings.ToLower(s)] = struct{}{}
+	}
+
+	for _, d := range cfg.ShortDomains {
+		p.shortDomains[strings.ToLower(d)] = struct{}{}
+	}
+
+	return p
+}
+
+// Check returns an error wrapping ErrForbiddenDestination if rawURL must not
+// be shortened.
+func (p *Policy) Check(ctx context.Context, rawURL string) error {
+	if err := p.check(ctx, rawURL); err != nil {
+		return fmt.Errorf("%w: %w", ErrForbiddenDestination, err)
+	}
+
+	return nil
+}
+
+func (p *Policy) check(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := p.schemes[strings.ToLower(u.Scheme)]; !ok {
+		return fmt.Errorf("%w: %q", ErrSchemeNotAllowed, u.Scheme)
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return ErrMissingHost
+	}
+
+	if _, ok := p.shortDomains[host]; ok {
+		return ErrSelfReference
+	}
+
+	if matchAny(p.deny, host) {
+		return fmt.Errorf("%w: %s", ErrDomainDenied, host)
+	}
+
+	if len(p.allow) > 0 && !matchAny(p.allow, host) {
+		return fmt.Errorf("%w: %s", ErrDomainNotAllowed, host)
+	}
+
+	if p.blockPrivate {
+		return p.checkAddresses(ctx, host)
+	}
+
+	return nil
+}
+
+// checkAddresses rejects the host if it is, or resolves to, an internal
+// address. Every resolved address is checked, not just the first, so a name
+// that mixes public and internal records cannot slip through.
+func (p *Policy) checkAddresses(ctx context.Context, host string) error {
+	if ip, ok := parseIP(host); ok {
+		if blockedIP(ip) {
+			return fmt.Errorf("%w: %s", ErrPrivateAddress, ip)
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, resolveTimeout)
+	defer cancel()
+
+	addrs, err := p.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUnresolvableHost, err)
+	}
+
+	if len(addrs) == 0 {
+		return ErrUnresolvableHost
+	}
+
+	for _, addr := range addrs {
+		ip, ok := netip.AddrFromSlice(addr.IP)
+		if !ok {
+			return ErrUnresolvableHost
+		}
+		if blockedIP(ip.Unmap()) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrPrivateAddress, host, ip)
+		}
+	}
+
+	return nil
+}
+
+// DialControl is a net.Dialer Control function that refuses connections to
+// the addresses a policy blocking private IPs rejects. Checked at dial time,
+// it also holds for a host that resolved to a public address when its URL was
+// checked and to an internal one since.
+func DialControl(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrForbiddenDestination, err)
+	}
+
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrForbiddenDestination, err)
+	}
+	if blockedIP(ip) {
+		return fmt.Errorf("%w: %w: %s", ErrForbiddenDestination, ErrPrivateAddress, ip)
+	}
+
+	return nil
+}
+
+func blockedIP(ip netip.Addr) bool {
+	ip = ip.Unmap()
+
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return true
+	}
+
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseIP recognizes IP literals, including the shorthand IPv4 forms browsers
+// accept, such as 2852039166, 0xA9FEA9FE or 0251.0376.0251.0376.
+func parseIP(host string) (netip.Addr, bool) {
+	if ip, err := netip.ParseAddr(strings.Trim(host, "[]")); err == nil {
+		return ip.Unmap(), true
+	}
+
+	parts := strings.Split(host, ".")
+	if len(parts) > 4 {
+		return netip.Addr{}, false
+	}
+
+	nums := make([]uint64, len(parts))
+	for i, part := range parts {
+		n, err := strconv.ParseUint(part, 0, 32)
+		if err != nil {
+			return netip.Addr{}, false
+		}
+		nums[i] = n
+	}
+
+	// Like inet_aton, the last part fills all remaining bytes.
+	var v uint64
+	for i, n := range nums[:len(nums)-1] {
+		if n > 0xff {
+			return netip.Addr{}, false
+		}
+		v |= n << (24 - 8*i)
+	}
+
+	last := nums[len(nums)-1]
+	if last >= 1<<(8*(5-len(nums))) {
+		return netip.Addr{}, false
+	}
+	v |= last
+
+	return netip.AddrFrom4([4]byte{byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}), true
+}
+
+// matchAny reports whether host matches one of the patterns. A pattern is an
+// exact host name or a glob such as "*.example.com".
+func matchAny(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		if pattern == host {
+			return true
+		}
+		if ok, _ := path.Match(pattern, host); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func lower(values []string) []string {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		out = append(out, strings.ToLower(v))
+	}
+
+	return out
+}
@@ -0,0 +1,122 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"url-shortener/internal/config"
+)
+
+type fakeResolver map[string][]string
+
+func (r fakeResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	ips, ok := r[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+
+	addrs := make([]net.IPAddr, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+
+	return addrs, nil
+}
+
+var resolver = fakeResolver{
+	"example.com":        {"93.184.216.34"},
+	"www.example.com":    {"93.184.216.34"},
+	"evil.example.net":   {"93.184.216.35"},
+	"internal.corp":      {"10.0.0.5"},
+	"rebind.attacker.io": {"93.184.216.36", "127.0.0.1"},
+	"metadata.v6":        {"fe80::1"},
+	"mapped.v6":          {"::ffff:192.168.1.1"},
+	"good.example.org":   {"2606:2800:220:1:248:1893:25c8:1946"},
+}
+
+func TestPolicy_Check(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.PolicyConfig{
+		BlockPrivateIPs: true,
+		DenyDomains:     []string{"*.example.net", "bad.com"},
+		ShortDomains:    []string{"sho.rt"},
+	}
+	p := New(cfg, resolver)
+
+	tests := []struct {
+		name string
+		url  string
+		err  error
+	}{
+		{name: "public https", url: "https://example.com/a"},
+		{name: "public ipv6 host", url: "https://good.example.org/"},
+		{name: "javascript scheme", url: "javascript:alert(1)", err: ErrSchemeNotAllowed},
+		{name: "file scheme", url: "file:///etc/passwd", err: ErrSchemeNotAllowed},
+		{name: "metadata ip", url: "http://169.254.169.254/latest/meta-data", err: ErrPrivateAddress},
+		{name: "decimal metadata ip", url: "http://2852039166/", err: ErrPrivateAddress},
+		{name: "hex metadata ip", url: "http://0xA9FEA9FE/", err: ErrPrivateAddress},
+		{name: "octal loopback", url: "http://0177.0.0.1/", err: ErrPrivateAddress},
+		{name: "short loopback", url: "http://127.1/", err: ErrPrivateAddress},
+		{name: "ipv6 loopback", url: "http://[::1]:8080/", err: ErrPrivateAddress},
+		{name: "private via dns", url: "http://internal.corp/", err: ErrPrivateAddress},
+		{name: "rebinding mixed records", url: "http://rebind.attacker.io/", err: ErrPrivateAddress},
+		{name: "link-local v6 via dns", url: "http://metadata.v6/", err: ErrPrivateAddress},
+		{name: "mapped private v6", url: "http://mapped.v6/", err: ErrPrivateAddress},
+		{name: "unresolvable", url: "http://nowhere.invalid/", err: ErrUnresolvableHost},
+		{name: "wildcard deny", url: "https://evil.example.net/", err: ErrDomainDenied},
+		{name: "exact deny", url: "https://BAD.com/", err: ErrDomainDenied},
+		{name: "own short domain", url: "https://sho.rt/abc", err: ErrSelfReference},
+		{name: "no host", url: "https:///path", err: ErrMissingHost},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := p.Check(context.Background(), tt.url)
+			if tt.err == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, ErrForbiddenDestination)
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestPolicy_AllowList(t *testing.T) {
+	t.Parallel()
+
+	p := New(config.PolicyConfig{AllowDomains: []string{"*.example.com"}}, resolver)
+
+	assert.NoError(t, p.Check(context.Background(), "https://www.example.com/"))
+	assert.ErrorIs(t, p.Check(context.Background(), "https://example.com/"), ErrDomainNotAllowed)
+	assert.ErrorIs(t, p.Check(context.Background(), "https://example.org/"), ErrDomainNotAllowed)
+}
+
+func TestPolicy_CustomSchemesWithoutIPBlocking(t *testing.T) {
+	t.Parallel()
+
+	p := New(config.PolicyConfig{AllowedSchemes: []string{"https", "ftp"}}, resolver)
+
+	assert.NoError(t, p.Check(context.Background(), "ftp://127.0.0.1/file"))
+	assert.ErrorIs(t, p.Check(context.Background(), "http://example.com/"), ErrSchemeNotAllowed)
+}
+
+func TestDialControl(t *testing.T) {
+	t.Parallel()
+
+	for _, address := range []string{"127.0.0.1:80", "10.0.0.5:443", "[fe80::1]:80", "[::ffff:169.254.169.254]:80", "0.0.0.0:8080"} {
+		err := DialControl("tcp", address, nil)
+		assert.ErrorIs(t, err, ErrForbiddenDestination, address)
+		assert.ErrorIs(t, err, ErrPrivateAddress, address)
+	}
+
+	assert.NoError(t, DialControl("tcp", "93.184.216.34:443", nil))
+	assert.NoError(t, DialControl("tcp6", "[2606:2800:220:1:248:1893:25c8:1946]:443", nil))
+}
@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepEvery is how many requests pass between removals of idle buckets.
+const sweepEvery = 10000
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time
+}
+
+// Memory keeps token buckets in process memory. Each instance enforces its
+// limits on its own.
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	calls   int
+	now     func() time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+func (m *Memory) Allow(_ context.Context, key string, rule Rule) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rule.Burst), updated: now}
+		m.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(rule.Burst), b.tokens+now.Sub(b.updated).Seconds()*rule.Rate)
+	b.updated = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+
+	res := newResult(rule, b.tokens, allowed)
+	b.full = now.Add(res.Reset)
+
+	return res, nil
+}
+
+// sweep drops buckets that have refilled completely, since a fresh bucket
+// behaves the same. It runs every sweepEvery calls to bound memory use.
+func (m *Memory) sweep(now time.Time) {
+	m.calls++
+	if m.calls < sweepEvery {
+		return
+	}
+	m.calls = 0
+
+	for key, b := range m.buckets {
+		if !now.Before(b.full) {
+			delete(m.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"time"
+
+	"url-shortener/internal/config"
+)
+
+const (
+	KeyIP     = "ip"
+	KeyAPIKey = "api_key"
+	KeyRoute  = "route"
+)
+
+// Rule is a token bucket: it holds up to Burst tokens and refills at Rate
+// tokens per second. Every request takes one token.
+type Rule struct {
+	// Name identifies the rule in bucket keys, e.g. "shorten".
+	Name  string
+	Rate  float64
+	Burst int
+	// Key is what requests are grouped by: KeyIP, KeyAPIKey or KeyRoute.
+	Key string
+}
+
+func RuleFromConfig(name string, cfg config.RateLimitRule) Rule {
+	key := cfg.Key
+	if key == "" {
+		key = KeyIP
+	}
+
+	burst := cfg.Burst
+	if burst <= 0 {
+		burst = int(math.Ceil(cfg.Rate))
+	}
+
+	return Rule{Name: name, Rate: cfg.Rate, Burst: burst, Key: key}
+}
+
+// Enabled reports whether the rule limits anything at all.
+func (r Rule) Enabled() bool {
+	return r.Rate > 0
+}
+
+// BucketKey returns the bucket a request belongs to. clientIP and apiKey are
+// the caller's identity; requests without an API key fall back to the IP.
+func (r Rule) BucketKey(clientIP, apiKey string) string {
+	switch {
+	case r.Key == KeyRoute:
+		return r.Name + ":route"
+	case r.Key == KeyAPIKey && apiKey != "":
+		// Only a digest of the key ends up in memory or in the database.
+		sum := sha256.Sum256([]byte(apiKey))
+		return r.Name + ":key:" + hex.EncodeToString(sum[:16])
+	default:
+		return r.Name + ":ip:" + clientIP
+	}
+}
+
+// Result describes the state of a bucket after a request.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// RetryAfter is how long until the next token, set when not allowed.
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+}
+
+// Limiter takes a token from the bucket identified by key.
+type Limiter interface {
+	Allow(ctx context.Context, key string, rule Rule) (Result, error)
+}
+
+func newResult(rule Rule, tokens float64, allowed bool) Result {
+	res := Result{
+		Allowed:   allowed,
+		Limit:     rule.Burst,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     seconds((float64(rule.Burst) - tokens) / rule.Rate),
+	}
+
+	if !allowed {
+		res.RetryAfter = seconds((1 - tokens) / rule.Rate)
+	}
+
+	return res
+}
+
+func seconds(s float64) time.Duration {
+	if s <= 0 {
+		return 0
+	}
+
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"url-shortener/internal/config"
+)
+
+func TestMemory_Allow(t *testing.T) {
+	now := time.Unix(0, 0)
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+
+	rule := Rule{Name: "shorten", Rate: 1, Burst: 3}
+
+	for i := 2; i >= 0; i-- {
+		res, err := m.Allow(context.Background(), "k", rule)
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 3, res.Limit)
+		assert.Equal(t, i, res.Remaining)
+	}
+
+	res, err := m.Allow(context.Background(), "k", rule)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, time.Second, res.RetryAfter)
+	assert.Equal(t, 3*time.Second, res.Reset)
+
+	res, _ = m.Allow(context.Background(), "other", rule)
+	assert.True(t, res.Allowed, "buckets are per key")
+
+	now = now.Add(1500 * time.Millisecond)
+	res, _ = m.Allow(context.Background(), "k", rule)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+
+	res, _ = m.Allow(context.Background(), "k", rule)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 500*time.Millisecond, res.RetryAfter)
+}
+
+func TestMemory_Sweep(t *testing.T) {
+	now := time.Unix(0, 0)
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+
+	rule := Rule{Name: "resolve", Rate: 10, Burst: 10}
+	_, _ = m.Allow(context.Background(), "idle", rule)
+
+	now = now.Add(time.Second)
+	m.calls = sweepEvery - 1
+	_, _ = m.Allow(context.Background(), "busy", rule)
+
+	assert.NotContains(t, m.buckets, "idle")
+	assert.Contains(t, m.buckets, "busy")
+}
+
+type fakeStore struct {
+	tokens map[string]float64
+	err    error
+}
+
+func (f *fakeStore) TakeToken(key string, _ float64, burst int) (bool, float64, error) {
+	if f.err != nil {
+		return false, 0, f.err
+	}
+
+	tokens, ok := f.tokens[key]
+	if !ok {
+		tokens = float64(burst)
+	}
+
+	if tokens < 1 {
+		return false, tokens, nil
+	}
+
+	f.tokens[key] = tokens - 1
+	return true, tokens - 1, nil
+}
+
+func TestShared_Allow(t *testing.T) {
+	store := &fakeStore{tokens: map[string]float64{}}
+	s := NewShared(store)
+	rule := Rule{Name: "shorten", Rate: 2, Burst: 1}
+
+	res, err := s.Allow(context.Background(), "k", rule)
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+
+	res, err = s.Allow(context.Background(), "k", rule)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 500*time.Millisecond, res.RetryAfter)
+
+	store.err = errors.New("connection refused")
+	_, err = s.Allow(context.Background(), "k", rule)
+	assert.Error(t, err)
+}
+
+func TestRule_BucketKey(t *testing.T) {
+	byIP := RuleFromConfig("shorten", config.RateLimitRule{Rate: 1})
+	assert.Equal(t, KeyIP, byIP.Key)
+	assert.Equal(t, 1, byIP.Burst)
+	assert.Equal(t, "shorten:ip:10.0.0.1", byIP.BucketKey("10.0.0.1", "secret"))
+
+	byKey := RuleFromConfig("shorten", config.RateLimitRule{Rate: 1, Key: KeyAPIKey})
+	key := byKey.BucketKey("10.0.0.1", "secret")
+	assert.NotContains(t, key, "secret")
+	assert.NotEqual(t, key, byKey.BucketKey("10.0.0.1", "other"))
+	assert.Equal(t, "shorten:ip:10.0.0.1", byKey.BucketKey("10.0.0.1", ""), "falls back to the IP")
+
+	byRoute := RuleFromConfig("resolve", config.RateLimitRule{Rate: 1, Key: KeyRoute})
+	assert.Equal(t, byRoute.BucketKey("10.0.0.1", ""), byRoute.BucketKey("10.0.0.2", "x"))
+
+	assert.False(t, RuleFromConfig("resolve", config.RateLimitRule{}).Enabled())
+}
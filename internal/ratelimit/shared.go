@@ -0,0 +1,33 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+)
+
+// TokenStore keeps token buckets in storage shared by all instances.
+// postgres.Storage implements it.
+type TokenStore interface {
+	// TakeToken refills the bucket for the time passed since it was last
+	// used, takes a token if one is available and returns whether it did and
+	// how many tokens are left. It must be atomic across instances.
+	TakeToken(key string, rate float64, burst int) (allowed bool, tokens float64, err error)
+}
+
+// Shared enforces limits across all instances through a TokenStore.
+type Shared struct {
+	store TokenStore
+}
+
+func NewShared(store TokenStore) *Shared {
+	return &Shared{store: store}
+}
+
+func (s *Shared) Allow(_ context.Context, key string, rule Rule) (Result, error) {
+	allowed, tokens, err := s.store.TakeToken(key, rule.Rate, rule.Burst)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to take rate limit token: %w", err)
+	}
+
+	return newResult(rule, tokens, allowed), nil
+}
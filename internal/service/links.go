@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"url-shortener/internal/auth"
+	"url-shortener/internal/domain"
+	"url-shortener/internal/model"
+	"url-shortener/internal/storage/errs"
+)
+
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 100
+)
+
+var (
+	ErrLinkNotFound = errors.New("link not found")
+	ErrNotOwner     = errors.New("only the owner or an admin can manage this link")
+)
+
+// LinkPage is one page of links. Next is the cursor for the following page
+// and is empty on the last page.
+type LinkPage struct {
+	Links []model.Link
+	Next  string
+}
+
+// ListMine returns the links created by the principal in ctx in its tenant on
+// all short domains, newest first.
+// after is the Next cursor of the previous page.
+func (s *Shortener) ListMine(ctx context.Context, after string, limit int) (LinkPage, error) {
+	principal, ok := auth.FromContext(ctx)
+	if !ok {
+		return LinkPage{}, auth.ErrMissingCredentials
+	}
+
+	if limit <= 0 {
+		limit = DefaultPageSize
+	}
+	limit = min(limit, MaxPageSize)
+
+	// One extra link tells whether there is a next page.
+	links, err := s.Storage.ListByOwner(principal.Tenant, principal.Subject, parseCursor(after), limit+1)
+	if errors.Is(err, errs.ErrURLIsNotExist) {
+		return LinkPage{}, ErrLinkNotFound
+	}
+	if err != nil {
+		return LinkPage{}, err
+	}
+
+	page := LinkPage{Links: links}
+	if len(links) > limit {
+		page.Links = links[:limit]
+		page.Next = cursor(links[limit-1])
+	}
+
+	return page, nil
+}
+
+// cursor identifies link in a page token: its code, prefixed by its domain if
+// it has one. Codes and hostnames never contain a slash.
+func cursor(link model.Link) string {
+	if link.Domain == domain.Default {
+		return link.ShortURL
+	}
+
+	return link.Domain + "/" + link.ShortURL
+}
+
+func parseCursor(after string) model.LinkKey {
+	host, code, ok := strings.Cut(after, "/")
+	if !ok {
+		return model.LinkKey{ShortURL: after}
+	}
+
+	return model.LinkKey{Domain: host, ShortURL: code}
+}
+
+// Update points the short URL code at url. Only the owner of the link or an
+// admin may do so.
+func (s *Shortener) Update(ctx context.Context, code, url string) (model.Link, error) {
+	s.Log.Info("Update link", zap.String("code", code), zap.String("url", url))
+
+	link, err := s.owned(ctx, code)
+	if err != nil {
+		return model.Link{}, err
+	}
+
+	normalized, err := s.vet(ctx, url)
+	if err != nil {
+		return model.Link{}, err
+	}
+
+	before := link
+	link.URL, link.NormalizedURL = url, normalized
+	err = s.Storage.Update(link)
+	switch {
+	case err == nil:
+		s.publish(ctx, model.EventLinkUpdated, link)
+		s.audit(ctx, model.EventLinkUpdated, link, before, link)
+		return link, nil
+	case errors.Is(err, errs.ErrURLIsExist):
+		return model.Link{}, fmt.Errorf("url already exists")
+	case errors.Is(err, errs.ErrURLIsNotExist):
+		return model.Link{}, ErrLinkNotFound
+	default:
+		return model.Link{}, err
+	}
+}
+
+// Delete removes the short URL code. Only the owner of the link or an admin
+// may do so.
+func (s *Shortener) Delete(ctx context.Context, code string) error {
+	s.Log.Info("Delete link", zap.String("code", code))
+
+	link, err := s.owned(ctx, code)
+	if err != nil {
+		return err
+	}
+
+	err = s.Storage.Delete(link.Key())
+	if errors.Is(err, errs.ErrURLIsNotExist) {
+		return ErrLinkNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	s.publish(ctx, model.EventLinkDeleted, link)
+	s.audit(ctx, model.EventLinkDeleted, link, link, nil)
+
+	return nil
+}
+
+// owned loads the link from the tenant of the principal in ctx and the short
+// domain of the request and checks that the principal may manage it. Links of
+// other tenants are not found at all.
+func (s *Shortener) owned(ctx context.Context, code string) (model.Link, error) {
+	principal, ok := auth.FromContext(ctx)
+	if !ok {
+		return model.Link{}, auth.ErrMissingCredentials
+	}
+
+	host, err := s.Domains.Canonical(domain.FromContext(ctx))
+	if err != nil {
+		return model.Link{}, err
+	}
+
+	link, err := s.getLink(model.LinkKey{Tenant: principal.Tenant, Domain: host, ShortURL: code})
+	if errors.Is(err, errs.ErrURLIsNotExist) {
+		return model.Link{}, ErrLinkNotFound
+	}
+	if err != nil {
+		return model.Link{}, err
+	}
+
+	if !principal.HasScope(auth.ScopeAdmin) && (link.Owner == "" || link.Owner != principal.Subject) {
+		s.Log.Info("link access denied", zap.String("code", code), zap.String("subject", principal.Subject))
+		return model.Link{}, ErrNotOwner
+	}
+
+	return link, nil
+}
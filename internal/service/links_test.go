@@ -0,0 +1,287 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"url-shortener/internal/auth"
+	"url-shortener/internal/config"
+	"url-shortener/internal/domain"
+	"url-shortener/internal/model"
+	"url-shortener/internal/policy"
+	"url-shortener/internal/storage/memory"
+	"url-shortener/internal/tenant"
+)
+
+func as(subject string, scopes ...string) context.Context {
+	return auth.WithPrincipal(context.Background(), auth.Principal{Subject: subject, Scopes: scopes})
+}
+
+func TestListMine_Paginates(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	service := NewShortener(memory.NewStorageInMemory(logger), logger)
+
+	for i := range 5 {
+		_, err := service.ShortenContext(as("alice"), fmt.Sprintf("https://example.com/%d", i), fmt.Sprintf("alice%d", i))
+		require.NoError(t, err)
+	}
+	_, err := service.ShortenContext(as("bob"), "https://bob.com", "")
+	require.NoError(t, err)
+
+	var seen []string
+	after := ""
+	for {
+		page, err := service.ListMine(as("alice"), after, 2)
+		require.NoError(t, err)
+		for _, link := range page.Links {
+			seen = append(seen, link.ShortURL)
+		}
+		if page.Next == "" {
+			break
+		}
+		after = page.Next
+	}
+
+	assert.ElementsMatch(t, []string{"alice0", "alice1", "alice2", "alice3", "alice4"}, seen)
+
+	_, err = service.ListMine(context.Background(), "", 0)
+	assert.ErrorIs(t, err, auth.ErrMissingCredentials)
+}
+
+func TestUpdateAndDelete_OnlyOwnerOrAdmin(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	service := NewShortener(memory.NewStorageInMemory(logger), logger)
+	service.Policy = policy.New(config.PolicyConfig{DenyDomains: []string{"evil.example"}}, nil)
+
+	code, err := service.ShortenContext(as("alice"), originalURL, "")
+	require.NoError(t, err)
+
+	_, err = service.Update(as("bob"), code, "https://bob.com")
+	assert.ErrorIs(t, err, ErrNotOwner)
+	assert.ErrorIs(t, service.Delete(as("bob"), code), ErrNotOwner)
+	assert.ErrorIs(t, service.Delete(context.Background(), code), auth.ErrMissingCredentials)
+
+	link, err := service.Update(as("alice"), code, "https://alice.com/new")
+	require.NoError(t, err)
+	assert.Equal(t, "https://alice.com/new", link.URL)
+
+	resolved, err := service.Resolve(code)
+	require.NoError(t, err)
+	assert.Equal(t, "https://alice.com/new", resolved)
+
+	_, err = service.Update(as("alice"), code, "https://evil.example/")
+	assert.Error(t, err, "updates are vetted like new links")
+
+	require.NoError(t, service.Delete(as("root", auth.ScopeAdmin), code))
+	_, err = service.Resolve(code)
+	assert.Error(t, err)
+
+	assert.ErrorIs(t, service.Delete(as("alice"), code), ErrLinkNotFound)
+}
+
+func TestUpdate_AnonymousLinksNeedAdmin(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	service := NewShortener(memory.NewStorageInMemory(logger), logger)
+
+	code, err := service.Shorten(originalURL)
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, service.Delete(as(""), code), ErrNotOwner)
+	assert.NoError(t, service.Delete(as("root", auth.ScopeAdmin), code))
+}
+
+func TestTenants_Isolated(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	service := NewShortener(memory.NewStorageInMemory(logger), logger)
+
+	acme := auth.WithPrincipal(context.Background(), auth.Principal{Subject: "alice", Tenant: "acme"})
+	globex := auth.WithPrincipal(context.Background(), auth.Principal{Subject: "alice", Tenant: "globex", Scopes: []string{auth.ScopeAdmin}})
+
+	_, err := service.ShortenContext(acme, "https://example.com", "promo")
+	require.NoError(t, err)
+	_, err = service.ShortenContext(globex, "https://example.com", "promo")
+	require.NoError(t, err, "aliases and destinations are unique per tenant")
+
+	res, err := service.LookupContext(tenant.WithTenant(context.Background(), "acme"), "promo")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com", res.URL)
+
+	_, err = service.Lookup("promo")
+	assert.Error(t, err, "the default tenant has no such link")
+
+	_, err = service.Update(globex, "promo", "https://globex.com")
+	require.NoError(t, err)
+	res, err = service.LookupContext(acme, "promo")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com", res.URL, "globex only changes its own promo")
+
+	require.NoError(t, service.Delete(globex, "promo"))
+	assert.ErrorIs(t, service.Delete(globex, "promo"), ErrLinkNotFound)
+
+	page, err := service.ListMine(acme, "", 0)
+	require.NoError(t, err)
+	assert.Len(t, page.Links, 1)
+}
+
+func TestTenants_Quota(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	service := NewShortener(memory.NewStorageInMemory(logger), logger)
+	service.Tenants = tenant.NewRegistry([]config.TenantConfig{{ID: "acme", Hosts: []string{"go.acme.com"}, MaxLinks: 1}}, nil, logger)
+
+	ctx := tenant.WithTenant(context.Background(), "acme")
+	_, err := service.ShortenContext(ctx, "https://one.com", "")
+	require.NoError(t, err)
+	_, err = service.ShortenContext(ctx, "https://two.com", "")
+	assert.ErrorIs(t, err, tenant.ErrLinkQuotaExceeded)
+
+	_, err = service.Shorten("https://two.com")
+	assert.NoError(t, err, "other tenants are not affected")
+}
+
+func TestDomains_SameCodeOnEachDomain(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	service := NewShortener(memory.NewStorageInMemory(logger), logger)
+	service.Domains = domain.NewRegistry([]config.DomainConfig{{Host: "go.brand-a.com"}, {Host: "l.brand-b.io"}})
+
+	brandA := domain.WithDomain(as("alice"), "go.brand-a.com")
+	brandB := domain.WithDomain(as("alice"), "l.brand-b.io")
+
+	_, err := service.ShortenContext(brandA, "https://example.com/a", "promo")
+	require.NoError(t, err)
+	_, err = service.ShortenContext(brandB, "https://example.com/b", "promo")
+	require.NoError(t, err)
+
+	assert.Equal(t, "https://l.brand-b.io/promo", service.ShortURL(brandB, "promo"))
+
+	res, err := service.LookupContext(brandB, "promo")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/b", res.URL)
+
+	res, err = service.Lookup("promo")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/a", res.URL, "requests without a domain use the primary one")
+
+	_, err = service.ShortenContext(domain.WithDomain(context.Background(), "evil.example"), "https://example.com/c", "")
+	assert.ErrorIs(t, err, domain.ErrUnknownDomain)
+
+	page, err := service.ListMine(as("alice"), "", 1)
+	require.NoError(t, err)
+	require.NotEmpty(t, page.Next)
+	next, err := service.ListMine(as("alice"), page.Next, 1)
+	require.NoError(t, err)
+	require.Len(t, next.Links, 1)
+	assert.NotEqual(t, page.Links[0].Domain, next.Links[0].Domain, "the cursor tells equal codes apart")
+
+	require.NoError(t, service.Delete(brandB, "promo"))
+	_, err = service.LookupContext(brandA, "promo")
+	assert.NoError(t, err)
+}
+
+func TestDomains_LegacyLinks(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	storage := memory.NewStorageInMemory(logger)
+	// Stored before short domains were configured.
+	require.NoError(t, storage.Put(model.Link{ShortURL: "legacy", URL: "https://example.com/old", Owner: "alice"}))
+
+	service := NewShortener(storage, logger)
+	service.Domains = domain.NewRegistry([]config.DomainConfig{{Host: "go.brand-a.com"}, {Host: "l.brand-b.io"}})
+
+	res, err := service.Lookup("legacy")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/old", res.URL)
+
+	brandA := domain.WithDomain(as("alice"), "go.brand-a.com")
+	res, err = service.LookupContext(brandA, "legacy")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/old", res.URL)
+
+	_, err = service.LookupContext(domain.WithDomain(context.Background(), "l.brand-b.io"), "legacy")
+	assert.Error(t, err, "only the primary domain falls back")
+
+	require.NoError(t, service.Delete(brandA, "legacy"))
+	_, err = storage.GetLink(model.LinkKey{ShortURL: "legacy"})
+	assert.Error(t, err)
+}
+
+type eventLog []model.LinkEvent
+
+func (l *eventLog) Publish(_ context.Context, event model.LinkEvent) {
+	*l = append(*l, event)
+}
+
+func TestLinkEvents(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	service := NewShortener(memory.NewStorageInMemory(logger), logger)
+	var events eventLog
+	service.Events = &events
+
+	code, err := service.ShortenContext(as("alice"), originalURL, "")
+	require.NoError(t, err)
+	_, err = service.ShortenContext(as("alice"), "https://example.com/alias", "alias")
+	require.NoError(t, err)
+	_, err = service.ShortenContext(as("alice"), originalURL, "")
+	require.Error(t, err)
+
+	_, err = service.Resolve(code)
+	require.NoError(t, err)
+	_, err = service.Update(as("alice"), code, "https://alice.com/new")
+	require.NoError(t, err)
+	require.NoError(t, service.Delete(as("alice"), code))
+	assert.Error(t, service.Delete(as("alice"), code))
+
+	var types []string
+	for _, e := range events {
+		types = append(types, e.Type+" "+e.Link.ShortURL)
+		assert.False(t, e.At.IsZero())
+	}
+	assert.Equal(t, []string{
+		model.EventLinkCreated + " " + code,
+		model.EventLinkCreated + " alias",
+		model.EventLinkResolved + " " + code,
+		model.EventLinkUpdated + " " + code,
+		model.EventLinkDeleted + " " + code,
+	}, types)
+	assert.Equal(t, "alice", events[0].Link.Owner)
+	assert.Equal(t, originalURL, events[2].Link.URL)
+	assert.Equal(t, "https://alice.com/new", events[4].Link.URL)
+}
+
+type auditRecord struct {
+	action, target string
+	before, after  any
+}
+
+type auditLog []auditRecord
+
+func (l *auditLog) Record(_ context.Context, action, target string, before, after any) {
+	*l = append(*l, auditRecord{action, target, before, after})
+}
+
+func TestAudit(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	service := NewShortener(memory.NewStorageInMemory(logger), logger)
+	var audit auditLog
+	service.Audit = &audit
+
+	code, err := service.ShortenContext(as("alice"), originalURL, "")
+	require.NoError(t, err)
+	_, err = service.Resolve(code)
+	require.NoError(t, err)
+	_, err = service.Update(as("bob"), code, "https://bob.com")
+	require.ErrorIs(t, err, ErrNotOwner)
+	updated, err := service.Update(as("alice"), code, "https://alice.com/new")
+	require.NoError(t, err)
+	require.NoError(t, service.Delete(as("alice"), code))
+
+	require.Len(t, audit, 3, "only changes that were made are recorded")
+	created := audit[0].after.(model.Link)
+	assert.Equal(t, auditRecord{model.EventLinkCreated, code, nil, created}, audit[0])
+	assert.Equal(t, originalURL, created.URL)
+	assert.Equal(t, auditRecord{model.EventLinkUpdated, code, created, updated}, audit[1])
+	assert.Equal(t, auditRecord{model.EventLinkDeleted, code, updated, nil}, audit[2])
+}
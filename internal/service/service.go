@@ -1,60 +1,484 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"go.uber.org/zap"
 
+	"url-shortener/internal/auth"
+	"url-shortener/internal/config"
+	"url-shortener/internal/domain"
+	"url-shortener/internal/generator"
+	"url-shortener/internal/model"
+	"url-shortener/internal/normalize"
+	"url-shortener/internal/ratelimit"
 	"url-shortener/internal/storage/errs"
+	"url-shortener/internal/tenant"
+	"url-shortener/internal/threat"
 	"url-shortener/pkg/util/random"
 )
 
-const shortURLLength = 10
+// maxGenerateAttempts bounds how many codes Shorten tries before giving up
+// when every generated code is already taken or filtered out.
+const maxGenerateAttempts = 10
+
+const (
+	minAliasLength = 3
+	maxAliasLength = 32
+)
+
+// maxSuggestionLookups bounds the storage lookups Resolve makes while looking
+// for the code a mistyped one was meant to be.
+const maxSuggestionLookups = 5
+
+// suggestionRule bounds those lookups across all requests of a tenant, so a
+// flood of mistyped codes cannot multiply storage reads. Without tokens left,
+// mistyped codes get no suggestion.
+var suggestionRule = ratelimit.Rule{Name: "suggest", Rate: 50, Burst: 100, Key: ratelimit.KeyRoute}
+
+var (
+	ErrInvalidAlias    = errors.New("alias must be 3 to 32 characters from the short URL alphabet")
+	ErrAliasNotAllowed = errors.New("alias is not allowed")
+	ErrAliasTaken      = errors.New("alias already taken")
+	ErrAliasCheckDigit = errors.New("alias of the generated code length must end with a valid check character")
+
+	ErrInvalidCheckDigit = errors.New("short url has an invalid check character")
+)
+
+// MistypedError is returned by Resolve for codes whose check character does
+// not match. Suggestion holds an existing code one typo away, if any.
+type MistypedError struct {
+	Suggestion string
+}
+
+func (e *MistypedError) Error() string {
+	if e.Suggestion == "" {
+		return ErrInvalidCheckDigit.Error()
+	}
+
+	return fmt.Sprintf("%s, did you mean %s?", ErrInvalidCheckDigit, e.Suggestion)
+}
+
+func (e *MistypedError) Is(target error) bool {
+	return target == ErrInvalidCheckDigit
+}
 
 type Storage interface {
-	Put(url, shortURL string) error
-	Get(url string) (string, error)
+	Put(link model.Link) error
+	GetLink(key model.LinkKey) (model.Link, error)
+	Update(link model.Link) error
+	Delete(key model.LinkKey) error
+	ListByOwner(tenant, owner string, after model.LinkKey, limit int) ([]model.Link, error)
+	CountByTenant(tenant string) (int, error)
+	ClickStats(key model.LinkKey, q model.ClickQuery) (model.ClickStats, error)
+}
+
+// DestinationPolicy rejects URLs that must not be shortened.
+type DestinationPolicy interface {
+	Check(ctx context.Context, url string) error
+}
+
+// ClickRecorder records successful resolves for analytics. It must not block.
+type ClickRecorder interface {
+	Record(ctx context.Context, key model.LinkKey)
+}
+
+// LinkEvents is told about links created, updated, deleted and resolved,
+// after the change is stored. Publish is called while serving the request and
+// must return quickly.
+type LinkEvents interface {
+	Publish(ctx context.Context, event model.LinkEvent)
+}
+
+// Auditor records who changed what in the audit log. before and after are the
+// target around the change, nil if it did not exist.
+type Auditor interface {
+	Record(ctx context.Context, action, target string, before, after any)
+}
+
+// URLNormalizer rewrites a URL to the canonical form used for deduplication.
+type URLNormalizer interface {
+	Normalize(url string) (string, error)
 }
 
 type Shortener struct {
-	Storage Storage
-	Log     *zap.Logger
+	Storage   Storage
+	Generator generator.CodeGenerator
+	// Alphabet is the characters of generated codes, which custom aliases
+	// are limited to as well.
+	Alphabet string
+	// Normalizer canonicalizes URLs before they are stored.
+	Normalizer URLNormalizer
+	// Policy, if set, vets destinations before they are stored.
+	Policy DestinationPolicy
+	// Threats, if set, blocks known malicious destinations on Shorten and,
+	// with CheckThreatsOnResolve, flags them on Lookup.
+	Threats               threat.Checker
+	CheckThreatsOnResolve bool
+	// Filter, if set, vets both generated codes and custom aliases.
+	Filter generator.CodeFilter
+	// CheckDigit, if set, lets Resolve reject mistyped codes without a
+	// storage lookup. It must match the one used by Generator.
+	CheckDigit *generator.CheckDigit
+	// LegacyCodes makes Resolve look up codes with a wrong check character
+	// before rejecting them, for links stored before CheckDigit was set.
+	LegacyCodes bool
+	// Tenants, if set, enforces per-tenant quotas on Shorten.
+	Tenants *tenant.Registry
+	// Domains are the short domains links may be created on.
+	Domains *domain.Registry
+	// BaseURL prefixes short URLs on the default domain. If empty, the
+	// origin of the request is used.
+	BaseURL string
+	// Clicks, if set, records every successful resolve.
+	Clicks ClickRecorder
+	// Trending, if set, counts every successful resolve towards the live
+	// ranking of links.
+	Trending ClickRecorder
+	// Events, if set, is told about every change to a link and every
+	// successful resolve.
+	Events LinkEvents
+	// Audit, if set, records every link created, updated or deleted.
+	Audit Auditor
+	Log   *zap.Logger
+
+	suggestions ratelimit.Limiter
 }
 
 func NewShortener(storage Storage, log *zap.Logger) *Shortener {
-	return &Shortener{Storage: storage, Log: log}
+	return &Shortener{
+		Storage:    storage,
+		Generator:  generator.NewRandom(generator.DefaultEncoding()),
+		Alphabet:   random.DefaultAlphabet,
+		Normalizer: normalize.New(config.NormalizeConfig{}),
+		Domains:    domain.NewRegistry(nil),
+		Log:        log,
+
+		suggestions: ratelimit.NewMemory(),
+	}
 }
 
 func (s *Shortener) Shorten(url string) (string, error) {
-	s.Log.Info("Shorten URL", zap.String("url", url))
+	return s.ShortenWithAlias(url, "")
+}
+
+// ShortenWithAlias stores url under alias, or under a generated code if alias
+// is empty.
+func (s *Shortener) ShortenWithAlias(url, alias string) (string, error) {
+	return s.ShortenContext(context.Background(), url, alias)
+}
 
-	shortURL, err := random.NewRandomString(shortURLLength)
+// ShortenContext is ShortenWithAlias for a request: the authenticated
+// principal in ctx, if any, is recorded as the link's owner, and the link is
+// created in the tenant and on the short domain of the request.
+func (s *Shortener) ShortenContext(ctx context.Context, url, alias string) (string, error) {
+	s.Log.Info("Shorten URL", zap.String("url", url), zap.String("alias", alias))
+
+	host, err := s.Domains.Canonical(domain.FromContext(ctx))
 	if err != nil {
 		return "", err
 	}
 
-	err = s.Storage.Put(url, shortURL)
+	normalized, err := s.vet(ctx, url)
 	if err != nil {
-		if errors.Is(err, errs.ErrURLIsExist) {
+		return "", err
+	}
+
+	link := model.Link{URL: url, NormalizedURL: normalized, Tenant: tenantOf(ctx), Domain: host, CreatedAt: time.Now().UTC()}
+	if principal, ok := auth.FromContext(ctx); ok {
+		link.Owner = principal.Subject
+	}
+
+	if s.Tenants != nil {
+		if err := s.Tenants.AllowCreate(ctx, link.Tenant, s.Storage.CountByTenant); err != nil {
+			s.Log.Info("tenant quota reached", zap.String("tenant", link.Tenant), zap.Error(err))
+			return "", err
+		}
+	}
+
+	if alias != "" {
+		code, err := s.putAlias(link, alias)
+		if err == nil {
+			link.ShortURL = code
+			s.publish(ctx, model.EventLinkCreated, link)
+			s.audit(ctx, model.EventLinkCreated, link, nil, link)
+		}
+		return code, err
+	}
+
+	for attempt := range maxGenerateAttempts {
+		shortURL, err := s.Generator.Generate(normalized, attempt)
+		if err != nil {
+			return "", err
+		}
+
+		if s.Filter != nil && !s.Filter.Allowed(shortURL) {
+			s.Log.Debug("short URL rejected by filter, regenerating", zap.Int("attempt", attempt))
+			continue
+		}
+
+		link.ShortURL = shortURL
+		err = s.Storage.Put(link)
+		switch {
+		case err == nil:
+			s.publish(ctx, model.EventLinkCreated, link)
+			s.audit(ctx, model.EventLinkCreated, link, nil, link)
+			return shortURL, nil
+		case errors.Is(err, errs.ErrShortURLIsExist):
+			s.Log.Debug("short URL collision, regenerating", zap.String("shortUrl", shortURL), zap.Int("attempt", attempt))
+			continue
+		case errors.Is(err, errs.ErrURLIsExist):
 			return "", fmt.Errorf("url already exists")
+		default:
+			return "", err
 		}
+	}
+
+	return "", fmt.Errorf("failed to generate unique short url after %d attempts", maxGenerateAttempts)
+}
+
+// ShortURL returns the fully qualified short URL of code on the short domain
+// of the request.
+func (s *Shortener) ShortURL(ctx context.Context, code string) string {
+	host, err := s.Domains.Canonical(domain.FromContext(ctx))
+	if err != nil {
+		return code
+	}
+
+	return s.LinkURL(ctx, model.Link{Domain: host, ShortURL: code})
+}
+
+// LinkURL returns the fully qualified short URL of link: on its short domain,
+// or else under BaseURL or the origin of the request. Without any of them,
+// which only happens outside of a request, it is just the code.
+func (s *Shortener) LinkURL(ctx context.Context, link model.Link) string {
+	if link.Domain != domain.Default {
+		return s.Domains.URL(link.Domain, link.ShortURL)
+	}
+
+	base := s.BaseURL
+	if base == "" {
+		base = domain.OriginFromContext(ctx)
+	}
+	if base == "" {
+		return link.ShortURL
+	}
+
+	return strings.TrimSuffix(base, "/") + "/" + link.ShortURL
+}
+
+func (s *Shortener) publish(ctx context.Context, event string, link model.Link) {
+	if s.Events != nil {
+		s.Events.Publish(ctx, model.LinkEvent{Type: event, Link: link, At: time.Now().UTC()})
+	}
+}
+
+// audit records a change to link under its code, prefixed by its domain if it
+// has one; its tenant is that of the request.
+func (s *Shortener) audit(ctx context.Context, action string, link model.Link, before, after any) {
+	if s.Audit != nil {
+		s.Audit.Record(ctx, action, cursor(link), before, after)
+	}
+}
+
+// tenantOf returns the tenant a request acts in: that of the authenticated
+// principal if there is one, otherwise the one derived from the request host.
+func tenantOf(ctx context.Context) string {
+	if principal, ok := auth.FromContext(ctx); ok {
+		return principal.Tenant
+	}
+
+	return tenant.FromContext(ctx)
+}
+
+// vet normalizes url and checks it against the destination policy and threat
+// lists, returning the normalized form.
+func (s *Shortener) vet(ctx context.Context, url string) (string, error) {
+	normalized, err := s.Normalizer.Normalize(url)
+	if err != nil {
 		return "", err
 	}
 
-	return shortURL, nil
+	if s.Policy != nil {
+		if err := s.Policy.Check(ctx, normalized); err != nil {
+			return "", err
+		}
+	}
+
+	if s.Threats != nil {
+		verdict, err := s.Threats.Check(ctx, normalized)
+		if err != nil {
+			return "", fmt.Errorf("failed to check destination against threat lists: %w", err)
+		}
+		if verdict.Malicious {
+			s.Log.Warn("malicious destination rejected", zap.String("url", url), zap.String("threat", verdict.Threat))
+			return "", &threat.Error{Verdict: verdict}
+		}
+	}
+
+	return normalized, nil
+}
+
+func (s *Shortener) putAlias(link model.Link, alias string) (string, error) {
+	if !validAlias(alias, s.Alphabet) {
+		return "", ErrInvalidAlias
+	}
+
+	if s.Filter != nil && !s.Filter.Allowed(alias) {
+		return "", ErrAliasNotAllowed
+	}
+
+	if s.CheckDigit != nil && s.CheckDigit.Applies(alias) && !s.CheckDigit.Valid(alias) {
+		return "", ErrAliasCheckDigit
+	}
+
+	link.ShortURL = alias
+	err := s.Storage.Put(link)
+	switch {
+	case err == nil:
+		return alias, nil
+	case errors.Is(err, errs.ErrShortURLIsExist):
+		return "", ErrAliasTaken
+	case errors.Is(err, errs.ErrURLIsExist):
+		return "", fmt.Errorf("url already exists")
+	default:
+		return "", err
+	}
+}
+
+// validAlias checks the length of alias and that it only uses characters of
+// alphabet.
+func validAlias(alias, alphabet string) bool {
+	if len(alias) < minAliasLength || len(alias) > maxAliasLength {
+		return false
+	}
+
+	for i := range len(alias) {
+		if strings.IndexByte(alphabet, alias[i]) < 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Resolution is the result of looking a short URL up.
+type Resolution struct {
+	URL string
+	// Threat is set if the destination was flagged after it was shortened.
+	// Callers should warn the user instead of redirecting straight away.
+	Threat *threat.Verdict
 }
 
 func (s *Shortener) Resolve(url string) (string, error) {
-	s.Log.Info("Resolve URL", zap.String("url", url))
+	res, err := s.Lookup(url)
+	if err != nil {
+		return "", err
+	}
+
+	return res.URL, nil
+}
 
-	originURL, err := s.Storage.Get(url)
+// Lookup resolves a short URL of the default tenant.
+func (s *Shortener) Lookup(url string) (Resolution, error) {
+	return s.LookupContext(context.Background(), url)
+}
+
+// LookupContext resolves a short URL in the tenant and on the short domain of
+// the request and, if enabled, checks the destination against threat
+// intelligence that may have been updated since it was shortened.
+func (s *Shortener) LookupContext(ctx context.Context, url string) (Resolution, error) {
+	host, err := s.Domains.Canonical(domain.FromContext(ctx))
+	if err != nil {
+		return Resolution{}, err
+	}
+
+	link, err := s.get(model.LinkKey{Tenant: tenantOf(ctx), Domain: host, ShortURL: url})
 	if err != nil {
-		if errors.Is(err, errs.ErrURLIsNotExist) {
-			return "", fmt.Errorf("url does not exist")
+		return Resolution{}, err
+	}
+	key, originURL := link.Key(), link.URL
+
+	if s.Clicks != nil {
+		s.Clicks.Record(ctx, key)
+	}
+	if s.Trending != nil {
+		s.Trending.Record(ctx, key)
+	}
+	s.publish(ctx, model.EventLinkResolved, model.Link{ShortURL: key.ShortURL, URL: originURL, Tenant: key.Tenant,
+		Domain: key.Domain})
+
+	res := Resolution{URL: originURL}
+
+	if s.Threats != nil && s.CheckThreatsOnResolve {
+		verdict, err := s.Threats.Check(ctx, originURL)
+		switch {
+		case err != nil:
+			// Redirects keep working if the threat provider is unavailable.
+			s.Log.Error("failed to check destination against threat lists", zap.Error(err))
+		case verdict.Malicious:
+			res.Threat = &verdict
+		}
+	}
+
+	return res, nil
+}
+
+func (s *Shortener) get(key model.LinkKey) (model.Link, error) {
+	s.Log.Info("Resolve URL", zap.String("url", key.ShortURL), zap.String("tenant", key.Tenant), zap.String("domain", key.Domain))
+
+	mistyped := s.CheckDigit != nil && s.CheckDigit.Applies(key.ShortURL) && !s.CheckDigit.Valid(key.ShortURL)
+	if mistyped && !s.LegacyCodes {
+		return model.Link{}, &MistypedError{Suggestion: s.suggest(key)}
+	}
+
+	link, err := s.getLink(key)
+	if err != nil {
+		if !errors.Is(err, errs.ErrURLIsNotExist) {
+			return model.Link{}, err
+		}
+		if mistyped {
+			return model.Link{}, &MistypedError{Suggestion: s.suggest(key)}
+		}
+		return model.Link{}, fmt.Errorf("url does not exist")
+	}
+
+	return link, nil
+}
+
+// getLink looks the link of key up. Links stored before short domains were
+// configured have the Default domain, so a miss on the primary domain is
+// looked up there too.
+func (s *Shortener) getLink(key model.LinkKey) (model.Link, error) {
+	link, err := s.Storage.GetLink(key)
+	if errors.Is(err, errs.ErrURLIsNotExist) && key.Domain != domain.Default && key.Domain == s.Domains.Primary() {
+		key.Domain = domain.Default
+		return s.Storage.GetLink(key)
+	}
+
+	return link, err
+}
+
+// suggest returns the most likely existing code the user meant to type.
+func (s *Shortener) suggest(key model.LinkKey) string {
+	for i, candidate := range s.CheckDigit.Candidates(key.ShortURL) {
+		if i == maxSuggestionLookups {
+			break
+		}
+		if res, err := s.suggestions.Allow(context.Background(), "suggest:"+key.Tenant, suggestionRule); err != nil || !res.Allowed {
+			s.Log.Debug("suggestion lookups exhausted", zap.String("tenant", key.Tenant))
+			break
+		}
+
+		key.ShortURL = candidate
+		if _, err := s.getLink(key); err == nil {
+			return candidate
 		}
-		return "", err
 	}
 
-	return originURL, nil
+	return ""
 }
@@ -1,13 +1,25 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"testing"
 
 	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest"
 
+	"url-shortener/internal/auth"
+	"url-shortener/internal/config"
+	"url-shortener/internal/generator"
+	"url-shortener/internal/model"
+	"url-shortener/internal/normalize"
+	"url-shortener/internal/ratelimit"
 	"url-shortener/internal/storage/memory"
+	"url-shortener/internal/threat"
+	"url-shortener/pkg/util/random"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const (
@@ -67,3 +79,286 @@ func TestResolve_UrlNotExist(t *testing.T) {
 	assert.Error(t, err)
 	assert.Equal(t, "url does not exist", err.Error())
 }
+
+type takenGenerator struct {
+	codes []string
+}
+
+func (g *takenGenerator) Generate(_ string, attempt int) (string, error) {
+	return g.codes[attempt%len(g.codes)], nil
+}
+
+func TestShorten_RegeneratesOnCollision(t *testing.T) {
+	logger, _ := zap.NewProduction()
+
+	storage := memory.NewStorageInMemory(logger)
+	assert.NoError(t, storage.Put(model.Link{URL: "https://taken.com", ShortURL: "aaaaaaaaaa"}))
+
+	service := NewShortener(storage, logger)
+	service.Generator = &takenGenerator{codes: []string{"aaaaaaaaaa", "bbbbbbbbbb"}}
+
+	shortURL, err := service.Shorten(originalURL)
+	assert.NoError(t, err)
+	assert.Equal(t, "bbbbbbbbbb", shortURL)
+}
+
+func TestShorten_GiveUpAfterMaxAttempts(t *testing.T) {
+	logger, _ := zap.NewProduction()
+
+	storage := memory.NewStorageInMemory(logger)
+	assert.NoError(t, storage.Put(model.Link{URL: "https://taken.com", ShortURL: "aaaaaaaaaa"}))
+
+	service := NewShortener(storage, logger)
+	service.Generator = &takenGenerator{codes: []string{"aaaaaaaaaa"}}
+
+	_, err := service.Shorten(originalURL)
+	assert.Error(t, err)
+}
+
+func TestShorten_RegeneratesFilteredCodes(t *testing.T) {
+	logger, _ := zap.NewProduction()
+
+	storage := memory.NewStorageInMemory(logger)
+	service := NewShortener(storage, logger)
+	service.Generator = &takenGenerator{codes: []string{"aaab4daaaa", "goodcode12"}}
+	service.Filter = generator.NewDenyList([]string{"bad"})
+
+	shortURL, err := service.Shorten(originalURL)
+	assert.NoError(t, err)
+	assert.Equal(t, "goodcode12", shortURL)
+}
+
+func TestShortenWithAlias(t *testing.T) {
+	logger, _ := zap.NewProduction()
+
+	storage := memory.NewStorageInMemory(logger)
+	service := NewShortener(storage, logger)
+	service.Filter = generator.NewDenyList([]string{"bad"})
+
+	shortURL, err := service.ShortenWithAlias(originalURL, "my_alias")
+	assert.NoError(t, err)
+	assert.Equal(t, "my_alias", shortURL)
+
+	_, err = service.ShortenWithAlias("https://other.com", "my_alias")
+	assert.ErrorIs(t, err, ErrAliasTaken)
+
+	_, err = service.ShortenWithAlias("https://other.com", "so_b4d")
+	assert.ErrorIs(t, err, ErrAliasNotAllowed)
+
+	_, err = service.ShortenWithAlias("https://other.com", "no")
+	assert.ErrorIs(t, err, ErrInvalidAlias)
+
+	_, err = service.ShortenWithAlias("https://other.com", "with-dash")
+	assert.ErrorIs(t, err, ErrInvalidAlias)
+
+	// Aliases follow the configured alphabet.
+	service.Alphabet = random.DefaultAlphabet + "-"
+	shortURL, err = service.ShortenWithAlias("https://other.com", "with-dash")
+	assert.NoError(t, err)
+	assert.Equal(t, "with-dash", shortURL)
+
+	service.Alphabet = "abcdefghijklmnopqrstuvwxyz"
+	_, err = service.ShortenWithAlias("https://third.com", "UPPER")
+	assert.ErrorIs(t, err, ErrInvalidAlias)
+}
+
+func TestResolve_CheckDigit(t *testing.T) {
+	logger, _ := zap.NewProduction()
+
+	check := generator.NewCheckDigit(random.DefaultAlphabet, 10)
+	code := check.Append("abcdefghi")
+
+	storage := memory.NewStorageInMemory(logger)
+	service := NewShortener(storage, logger)
+	service.Generator = &takenGenerator{codes: []string{code}}
+	service.CheckDigit = check
+
+	shortURL, err := service.Shorten(originalURL)
+	assert.NoError(t, err)
+	assert.Equal(t, code, shortURL)
+
+	url, err := service.Resolve(shortURL)
+	assert.NoError(t, err)
+	assert.Equal(t, originalURL, url)
+
+	_, err = service.Resolve("bacdefghi" + code[9:])
+	assert.ErrorIs(t, err, ErrInvalidCheckDigit)
+
+	var mistyped *MistypedError
+	assert.ErrorAs(t, err, &mistyped)
+	assert.Equal(t, code, mistyped.Suggestion)
+
+	_, err = service.Resolve("zzzzzzzzz" + code[9:])
+	assert.ErrorAs(t, err, &mistyped)
+	assert.Empty(t, mistyped.Suggestion)
+
+	// Mistyped codes are rejected before a lookup, so links stored before
+	// check characters were enabled only resolve with LegacyCodes.
+	legacy := "zzzzzzzzz" + code[9:]
+	require.NoError(t, storage.Put(model.Link{ShortURL: legacy, URL: "https://legacy.com"}))
+	_, err = service.Resolve(legacy)
+	assert.ErrorIs(t, err, ErrInvalidCheckDigit)
+
+	service.LegacyCodes = true
+	url, err = service.Resolve(legacy)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://legacy.com", url)
+}
+
+// budget is a suggestion limiter allowing a fixed number of lookups.
+type budget int
+
+func (b *budget) Allow(_ context.Context, _ string, rule ratelimit.Rule) (ratelimit.Result, error) {
+	if *b == 0 {
+		return ratelimit.Result{Limit: rule.Burst}, nil
+	}
+	*b--
+
+	return ratelimit.Result{Allowed: true, Limit: rule.Burst}, nil
+}
+
+func TestResolve_SuggestionLookupsAreLimited(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+
+	check := generator.NewCheckDigit(random.DefaultAlphabet, 10)
+	code := check.Append("abcdefghi")
+
+	storage := memory.NewStorageInMemory(logger)
+	require.NoError(t, storage.Put(model.Link{ShortURL: code, URL: originalURL}))
+	service := NewShortener(storage, logger)
+	service.CheckDigit = check
+	lookups := budget(1)
+	service.suggestions = &lookups
+
+	// The swapped code is the first candidate, so one lookup finds it.
+	var mistyped *MistypedError
+	_, err := service.Resolve("bacdefghi" + code[9:])
+	require.ErrorAs(t, err, &mistyped)
+	assert.Equal(t, code, mistyped.Suggestion)
+
+	_, err = service.Resolve("bacdefghi" + code[9:])
+	require.ErrorAs(t, err, &mistyped)
+	assert.Empty(t, mistyped.Suggestion, "without lookups left there is no suggestion")
+}
+
+func TestShortenWithAlias_CheckDigit(t *testing.T) {
+	logger, _ := zap.NewProduction()
+
+	check := generator.NewCheckDigit(random.DefaultAlphabet, 10)
+	valid := check.Append("promo_sal")
+	invalid := valid[:9] + "a"
+	if valid[9] == 'a' {
+		invalid = valid[:9] + "b"
+	}
+
+	storage := memory.NewStorageInMemory(logger)
+	service := NewShortener(storage, logger)
+	service.CheckDigit = check
+
+	_, err := service.ShortenWithAlias("https://one.com", invalid)
+	assert.ErrorIs(t, err, ErrAliasCheckDigit)
+
+	_, err = service.ShortenWithAlias("https://one.com", valid)
+	assert.NoError(t, err)
+
+	_, err = service.ShortenWithAlias("https://two.com", "promo")
+	assert.NoError(t, err)
+}
+
+func TestShorten_DeduplicatesNormalizedURLs(t *testing.T) {
+	logger, _ := zap.NewProduction()
+
+	storage := memory.NewStorageInMemory(logger)
+	service := NewShortener(storage, logger)
+	service.Normalizer = normalize.New(config.NormalizeConfig{DropTracking: true})
+
+	shortURL, err := service.Shorten("HTTPS://Example.com/?utm_source=mail")
+	assert.NoError(t, err)
+
+	for _, url := range []string{"https://example.com", "https://example.com/?", "https://example.com:443/?fbclid=1"} {
+		_, err = service.Shorten(url)
+		assert.EqualError(t, err, "url already exists", url)
+	}
+
+	url, err := service.Resolve(shortURL)
+	assert.NoError(t, err)
+	assert.Equal(t, "HTTPS://Example.com/?utm_source=mail", url)
+}
+
+func TestShorten_MaliciousDestination(t *testing.T) {
+	logger, _ := zap.NewProduction()
+
+	storage := memory.NewStorageInMemory(logger)
+	service := NewShortener(storage, logger)
+	service.Threats = &threat.Fake{Hosts: map[string]string{"phish.example": "phishing"}}
+
+	_, err := service.Shorten("https://PHISH.example/login")
+	assert.ErrorIs(t, err, threat.ErrMalicious)
+	assert.Contains(t, err.Error(), "phishing")
+
+	_, err = service.Shorten(originalURL)
+	assert.NoError(t, err)
+
+	service.Threats = &threat.Fake{Err: errors.New("provider down")}
+	_, err = service.Shorten("https://another.example/")
+	assert.Error(t, err)
+}
+
+func TestLookup_ThreatWarning(t *testing.T) {
+	logger, _ := zap.NewProduction()
+
+	storage := memory.NewStorageInMemory(logger)
+	service := NewShortener(storage, logger)
+
+	shortURL, err := service.Shorten("https://later-bad.example/")
+	assert.NoError(t, err)
+
+	service.Threats = &threat.Fake{Hosts: map[string]string{"later-bad.example": "malware"}}
+
+	res, err := service.Lookup(shortURL)
+	assert.NoError(t, err)
+	assert.Nil(t, res.Threat, "resolve checks are disabled by default")
+
+	service.CheckThreatsOnResolve = true
+	res, err = service.Lookup(shortURL)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://later-bad.example/", res.URL)
+	if assert.NotNil(t, res.Threat) {
+		assert.Equal(t, "malware", res.Threat.Threat)
+	}
+
+	service.Threats = &threat.Fake{Err: errors.New("provider down")}
+	res, err = service.Lookup(shortURL)
+	assert.NoError(t, err)
+	assert.Nil(t, res.Threat)
+}
+
+type recordingStorage struct {
+	*memory.StorageInMemory
+	links []model.Link
+}
+
+func (s *recordingStorage) Put(link model.Link) error {
+	s.links = append(s.links, link)
+	return s.StorageInMemory.Put(link)
+}
+
+func TestShortenContext_RecordsOwner(t *testing.T) {
+	logger, _ := zap.NewProduction()
+
+	storage := &recordingStorage{StorageInMemory: memory.NewStorageInMemory(logger)}
+	service := NewShortener(storage, logger)
+
+	ctx := auth.WithPrincipal(context.Background(), auth.Principal{Subject: "alice", Tenant: "acme"})
+	_, err := service.ShortenContext(ctx, originalURL, "")
+	assert.NoError(t, err)
+
+	_, err = service.Shorten("https://anonymous.com")
+	assert.NoError(t, err)
+
+	if assert.Len(t, storage.links, 2) {
+		assert.Equal(t, "alice", storage.links[0].Owner)
+		assert.Equal(t, "acme", storage.links[0].Tenant)
+		assert.Empty(t, storage.links[1].Owner)
+	}
+}
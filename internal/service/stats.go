@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+
+	"url-shortener/internal/model"
+)
+
+const (
+	DefaultStatsTop      = 10
+	MaxStatsTop          = 100
+	DefaultStatsInterval = 24 * time.Hour
+	// DefaultStatsRange is how far back stats go when no start is given.
+	DefaultStatsRange = 30 * 24 * time.Hour
+
+	maxStatsBuckets = 1000
+)
+
+var ErrInvalidStatsQuery = errors.New("stats range must be non-empty and span at most 1000 intervals, " +
+	"the interval must be whole minutes that divide a day, and traffic one of human, bot, suspicious or all")
+
+// Stats summarizes the clicks on the short URL code. Zero fields of q are
+// filled with defaults: the human clicks of the last DefaultStatsRange in
+// buckets of DefaultStatsInterval. Only the owner of the link or an admin may
+// see them.
+func (s *Shortener) Stats(ctx context.Context, code string, q model.ClickQuery) (model.ClickStats, error) {
+	s.Log.Info("Link stats", zap.String("code", code))
+
+	q, err := statsQuery(q, time.Now().UTC())
+	if err != nil {
+		return model.ClickStats{}, err
+	}
+
+	link, err := s.owned(ctx, code)
+	if err != nil {
+		return model.ClickStats{}, err
+	}
+
+	stats, err := s.Storage.ClickStats(link.Key(), q)
+	if err != nil {
+		return model.ClickStats{}, err
+	}
+
+	stats.Series = fillSeries(stats.Series, q)
+
+	return stats, nil
+}
+
+func statsQuery(q model.ClickQuery, now time.Time) (model.ClickQuery, error) {
+	if q.To.IsZero() {
+		q.To = now
+	}
+	if q.From.IsZero() {
+		q.From = q.To.Add(-DefaultStatsRange)
+	}
+	if q.Interval == 0 {
+		q.Interval = DefaultStatsInterval
+	}
+	if q.Top <= 0 {
+		q.Top = DefaultStatsTop
+	}
+	q.Top = min(q.Top, MaxStatsTop)
+	if q.Traffic == "" {
+		q.Traffic = model.ClassHuman
+	}
+
+	switch q.Traffic {
+	case model.ClassHuman, model.ClassBot, model.ClassSuspicious, model.TrafficAll:
+	default:
+		return model.ClickQuery{}, ErrInvalidStatsQuery
+	}
+
+	// Intervals that divide a day line buckets up the same way whether
+	// they are counted from the Unix epoch or from Go's zero time.
+	if !q.From.Before(q.To) || q.Interval < time.Minute || q.Interval%time.Minute != 0 ||
+		(24*time.Hour)%q.Interval != 0 || q.To.Sub(q.From.Truncate(q.Interval))/q.Interval >= maxStatsBuckets {
+		return model.ClickQuery{}, ErrInvalidStatsQuery
+	}
+
+	return q, nil
+}
+
+// fillSeries returns one bucket per interval of the query, including those
+// without clicks, so the series can be plotted as is.
+func fillSeries(series []model.ClickBucket, q model.ClickQuery) []model.ClickBucket {
+	filled := make([]model.ClickBucket, 0, q.To.Sub(q.From)/q.Interval+1)
+
+	i := 0
+	for start := q.From.Truncate(q.Interval); start.Before(q.To); start = start.Add(q.Interval) {
+		bucket := model.ClickBucket{Start: start.UTC()}
+		for ; i < len(series) && series[i].Start.Before(start.Add(q.Interval)); i++ {
+			bucket.Clicks += series[i].Clicks
+		}
+		filled = append(filled, bucket)
+	}
+
+	return filled
+}
+
+// ParseStatsInterval parses "hour", "day" or a duration such as "15m". Empty
+// is the default interval.
+func ParseStatsInterval(s string) (time.Duration, error) {
+	switch s {
+	case "":
+		return 0, nil
+	case "hour":
+		return time.Hour, nil
+	case "day":
+		return 24 * time.Hour, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, ErrInvalidStatsQuery
+	}
+
+	return d, nil
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"url-shortener/internal/auth"
+	"url-shortener/internal/model"
+	"url-shortener/internal/storage/memory"
+)
+
+type clickStore struct {
+	*memory.StorageInMemory
+}
+
+// Record writes clicks straight away, so tests need not run a recorder.
+func (s clickStore) Record(_ context.Context, key model.LinkKey) {
+	_ = s.PutClicks([]model.Click{{Tenant: key.Tenant, Domain: key.Domain, ShortURL: key.ShortURL, At: time.Now().UTC()}})
+}
+
+func TestStats(t *testing.T) {
+	logger := zaptest.NewLogger(t)
+	storage := clickStore{memory.NewStorageInMemory(logger)}
+	service := NewShortener(storage, logger)
+	service.Clicks = storage
+
+	_, err := service.ShortenContext(as("alice"), "https://example.com", "promo")
+	require.NoError(t, err)
+
+	for range 3 {
+		_, err := service.Lookup("promo")
+		require.NoError(t, err)
+	}
+	_, err = service.Lookup("missing")
+	require.Error(t, err)
+
+	stats, err := service.Stats(as("alice"), "promo", model.ClickQuery{Interval: time.Hour, From: time.Now().Add(-3 * time.Hour)})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), stats.Total)
+	assert.Len(t, stats.Series, 4)
+	assert.Equal(t, int64(3), stats.Series[len(stats.Series)-1].Clicks)
+
+	stats, err = service.Stats(as("admin", auth.ScopeAdmin), "promo", model.ClickQuery{})
+	require.NoError(t, err)
+	assert.Len(t, stats.Series, 31)
+
+	_, err = service.Stats(as("bob"), "promo", model.ClickQuery{})
+	assert.ErrorIs(t, err, ErrNotOwner)
+
+	_, err = service.Stats(context.Background(), "promo", model.ClickQuery{})
+	assert.ErrorIs(t, err, auth.ErrMissingCredentials)
+
+	_, err = service.Stats(as("alice"), "missing", model.ClickQuery{})
+	assert.ErrorIs(t, err, ErrLinkNotFound)
+}
+
+func TestStatsQuery(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC)
+
+	q, err := statsQuery(model.ClickQuery{}, now)
+	require.NoError(t, err)
+	assert.Equal(t, now, q.To)
+	assert.Equal(t, now.Add(-DefaultStatsRange), q.From)
+	assert.Equal(t, DefaultStatsInterval, q.Interval)
+	assert.Equal(t, DefaultStatsTop, q.Top)
+
+	q, err = statsQuery(model.ClickQuery{Top: 1000}, now)
+	require.NoError(t, err)
+	assert.Equal(t, MaxStatsTop, q.Top)
+
+	for name, bad := range map[string]model.ClickQuery{
+		"empty range":        {From: now, To: now},
+		"sub-minute":         {Interval: time.Second},
+		"not dividing a day": {Interval: 7 * time.Minute},
+		"too many buckets":   {From: now.Add(-2000 * time.Hour), To: now, Interval: time.Hour},
+	} {
+		_, err := statsQuery(bad, now)
+		assert.ErrorIs(t, err, ErrInvalidStatsQuery, name)
+	}
+}
+
+func TestFillSeries(t *testing.T) {
+	from := time.Date(2026, 3, 1, 10, 15, 0, 0, time.UTC)
+	q := model.ClickQuery{From: from, To: from.Add(3 * time.Hour), Interval: time.Hour}
+
+	series := fillSeries([]model.ClickBucket{{Start: from.Add(45 * time.Minute), Clicks: 5}}, q)
+
+	assert.Equal(t, []model.ClickBucket{
+		{Start: from.Add(-15 * time.Minute), Clicks: 0},
+		{Start: from.Add(45 * time.Minute), Clicks: 5},
+		{Start: from.Add(105 * time.Minute), Clicks: 0},
+		{Start: from.Add(165 * time.Minute), Clicks: 0},
+	}, series)
+}
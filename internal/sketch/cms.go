@@ -0,0 +1,71 @@
+package sketch
+
+import (
+	"errors"
+	"hash/fnv"
+)
+
+var ErrShapeMismatch = errors.New("count-min sketches of different shape cannot be merged")
+
+// CountMinSketch counts items in width*depth counters. Estimates never
+// undercount; with probability 1-e^-depth they overcount by at most
+// e/width of the total added. It is not safe for concurrent use.
+type CountMinSketch struct {
+	width  uint32
+	depth  int
+	counts []uint32
+}
+
+func NewCountMinSketch(width, depth int) *CountMinSketch {
+	return &CountMinSketch{width: uint32(width), depth: depth, counts: make([]uint32, width*depth)}
+}
+
+// Add adds n occurrences of item and returns its new estimate.
+func (s *CountMinSketch) Add(item string, n uint32) uint32 {
+	estimate := ^uint32(0)
+	s.each(item, func(i int) {
+		s.counts[i] += n
+		estimate = min(estimate, s.counts[i])
+	})
+
+	return estimate
+}
+
+func (s *CountMinSketch) Estimate(item string) uint32 {
+	estimate := ^uint32(0)
+	s.each(item, func(i int) {
+		estimate = min(estimate, s.counts[i])
+	})
+
+	return estimate
+}
+
+// Merge adds the counts of other, which must have the same shape.
+func (s *CountMinSketch) Merge(other *CountMinSketch) error {
+	if s.width != other.width || s.depth != other.depth {
+		return ErrShapeMismatch
+	}
+
+	for i, c := range other.counts {
+		s.counts[i] += c
+	}
+
+	return nil
+}
+
+func (s *CountMinSketch) Reset() {
+	clear(s.counts)
+}
+
+// each calls fn with the counter of item in every row. The row hashes are
+// derived from one 64-bit hash (Kirsch-Mitzenmacher).
+func (s *CountMinSketch) each(item string, fn func(i int)) {
+	f := fnv.New64a()
+	_, _ = f.Write([]byte(item))
+	h := mix(f.Sum64())
+	h1, h2 := uint32(h), uint32(h>>32)|1
+
+	for row := range s.depth {
+		fn(row*int(s.width) + int((h1+uint32(row)*h2)%s.width))
+	}
+}
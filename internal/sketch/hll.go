@@ -0,0 +1,145 @@
+// Package sketch holds probabilistic data structures that summarize streams in
+// bounded memory.
+package sketch
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// HLLPrecision is the number of index bits of the sketches used for unique
+// visitors: 4096 one-byte registers and a standard error of 1.04/sqrt(4096),
+// about 1.6%.
+const HLLPrecision = 12
+
+const (
+	minPrecision = 4
+	maxPrecision = 16
+
+	hllVersion = 1
+)
+
+var (
+	ErrInvalidPrecision  = errors.New("hyperloglog precision must be between 4 and 16")
+	ErrPrecisionMismatch = errors.New("hyperloglog sketches of different precision cannot be merged")
+	ErrInvalidEncoding   = errors.New("invalid hyperloglog encoding")
+)
+
+// HLL is a HyperLogLog sketch estimating the number of distinct items added
+// to it. Sketches of the same precision merge losslessly: the merge of the
+// sketches of two sets is the sketch of their union. It is not safe for
+// concurrent use.
+type HLL struct {
+	p         uint8
+	registers []uint8
+}
+
+func NewHLL(precision uint8) (*HLL, error) {
+	if precision < minPrecision || precision > maxPrecision {
+		return nil, ErrInvalidPrecision
+	}
+
+	return &HLL{p: precision, registers: make([]uint8, 1<<precision)}, nil
+}
+
+// Add adds item to the sketch. Items are hashed with a fixed function, so
+// sketches built on different instances can be merged.
+func (h *HLL) Add(item []byte) {
+	f := fnv.New64a()
+	_, _ = f.Write(item)
+	h.AddHash(mix(f.Sum64()))
+}
+
+// AddHash adds an item by its uniformly distributed 64-bit hash.
+func (h *HLL) AddHash(x uint64) {
+	idx := x >> (64 - h.p)
+	// The remaining bits, with a sentinel so the rank is at most 64-p+1.
+	rank := uint8(bits.LeadingZeros64(x<<h.p|1<<(h.p-1))) + 1
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+}
+
+// Merge folds other into h.
+func (h *HLL) Merge(other *HLL) error {
+	if h.p != other.p {
+		return ErrPrecisionMismatch
+	}
+
+	for i, r := range other.registers {
+		if r > h.registers[i] {
+			h.registers[i] = r
+		}
+	}
+
+	return nil
+}
+
+// Estimate returns the estimated number of distinct items. Small cardinalities
+// are counted from the empty registers, which is nearly exact.
+func (h *HLL) Estimate() uint64 {
+	m := float64(len(h.registers))
+
+	sum, zeros := 0.0, 0
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	estimate := alpha(len(h.registers)) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+
+	return uint64(estimate + 0.5)
+}
+
+func alpha(m int) float64 {
+	switch m {
+	case 16:
+		return 0.673
+	case 32:
+		return 0.697
+	case 64:
+		return 0.709
+	default:
+		return 0.7213 / (1 + 1.079/float64(m))
+	}
+}
+
+// MarshalBinary encodes the sketch as a version byte, the precision and the
+// registers.
+func (h *HLL) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 0, 2+len(h.registers))
+	data = append(data, hllVersion, h.p)
+
+	return append(data, h.registers...), nil
+}
+
+func (h *HLL) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 || data[0] != hllVersion || data[1] < minPrecision || data[1] > maxPrecision ||
+		len(data) != 2+1<<data[1] {
+		return ErrInvalidEncoding
+	}
+
+	h.p = data[1]
+	h.registers = append([]uint8(nil), data[2:]...)
+
+	return nil
+}
+
+// mix is the splitmix64 finalizer. FNV alone spreads short, similar inputs
+// poorly over the high bits the register index is taken from.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+
+	return x
+}
@@ -0,0 +1,100 @@
+package sketch
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newHLL(t *testing.T) *HLL {
+	t.Helper()
+
+	h, err := NewHLL(HLLPrecision)
+	require.NoError(t, err)
+
+	return h
+}
+
+func add(h *HLL, prefix string, from, to int) {
+	for i := from; i < to; i++ {
+		h.Add([]byte(fmt.Sprintf("%s-%d", prefix, i)))
+	}
+}
+
+// stdError is the relative standard error of the estimate.
+func stdError(h *HLL) float64 {
+	return 1.04 / math.Sqrt(float64(len(h.registers)))
+}
+
+func assertWithin(t *testing.T, want int, got uint64, rel float64) {
+	t.Helper()
+
+	assert.InDelta(t, float64(want), float64(got), rel*float64(want), "estimate %d of %d", got, want)
+}
+
+func TestHLL_ErrorBound(t *testing.T) {
+	for _, n := range []int{10, 100, 1000, 10_000, 100_000, 1_000_000} {
+		h := newHLL(t)
+		add(h, "visitor", 0, n)
+		// Repeat visits must not count.
+		add(h, "visitor", 0, n/2)
+
+		// Three standard errors: the hash is fixed, so this is deterministic
+		// and holds with a wide margin.
+		assertWithin(t, n, h.Estimate(), 3*stdError(h))
+	}
+}
+
+func TestHLL_SmallCountsAreNearlyExact(t *testing.T) {
+	h := newHLL(t)
+	assert.Zero(t, h.Estimate())
+
+	add(h, "visitor", 0, 1)
+	assert.Equal(t, uint64(1), h.Estimate())
+
+	add(h, "visitor", 0, 50)
+	assertWithin(t, 50, h.Estimate(), 0.02)
+}
+
+func TestHLL_Merge(t *testing.T) {
+	a, b := newHLL(t), newHLL(t)
+	add(a, "visitor", 0, 60_000)
+	add(b, "visitor", 40_000, 100_000)
+
+	union := newHLL(t)
+	add(union, "visitor", 0, 100_000)
+
+	require.NoError(t, a.Merge(b))
+	assert.Equal(t, union.registers, a.registers)
+	assertWithin(t, 100_000, a.Estimate(), 3*stdError(a))
+
+	other, err := NewHLL(HLLPrecision + 1)
+	require.NoError(t, err)
+	assert.ErrorIs(t, a.Merge(other), ErrPrecisionMismatch)
+}
+
+func TestHLL_Binary(t *testing.T) {
+	h := newHLL(t)
+	add(h, "visitor", 0, 1000)
+
+	data, err := h.MarshalBinary()
+	require.NoError(t, err)
+
+	var decoded HLL
+	require.NoError(t, decoded.UnmarshalBinary(data))
+	assert.Equal(t, h.Estimate(), decoded.Estimate())
+
+	assert.ErrorIs(t, decoded.UnmarshalBinary(data[:len(data)-1]), ErrInvalidEncoding)
+	assert.ErrorIs(t, decoded.UnmarshalBinary(nil), ErrInvalidEncoding)
+}
+
+func TestNewHLL_Precision(t *testing.T) {
+	_, err := NewHLL(3)
+	assert.ErrorIs(t, err, ErrInvalidPrecision)
+
+	_, err = NewHLL(17)
+	assert.ErrorIs(t, err, ErrInvalidPrecision)
+}
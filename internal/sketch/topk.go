@@ -0,0 +1,124 @@
+package sketch
+
+import (
+	"cmp"
+	"container/heap"
+	"slices"
+)
+
+// Count is an item with its estimated count.
+type Count struct {
+	Item  string
+	Count uint64
+}
+
+// TopK keeps the k items with the highest counts offered so far. Counts of an
+// item may only grow, as estimates of a CountMinSketch do.
+type TopK struct {
+	k     int
+	items countHeap
+}
+
+func NewTopK(k int) *TopK {
+	return &TopK{k: k, items: countHeap{index: make(map[string]int, k)}}
+}
+
+// Offer records that item has reached count.
+func (t *TopK) Offer(item string, count uint64) {
+	if i, ok := t.items.index[item]; ok {
+		t.items.counts[i].Count = count
+		heap.Fix(&t.items, i)
+		return
+	}
+
+	if len(t.items.counts) < t.k {
+		heap.Push(&t.items, Count{Item: item, Count: count})
+		return
+	}
+
+	if t.k == 0 || count <= t.items.counts[0].Count {
+		return
+	}
+
+	delete(t.items.index, t.items.counts[0].Item)
+	t.items.counts[0] = Count{Item: item, Count: count}
+	t.items.index[item] = 0
+	heap.Fix(&t.items, 0)
+}
+
+// List returns the kept items, highest count first.
+func (t *TopK) List() []Count {
+	list := slices.Clone(t.items.counts)
+	slices.SortFunc(list, func(a, b Count) int {
+		if c := cmp.Compare(b.Count, a.Count); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Item, b.Item)
+	})
+
+	return list
+}
+
+func (t *TopK) Reset() {
+	t.items.counts = t.items.counts[:0]
+	clear(t.items.index)
+}
+
+// countHeap is a min-heap of counts that keeps index pointing at the position
+// of every item.
+type countHeap struct {
+	counts []Count
+	index  map[string]int
+}
+
+func (h *countHeap) Len() int           { return len(h.counts) }
+func (h *countHeap) Less(i, j int) bool { return h.counts[i].Count < h.counts[j].Count }
+
+func (h *countHeap) Swap(i, j int) {
+	h.counts[i], h.counts[j] = h.counts[j], h.counts[i]
+	h.index[h.counts[i].Item] = i
+	h.index[h.counts[j].Item] = j
+}
+
+func (h *countHeap) Push(x any) {
+	c := x.(Count)
+	h.index[c.Item] = len(h.counts)
+	h.counts = append(h.counts, c)
+}
+
+func (h *countHeap) Pop() any {
+	last := h.counts[len(h.counts)-1]
+	h.counts = h.counts[:len(h.counts)-1]
+	delete(h.index, last.Item)
+
+	return last
+}
+
+// HeavyHitters finds the most frequent items of a stream in bounded memory: a
+// CountMinSketch estimates every item and a TopK keeps the leaders.
+type HeavyHitters struct {
+	counts *CountMinSketch
+	top    *TopK
+}
+
+func NewHeavyHitters(k, width, depth int) *HeavyHitters {
+	return &HeavyHitters{counts: NewCountMinSketch(width, depth), top: NewTopK(k)}
+}
+
+func (h *HeavyHitters) Add(item string) {
+	h.top.Offer(item, uint64(h.counts.Add(item, 1)))
+}
+
+func (h *HeavyHitters) Estimate(item string) uint64 {
+	return uint64(h.counts.Estimate(item))
+}
+
+// Top returns the leading items, highest count first.
+func (h *HeavyHitters) Top() []Count {
+	return h.top.List()
+}
+
+func (h *HeavyHitters) Reset() {
+	h.counts.Reset()
+	h.top.Reset()
+}
@@ -0,0 +1,91 @@
+package sketch
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountMinSketch_NeverUndercounts(t *testing.T) {
+	s := NewCountMinSketch(2048, 4)
+
+	exact := make(map[string]uint32)
+	rng := rand.New(rand.NewPCG(1, 2))
+	total := 0
+	for range 100_000 {
+		item := fmt.Sprint("item-", rng.IntN(20_000))
+		exact[item]++
+		s.Add(item, 1)
+		total++
+	}
+
+	// e/width of the total, which holds for all but a fraction e^-depth.
+	bound := uint32(2.72 / 2048 * float64(total))
+	over := 0
+	for item, n := range exact {
+		est := s.Estimate(item)
+		require.GreaterOrEqual(t, est, n, item)
+		if est-n > bound {
+			over++
+		}
+	}
+	assert.Less(t, float64(over)/float64(len(exact)), 0.02)
+}
+
+func TestCountMinSketch_Merge(t *testing.T) {
+	a, b := NewCountMinSketch(64, 3), NewCountMinSketch(64, 3)
+	a.Add("x", 3)
+	b.Add("x", 4)
+
+	require.NoError(t, a.Merge(b))
+	assert.Equal(t, uint32(7), a.Estimate("x"))
+	assert.ErrorIs(t, a.Merge(NewCountMinSketch(32, 3)), ErrShapeMismatch)
+
+	a.Reset()
+	assert.Zero(t, a.Estimate("x"))
+}
+
+func TestTopK(t *testing.T) {
+	top := NewTopK(2)
+	top.Offer("a", 1)
+	top.Offer("b", 5)
+	top.Offer("c", 2)
+	assert.Equal(t, []Count{{"b", 5}, {"c", 2}}, top.List())
+
+	top.Offer("a", 1)
+	assert.Equal(t, []Count{{"b", 5}, {"c", 2}}, top.List())
+
+	top.Offer("c", 9)
+	top.Offer("d", 3)
+	assert.Equal(t, []Count{{"c", 9}, {"b", 5}}, top.List())
+
+	top.Reset()
+	assert.Empty(t, top.List())
+	assert.Empty(t, NewTopK(0).List())
+}
+
+func TestHeavyHitters(t *testing.T) {
+	h := NewHeavyHitters(3, 1024, 4)
+
+	rng := rand.New(rand.NewPCG(3, 4))
+	for range 50_000 {
+		// Background noise over many items that are each rare.
+		h.Add(fmt.Sprint("noise-", rng.IntN(10_000)))
+	}
+	for i, hot := range []string{"hot-a", "hot-b", "hot-c"} {
+		for range 3000 - 500*i {
+			h.Add(hot)
+		}
+	}
+
+	top := h.Top()
+	if assert.Len(t, top, 3) {
+		assert.Equal(t, "hot-a", top[0].Item)
+		assert.Equal(t, "hot-b", top[1].Item)
+		assert.Equal(t, "hot-c", top[2].Item)
+		assert.InDelta(t, 3000, float64(top[0].Count), 200)
+	}
+}
@@ -3,6 +3,13 @@ package errs
 import "errors"
 
 var (
-	ErrURLIsExist    = errors.New("URL already exists")
-	ErrURLIsNotExist = errors.New("URL does not exist")
+	ErrURLIsExist      = errors.New("URL already exists")
+	ErrURLIsNotExist   = errors.New("URL does not exist")
+	ErrShortURLIsExist = errors.New("short URL already exists")
+
+	ErrAPIKeyIsExist    = errors.New("API key already exists")
+	ErrAPIKeyIsNotExist = errors.New("API key does not exist")
+
+	ErrWebhookIsExist    = errors.New("webhook already exists")
+	ErrWebhookIsNotExist = errors.New("webhook does not exist")
 )
@@ -0,0 +1,213 @@
+package memory
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+
+	"url-shortener/internal/model"
+	"url-shortener/internal/sketch"
+)
+
+const secondsPerDay = 24 * 60 * 60
+
+func (s *StorageInMemory) PutClicks(clicks []model.Click) error {
+	s.clkMu.Lock()
+	defer s.clkMu.Unlock()
+
+	s.log.Debug("put clicks", zap.Int("clicks", len(clicks)))
+
+	events := make([]model.LinkEvent, 0, len(clicks))
+	for _, click := range clicks {
+		s.lastClickID++
+		click.ID = s.lastClickID
+		s.clicks[click.Key()] = append(s.clicks[click.Key()], click)
+		events = append(events, click.ResolvedEvent())
+	}
+	s.queueEvents(events...)
+
+	// Some slack keeps trimming rare.
+	s.clickCount += len(clicks)
+	if s.MaxClicks > 0 && s.clickCount > s.MaxClicks+s.MaxClicks/10 {
+		s.trimClicks()
+	}
+
+	return nil
+}
+
+// trimClicks drops the oldest clicks down to MaxClicks, and the unique
+// visitors of each link from before the day of its first click left. Callers
+// hold clkMu.
+func (s *StorageInMemory) trimClicks() {
+	// IDs grow with every click stored, and so do those of each link.
+	keep := s.lastClickID - int64(s.MaxClicks)
+
+	s.clickCount = 0
+	for key, clicks := range s.clicks {
+		i, _ := slices.BinarySearchFunc(clicks, keep+1, func(c model.Click, id int64) int {
+			return cmp.Compare(c.ID, id)
+		})
+		if i == len(clicks) {
+			delete(s.clicks, key)
+			continue
+		}
+
+		// A copy lets the dropped clicks be freed.
+		s.clicks[key] = slices.Clone(clicks[i:])
+		s.clickCount += len(clicks) - i
+	}
+
+	for key, days := range s.visitors {
+		clicks, ok := s.clicks[key]
+		if !ok {
+			delete(s.visitors, key)
+			continue
+		}
+
+		first := unixDay(slices.MinFunc(clicks, func(a, b model.Click) int { return a.At.Compare(b.At) }).At)
+		for day := range days {
+			if day < first {
+				delete(days, day)
+			}
+		}
+	}
+
+	s.log.Info("dropped the oldest clicks", zap.Int("kept", s.clickCount))
+}
+
+func (s *StorageInMemory) MergeVisitors(sketches []model.VisitorSketch) error {
+	s.clkMu.Lock()
+	defer s.clkMu.Unlock()
+
+	for _, v := range sketches {
+		days, ok := s.visitors[v.Key()]
+		if !ok {
+			days = make(map[int64]*sketch.HLL)
+			s.visitors[v.Key()] = days
+		}
+
+		day := unixDay(v.Day)
+		if days[day] == nil {
+			h, err := sketch.NewHLL(sketch.HLLPrecision)
+			if err != nil {
+				return err
+			}
+			days[day] = h
+		}
+
+		if err := days[day].Merge(v.Sketch); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unixDay numbers the UTC day of t.
+func unixDay(t time.Time) int64 {
+	return t.Unix() / secondsPerDay
+}
+
+func (s *StorageInMemory) ClickStats(key model.LinkKey, q model.ClickQuery) (model.ClickStats, error) {
+	s.clkMu.RLock()
+	defer s.clkMu.RUnlock()
+
+	buckets := make(map[int64]int64)
+	referrers := make(map[string]int64)
+	userAgents := make(map[string]int64)
+	classes := make(map[string]int64)
+	bots := make(map[string]int64)
+	countries := make(map[string]int64)
+	cities := make(map[string]int64)
+	devices := make(map[string]int64)
+	systems := make(map[string]int64)
+	browsers := make(map[string]int64)
+
+	traffic := cmp.Or(q.Traffic, model.ClassHuman)
+
+	var stats model.ClickStats
+	for _, click := range s.clicks[key] {
+		if click.At.Before(q.From) || !click.At.Before(q.To) {
+			continue
+		}
+
+		class := cmp.Or(click.Class, model.ClassHuman)
+		classes[class]++
+		if class == model.ClassBot && click.Bot != "" {
+			bots[click.Bot]++
+		}
+		if traffic != model.TrafficAll && traffic != class {
+			continue
+		}
+
+		stats.Total++
+		buckets[click.At.Truncate(q.Interval).Unix()]++
+		count(referrers, click.Referrer)
+		count(userAgents, click.UserAgent)
+		count(countries, click.Country)
+		if click.City != "" {
+			cities[click.City+", "+click.Country]++
+		}
+		count(devices, click.Device)
+		count(systems, click.OS)
+		count(browsers, click.Browser)
+	}
+
+	for start, clicks := range buckets {
+		stats.Series = append(stats.Series, model.ClickBucket{Start: time.Unix(start, 0).UTC(), Clicks: clicks})
+	}
+	slices.SortFunc(stats.Series, func(a, b model.ClickBucket) int {
+		return a.Start.Compare(b.Start)
+	})
+
+	visitors, err := sketch.NewHLL(sketch.HLLPrecision)
+	if err != nil {
+		return model.ClickStats{}, err
+	}
+	for day := unixDay(q.From); day <= unixDay(q.To.Add(-time.Nanosecond)); day++ {
+		if h := s.visitors[key][day]; h != nil {
+			if err := visitors.Merge(h); err != nil {
+				return model.ClickStats{}, err
+			}
+		}
+	}
+	stats.UniqueVisitors = int64(visitors.Estimate())
+
+	stats.TopReferrers = top(referrers, q.Top)
+	stats.TopUserAgents = top(userAgents, q.Top)
+	stats.ByClass = top(classes, len(classes))
+	stats.TopBots = top(bots, q.Top)
+	stats.TopCountries = top(countries, q.Top)
+	stats.TopCities = top(cities, q.Top)
+	stats.TopDevices = top(devices, q.Top)
+	stats.TopOS = top(systems, q.Top)
+	stats.TopBrowsers = top(browsers, q.Top)
+
+	return stats, nil
+}
+
+// count counts a click on value unless it is empty.
+func count(counts map[string]int64, value string) {
+	if value != "" {
+		counts[value]++
+	}
+}
+
+// top returns the n values with the most clicks, ties broken by value.
+func top(counts map[string]int64, n int) []model.ClickCount {
+	all := make([]model.ClickCount, 0, len(counts))
+	for value, clicks := range counts {
+		all = append(all, model.ClickCount{Value: value, Clicks: clicks})
+	}
+
+	slices.SortFunc(all, func(a, b model.ClickCount) int {
+		if c := cmp.Compare(b.Clicks, a.Clicks); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.Value, b.Value)
+	})
+
+	return all[:min(n, len(all))]
+}
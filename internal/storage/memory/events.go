@@ -0,0 +1,59 @@
+package memory
+
+import (
+	"slices"
+	"time"
+
+	"url-shortener/internal/model"
+)
+
+// queueEvents adds events to the outbox if it is enabled. Callers hold the
+// lock of the change the events describe, so events are queued in the order
+// of the changes.
+func (s *StorageInMemory) queueEvents(events ...model.LinkEvent) {
+	if !s.Outbox {
+		return
+	}
+
+	s.evMu.Lock()
+	defer s.evMu.Unlock()
+
+	for _, event := range events {
+		s.lastEventID++
+		s.events = append(s.events, model.OutboxEvent{ID: s.lastEventID, LinkEvent: event})
+	}
+}
+
+// RelayEvents passes up to limit of the oldest queued events to publish and
+// removes them once it succeeds.
+func (s *StorageInMemory) RelayEvents(limit int, publish func([]model.OutboxEvent) error) (int, error) {
+	s.relayMu.Lock()
+	defer s.relayMu.Unlock()
+
+	s.evMu.Lock()
+	events := slices.Clone(s.events[:min(limit, len(s.events))])
+	s.evMu.Unlock()
+
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	if err := publish(events); err != nil {
+		return 0, err
+	}
+
+	// Events are only appended meanwhile, so the relayed ones are still first.
+	s.evMu.Lock()
+	s.events = slices.Delete(s.events, 0, len(events))
+	s.evMu.Unlock()
+
+	return len(events), nil
+}
+
+func createdAt(link model.Link) time.Time {
+	if link.CreatedAt.IsZero() {
+		return time.Now().UTC()
+	}
+
+	return link.CreatedAt
+}
@@ -0,0 +1,51 @@
+package memory
+
+import (
+	"cmp"
+	"slices"
+
+	"url-shortener/internal/model"
+)
+
+// ExportClicks returns up to limit clicks of q ordered by time and ID,
+// starting after the time and ID of after.
+func (s *StorageInMemory) ExportClicks(q model.ExportQuery, after model.Click, limit int) ([]model.Click, error) {
+	s.clkMu.RLock()
+	defer s.clkMu.RUnlock()
+
+	keys := make(map[model.LinkKey]bool, len(q.Links))
+	for _, key := range q.Links {
+		keys[key] = true
+	}
+	if len(keys) == 0 {
+		for key := range s.clicks {
+			keys[key] = true
+		}
+	}
+
+	var clicks []model.Click
+	for key := range keys {
+		if len(q.Tenants) > 0 && !slices.Contains(q.Tenants, key.Tenant) {
+			continue
+		}
+		for _, click := range s.clicks[key] {
+			if click.At.Before(q.From) || !click.At.Before(q.To) || compareClicks(click, after) <= 0 {
+				continue
+			}
+			clicks = append(clicks, click)
+		}
+	}
+
+	slices.SortFunc(clicks, compareClicks)
+
+	return clicks[:min(limit, len(clicks))], nil
+}
+
+func compareClicks(a, b model.Click) int {
+	return cmp.Or(a.At.Compare(b.At), cmp.Compare(a.ID, b.ID))
+}
+
+// ExportRollups returns no rollups: memory storage keeps raw clicks only.
+func (s *StorageInMemory) ExportRollups(string, model.ExportQuery, model.ClickRollup, int) ([]model.ClickRollup, error) {
+	return nil, nil
+}
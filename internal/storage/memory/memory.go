@@ -1,57 +1,352 @@
 package memory
 
 import (
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
 	"go.uber.org/zap"
 
+	"url-shortener/internal/model"
+	"url-shortener/internal/sketch"
 	"url-shortener/internal/storage/errs"
 )
 
+// DefaultMaxClicks is the number of clicks memory storage keeps by default,
+// in the order of a few hundred megabytes.
+const DefaultMaxClicks = 1_000_000
+
 type StorageInMemory struct {
+	// Outbox queues an event with every link created or deleted and every
+	// click recorded, for RelayEvents.
+	Outbox bool
+	// MaxClicks bounds the clicks kept; past it the oldest are dropped,
+	// together with the unique visitors of days no click is left of. 0 keeps
+	// every click.
+	MaxClicks int
+
 	rvMu    sync.RWMutex
-	storage map[string]string
-	reverse map[string]string
+	storage map[model.LinkKey]model.Link
+	// reverse maps a tenant, domain and dedup key to the short URL holding it.
+	reverse map[dedupKey]string
+	// clicked holds the links that have been clicked.
+	clicked map[model.LinkKey]bool
 	log     *zap.Logger
+
+	blMu   sync.Mutex
+	blocks map[string]uint64
+
+	keyMu sync.RWMutex
+	keys  map[string]model.APIKey
+
+	clkMu  sync.RWMutex
+	clicks map[model.LinkKey][]model.Click
+	// clickCount is the number of clicks held.
+	clickCount int
+	// lastClickID is the ID of the last click stored.
+	lastClickID int64
+	// visitors holds the visitor sketches of each link by Unix day.
+	visitors map[model.LinkKey]map[int64]*sketch.HLL
+
+	whMu     sync.Mutex
+	webhooks map[string]model.Webhook
+	// deliveries builds the webhook delivery of a link event; nil queues
+	// none. See QueueWebhookDeliveries.
+	deliveries func(model.LinkEvent) (model.WebhookDelivery, error)
+	// outbox holds the webhook deliveries by ID.
+	outbox         map[int64]model.WebhookDelivery
+	lastDeliveryID int64
+
+	// relayMu lets one relay at a time take events from the queue.
+	relayMu     sync.Mutex
+	evMu        sync.Mutex
+	events      []model.OutboxEvent
+	lastEventID int64
+}
+
+type dedupKey struct {
+	tenant string
+	domain string
+	url    string
+}
+
+func reverseKey(link model.Link) dedupKey {
+	return dedupKey{tenant: link.Tenant, domain: link.Domain, url: link.DedupKey()}
 }
 
 func NewStorageInMemory(log *zap.Logger) *StorageInMemory {
 	return &StorageInMemory{
-		storage: make(map[string]string),
-		reverse: make(map[string]string),
-		log:     log,
+		storage:  make(map[model.LinkKey]model.Link),
+		reverse:  make(map[dedupKey]string),
+		clicked:  make(map[model.LinkKey]bool),
+		blocks:   make(map[string]uint64),
+		keys:     make(map[string]model.APIKey),
+		clicks:   make(map[model.LinkKey][]model.Click),
+		visitors: make(map[model.LinkKey]map[int64]*sketch.HLL),
+		webhooks: make(map[string]model.Webhook),
+		outbox:   make(map[int64]model.WebhookDelivery),
+		log:      log,
+
+		MaxClicks: DefaultMaxClicks,
 	}
 }
 
-func (s *StorageInMemory) Put(url, shortURL string) error {
+func (s *StorageInMemory) Put(link model.Link) error {
 	s.rvMu.Lock()
 	defer s.rvMu.Unlock()
 
-	s.log.Debug("put", zap.String("url", url), zap.String("shortUrl", shortURL))
+	s.log.Debug("put", zap.String("url", link.URL), zap.String("shortUrl", link.ShortURL), zap.String("tenant", link.Tenant))
 
-	if _, ok := s.storage[shortURL]; ok {
+	if _, ok := s.reverse[reverseKey(link)]; ok {
 		return errs.ErrURLIsExist
 	}
 
-	if _, ok := s.reverse[url]; ok {
-		return errs.ErrURLIsExist
+	if _, ok := s.storage[link.Key()]; ok {
+		return errs.ErrShortURLIsExist
+	}
+
+	event := model.LinkEvent{Type: model.EventLinkCreated, Link: link, At: createdAt(link)}
+	if err := s.queueDeliveries(event); err != nil {
+		return err
 	}
 
-	s.storage[shortURL] = url
-	s.reverse[url] = shortURL
+	s.storage[link.Key()] = link
+	s.reverse[reverseKey(link)] = link.ShortURL
+	s.queueEvents(event)
 
 	return nil
 }
 
+// Get looks shortURL up in the default tenant and domain.
 func (s *StorageInMemory) Get(shortURL string) (string, error) {
+	link, err := s.GetLink(model.LinkKey{ShortURL: shortURL})
+	if err != nil {
+		return "", err
+	}
+
+	return link.URL, nil
+}
+
+func (s *StorageInMemory) GetLink(key model.LinkKey) (model.Link, error) {
 	s.rvMu.RLock()
 	defer s.rvMu.RUnlock()
 
-	s.log.Debug("get", zap.String("shortUrl", shortURL))
+	s.log.Debug("get", zap.String("shortUrl", key.ShortURL), zap.String("tenant", key.Tenant))
+
+	link, ok := s.storage[key]
+	if !ok {
+		return model.Link{}, errs.ErrURLIsNotExist
+	}
+
+	return link, nil
+}
+
+func (s *StorageInMemory) Update(link model.Link) error {
+	s.rvMu.Lock()
+	defer s.rvMu.Unlock()
+
+	s.log.Debug("update", zap.String("url", link.URL), zap.String("shortUrl", link.ShortURL), zap.String("tenant", link.Tenant))
+
+	old, ok := s.storage[link.Key()]
+	if !ok {
+		return errs.ErrURLIsNotExist
+	}
+
+	if existing, ok := s.reverse[reverseKey(link)]; ok && existing != link.ShortURL {
+		return errs.ErrURLIsExist
+	}
+
+	updated := old
+	updated.URL, updated.NormalizedURL = link.URL, link.NormalizedURL
+	if err := s.queueDeliveries(model.LinkEvent{Type: model.EventLinkUpdated, Link: updated, At: time.Now().UTC()}); err != nil {
+		return err
+	}
+
+	delete(s.reverse, reverseKey(old))
+	s.storage[link.Key()] = updated
+	s.reverse[reverseKey(updated)] = updated.ShortURL
+
+	return nil
+}
+
+func (s *StorageInMemory) Delete(key model.LinkKey) error {
+	s.rvMu.Lock()
+	defer s.rvMu.Unlock()
+
+	s.log.Debug("delete", zap.String("shortUrl", key.ShortURL), zap.String("tenant", key.Tenant))
 
-	if url, ok := s.storage[shortURL]; ok {
-		return url, nil
+	link, ok := s.storage[key]
+	if !ok {
+		return errs.ErrURLIsNotExist
 	}
 
-	return "", errs.ErrURLIsNotExist
+	event := model.LinkEvent{Type: model.EventLinkDeleted, Link: link, At: time.Now().UTC()}
+	if err := s.queueDeliveries(event); err != nil {
+		return err
+	}
+
+	delete(s.storage, key)
+	delete(s.reverse, reverseKey(link))
+	delete(s.clicked, key)
+	s.queueEvents(event)
+
+	s.clkMu.Lock()
+	s.clickCount -= len(s.clicks[key])
+	delete(s.clicks, key)
+	delete(s.visitors, key)
+	s.clkMu.Unlock()
+
+	return nil
+}
+
+func (s *StorageInMemory) ListByOwner(tenant, owner string, after model.LinkKey, limit int) ([]model.Link, error) {
+	s.rvMu.RLock()
+	defer s.rvMu.RUnlock()
+
+	var links []model.Link
+	for _, link := range s.storage {
+		if link.Tenant == tenant && link.Owner == owner {
+			links = append(links, link)
+		}
+	}
+
+	slices.SortFunc(links, newestFirst)
+
+	if after.ShortURL != "" {
+		cursor, ok := s.storage[model.LinkKey{Tenant: tenant, Domain: after.Domain, ShortURL: after.ShortURL}]
+		if !ok {
+			return nil, errs.ErrURLIsNotExist
+		}
+		i, found := slices.BinarySearchFunc(links, cursor, newestFirst)
+		if found {
+			i++
+		}
+		links = links[i:]
+	}
+
+	return links[:min(limit, len(links))], nil
+}
+
+func (s *StorageInMemory) CountByTenant(tenant string) (int, error) {
+	s.rvMu.RLock()
+	defer s.rvMu.RUnlock()
+
+	count := 0
+	for key := range s.storage {
+		if key.Tenant == tenant {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func newestFirst(a, b model.Link) int {
+	if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+		return c
+	}
+
+	if c := strings.Compare(b.ShortURL, a.ShortURL); c != 0 {
+		return c
+	}
+
+	return strings.Compare(b.Domain, a.Domain)
+}
+
+func (s *StorageInMemory) NextBlock(name string, size uint64) (uint64, error) {
+	s.blMu.Lock()
+	defer s.blMu.Unlock()
+
+	start := s.blocks[name]
+	s.blocks[name] = start + size
+
+	s.log.Debug("next block", zap.String("name", name), zap.Uint64("start", start), zap.Uint64("size", size))
+
+	return start, nil
+}
+
+func (s *StorageInMemory) ReleaseBlock(name string, start, end uint64) error {
+	s.blMu.Lock()
+	defer s.blMu.Unlock()
+
+	if s.blocks[name] == end {
+		s.blocks[name] = start
+	}
+
+	s.log.Debug("release block", zap.String("name", name), zap.Uint64("start", start), zap.Uint64("end", end))
+
+	return nil
+}
+
+func (s *StorageInMemory) PutAPIKey(key model.APIKey) error {
+	s.keyMu.Lock()
+	defer s.keyMu.Unlock()
+
+	if _, ok := s.keys[key.ID]; ok {
+		return errs.ErrAPIKeyIsExist
+	}
+
+	key.Scopes = slices.Clone(key.Scopes)
+	s.keys[key.ID] = key
+
+	return nil
+}
+
+func (s *StorageInMemory) GetAPIKey(id string) (model.APIKey, error) {
+	s.keyMu.RLock()
+	defer s.keyMu.RUnlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return model.APIKey{}, errs.ErrAPIKeyIsNotExist
+	}
+
+	return key, nil
+}
+
+func (s *StorageInMemory) ListAPIKeys() ([]model.APIKey, error) {
+	s.keyMu.RLock()
+	defer s.keyMu.RUnlock()
+
+	keys := make([]model.APIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+
+	slices.SortFunc(keys, func(a, b model.APIKey) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	return keys, nil
+}
+
+func (s *StorageInMemory) RevokeAPIKey(id string, at time.Time) error {
+	return s.updateAPIKey(id, func(key *model.APIKey) {
+		// An earlier revocation, e.g. from a rotation grace period, stands.
+		if key.RevokedAt.IsZero() || at.Before(key.RevokedAt) {
+			key.RevokedAt = at
+		}
+	})
+}
+
+func (s *StorageInMemory) TouchAPIKey(id string, at time.Time) error {
+	return s.updateAPIKey(id, func(key *model.APIKey) {
+		key.LastUsedAt = at
+	})
+}
+
+func (s *StorageInMemory) updateAPIKey(id string, update func(key *model.APIKey)) error {
+	s.keyMu.Lock()
+	defer s.keyMu.Unlock()
+
+	key, ok := s.keys[id]
+	if !ok {
+		return errs.ErrAPIKeyIsNotExist
+	}
+
+	update(&key)
+	s.keys[id] = key
+
+	return nil
 }
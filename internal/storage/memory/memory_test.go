@@ -5,9 +5,13 @@ import (
 	"fmt"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
 	"go.uber.org/zap/zaptest"
 
+	"url-shortener/internal/model"
+	"url-shortener/internal/sketch"
 	"url-shortener/internal/storage/errs"
 )
 
@@ -25,7 +29,7 @@ func TestStorageInMemory_PutAndGet(t *testing.T) {
 	url := originalURL
 	shortURL := shortedURL
 
-	err := storage.Put(url, shortURL)
+	err := storage.Put(model.Link{URL: url, ShortURL: shortURL})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -49,17 +53,34 @@ func TestStorageInMemory_PutDuplicate(t *testing.T) {
 	url := originalURL
 	shortURL := shortedURL
 
-	err := storage.Put(url, shortURL)
+	err := storage.Put(model.Link{URL: url, ShortURL: shortURL})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	err = storage.Put(url, shortURL)
+	err = storage.Put(model.Link{URL: url, ShortURL: shortURL})
 	if !errors.Is(err, errs.ErrURLIsExist) {
 		t.Errorf("expected error %v, got %v", errs.ErrURLIsExist, err)
 	}
 }
 
+func TestStorageInMemory_PutShortURLCollision(t *testing.T) {
+	t.Parallel()
+
+	logger := zaptest.NewLogger(t)
+	storage := NewStorageInMemory(logger)
+
+	err := storage.Put(model.Link{URL: originalURL, ShortURL: shortedURL})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = storage.Put(model.Link{URL: "https://another.com", ShortURL: shortedURL})
+	if !errors.Is(err, errs.ErrShortURLIsExist) {
+		t.Errorf("expected error %v, got %v", errs.ErrShortURLIsExist, err)
+	}
+}
+
 func TestStorageInMemory_GetNotFound(t *testing.T) {
 	t.Parallel()
 
@@ -88,7 +109,7 @@ func TestStorageInMemory_ConcurrencyStress(t *testing.T) {
 			defer wg.Done()
 			url := fmt.Sprintf("https://example.com/%d", i)
 			shortURL := fmt.Sprintf("short%d", i)
-			_ = storage.Put(url, shortURL)
+			_ = storage.Put(model.Link{URL: url, ShortURL: shortURL})
 		}(i)
 
 		go func(i int) {
@@ -100,3 +121,356 @@ func TestStorageInMemory_ConcurrencyStress(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestStorageInMemory_Blocks(t *testing.T) {
+	t.Parallel()
+
+	logger := zaptest.NewLogger(t)
+	storage := NewStorageInMemory(logger)
+
+	first, _ := storage.NextBlock("seq", 10)
+	second, _ := storage.NextBlock("seq", 10)
+	other, _ := storage.NextBlock("other", 10)
+
+	if first != 0 || second != 10 || other != 0 {
+		t.Fatalf("unexpected blocks: %d, %d, %d", first, second, other)
+	}
+
+	_ = storage.ReleaseBlock("seq", 5, 10)
+	if next, _ := storage.NextBlock("seq", 10); next != 20 {
+		t.Errorf("stale block must not be reclaimed, got %d", next)
+	}
+
+	_ = storage.ReleaseBlock("seq", 25, 30)
+	if next, _ := storage.NextBlock("seq", 10); next != 25 {
+		t.Errorf("latest block tail must be reclaimed, got %d", next)
+	}
+}
+
+func TestStorageInMemory_APIKeys(t *testing.T) {
+	t.Parallel()
+
+	storage := NewStorageInMemory(zaptest.NewLogger(t))
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	assert.NoError(t, storage.PutAPIKey(model.APIKey{ID: "b", Name: "second", CreatedAt: created.Add(time.Minute)}))
+	assert.NoError(t, storage.PutAPIKey(model.APIKey{ID: "a", Name: "first", CreatedAt: created}))
+	assert.ErrorIs(t, storage.PutAPIKey(model.APIKey{ID: "a"}), errs.ErrAPIKeyIsExist)
+
+	keys, err := storage.ListAPIKeys()
+	assert.NoError(t, err)
+	if assert.Len(t, keys, 2) {
+		assert.Equal(t, "a", keys[0].ID)
+	}
+
+	assert.NoError(t, storage.RevokeAPIKey("a", created.Add(time.Hour)))
+	assert.NoError(t, storage.RevokeAPIKey("a", created.Add(2*time.Hour)))
+	assert.NoError(t, storage.TouchAPIKey("a", created.Add(time.Minute)))
+
+	key, err := storage.GetAPIKey("a")
+	assert.NoError(t, err)
+	assert.Equal(t, created.Add(time.Hour), key.RevokedAt, "the earlier revocation stands")
+	assert.Equal(t, created.Add(time.Minute), key.LastUsedAt)
+
+	_, err = storage.GetAPIKey("missing")
+	assert.ErrorIs(t, err, errs.ErrAPIKeyIsNotExist)
+	assert.ErrorIs(t, storage.TouchAPIKey("missing", created), errs.ErrAPIKeyIsNotExist)
+}
+
+func TestStorageInMemory_UpdateAndDelete(t *testing.T) {
+	t.Parallel()
+
+	storage := NewStorageInMemory(zaptest.NewLogger(t))
+	assert.NoError(t, storage.Put(model.Link{URL: originalURL, ShortURL: shortedURL, Owner: "alice"}))
+	assert.NoError(t, storage.Put(model.Link{URL: "https://other.com", ShortURL: "other"}))
+
+	assert.ErrorIs(t, storage.Update(model.Link{URL: "https://other.com", ShortURL: shortedURL}), errs.ErrURLIsExist)
+	assert.NoError(t, storage.Update(model.Link{URL: "https://new.com", ShortURL: shortedURL}))
+	assert.ErrorIs(t, storage.Update(model.Link{URL: "https://new.com", ShortURL: "missing"}), errs.ErrURLIsNotExist)
+
+	link, err := storage.GetLink(model.LinkKey{ShortURL: shortedURL})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://new.com", link.URL)
+	assert.Equal(t, "alice", link.Owner, "update keeps the owner")
+
+	assert.NoError(t, storage.Put(model.Link{URL: originalURL, ShortURL: "again"}), "the old URL is free again")
+
+	assert.NoError(t, storage.Delete(model.LinkKey{ShortURL: shortedURL}))
+	assert.ErrorIs(t, storage.Delete(model.LinkKey{ShortURL: shortedURL}), errs.ErrURLIsNotExist)
+	_, err = storage.Get(shortedURL)
+	assert.ErrorIs(t, err, errs.ErrURLIsNotExist)
+	assert.NoError(t, storage.Put(model.Link{URL: "https://new.com", ShortURL: "new"}))
+}
+
+func TestStorageInMemory_ListByOwner(t *testing.T) {
+	t.Parallel()
+
+	storage := NewStorageInMemory(zaptest.NewLogger(t))
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := range 5 {
+		assert.NoError(t, storage.Put(model.Link{
+			URL:       fmt.Sprintf("https://example.com/%d", i),
+			ShortURL:  fmt.Sprintf("code%d", i),
+			Owner:     "alice",
+			CreatedAt: created.Add(time.Duration(i) * time.Minute),
+		}))
+	}
+	assert.NoError(t, storage.Put(model.Link{URL: "https://bob.com", ShortURL: "bob", Owner: "bob", CreatedAt: created}))
+
+	page, err := storage.ListByOwner("", "alice", model.LinkKey{}, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"code4", "code3"}, codes(page))
+
+	page, err = storage.ListByOwner("", "alice", model.LinkKey{ShortURL: "code3"}, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"code2", "code1"}, codes(page))
+
+	page, err = storage.ListByOwner("", "alice", model.LinkKey{ShortURL: "code1"}, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"code0"}, codes(page))
+
+	_, err = storage.ListByOwner("", "alice", model.LinkKey{ShortURL: "missing"}, 2)
+	assert.ErrorIs(t, err, errs.ErrURLIsNotExist)
+}
+
+func TestStorageInMemory_Tenants(t *testing.T) {
+	t.Parallel()
+
+	storage := NewStorageInMemory(zaptest.NewLogger(t))
+	assert.NoError(t, storage.Put(model.Link{URL: originalURL, ShortURL: shortedURL, Owner: "alice"}))
+	assert.NoError(t, storage.Put(model.Link{URL: originalURL, ShortURL: shortedURL, Owner: "alice", Tenant: "acme"}),
+		"short URLs and destinations are unique per tenant")
+	assert.ErrorIs(t, storage.Put(model.Link{URL: originalURL, ShortURL: "dup", Tenant: "acme"}), errs.ErrURLIsExist)
+	assert.NoError(t, storage.Update(model.Link{URL: "https://acme.com", ShortURL: shortedURL, Tenant: "acme"}))
+
+	link, err := storage.GetLink(model.LinkKey{Tenant: "acme", ShortURL: shortedURL})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://acme.com", link.URL)
+
+	url, err := storage.Get(shortedURL)
+	assert.NoError(t, err)
+	assert.Equal(t, originalURL, url, "the default tenant is untouched")
+
+	_, err = storage.GetLink(model.LinkKey{Tenant: "globex", ShortURL: shortedURL})
+	assert.ErrorIs(t, err, errs.ErrURLIsNotExist)
+
+	page, err := storage.ListByOwner("acme", "alice", model.LinkKey{}, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{shortedURL}, codes(page))
+
+	n, err := storage.CountByTenant("acme")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	assert.NoError(t, storage.Delete(model.LinkKey{Tenant: "acme", ShortURL: shortedURL}))
+	n, err = storage.CountByTenant("acme")
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+	_, err = storage.Get(shortedURL)
+	assert.NoError(t, err)
+}
+
+func codes(links []model.Link) []string {
+	var result []string
+	for _, link := range links {
+		result = append(result, link.ShortURL)
+	}
+
+	return result
+}
+
+func TestStorageInMemory_ClickStats(t *testing.T) {
+	t.Parallel()
+
+	storage := NewStorageInMemory(zaptest.NewLogger(t))
+	link := model.Link{URL: originalURL, ShortURL: shortedURL, Tenant: "acme"}
+	assert.NoError(t, storage.Put(link))
+
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	click := func(at time.Duration, referrer, ua string) model.Click {
+		return model.Click{Tenant: "acme", ShortURL: shortedURL, At: day.Add(at), Referrer: referrer, UserAgent: ua}
+	}
+	assert.NoError(t, storage.PutClicks([]model.Click{
+		click(10*time.Minute, "https://t.me/", "curl"),
+		click(20*time.Minute, "https://t.me/", "Mozilla"),
+		click(90*time.Minute, "https://x.com/", "Mozilla"),
+		click(100*time.Minute, "", "Mozilla"),
+		click(-time.Minute, "https://t.me/", "Mozilla"),
+		// Same code in another tenant.
+		{ShortURL: shortedURL, At: day.Add(time.Minute)},
+	}))
+
+	stats, err := storage.ClickStats(link.Key(), model.ClickQuery{From: day, To: day.Add(24 * time.Hour), Interval: time.Hour, Top: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), stats.Total)
+	assert.Equal(t, []model.ClickBucket{{Start: day, Clicks: 2}, {Start: day.Add(time.Hour), Clicks: 2}}, stats.Series)
+	assert.Equal(t, []model.ClickCount{{Value: "https://t.me/", Clicks: 2}}, stats.TopReferrers)
+	assert.Equal(t, []model.ClickCount{{Value: "Mozilla", Clicks: 3}}, stats.TopUserAgents)
+
+	assert.NoError(t, storage.Delete(link.Key()))
+	stats, err = storage.ClickStats(link.Key(), model.ClickQuery{From: day, To: day.Add(24 * time.Hour), Interval: time.Hour, Top: 1})
+	assert.NoError(t, err)
+	assert.Zero(t, stats.Total)
+}
+
+func TestStorageInMemory_ClickStatsTraffic(t *testing.T) {
+	t.Parallel()
+
+	storage := NewStorageInMemory(zaptest.NewLogger(t))
+	link := model.Link{URL: originalURL, ShortURL: shortedURL}
+	assert.NoError(t, storage.Put(link))
+
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	assert.NoError(t, storage.PutClicks([]model.Click{
+		{ShortURL: shortedURL, At: day, UserAgent: "Mozilla"},
+		{ShortURL: shortedURL, At: day, UserAgent: "Mozilla", Class: model.ClassHuman},
+		{ShortURL: shortedURL, At: day, UserAgent: "Slackbot", Class: model.ClassBot, Bot: "Slack"},
+		{ShortURL: shortedURL, At: day, UserAgent: "Slackbot", Class: model.ClassBot, Bot: "Slack"},
+		{ShortURL: shortedURL, At: day, UserAgent: "Twitterbot", Class: model.ClassBot, Bot: "Twitter"},
+		{ShortURL: shortedURL, At: day, UserAgent: "curl", Class: model.ClassSuspicious},
+	}))
+
+	q := model.ClickQuery{From: day, To: day.Add(24 * time.Hour), Interval: time.Hour, Top: 10}
+	stats, err := storage.ClickStats(link.Key(), q)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), stats.Total)
+	assert.Equal(t, []model.ClickCount{{Value: "Mozilla", Clicks: 2}}, stats.TopUserAgents)
+	assert.Equal(t, []model.ClickCount{
+		{Value: model.ClassBot, Clicks: 3}, {Value: model.ClassHuman, Clicks: 2}, {Value: model.ClassSuspicious, Clicks: 1},
+	}, stats.ByClass)
+	assert.Equal(t, []model.ClickCount{{Value: "Slack", Clicks: 2}, {Value: "Twitter", Clicks: 1}}, stats.TopBots)
+
+	q.Traffic = model.ClassBot
+	stats, err = storage.ClickStats(link.Key(), q)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), stats.Total)
+
+	q.Traffic = model.TrafficAll
+	stats, err = storage.ClickStats(link.Key(), q)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), stats.Total)
+}
+
+func TestStorageInMemory_ClickStatsBreakdowns(t *testing.T) {
+	t.Parallel()
+
+	storage := NewStorageInMemory(zaptest.NewLogger(t))
+	link := model.Link{URL: originalURL, ShortURL: shortedURL}
+	assert.NoError(t, storage.Put(link))
+
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	click := func(country, city, device, os, browser string) model.Click {
+		return model.Click{ShortURL: shortedURL, At: day, Country: country, City: city, Device: device, OS: os, Browser: browser}
+	}
+	assert.NoError(t, storage.PutClicks([]model.Click{
+		click("DE", "Berlin", "mobile", "iOS", "Safari"),
+		click("DE", "Berlin", "desktop", "Windows", "Chrome"),
+		click("DE", "", "mobile", "Android", "Chrome"),
+		click("US", "Berlin", "mobile", "iOS", "Safari"),
+		click("", "", "", "", ""),
+	}))
+
+	stats, err := storage.ClickStats(link.Key(), model.ClickQuery{From: day, To: day.Add(time.Hour), Interval: time.Hour, Top: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, []model.ClickCount{{Value: "DE", Clicks: 3}, {Value: "US", Clicks: 1}}, stats.TopCountries)
+	assert.Equal(t, []model.ClickCount{{Value: "Berlin, DE", Clicks: 2}, {Value: "Berlin, US", Clicks: 1}}, stats.TopCities)
+	assert.Equal(t, []model.ClickCount{{Value: "mobile", Clicks: 3}, {Value: "desktop", Clicks: 1}}, stats.TopDevices)
+	assert.Equal(t, []model.ClickCount{{Value: "iOS", Clicks: 2}, {Value: "Android", Clicks: 1}}, stats.TopOS)
+	assert.Equal(t, []model.ClickCount{{Value: "Chrome", Clicks: 2}, {Value: "Safari", Clicks: 2}}, stats.TopBrowsers)
+}
+
+func TestStorageInMemory_Visitors(t *testing.T) {
+	t.Parallel()
+
+	storage := NewStorageInMemory(zaptest.NewLogger(t))
+	key := model.LinkKey{ShortURL: shortedURL}
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	visitors := func(day time.Time, from, to int) model.VisitorSketch {
+		h, err := sketch.NewHLL(sketch.HLLPrecision)
+		assert.NoError(t, err)
+		for i := from; i < to; i++ {
+			h.Add([]byte(fmt.Sprint("visitor-", i)))
+		}
+		return model.VisitorSketch{ShortURL: shortedURL, Day: day, Sketch: h}
+	}
+
+	// Two instances saw overlapping visitors on the first day.
+	assert.NoError(t, storage.MergeVisitors([]model.VisitorSketch{visitors(day, 0, 300)}))
+	assert.NoError(t, storage.MergeVisitors([]model.VisitorSketch{visitors(day, 200, 500), visitors(day.Add(24*time.Hour), 400, 600)}))
+
+	query := func(from, to time.Time) int64 {
+		stats, err := storage.ClickStats(key, model.ClickQuery{From: from, To: to, Interval: time.Hour, Top: 1})
+		assert.NoError(t, err)
+		return stats.UniqueVisitors
+	}
+
+	assert.InDelta(t, 500, query(day, day.Add(24*time.Hour)), 10)
+	// A partial day counts the whole day.
+	assert.InDelta(t, 500, query(day.Add(time.Hour), day.Add(2*time.Hour)), 10)
+	assert.InDelta(t, 600, query(day, day.Add(48*time.Hour)), 12)
+	assert.Zero(t, query(day.Add(-24*time.Hour), day))
+}
+
+func TestStorageInMemory_WebhookDeliveries(t *testing.T) {
+	t.Parallel()
+
+	storage := NewStorageInMemory(zaptest.NewLogger(t))
+	assert.NoError(t, storage.PutWebhook(model.Webhook{ID: "all", Tenant: "acme"}))
+	assert.NoError(t, storage.PutWebhook(model.Webhook{ID: "deleted", Tenant: "acme", Events: []string{model.EventLinkDeleted}}))
+	assert.NoError(t, storage.PutWebhook(model.Webhook{ID: "globex", Tenant: "globex"}))
+
+	failing := errors.New("no payload")
+	storage.QueueWebhookDeliveries(func(event model.LinkEvent) (model.WebhookDelivery, error) {
+		if event.Link.URL == "https://fail.com" {
+			return model.WebhookDelivery{}, failing
+		}
+		return model.WebhookDelivery{Event: event.Type}, nil
+	})
+
+	link := model.Link{URL: originalURL, ShortURL: shortedURL, Tenant: "acme"}
+	assert.NoError(t, storage.Put(link))
+	assert.NoError(t, storage.Delete(link.Key()))
+
+	// A change whose deliveries cannot be queued is not made.
+	assert.ErrorIs(t, storage.Put(model.Link{URL: "https://fail.com", ShortURL: "fail", Tenant: "acme"}), failing)
+	_, err := storage.GetLink(model.LinkKey{Tenant: "acme", ShortURL: "fail"})
+	assert.ErrorIs(t, err, errs.ErrURLIsNotExist)
+
+	var queued []string
+	for _, d := range storage.outbox {
+		queued = append(queued, d.WebhookID+" "+d.Event)
+	}
+	assert.ElementsMatch(t, []string{"all link.created", "all link.deleted", "deleted link.deleted"}, queued)
+}
+
+func TestStorageInMemory_MaxClicks(t *testing.T) {
+	t.Parallel()
+
+	storage := NewStorageInMemory(zaptest.NewLogger(t))
+	storage.MaxClicks = 10
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	h, err := sketch.NewHLL(sketch.HLLPrecision)
+	assert.NoError(t, err)
+	h.Add([]byte("visitor"))
+	assert.NoError(t, storage.MergeVisitors([]model.VisitorSketch{
+		{ShortURL: "old", Day: day, Sketch: h},
+		{ShortURL: shortedURL, Day: day, Sketch: h},
+		{ShortURL: shortedURL, Day: day.Add(24 * time.Hour), Sketch: h},
+	}))
+
+	assert.NoError(t, storage.PutClicks([]model.Click{{ShortURL: "old", At: day}}))
+	for i := range 10 {
+		assert.NoError(t, storage.PutClicks([]model.Click{{ShortURL: shortedURL, At: day.Add(24*time.Hour + time.Duration(i)*time.Minute)}}))
+	}
+	assert.Len(t, storage.clicks[model.LinkKey{ShortURL: shortedURL}], 10)
+	assert.Len(t, storage.clicks[model.LinkKey{ShortURL: "old"}], 1, "within the slack nothing is dropped")
+
+	assert.NoError(t, storage.PutClicks([]model.Click{{ShortURL: shortedURL, At: day.Add(48 * time.Hour)}}))
+	assert.Equal(t, 10, storage.clickCount)
+	assert.NotContains(t, storage.clicks, model.LinkKey{ShortURL: "old"})
+	assert.NotContains(t, storage.visitors, model.LinkKey{ShortURL: "old"})
+	assert.Len(t, storage.visitors[model.LinkKey{ShortURL: shortedURL}], 1, "the visitors of days without clicks are dropped")
+}
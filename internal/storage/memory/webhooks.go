@@ -0,0 +1,230 @@
+package memory
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"time"
+
+	"go.uber.org/zap"
+
+	"url-shortener/internal/model"
+	"url-shortener/internal/storage/errs"
+)
+
+// MarkFirstClick records that the link of key has been clicked and reports
+// whether it had not been before, queueing the deliveries of the first click
+// if so.
+func (s *StorageInMemory) MarkFirstClick(key model.LinkKey, at time.Time) (bool, error) {
+	s.rvMu.Lock()
+	defer s.rvMu.Unlock()
+
+	link, ok := s.storage[key]
+	if !ok || s.clicked[key] {
+		return false, nil
+	}
+
+	if err := s.queueDeliveries(model.LinkEvent{Type: model.EventLinkFirstClicked, Link: link, At: at}); err != nil {
+		return false, err
+	}
+	s.clicked[key] = true
+
+	return true, nil
+}
+
+// QueueWebhookDeliveries makes every link created, updated, deleted or first
+// clicked queue the delivery build returns to each webhook of the link's
+// tenant that subscribes to the event, together with the change. It must be
+// called before the storage is used.
+func (s *StorageInMemory) QueueWebhookDeliveries(build func(model.LinkEvent) (model.WebhookDelivery, error)) {
+	s.deliveries = build
+}
+
+// queueDeliveries queues the delivery of event to the webhooks subscribed to
+// it. Callers hold the lock of the change and make it only if this succeeds.
+func (s *StorageInMemory) queueDeliveries(event model.LinkEvent) error {
+	if s.deliveries == nil {
+		return nil
+	}
+
+	d, err := s.deliveries(event)
+	if err != nil {
+		return fmt.Errorf("failed to build webhook delivery: %w", err)
+	}
+
+	s.whMu.Lock()
+	defer s.whMu.Unlock()
+
+	for _, webhook := range s.webhooks {
+		if webhook.Tenant != event.Link.Tenant || !webhook.Wants(event.Type) {
+			continue
+		}
+
+		s.lastDeliveryID++
+		d.ID, d.WebhookID = s.lastDeliveryID, webhook.ID
+		s.outbox[d.ID] = d
+	}
+
+	s.log.Debug("queue webhook deliveries", zap.String("event", event.Type), zap.String("tenant", event.Link.Tenant))
+
+	return nil
+}
+
+func (s *StorageInMemory) PutWebhook(webhook model.Webhook) error {
+	s.whMu.Lock()
+	defer s.whMu.Unlock()
+
+	if _, ok := s.webhooks[webhook.ID]; ok {
+		return errs.ErrWebhookIsExist
+	}
+
+	webhook.Events = slices.Clone(webhook.Events)
+	s.webhooks[webhook.ID] = webhook
+
+	return nil
+}
+
+func (s *StorageInMemory) GetWebhook(id string) (model.Webhook, error) {
+	s.whMu.Lock()
+	defer s.whMu.Unlock()
+
+	webhook, ok := s.webhooks[id]
+	if !ok {
+		return model.Webhook{}, errs.ErrWebhookIsNotExist
+	}
+
+	return webhook, nil
+}
+
+func (s *StorageInMemory) ListWebhooks() ([]model.Webhook, error) {
+	s.whMu.Lock()
+	defer s.whMu.Unlock()
+
+	webhooks := make([]model.Webhook, 0, len(s.webhooks))
+	for _, webhook := range s.webhooks {
+		webhooks = append(webhooks, webhook)
+	}
+
+	slices.SortFunc(webhooks, func(a, b model.Webhook) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+
+	return webhooks, nil
+}
+
+// DeleteWebhook deletes the webhook with its queued and dead deliveries.
+func (s *StorageInMemory) DeleteWebhook(id string) error {
+	s.whMu.Lock()
+	defer s.whMu.Unlock()
+
+	if _, ok := s.webhooks[id]; !ok {
+		return errs.ErrWebhookIsNotExist
+	}
+
+	delete(s.webhooks, id)
+	for deliveryID, d := range s.outbox {
+		if d.WebhookID == id {
+			delete(s.outbox, deliveryID)
+		}
+	}
+
+	return nil
+}
+
+// ClaimWebhookDeliveries returns up to limit deliveries due at now, oldest
+// first, and postpones them to until so that they are not claimed again while
+// they are being sent.
+func (s *StorageInMemory) ClaimWebhookDeliveries(now, until time.Time, limit int) ([]model.WebhookDelivery, error) {
+	s.whMu.Lock()
+	defer s.whMu.Unlock()
+
+	var due []model.WebhookDelivery
+	for _, d := range s.outbox {
+		if d.DeadAt.IsZero() && !d.NextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+
+	slices.SortFunc(due, func(a, b model.WebhookDelivery) int {
+		return cmp.Or(a.NextAttemptAt.Compare(b.NextAttemptAt), cmp.Compare(a.ID, b.ID))
+	})
+	due = due[:min(limit, len(due))]
+
+	for i, d := range due {
+		d.NextAttemptAt = until
+		s.outbox[d.ID] = d
+
+		webhook := s.webhooks[d.WebhookID]
+		due[i].URL, due[i].Secret = webhook.URL, webhook.Secret
+	}
+
+	return due, nil
+}
+
+// DeleteWebhookDelivery removes a delivered delivery from the outbox.
+func (s *StorageInMemory) DeleteWebhookDelivery(id int64) error {
+	s.whMu.Lock()
+	defer s.whMu.Unlock()
+
+	delete(s.outbox, id)
+
+	return nil
+}
+
+// RetryWebhookDelivery records a failed attempt: the attempts, next attempt,
+// last error and dead time of d.
+func (s *StorageInMemory) RetryWebhookDelivery(d model.WebhookDelivery) error {
+	s.whMu.Lock()
+	defer s.whMu.Unlock()
+
+	stored, ok := s.outbox[d.ID]
+	if !ok {
+		return nil
+	}
+
+	stored.Attempts, stored.NextAttemptAt, stored.LastError, stored.DeadAt = d.Attempts, d.NextAttemptAt, d.LastError, d.DeadAt
+	s.outbox[d.ID] = stored
+
+	return nil
+}
+
+// ListDeadWebhookDeliveries returns up to limit deliveries given up on for
+// the webhook, oldest first.
+func (s *StorageInMemory) ListDeadWebhookDeliveries(webhookID string, limit int) ([]model.WebhookDelivery, error) {
+	s.whMu.Lock()
+	defer s.whMu.Unlock()
+
+	var dead []model.WebhookDelivery
+	for _, d := range s.outbox {
+		if d.WebhookID == webhookID && !d.DeadAt.IsZero() {
+			dead = append(dead, d)
+		}
+	}
+
+	slices.SortFunc(dead, func(a, b model.WebhookDelivery) int {
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	return dead[:min(limit, len(dead))], nil
+}
+
+// ReplayWebhookDeliveries queues the dead deliveries of the webhook with the
+// IDs, or all of them if there are none, for delivery at at with fresh
+// attempts. It returns how many it queued.
+func (s *StorageInMemory) ReplayWebhookDeliveries(webhookID string, ids []int64, at time.Time) (int64, error) {
+	s.whMu.Lock()
+	defer s.whMu.Unlock()
+
+	var replayed int64
+	for id, d := range s.outbox {
+		if d.WebhookID != webhookID || d.DeadAt.IsZero() || (len(ids) > 0 && !slices.Contains(ids, id)) {
+			continue
+		}
+
+		d.Attempts, d.NextAttemptAt, d.LastError, d.DeadAt = 0, at, "", time.Time{}
+		s.outbox[id] = d
+		replayed++
+	}
+
+	return replayed, nil
+}
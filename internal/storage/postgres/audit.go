@@ -0,0 +1,200 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"url-shortener/internal/model"
+)
+
+// auditLock is the key of the advisory lock held while a chained audit entry
+// is appended; it spells "audit".
+const auditLock = 0x6175646974
+
+const auditColumns = `id, at, actor, tenant, action, target, before_state, after_state, request_id, ip, prev_hash, hash`
+
+// createAuditTable creates the audit log. A trigger rejects every UPDATE,
+// DELETE and TRUNCATE, so entries can only be appended; the snapshots are
+// JSON rather than JSONB so they keep the exact text that was hashed.
+func createAuditTable(db *sql.DB) error {
+	createAuditTableStmt := `
+    CREATE TABLE IF NOT EXISTS urlshortener_audit (
+        id BIGSERIAL PRIMARY KEY,
+        at TIMESTAMPTZ NOT NULL,
+        actor TEXT NOT NULL,
+        tenant TEXT NOT NULL,
+        action TEXT NOT NULL,
+        target TEXT NOT NULL,
+        before_state JSON,
+        after_state JSON,
+        request_id TEXT NOT NULL,
+        ip TEXT NOT NULL,
+        prev_hash TEXT NOT NULL,
+        hash TEXT NOT NULL
+    )`
+
+	if _, err := db.Exec(createAuditTableStmt); err != nil {
+		return fmt.Errorf("error executing create audit table statement: %w", err)
+	}
+
+	_, err := db.Exec(`CREATE INDEX IF NOT EXISTS urlshortener_audit_tenant_id_idx ON urlshortener_audit (tenant, id)`)
+	if err != nil {
+		return fmt.Errorf("error creating audit tenant index: %w", err)
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS urlshortener_audit_target_id_idx ON urlshortener_audit (target, id)`)
+	if err != nil {
+		return fmt.Errorf("error creating audit target index: %w", err)
+	}
+
+	createFunctionStmt := `
+    CREATE OR REPLACE FUNCTION urlshortener_audit_append_only() RETURNS trigger AS $$
+    BEGIN
+        RAISE EXCEPTION 'urlshortener_audit is append-only';
+    END $$ LANGUAGE plpgsql`
+
+	if _, err = db.Exec(createFunctionStmt); err != nil {
+		return fmt.Errorf("error creating audit trigger function: %w", err)
+	}
+
+	createTriggerStmt := `
+    DO $$
+    BEGIN
+        IF NOT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = 'urlshortener_audit_append_only') THEN
+            CREATE TRIGGER urlshortener_audit_append_only
+                BEFORE UPDATE OR DELETE OR TRUNCATE ON urlshortener_audit
+                FOR EACH STATEMENT EXECUTE FUNCTION urlshortener_audit_append_only();
+        END IF;
+    END $$`
+
+	if _, err = db.Exec(createTriggerStmt); err != nil {
+		return fmt.Errorf("error creating audit trigger: %w", err)
+	}
+
+	return nil
+}
+
+// AppendAuditEntry inserts the entry. Chained entries are appended one at a
+// time under an advisory lock, so each refers to the hash of the entry with
+// the ID right before its own, across instances.
+func (s *Storage) AppendAuditEntry(entry model.AuditEntry, seal func(*model.AuditEntry)) (model.AuditEntry, error) {
+	if seal == nil {
+		err := s.db.QueryRow(`INSERT INTO urlshortener_audit (at, actor, tenant, action, target, before_state, after_state,
+        request_id, ip, prev_hash, hash) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, '', '') RETURNING id`,
+			entry.At, entry.Actor, entry.Tenant, entry.Action, entry.Target, jsonOrNull(entry.Before),
+			jsonOrNull(entry.After), entry.RequestID, entry.IP).Scan(&entry.ID)
+		if err != nil {
+			return model.AuditEntry{}, fmt.Errorf("error inserting audit entry: %w", err)
+		}
+
+		return entry, nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return model.AuditEntry{}, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, auditLock); err != nil {
+		return model.AuditEntry{}, fmt.Errorf("error taking audit lock: %w", err)
+	}
+
+	err = tx.QueryRow(`SELECT hash FROM urlshortener_audit ORDER BY id DESC LIMIT 1`).Scan(&entry.PrevHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return model.AuditEntry{}, fmt.Errorf("error selecting last audit hash: %w", err)
+	}
+
+	err = tx.QueryRow(`SELECT nextval(pg_get_serial_sequence('urlshortener_audit', 'id'))`).Scan(&entry.ID)
+	if err != nil {
+		return model.AuditEntry{}, fmt.Errorf("error selecting next audit id: %w", err)
+	}
+
+	seal(&entry)
+
+	_, err = tx.Exec(`INSERT INTO urlshortener_audit (`+auditColumns+`)
+    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		entry.ID, entry.At, entry.Actor, entry.Tenant, entry.Action, entry.Target, jsonOrNull(entry.Before),
+		jsonOrNull(entry.After), entry.RequestID, entry.IP, entry.PrevHash, entry.Hash)
+	if err != nil {
+		return model.AuditEntry{}, fmt.Errorf("error inserting audit entry: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return model.AuditEntry{}, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return entry, nil
+}
+
+func (s *Storage) ListAuditEntries(q model.AuditQuery, limit int) ([]model.AuditEntry, error) {
+	var conds []string
+	var args []any
+	where := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, strings.ReplaceAll(cond, "?", "$"+strconv.Itoa(len(args))))
+	}
+
+	for _, filter := range []struct{ column, value string }{
+		{"actor", q.Actor}, {"action", q.Action}, {"target", q.Target}, {"request_id", q.RequestID},
+	} {
+		if filter.value != "" {
+			where(filter.column+" = ?", filter.value)
+		}
+	}
+	if len(q.Tenants) > 0 {
+		where("tenant = ANY(?::text[])", pq.StringArray(q.Tenants))
+	}
+	if !q.From.IsZero() {
+		where("at >= ?", q.From)
+	}
+	if !q.To.IsZero() {
+		where("at < ?", q.To)
+	}
+	if q.BeforeID > 0 {
+		where("id < ?", q.BeforeID)
+	}
+
+	query := `SELECT ` + auditColumns + ` FROM urlshortener_audit`
+	if len(conds) > 0 {
+		query += ` WHERE ` + strings.Join(conds, " AND ")
+	}
+	args = append(args, limit)
+	query += ` ORDER BY id DESC LIMIT $` + strconv.Itoa(len(args))
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting audit entries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []model.AuditEntry
+	for rows.Next() {
+		var e model.AuditEntry
+		var before, after []byte
+		err := rows.Scan(&e.ID, &e.At, &e.Actor, &e.Tenant, &e.Action, &e.Target, &before, &after, &e.RequestID, &e.IP,
+			&e.PrevHash, &e.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning audit entry: %w", err)
+		}
+		e.Before, e.After = before, after
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// jsonOrNull passes a snapshot as text, which lib/pq sends as is, or NULL if
+// there is none.
+func jsonOrNull(raw []byte) any {
+	if len(raw) == 0 {
+		return nil
+	}
+
+	return string(raw)
+}
@@ -0,0 +1,338 @@
+package postgres
+
+import (
+	"cmp"
+	"database/sql"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+
+	"url-shortener/internal/model"
+	"url-shortener/internal/sketch"
+)
+
+// date formats the UTC day of t for a DATE column. Passing the time itself
+// would convert it in the time zone of the session.
+func date(t time.Time) string {
+	return t.UTC().Format(time.DateOnly)
+}
+
+// PutClicks copies clicks into the clicks table in one transaction.
+func (s *Storage) PutClicks(clicks []model.Click) error {
+	s.log.Debug("storage.put-clicks", zap.Int("clicks", len(clicks)))
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	stmt, err := tx.Prepare(pq.CopyIn("urlshortener_clicks",
+		"tenant", "domain", "short_url", "at", "referrer", "user_agent", "ip_hash", "class", "bot",
+		"country", "city", "device", "os", "browser"))
+	if err != nil {
+		return fmt.Errorf("error preparing copy statement: %w", err)
+	}
+
+	for _, c := range clicks {
+		class := cmp.Or(c.Class, model.ClassHuman)
+		_, err = stmt.Exec(c.Tenant, c.Domain, c.ShortURL, c.At, c.Referrer, c.UserAgent, c.IPHash, class, c.Bot,
+			c.Country, c.City, c.Device, c.OS, c.Browser)
+		if err != nil {
+			_ = stmt.Close()
+			return fmt.Errorf("error copying click: %w", err)
+		}
+	}
+
+	if _, err = stmt.Exec(); err != nil {
+		_ = stmt.Close()
+		return fmt.Errorf("error flushing clicks: %w", err)
+	}
+
+	if err = stmt.Close(); err != nil {
+		return fmt.Errorf("error closing copy statement: %w", err)
+	}
+
+	events := make([]model.LinkEvent, 0, len(clicks))
+	for _, c := range clicks {
+		events = append(events, c.ResolvedEvent())
+	}
+	if err = s.writeEvents(tx, events...); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// MergeVisitors merges each sketch into the stored one of its link and day.
+// Rows are locked in key order, so instances merging at the same time do not
+// deadlock.
+func (s *Storage) MergeVisitors(sketches []model.VisitorSketch) error {
+	s.log.Debug("storage.merge-visitors", zap.Int("sketches", len(sketches)))
+
+	sorted := slices.Clone(sketches)
+	slices.SortFunc(sorted, func(a, b model.VisitorSketch) int {
+		return cmp.Or(
+			cmp.Compare(a.Tenant, b.Tenant),
+			cmp.Compare(a.Domain, b.Domain),
+			cmp.Compare(a.ShortURL, b.ShortURL),
+			a.Day.Compare(b.Day),
+		)
+	})
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, v := range sorted {
+		if err := mergeVisitors(tx, v); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+func mergeVisitors(tx *sql.Tx, v model.VisitorSketch) error {
+	data, err := v.Sketch.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(`INSERT INTO urlshortener_visitors (tenant, domain, short_url, day, sketch)
+    VALUES ($1, $2, $3, $4, $5) ON CONFLICT DO NOTHING`, v.Tenant, v.Domain, v.ShortURL, date(v.Day), data)
+	if err != nil {
+		return fmt.Errorf("error inserting visitor sketch: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 1 {
+		return nil
+	}
+
+	// The sketch exists: merge into it under a row lock.
+	var stored []byte
+	err = tx.QueryRow(`SELECT sketch FROM urlshortener_visitors
+    WHERE tenant = $1 AND domain = $2 AND short_url = $3 AND day = $4 FOR UPDATE`,
+		v.Tenant, v.Domain, v.ShortURL, date(v.Day)).Scan(&stored)
+	if err != nil {
+		return fmt.Errorf("error reading visitor sketch: %w", err)
+	}
+
+	var merged sketch.HLL
+	if err := merged.UnmarshalBinary(stored); err != nil {
+		return err
+	}
+	if err := merged.Merge(v.Sketch); err != nil {
+		return err
+	}
+	if data, err = merged.MarshalBinary(); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE urlshortener_visitors SET sketch = $5
+    WHERE tenant = $1 AND domain = $2 AND short_url = $3 AND day = $4`,
+		v.Tenant, v.Domain, v.ShortURL, date(v.Day), data)
+	if err != nil {
+		return fmt.Errorf("error updating visitor sketch: %w", err)
+	}
+
+	return nil
+}
+
+// clickColumns compute each breakdown of the clicks from a raw click. They
+// are never user input.
+var clickColumns = map[string]string{
+	"class":      "class",
+	"bot":        "bot",
+	"referrer":   "referrer",
+	"user_agent": "user_agent",
+	"country":    "country",
+	// NULL for clicks without a city, which leaves them out.
+	"city":    "(nullif(city, '') || ', ' || country)",
+	"device":  "device",
+	"os":      "os",
+	"browser": "browser",
+}
+
+// countedClicks starts a query with a counted table of (at, value, clicks)
+// rows, where value is the dimension of the clicks of link $1-$3 in [$4, $5)
+// and of traffic $7. Clicks since the hourly rollup watermark are counted
+// from raw clicks, older ones from hourly rollups back to the daily watermark
+// and from daily rollups before that. A rollup counts in full if its bucket
+// starts in the range.
+func countedClicks(dimension string) string {
+	return fmt.Sprintf(`WITH marks AS (
+        SELECT coalesce(max(done_through) FILTER (WHERE granularity = 'hour'), '-infinity') AS hour_mark,
+            coalesce(max(done_through) FILTER (WHERE granularity = 'day'), '-infinity') AS day_mark
+        FROM urlshortener_rollup_state
+    ), counted AS (
+        SELECT at, %[2]s AS value, 1::bigint AS clicks FROM urlshortener_clicks, marks
+        WHERE tenant = $1 AND domain = $2 AND short_url = $3 AND at >= $4 AND at < $5 AND at >= hour_mark
+          AND ($7 = 'all' OR class = $7)
+        UNION ALL
+        SELECT bucket, value, clicks FROM urlshortener_click_rollups, marks
+        WHERE tenant = $1 AND domain = $2 AND short_url = $3 AND dimension = '%[1]s' AND bucket >= $4 AND bucket < $5
+          AND bucket < hour_mark AND CASE granularity WHEN 'hour' THEN bucket >= day_mark ELSE bucket < day_mark END
+          AND ($7 = 'all' OR class = $7)
+    )`, dimension, clickColumns[dimension])
+}
+
+// ClickStats aggregates the clicks of a link in the database, from raw clicks
+// and, for the time rolled up, from rollups. Buckets are computed from the
+// Unix epoch, so they line up with those of memory storage. Top user agents
+// only cover raw clicks.
+func (s *Storage) ClickStats(key model.LinkKey, q model.ClickQuery) (model.ClickStats, error) {
+	s.log.Info("storage.click-stats", zap.String("short-url", key.ShortURL), zap.String("tenant", key.Tenant),
+		zap.String("domain", key.Domain))
+
+	q.Traffic = cmp.Or(q.Traffic, model.ClassHuman)
+
+	rows, err := s.db.Query(countedClicks("class")+`
+    SELECT to_timestamp(floor(extract(epoch FROM at) / $6) * $6) AS bucket, sum(clicks)::bigint
+    FROM counted GROUP BY bucket ORDER BY bucket`,
+		key.Tenant, key.Domain, key.ShortURL, q.From, q.To, int64(q.Interval.Seconds()), q.Traffic)
+	if err != nil {
+		return model.ClickStats{}, fmt.Errorf("error querying click series: %w", err)
+	}
+	defer rows.Close()
+
+	var stats model.ClickStats
+	for rows.Next() {
+		var b model.ClickBucket
+		if err := rows.Scan(&b.Start, &b.Clicks); err != nil {
+			return model.ClickStats{}, fmt.Errorf("error scanning row: %w", err)
+		}
+		b.Start = b.Start.UTC()
+		stats.Series = append(stats.Series, b)
+		stats.Total += b.Clicks
+	}
+	if err := rows.Err(); err != nil {
+		return model.ClickStats{}, fmt.Errorf("error reading click series: %w", err)
+	}
+
+	if stats.UniqueVisitors, err = s.uniqueVisitors(key, q); err != nil {
+		return model.ClickStats{}, err
+	}
+
+	breakdowns := []struct {
+		dimension string
+		counts    *[]model.ClickCount
+	}{
+		{dimension: "referrer", counts: &stats.TopReferrers},
+		{dimension: "user_agent", counts: &stats.TopUserAgents},
+		{dimension: "country", counts: &stats.TopCountries},
+		{dimension: "city", counts: &stats.TopCities},
+		{dimension: "device", counts: &stats.TopDevices},
+		{dimension: "os", counts: &stats.TopOS},
+		{dimension: "browser", counts: &stats.TopBrowsers},
+	}
+	for _, b := range breakdowns {
+		if *b.counts, err = s.topClicks(b.dimension, key, q); err != nil {
+			return model.ClickStats{}, err
+		}
+	}
+
+	// The breakdowns cover every class, whatever traffic is selected.
+	classes := q
+	classes.Traffic, classes.Top = model.TrafficAll, 3 // human, bot and suspicious
+	if stats.ByClass, err = s.topClicks("class", key, classes); err != nil {
+		return model.ClickStats{}, err
+	}
+
+	bots := q
+	bots.Traffic = model.ClassBot
+	if stats.TopBots, err = s.topClicks("bot", key, bots); err != nil {
+		return model.ClickStats{}, err
+	}
+
+	return stats, nil
+}
+
+// uniqueVisitors merges the visitor sketches of the days q touches.
+func (s *Storage) uniqueVisitors(key model.LinkKey, q model.ClickQuery) (int64, error) {
+	rows, err := s.db.Query(`SELECT sketch FROM urlshortener_visitors
+    WHERE tenant = $1 AND domain = $2 AND short_url = $3 AND day >= $4 AND day <= $5`,
+		key.Tenant, key.Domain, key.ShortURL, date(q.From), date(q.To.Add(-time.Nanosecond)))
+	if err != nil {
+		return 0, fmt.Errorf("error querying visitor sketches: %w", err)
+	}
+	defer rows.Close()
+
+	visitors, err := sketch.NewHLL(sketch.HLLPrecision)
+	if err != nil {
+		return 0, err
+	}
+
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return 0, fmt.Errorf("error scanning row: %w", err)
+		}
+
+		var h sketch.HLL
+		if err := h.UnmarshalBinary(data); err != nil {
+			return 0, err
+		}
+		if err := visitors.Merge(&h); err != nil {
+			return 0, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("error reading visitor sketches: %w", err)
+	}
+
+	return int64(visitors.Estimate()), nil
+}
+
+// topClicks returns the most frequent non-empty values of the dimension, one
+// of clickColumns, among the clicks of the traffic of q.
+func (s *Storage) topClicks(dimension string, key model.LinkKey, q model.ClickQuery) ([]model.ClickCount, error) {
+	rows, err := s.db.Query(countedClicks(dimension)+`
+    SELECT value, sum(clicks)::bigint AS clicks FROM counted WHERE value <> ''
+    GROUP BY value ORDER BY clicks DESC, value LIMIT $6`,
+		key.Tenant, key.Domain, key.ShortURL, q.From, q.To, q.Top, q.Traffic)
+	if err != nil {
+		return nil, fmt.Errorf("error querying top %s: %w", dimension, err)
+	}
+	defer rows.Close()
+
+	var counts []model.ClickCount
+	for rows.Next() {
+		var c model.ClickCount
+		if err := rows.Scan(&c.Value, &c.Clicks); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		counts = append(counts, c)
+	}
+
+	return counts, rows.Err()
+}
+
+// IPSalt stores salt as the IP salt unless another instance stored one first,
+// and returns the stored salt.
+func (s *Storage) IPSalt(salt string) (string, error) {
+	_, err := s.db.Exec(`INSERT INTO urlshortener_settings (name, value) VALUES ('ip_salt', $1)
+    ON CONFLICT (name) DO NOTHING`, salt)
+	if err != nil {
+		return "", fmt.Errorf("error inserting IP salt: %w", err)
+	}
+
+	err = s.db.QueryRow(`SELECT value FROM urlshortener_settings WHERE name = 'ip_salt'`).Scan(&salt)
+	if err != nil {
+		return "", fmt.Errorf("error selecting IP salt: %w", err)
+	}
+
+	return salt, nil
+}
@@ -0,0 +1,119 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+
+	"url-shortener/internal/model"
+)
+
+// relayLock is the key of the advisory lock held while relaying events; it
+// spells "relay".
+const relayLock = 0x72656c6179
+
+// writeEvents copies events into the outbox within tx, if the outbox is
+// enabled.
+func (s *Storage) writeEvents(tx *sql.Tx, events ...model.LinkEvent) error {
+	if !s.Outbox || len(events) == 0 {
+		return nil
+	}
+
+	stmt, err := tx.Prepare(pq.CopyIn("urlshortener_events",
+		"type", "tenant", "domain", "short_url", "url", "owner", "link_created_at", "class", "at"))
+	if err != nil {
+		return fmt.Errorf("error preparing event copy statement: %w", err)
+	}
+
+	for _, e := range events {
+		createdAt := sql.NullTime{Time: e.Link.CreatedAt, Valid: !e.Link.CreatedAt.IsZero()}
+		_, err = stmt.Exec(e.Type, e.Link.Tenant, e.Link.Domain, e.Link.ShortURL, e.Link.URL, e.Link.Owner, createdAt,
+			e.Class, e.At)
+		if err != nil {
+			_ = stmt.Close()
+			return fmt.Errorf("error copying event: %w", err)
+		}
+	}
+
+	if _, err = stmt.Exec(); err != nil {
+		_ = stmt.Close()
+		return fmt.Errorf("error flushing events: %w", err)
+	}
+
+	if err = stmt.Close(); err != nil {
+		return fmt.Errorf("error closing event copy statement: %w", err)
+	}
+
+	return nil
+}
+
+// RelayEvents passes up to limit of the oldest events in the outbox to
+// publish and deletes them once it succeeds, in one transaction. Only one
+// instance relays at a time, so events are published in order; the others
+// find the advisory lock taken and relay nothing.
+func (s *Storage) RelayEvents(limit int, publish func([]model.OutboxEvent) error) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var locked bool
+	if err := tx.QueryRow(`SELECT pg_try_advisory_xact_lock($1)`, relayLock).Scan(&locked); err != nil {
+		return 0, fmt.Errorf("error taking relay lock: %w", err)
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	events, err := s.oldestEvents(tx, limit)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+
+	if err := publish(events); err != nil {
+		return 0, err
+	}
+
+	ids := make(pq.Int64Array, 0, len(events))
+	for _, e := range events {
+		ids = append(ids, e.ID)
+	}
+	if _, err := tx.Exec(`DELETE FROM urlshortener_events WHERE id = ANY($1)`, ids); err != nil {
+		return 0, fmt.Errorf("error deleting relayed events: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	s.log.Debug("storage.relay-events", zap.Int("events", len(events)))
+
+	return len(events), nil
+}
+
+func (s *Storage) oldestEvents(tx *sql.Tx, limit int) ([]model.OutboxEvent, error) {
+	rows, err := tx.Query(`SELECT id, type, tenant, domain, short_url, url, owner, link_created_at, class, at
+    FROM urlshortener_events ORDER BY id LIMIT $1`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []model.OutboxEvent
+	for rows.Next() {
+		var e model.OutboxEvent
+		var createdAt sql.NullTime
+		err := rows.Scan(&e.ID, &e.Type, &e.Link.Tenant, &e.Link.Domain, &e.Link.ShortURL, &e.Link.URL, &e.Link.Owner,
+			&createdAt, &e.Class, &e.At)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning event: %w", err)
+		}
+		e.Link.CreatedAt = createdAt.Time
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
@@ -0,0 +1,109 @@
+package postgres
+
+import (
+	"fmt"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+
+	"url-shortener/internal/model"
+)
+
+// linksFilter matches the rows of the links in $n to $n+2, arrays of their
+// tenants, domains and short URLs, or every row if the arrays are empty.
+func linksFilter(n int) string {
+	return fmt.Sprintf(`(cardinality($%[1]d::text[]) = 0 OR (tenant, domain, short_url) IN
+        (SELECT * FROM unnest($%[1]d::text[], $%[2]d::text[], $%[3]d::text[])))`, n, n+1, n+2)
+}
+
+// linkArrays splits links for linksFilter. The arrays are never nil, which
+// would be NULL.
+func linkArrays(links []model.LinkKey) (tenants, domains, shortURLs pq.StringArray) {
+	tenants, domains, shortURLs = make(pq.StringArray, 0, len(links)), make(pq.StringArray, 0, len(links)),
+		make(pq.StringArray, 0, len(links))
+	for _, key := range links {
+		tenants = append(tenants, key.Tenant)
+		domains = append(domains, key.Domain)
+		shortURLs = append(shortURLs, key.ShortURL)
+	}
+
+	return tenants, domains, shortURLs
+}
+
+// tenantsFilter matches the rows of the tenants in $n, or every row if the
+// array is empty.
+func tenantsFilter(n int) string {
+	return fmt.Sprintf(`(cardinality($%[1]d::text[]) = 0 OR tenant = ANY($%[1]d::text[]))`, n)
+}
+
+// tenantArray passes tenants to tenantsFilter; like linkArrays, never nil.
+func tenantArray(tenants []string) pq.StringArray {
+	return append(make(pq.StringArray, 0, len(tenants)), tenants...)
+}
+
+// ExportClicks returns up to limit clicks of q ordered by time and ID,
+// starting after the time and ID of after.
+func (s *Storage) ExportClicks(q model.ExportQuery, after model.Click, limit int) ([]model.Click, error) {
+	s.log.Debug("storage.export-clicks", zap.Time("after", after.At), zap.Int64("after-id", after.ID))
+
+	tenants, domains, shortURLs := linkArrays(q.Links)
+	rows, err := s.db.Query(`SELECT id, tenant, domain, short_url, at, referrer, user_agent, ip_hash, class, bot,
+        country, city, device, os, browser
+    FROM urlshortener_clicks
+    WHERE at >= $1 AND at < $2 AND (at, id) > ($3, $4) AND `+linksFilter(5)+` AND `+tenantsFilter(8)+`
+    ORDER BY at, id LIMIT $9`,
+		q.From, q.To, after.At, after.ID, tenants, domains, shortURLs, tenantArray(q.Tenants), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying clicks: %w", err)
+	}
+	defer rows.Close()
+
+	var clicks []model.Click
+	for rows.Next() {
+		var c model.Click
+		err := rows.Scan(&c.ID, &c.Tenant, &c.Domain, &c.ShortURL, &c.At, &c.Referrer, &c.UserAgent, &c.IPHash,
+			&c.Class, &c.Bot, &c.Country, &c.City, &c.Device, &c.OS, &c.Browser)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		c.At = c.At.UTC()
+		clicks = append(clicks, c)
+	}
+
+	return clicks, rows.Err()
+}
+
+// ExportRollups returns up to limit rollups of the granularity and q ordered
+// by bucket and key, starting after the bucket and key of after.
+func (s *Storage) ExportRollups(granularity string, q model.ExportQuery, after model.ClickRollup,
+	limit int) ([]model.ClickRollup, error) {
+	s.log.Debug("storage.export-rollups", zap.String("granularity", granularity), zap.Time("after", after.Bucket))
+
+	tenants, domains, shortURLs := linkArrays(q.Links)
+	rows, err := s.db.Query(`SELECT tenant, domain, short_url, granularity, bucket, class, dimension, value, clicks
+    FROM urlshortener_click_rollups
+    WHERE granularity = $1 AND bucket >= $2 AND bucket < $3
+      AND (bucket, tenant, domain, short_url, dimension, class, value) > ($4, $5, $6, $7, $8, $9, $10)
+      AND `+linksFilter(11)+` AND `+tenantsFilter(14)+`
+    ORDER BY bucket, tenant, domain, short_url, dimension, class, value LIMIT $15`,
+		granularity, q.From, q.To, after.Bucket, after.Tenant, after.Domain, after.ShortURL, after.Dimension,
+		after.Class, after.Value, tenants, domains, shortURLs, tenantArray(q.Tenants), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying rollups: %w", err)
+	}
+	defer rows.Close()
+
+	var rollups []model.ClickRollup
+	for rows.Next() {
+		var r model.ClickRollup
+		err := rows.Scan(&r.Tenant, &r.Domain, &r.ShortURL, &r.Granularity, &r.Bucket, &r.Class, &r.Dimension,
+			&r.Value, &r.Clicks)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		r.Bucket = r.Bucket.UTC()
+		rollups = append(rollups, r)
+	}
+
+	return rollups, rows.Err()
+}
@@ -4,8 +4,11 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"math"
+	"strings"
 	"time"
 	"url-shortener/internal/config"
+	"url-shortener/internal/model"
 	"url-shortener/internal/storage/errs"
 
 	"github.com/lib/pq"
@@ -15,7 +18,20 @@ import (
 const maxRetries = 10
 const retryDelay = 3 * time.Second
 
+const (
+	uniqueViolation = "23505"
+	shortURLKey     = "urlshortener_pkey"
+)
+
 type Storage struct {
+	// Outbox writes an event to urlshortener_events in the same transaction
+	// as every link created or deleted and every click recorded.
+	Outbox bool
+
+	// deliveries builds the webhook delivery of a link event; nil queues
+	// none. See QueueWebhookDeliveries.
+	deliveries func(model.LinkEvent) (model.WebhookDelivery, error)
+
 	db  *sql.DB
 	log *zap.Logger
 }
@@ -62,29 +78,380 @@ func NewStorage(postgresConf config.PostgresConfig, log *zap.Logger) (*Storage,
 		return nil, fmt.Errorf("error executing create table statement: %w", err)
 	}
 
+	_, err = db.Exec(`ALTER TABLE urlshortener ADD COLUMN IF NOT EXISTS original_url TEXT`)
+	if err != nil {
+		return nil, fmt.Errorf("error adding original_url column: %w", err)
+	}
+
+	_, err = db.Exec(`ALTER TABLE urlshortener ADD COLUMN IF NOT EXISTS owner TEXT, ADD COLUMN IF NOT EXISTS tenant TEXT`)
+	if err != nil {
+		return nil, fmt.Errorf("error adding owner and tenant columns: %w", err)
+	}
+
+	_, err = db.Exec(`ALTER TABLE urlshortener ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now()`)
+	if err != nil {
+		return nil, fmt.Errorf("error adding created_at column: %w", err)
+	}
+
+	_, err = db.Exec(`ALTER TABLE urlshortener ADD COLUMN IF NOT EXISTS domain TEXT NOT NULL DEFAULT ''`)
+	if err != nil {
+		return nil, fmt.Errorf("error adding domain column: %w", err)
+	}
+
+	// Links are unique per tenant and domain. Older databases have NULL tenants, a
+	// primary key on short_url alone and a global unique constraint on url.
+	migrateTenantStmt := `
+    DO $$
+    BEGIN
+        IF EXISTS (SELECT 1 FROM information_schema.columns
+                   WHERE table_name = 'urlshortener' AND column_name = 'tenant' AND is_nullable = 'YES') THEN
+            UPDATE urlshortener SET tenant = '' WHERE tenant IS NULL;
+            ALTER TABLE urlshortener ALTER COLUMN tenant SET DEFAULT '', ALTER COLUMN tenant SET NOT NULL;
+            ALTER TABLE urlshortener DROP CONSTRAINT IF EXISTS urlshortener_url_key;
+        END IF;
+    END $$`
+
+	_, err = db.Exec(migrateTenantStmt)
+	if err != nil {
+		return nil, fmt.Errorf("error migrating tenant column: %w", err)
+	}
+
+	if err = setPrimaryKey(db, "tenant", "domain", "short_url"); err != nil {
+		return nil, err
+	}
+
+	_, err = db.Exec(`DROP INDEX IF EXISTS urlshortener_owner_idx, urlshortener_tenant_owner_idx, urlshortener_tenant_url_key`)
+	if err != nil {
+		return nil, fmt.Errorf("error dropping superseded indexes: %w", err)
+	}
+
+	_, err = db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS urlshortener_tenant_domain_url_key ON urlshortener (tenant, domain, url)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating tenant url index: %w", err)
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS urlshortener_tenant_owner_created_idx
+    ON urlshortener (tenant, owner, created_at DESC, short_url DESC, domain DESC)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating owner index: %w", err)
+	}
+
+	createBlocksTableStmt := `
+    CREATE TABLE IF NOT EXISTS urlshortener_id_blocks (
+        name TEXT NOT NULL PRIMARY KEY,
+        next_id BIGINT NOT NULL
+    )`
+
+	_, err = db.Exec(createBlocksTableStmt)
+	if err != nil {
+		return nil, fmt.Errorf("error executing create id blocks table statement: %w", err)
+	}
+
+	createRateLimitsTableStmt := `
+    CREATE TABLE IF NOT EXISTS urlshortener_rate_limits (
+        key TEXT NOT NULL PRIMARY KEY,
+        tokens DOUBLE PRECISION NOT NULL,
+        updated_at TIMESTAMPTZ NOT NULL
+    )`
+
+	_, err = db.Exec(createRateLimitsTableStmt)
+	if err != nil {
+		return nil, fmt.Errorf("error executing create rate limits table statement: %w", err)
+	}
+
+	createAPIKeysTableStmt := `
+    CREATE TABLE IF NOT EXISTS urlshortener_api_keys (
+        id TEXT NOT NULL PRIMARY KEY,
+        name TEXT NOT NULL,
+        hash TEXT NOT NULL,
+        scopes TEXT[] NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL,
+        last_used_at TIMESTAMPTZ,
+        revoked_at TIMESTAMPTZ
+    )`
+
+	_, err = db.Exec(createAPIKeysTableStmt)
+	if err != nil {
+		return nil, fmt.Errorf("error executing create api keys table statement: %w", err)
+	}
+
+	_, err = db.Exec(`ALTER TABLE urlshortener_api_keys ADD COLUMN IF NOT EXISTS tenant TEXT NOT NULL DEFAULT ''`)
+	if err != nil {
+		return nil, fmt.Errorf("error adding api key tenant column: %w", err)
+	}
+
+	createClicksTableStmt := `
+    CREATE TABLE IF NOT EXISTS urlshortener_clicks (
+        tenant TEXT NOT NULL,
+        domain TEXT NOT NULL,
+        short_url TEXT NOT NULL,
+        at TIMESTAMPTZ NOT NULL,
+        referrer TEXT NOT NULL,
+        user_agent TEXT NOT NULL,
+        ip_hash TEXT NOT NULL
+    )`
+
+	_, err = db.Exec(createClicksTableStmt)
+	if err != nil {
+		return nil, fmt.Errorf("error executing create clicks table statement: %w", err)
+	}
+
+	// Clicks recorded before bot detection count as human.
+	_, err = db.Exec(`ALTER TABLE urlshortener_clicks ADD COLUMN IF NOT EXISTS class TEXT NOT NULL DEFAULT 'human',
+    ADD COLUMN IF NOT EXISTS bot TEXT NOT NULL DEFAULT ''`)
+	if err != nil {
+		return nil, fmt.Errorf("error adding click class columns: %w", err)
+	}
+
+	_, err = db.Exec(`ALTER TABLE urlshortener_clicks ADD COLUMN IF NOT EXISTS country TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS city TEXT NOT NULL DEFAULT '', ADD COLUMN IF NOT EXISTS device TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS os TEXT NOT NULL DEFAULT '', ADD COLUMN IF NOT EXISTS browser TEXT NOT NULL DEFAULT ''`)
+	if err != nil {
+		return nil, fmt.Errorf("error adding click location and device columns: %w", err)
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS urlshortener_clicks_link_at_idx
+    ON urlshortener_clicks (tenant, domain, short_url, at)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating clicks index: %w", err)
+	}
+
+	createVisitorsTableStmt := `
+    CREATE TABLE IF NOT EXISTS urlshortener_visitors (
+        tenant TEXT NOT NULL,
+        domain TEXT NOT NULL,
+        short_url TEXT NOT NULL,
+        day DATE NOT NULL,
+        sketch BYTEA NOT NULL,
+        PRIMARY KEY (tenant, domain, short_url, day)
+    )`
+
+	_, err = db.Exec(createVisitorsTableStmt)
+	if err != nil {
+		return nil, fmt.Errorf("error executing create visitors table statement: %w", err)
+	}
+
+	// IDs order clicks of the same time for exports.
+	_, err = db.Exec(`ALTER TABLE urlshortener_clicks ADD COLUMN IF NOT EXISTS id BIGSERIAL`)
+	if err != nil {
+		return nil, fmt.Errorf("error adding click id column: %w", err)
+	}
+
+	_, err = db.Exec(`DROP INDEX IF EXISTS urlshortener_clicks_at_idx, urlshortener_click_rollups_bucket_idx`)
+	if err != nil {
+		return nil, fmt.Errorf("error dropping superseded click indexes: %w", err)
+	}
+
+	// Exports page through clicks by time, and retention deletes them by time.
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS urlshortener_clicks_at_id_idx ON urlshortener_clicks (at, id)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating clicks time index: %w", err)
+	}
+
+	// A rollup counts the clicks of a link, bucket and class with one value of
+	// a dimension, such as a referrer.
+	createClickRollupsTableStmt := `
+    CREATE TABLE IF NOT EXISTS urlshortener_click_rollups (
+        tenant TEXT NOT NULL,
+        domain TEXT NOT NULL,
+        short_url TEXT NOT NULL,
+        dimension TEXT NOT NULL,
+        granularity TEXT NOT NULL,
+        bucket TIMESTAMPTZ NOT NULL,
+        class TEXT NOT NULL,
+        value TEXT NOT NULL,
+        clicks BIGINT NOT NULL,
+        PRIMARY KEY (tenant, domain, short_url, dimension, granularity, bucket, class, value)
+    )`
+
+	_, err = db.Exec(createClickRollupsTableStmt)
+	if err != nil {
+		return nil, fmt.Errorf("error executing create click rollups table statement: %w", err)
+	}
+
+	// Exports page through rollups in this order, and retention deletes them
+	// by bucket.
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS urlshortener_click_rollups_export_idx
+    ON urlshortener_click_rollups (granularity, bucket, tenant, domain, short_url, dimension, class, value)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating click rollups index: %w", err)
+	}
+
+	// done_through is the end of the time rolled up at each granularity.
+	createRollupStateTableStmt := `
+    CREATE TABLE IF NOT EXISTS urlshortener_rollup_state (
+        granularity TEXT NOT NULL PRIMARY KEY,
+        done_through TIMESTAMPTZ NOT NULL
+    )`
+
+	_, err = db.Exec(createRollupStateTableStmt)
+	if err != nil {
+		return nil, fmt.Errorf("error executing create rollup state table statement: %w", err)
+	}
+
+	// Webhooks announce the first click of a link once.
+	_, err = db.Exec(`ALTER TABLE urlshortener ADD COLUMN IF NOT EXISTS first_clicked_at TIMESTAMPTZ`)
+	if err != nil {
+		return nil, fmt.Errorf("error adding first_clicked_at column: %w", err)
+	}
+
+	createWebhooksTableStmt := `
+    CREATE TABLE IF NOT EXISTS urlshortener_webhooks (
+        id TEXT NOT NULL PRIMARY KEY,
+        tenant TEXT NOT NULL,
+        url TEXT NOT NULL,
+        secret TEXT NOT NULL,
+        events TEXT[] NOT NULL,
+        created_at TIMESTAMPTZ NOT NULL
+    )`
+
+	_, err = db.Exec(createWebhooksTableStmt)
+	if err != nil {
+		return nil, fmt.Errorf("error executing create webhooks table statement: %w", err)
+	}
+
+	// The outbox holds deliveries until they succeed; dead_at is set on those
+	// given up on.
+	createWebhookOutboxTableStmt := `
+    CREATE TABLE IF NOT EXISTS urlshortener_webhook_outbox (
+        id BIGSERIAL PRIMARY KEY,
+        webhook_id TEXT NOT NULL REFERENCES urlshortener_webhooks (id) ON DELETE CASCADE,
+        event_id TEXT NOT NULL,
+        event TEXT NOT NULL,
+        payload BYTEA NOT NULL,
+        attempts INTEGER NOT NULL DEFAULT 0,
+        next_attempt_at TIMESTAMPTZ NOT NULL,
+        last_error TEXT NOT NULL DEFAULT '',
+        created_at TIMESTAMPTZ NOT NULL,
+        dead_at TIMESTAMPTZ
+    )`
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS urlshortener_webhooks_tenant_idx ON urlshortener_webhooks (tenant)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating webhooks tenant index: %w", err)
+	}
+
+	_, err = db.Exec(createWebhookOutboxTableStmt)
+	if err != nil {
+		return nil, fmt.Errorf("error executing create webhook outbox table statement: %w", err)
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS urlshortener_webhook_outbox_due_idx
+    ON urlshortener_webhook_outbox (next_attempt_at, id) WHERE dead_at IS NULL`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating webhook outbox due index: %w", err)
+	}
+
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS urlshortener_webhook_outbox_webhook_idx
+    ON urlshortener_webhook_outbox (webhook_id, id)`)
+	if err != nil {
+		return nil, fmt.Errorf("error creating webhook outbox index: %w", err)
+	}
+
+	// The events outbox is written with the changes it describes and emptied
+	// by the events relay.
+	createEventsTableStmt := `
+    CREATE TABLE IF NOT EXISTS urlshortener_events (
+        id BIGSERIAL PRIMARY KEY,
+        type TEXT NOT NULL,
+        tenant TEXT NOT NULL,
+        domain TEXT NOT NULL,
+        short_url TEXT NOT NULL,
+        url TEXT NOT NULL,
+        owner TEXT NOT NULL,
+        link_created_at TIMESTAMPTZ,
+        class TEXT NOT NULL,
+        at TIMESTAMPTZ NOT NULL
+    )`
+
+	_, err = db.Exec(createEventsTableStmt)
+	if err != nil {
+		return nil, fmt.Errorf("error executing create events table statement: %w", err)
+	}
+
+	if err = createAuditTable(db); err != nil {
+		return nil, err
+	}
+
+	// Settings are values generated once per deployment and shared by every
+	// instance.
+	createSettingsTableStmt := `
+    CREATE TABLE IF NOT EXISTS urlshortener_settings (
+        name TEXT PRIMARY KEY,
+        value TEXT NOT NULL
+    )`
+
+	_, err = db.Exec(createSettingsTableStmt)
+	if err != nil {
+		return nil, fmt.Errorf("error executing create settings table statement: %w", err)
+	}
+
 	return &Storage{db: db, log: log}, nil
 }
 
-func (s *Storage) Put(url, shortURL string) error {
+// setPrimaryKey makes columns the primary key of urlshortener unless the key
+// already has that many columns.
+func setPrimaryKey(db *sql.DB, columns ...string) error {
+	stmt := fmt.Sprintf(`
+    DO $$
+    BEGIN
+        IF (SELECT array_length(indkey::int2[], 1) FROM pg_index
+            WHERE indexrelid = '%[1]s'::regclass) <> %[2]d THEN
+            ALTER TABLE urlshortener DROP CONSTRAINT %[1]s;
+            ALTER TABLE urlshortener ADD CONSTRAINT %[1]s PRIMARY KEY (%[3]s);
+        END IF;
+    END $$`, shortURLKey, len(columns), strings.Join(columns, ", "))
+
+	if _, err := db.Exec(stmt); err != nil {
+		return fmt.Errorf("error migrating primary key: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Put(link model.Link) error {
 	tx, err := s.db.Begin()
 	if err != nil {
 		return fmt.Errorf("error starting transaction: %w", err)
 	}
 
-	query := `INSERT INTO urlshortener (url, short_url) VALUES ($1, $2)`
-	s.log.Info("storage.put", zap.String("url", url), zap.String("short-url", shortURL))
+	// The unique url column holds the normalized URL; original_url keeps the
+	// URL as submitted, which is where the short URL redirects to.
+	query := `INSERT INTO urlshortener (url, short_url, original_url, owner, tenant, domain, created_at)
+    VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7)`
+	s.log.Info("storage.put", zap.String("url", link.URL), zap.String("short-url", link.ShortURL),
+		zap.String("tenant", link.Tenant), zap.String("domain", link.Domain))
 
-	_, err = tx.Exec(query, url, shortURL)
+	createdAt := link.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now().UTC()
+	}
+
+	_, err = tx.Exec(query, link.DedupKey(), link.ShortURL, link.URL, link.Owner, link.Tenant, link.Domain, createdAt)
 	if err != nil {
 		_ = tx.Rollback()
 		var pqErr *pq.Error
-		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			if pqErr.Constraint == shortURLKey {
+				return errs.ErrShortURLIsExist
+			}
 			return errs.ErrURLIsExist
 		}
 
 		return fmt.Errorf("error executing insert statement: %w", err)
 	}
 
+	link.CreatedAt = createdAt
+	event := model.LinkEvent{Type: model.EventLinkCreated, Link: link, At: createdAt}
+	if err = s.writeEvents(tx, event); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err = s.writeDeliveries(tx, event); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
 	if err = tx.Commit(); err != nil {
 		return fmt.Errorf("error committing transaction: %w", err)
 	}
@@ -92,13 +459,14 @@ func (s *Storage) Put(url, shortURL string) error {
 	return nil
 }
 
+// Get resolves shortURL in the default tenant and domain.
 func (s *Storage) Get(shortURL string) (string, error) {
 	tx, err := s.db.Begin()
 	if err != nil {
 		return "", fmt.Errorf("error starting transaction: %w", err)
 	}
 
-	query := `SELECT url FROM urlshortener WHERE short_url = $1`
+	query := `SELECT COALESCE(original_url, url) FROM urlshortener WHERE tenant = '' AND domain = '' AND short_url = $1`
 	s.log.Info("storage.get", zap.String("short-url", shortURL))
 
 	var url string
@@ -119,3 +487,332 @@ func (s *Storage) Get(shortURL string) (string, error) {
 
 	return url, nil
 }
+
+const linkColumns = `short_url, COALESCE(original_url, url), url, COALESCE(owner, ''), tenant, domain, created_at`
+
+func scanLink(row rowScanner) (model.Link, error) {
+	var link model.Link
+	err := row.Scan(&link.ShortURL, &link.URL, &link.NormalizedURL, &link.Owner, &link.Tenant, &link.Domain, &link.CreatedAt)
+
+	return link, err
+}
+
+func (s *Storage) GetLink(key model.LinkKey) (model.Link, error) {
+	s.log.Info("storage.get-link", zap.String("short-url", key.ShortURL), zap.String("tenant", key.Tenant),
+		zap.String("domain", key.Domain))
+
+	link, err := scanLink(s.db.QueryRow(`SELECT `+linkColumns+` FROM urlshortener
+    WHERE tenant = $1 AND domain = $2 AND short_url = $3`, key.Tenant, key.Domain, key.ShortURL))
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.Link{}, errs.ErrURLIsNotExist
+	}
+	if err != nil {
+		return model.Link{}, fmt.Errorf("error scanning row: %w", err)
+	}
+
+	return link, nil
+}
+
+func (s *Storage) Update(link model.Link) error {
+	query := `UPDATE urlshortener SET url = $4, original_url = $5 WHERE tenant = $1 AND domain = $2 AND short_url = $3
+    RETURNING ` + linkColumns
+	s.log.Info("storage.update", zap.String("url", link.URL), zap.String("short-url", link.ShortURL),
+		zap.String("tenant", link.Tenant), zap.String("domain", link.Domain))
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	updated, err := scanLink(tx.QueryRow(query, link.Tenant, link.Domain, link.ShortURL, link.DedupKey(), link.URL))
+	if errors.Is(err, sql.ErrNoRows) {
+		return errs.ErrURLIsNotExist
+	}
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return errs.ErrURLIsExist
+		}
+
+		return fmt.Errorf("error executing update statement: %w", err)
+	}
+
+	if err = s.writeDeliveries(tx, model.LinkEvent{Type: model.EventLinkUpdated, Link: updated, At: time.Now().UTC()}); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Storage) Delete(key model.LinkKey) error {
+	s.log.Info("storage.delete", zap.String("short-url", key.ShortURL), zap.String("tenant", key.Tenant),
+		zap.String("domain", key.Domain))
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	link, err := scanLink(tx.QueryRow(`DELETE FROM urlshortener WHERE tenant = $1 AND domain = $2 AND short_url = $3
+    RETURNING `+linkColumns, key.Tenant, key.Domain, key.ShortURL))
+	if errors.Is(err, sql.ErrNoRows) {
+		return errs.ErrURLIsNotExist
+	}
+	if err != nil {
+		return fmt.Errorf("error executing delete statement: %w", err)
+	}
+
+	// A link created later with the same code must not inherit the clicks.
+	for _, table := range []string{"urlshortener_clicks", "urlshortener_click_rollups", "urlshortener_visitors"} {
+		_, err = tx.Exec(`DELETE FROM `+table+` WHERE tenant = $1 AND domain = $2 AND short_url = $3`,
+			key.Tenant, key.Domain, key.ShortURL)
+		if err != nil {
+			return fmt.Errorf("error deleting from %s: %w", table, err)
+		}
+	}
+
+	event := model.LinkEvent{Type: model.EventLinkDeleted, Link: link, At: time.Now().UTC()}
+	if err = s.writeEvents(tx, event); err != nil {
+		return err
+	}
+	if err = s.writeDeliveries(tx, event); err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// ListByOwner pages by (created_at, short_url, domain) of the last link seen,
+// so pages stay stable while new links are added.
+func (s *Storage) ListByOwner(tenant, owner string, after model.LinkKey, limit int) ([]model.Link, error) {
+	s.log.Info("storage.list-by-owner", zap.String("tenant", tenant), zap.String("owner", owner),
+		zap.String("after", after.ShortURL), zap.Int("limit", limit))
+
+	var rows *sql.Rows
+	var err error
+	if after.ShortURL == "" {
+		rows, err = s.db.Query(`SELECT `+linkColumns+` FROM urlshortener WHERE tenant = $1 AND owner = $2
+        ORDER BY created_at DESC, short_url DESC, domain DESC LIMIT $3`, tenant, owner, limit)
+	} else {
+		var createdAt time.Time
+		err = s.db.QueryRow(`SELECT created_at FROM urlshortener WHERE tenant = $1 AND domain = $2 AND short_url = $3`,
+			tenant, after.Domain, after.ShortURL).Scan(&createdAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errs.ErrURLIsNotExist
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading page cursor: %w", err)
+		}
+
+		rows, err = s.db.Query(`SELECT `+linkColumns+` FROM urlshortener
+        WHERE tenant = $1 AND owner = $2 AND (created_at, short_url, domain) < ($3, $4, $5)
+        ORDER BY created_at DESC, short_url DESC, domain DESC LIMIT $6`,
+			tenant, owner, createdAt, after.ShortURL, after.Domain, limit)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error listing links: %w", err)
+	}
+	defer rows.Close()
+
+	var links []model.Link
+	for rows.Next() {
+		link, err := scanLink(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		links = append(links, link)
+	}
+
+	return links, rows.Err()
+}
+
+func (s *Storage) CountByTenant(tenant string) (int, error) {
+	var n int
+	if err := s.db.QueryRow(`SELECT count(*) FROM urlshortener WHERE tenant = $1`, tenant).Scan(&n); err != nil {
+		return 0, fmt.Errorf("error counting links: %w", err)
+	}
+
+	return n, nil
+}
+
+// NextBlock leases size IDs of the named sequence in a single atomic upsert,
+// so concurrent instances always get disjoint ranges.
+func (s *Storage) NextBlock(name string, size uint64) (uint64, error) {
+	query := `
+    INSERT INTO urlshortener_id_blocks (name, next_id) VALUES ($1, $2)
+    ON CONFLICT (name) DO UPDATE SET next_id = urlshortener_id_blocks.next_id + EXCLUDED.next_id
+    RETURNING next_id - $2`
+	s.log.Info("storage.next-block", zap.String("name", name), zap.Uint64("size", size))
+
+	var start int64
+	if err := s.db.QueryRow(query, name, int64(size)).Scan(&start); err != nil {
+		return 0, fmt.Errorf("error leasing id block: %w", err)
+	}
+
+	return uint64(start), nil
+}
+
+// ReleaseBlock moves the sequence back to start only if no other instance has
+// leased a block since [start, end) was handed out.
+func (s *Storage) ReleaseBlock(name string, start, end uint64) error {
+	query := `UPDATE urlshortener_id_blocks SET next_id = $2 WHERE name = $1 AND next_id = $3`
+	s.log.Info("storage.release-block", zap.String("name", name), zap.Uint64("start", start), zap.Uint64("end", end))
+
+	if _, err := s.db.Exec(query, name, int64(start), int64(end)); err != nil {
+		return fmt.Errorf("error releasing id block: %w", err)
+	}
+
+	return nil
+}
+
+// TakeToken refills the token bucket for key and takes a token from it. The
+// row is locked for the duration of the transaction, so instances sharing the
+// database see one bucket.
+func (s *Storage) TakeToken(key string, rate float64, burst int) (bool, float64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.Exec(`INSERT INTO urlshortener_rate_limits (key, tokens, updated_at) VALUES ($1, $2, now())
+    ON CONFLICT (key) DO NOTHING`, key, float64(burst))
+	if err != nil {
+		return false, 0, fmt.Errorf("error creating rate limit bucket: %w", err)
+	}
+
+	// now() is fixed at the start of the transaction, which may be long before
+	// the lock is granted, so the wall clock is read after locking instead.
+	var tokens float64
+	var updatedAt, now time.Time
+	err = tx.QueryRow(`SELECT tokens, updated_at, clock_timestamp()
+    FROM urlshortener_rate_limits WHERE key = $1 FOR UPDATE`, key).Scan(&tokens, &updatedAt, &now)
+	if err != nil {
+		return false, 0, fmt.Errorf("error reading rate limit bucket: %w", err)
+	}
+
+	elapsed := math.Max(now.Sub(updatedAt).Seconds(), 0)
+	tokens = math.Min(float64(burst), tokens+elapsed*rate)
+	allowed := tokens >= 1
+	if allowed {
+		tokens--
+	}
+
+	_, err = tx.Exec(`UPDATE urlshortener_rate_limits SET tokens = $2, updated_at = $3 WHERE key = $1`, key, tokens, now)
+	if err != nil {
+		return false, 0, fmt.Errorf("error updating rate limit bucket: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, 0, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return allowed, tokens, nil
+}
+
+func (s *Storage) PutAPIKey(key model.APIKey) error {
+	query := `INSERT INTO urlshortener_api_keys (id, name, hash, scopes, tenant, created_at) VALUES ($1, $2, $3, $4, $5, $6)`
+	s.log.Info("storage.put-api-key", zap.String("id", key.ID), zap.String("name", key.Name))
+
+	_, err := s.db.Exec(query, key.ID, key.Name, key.Hash, pq.Array(key.Scopes), key.Tenant, key.CreatedAt)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return errs.ErrAPIKeyIsExist
+		}
+
+		return fmt.Errorf("error inserting api key: %w", err)
+	}
+
+	return nil
+}
+
+const apiKeyColumns = `id, name, hash, scopes, tenant, created_at, last_used_at, revoked_at`
+
+func (s *Storage) GetAPIKey(id string) (model.APIKey, error) {
+	row := s.db.QueryRow(`SELECT `+apiKeyColumns+` FROM urlshortener_api_keys WHERE id = $1`, id)
+
+	key, err := scanAPIKey(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.APIKey{}, errs.ErrAPIKeyIsNotExist
+	}
+	if err != nil {
+		return model.APIKey{}, fmt.Errorf("error scanning api key: %w", err)
+	}
+
+	return key, nil
+}
+
+func (s *Storage) ListAPIKeys() ([]model.APIKey, error) {
+	rows, err := s.db.Query(`SELECT ` + apiKeyColumns + ` FROM urlshortener_api_keys ORDER BY created_at`)
+	if err != nil {
+		return nil, fmt.Errorf("error listing api keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []model.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning api key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey keeps an earlier revocation time, e.g. from a rotation grace
+// period, if one is already set.
+func (s *Storage) RevokeAPIKey(id string, at time.Time) error {
+	query := `UPDATE urlshortener_api_keys SET revoked_at = LEAST(COALESCE(revoked_at, $2), $2) WHERE id = $1`
+	s.log.Info("storage.revoke-api-key", zap.String("id", id), zap.Time("at", at))
+
+	return s.execAPIKeyUpdate(query, id, at)
+}
+
+func (s *Storage) TouchAPIKey(id string, at time.Time) error {
+	return s.execAPIKeyUpdate(`UPDATE urlshortener_api_keys SET last_used_at = $2 WHERE id = $1`, id, at)
+}
+
+func (s *Storage) execAPIKeyUpdate(query, id string, at time.Time) error {
+	res, err := s.db.Exec(query, id, at)
+	if err != nil {
+		return fmt.Errorf("error updating api key: %w", err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return errs.ErrAPIKeyIsNotExist
+	}
+
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAPIKey(row rowScanner) (model.APIKey, error) {
+	var key model.APIKey
+	var lastUsedAt, revokedAt sql.NullTime
+
+	err := row.Scan(&key.ID, &key.Name, &key.Hash, pq.Array(&key.Scopes), &key.Tenant, &key.CreatedAt, &lastUsedAt, &revokedAt)
+	if err != nil {
+		return model.APIKey{}, err
+	}
+
+	key.LastUsedAt = lastUsedAt.Time
+	key.RevokedAt = revokedAt.Time
+
+	return key, nil
+}
@@ -0,0 +1,254 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"url-shortener/internal/model"
+)
+
+// rollupLock is the key of the advisory lock held while rolling clicks up;
+// it spells "rollup".
+const rollupLock = 0x726f6c6c7570
+
+// settleDelay is how long after an hour ends it is rolled up, so that clicks
+// still queued in recorders are written first.
+const settleDelay = 5 * time.Minute
+
+// How much time one transaction rolls up at each granularity.
+const (
+	hourlyStep = 24 * time.Hour
+	dailyStep  = 7 * 24 * time.Hour
+)
+
+// rolledUpDimensions are the breakdowns kept in rollups. User agents are too
+// varied to keep; the devices, systems and browsers parsed from them are.
+var rolledUpDimensions = []string{"class", "bot", "referrer", "country", "city", "device", "os", "browser"}
+
+// rollupHoursStmt counts the clicks of [$1, $2) per link, hour, class and
+// value of every rolled-up dimension.
+var rollupHoursStmt = func() string {
+	values := make([]string, 0, len(rolledUpDimensions))
+	for _, d := range rolledUpDimensions {
+		values = append(values, fmt.Sprintf("('%s', %s)", d, clickColumns[d]))
+	}
+
+	return fmt.Sprintf(`INSERT INTO urlshortener_click_rollups
+        (tenant, domain, short_url, dimension, granularity, bucket, class, value, clicks)
+    SELECT tenant, domain, short_url, d.dimension, 'hour', to_timestamp(floor(extract(epoch FROM at) / 3600) * 3600) AS start,
+        class, d.value, count(*)
+    FROM urlshortener_clicks, LATERAL (VALUES %s) AS d (dimension, value)
+    WHERE at >= $1 AND at < $2 AND d.value <> ''
+    GROUP BY tenant, domain, short_url, d.dimension, start, class, d.value`, strings.Join(values, ", "))
+}()
+
+// rollupDaysStmt sums the hourly rollups of [$1, $2) into UTC days.
+const rollupDaysStmt = `INSERT INTO urlshortener_click_rollups
+        (tenant, domain, short_url, dimension, granularity, bucket, class, value, clicks)
+    SELECT tenant, domain, short_url, dimension, 'day', to_timestamp(floor(extract(epoch FROM bucket) / 86400) * 86400) AS start,
+        class, value, sum(clicks)
+    FROM urlshortener_click_rollups
+    WHERE granularity = 'hour' AND bucket >= $1 AND bucket < $2
+    GROUP BY tenant, domain, short_url, dimension, start, class, value`
+
+// RollupClicks rolls raw clicks up into hourly rollups and those into daily
+// ones, then deletes raw clicks, rollups and visitor sketches past retention.
+// Only one instance rolls up at a time; the others find the advisory lock
+// taken and return at once.
+//
+// The time rolled up at each granularity is tracked by a watermark. Every
+// transaction replaces the rollups of the period it covers and moves the
+// watermark past it, so a run that stops half-way resumes after the last
+// committed period and nothing is counted twice. Data is only deleted once
+// it is rolled up, whatever the retention.
+func (s *Storage) RollupClicks(ctx context.Context, now time.Time, retention model.Retention) (model.RollupResult, error) {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return model.RollupResult{}, fmt.Errorf("error getting connection: %w", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, rollupLock).Scan(&locked); err != nil {
+		return model.RollupResult{}, fmt.Errorf("error taking rollup lock: %w", err)
+	}
+	if !locked {
+		return model.RollupResult{}, nil
+	}
+	// The lock belongs to the session, which outlives this call in the pool.
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, rollupLock); err != nil {
+			s.log.Error("failed to release rollup lock", zap.Error(err))
+		}
+	}()
+
+	result := model.RollupResult{Ran: true}
+
+	hourMark, hours, err := rollup(ctx, conn, model.RollupHourly, `SELECT min(at) FROM urlshortener_clicks`,
+		now.Add(-settleDelay).Truncate(time.Hour), time.Hour, hourlyStep, rollupHoursStmt)
+	result.Hours = hours
+	if err != nil {
+		return result, err
+	}
+
+	dayMark, days, err := rollup(ctx, conn, model.RollupDaily, `SELECT min(bucket) FROM urlshortener_click_rollups WHERE granularity = 'hour'`,
+		hourMark.Truncate(24*time.Hour), 24*time.Hour, dailyStep, rollupDaysStmt)
+	result.Days = days
+	if err != nil {
+		return result, err
+	}
+
+	result.Deleted, err = expire(ctx, conn, now, hourMark, dayMark, retention)
+
+	return result, err
+}
+
+// rollup rolls up the granularity from its watermark to end, step by step,
+// and returns the new watermark and how many buckets of width it rolled up.
+// The first run starts at the bucket of the earliest data, found by first.
+func rollup(ctx context.Context, conn *sql.Conn, granularity, first string, end time.Time, width, step time.Duration,
+	insertStmt string) (time.Time, int, error) {
+	mark, err := watermark(ctx, conn, granularity, first, end, width)
+	if err != nil {
+		return mark, 0, err
+	}
+
+	buckets := 0
+	for mark.Before(end) {
+		next := mark.Add(step)
+		if next.After(end) {
+			next = end
+		}
+
+		if err := rollupStep(ctx, conn, granularity, mark, next, insertStmt); err != nil {
+			return mark, buckets, err
+		}
+		buckets += int(next.Sub(mark) / width)
+		mark = next
+	}
+
+	return mark, buckets, nil
+}
+
+// watermark returns the end of the time rolled up at granularity, starting it
+// at the bucket of the earliest data or at end if there is none yet.
+func watermark(ctx context.Context, conn *sql.Conn, granularity, first string, end time.Time, width time.Duration) (time.Time, error) {
+	var mark time.Time
+	err := conn.QueryRowContext(ctx, `SELECT done_through FROM urlshortener_rollup_state WHERE granularity = $1`,
+		granularity).Scan(&mark)
+	if err == nil {
+		return mark.UTC(), nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return time.Time{}, fmt.Errorf("error reading %s rollup watermark: %w", granularity, err)
+	}
+
+	var earliest sql.NullTime
+	if err := conn.QueryRowContext(ctx, first).Scan(&earliest); err != nil {
+		return time.Time{}, fmt.Errorf("error finding data to roll up by %s: %w", granularity, err)
+	}
+
+	mark = end
+	if earliest.Valid && earliest.Time.Before(end) {
+		mark = earliest.Time.UTC().Truncate(width)
+	}
+
+	_, err = conn.ExecContext(ctx, `INSERT INTO urlshortener_rollup_state (granularity, done_through) VALUES ($1, $2)`,
+		granularity, mark)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("error starting %s rollup watermark: %w", granularity, err)
+	}
+
+	return mark, nil
+}
+
+// rollupStep replaces the rollups of [from, to) and moves the watermark from
+// from to to in one transaction.
+func rollupStep(ctx context.Context, conn *sql.Conn, granularity string, from, to time.Time, insertStmt string) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM urlshortener_click_rollups WHERE granularity = $1 AND bucket >= $2 AND bucket < $3`,
+		granularity, from, to)
+	if err != nil {
+		return fmt.Errorf("error deleting %s rollups: %w", granularity, err)
+	}
+
+	if _, err = tx.ExecContext(ctx, insertStmt, from, to); err != nil {
+		return fmt.Errorf("error rolling up clicks by %s: %w", granularity, err)
+	}
+
+	res, err := tx.ExecContext(ctx, `UPDATE urlshortener_rollup_state SET done_through = $3
+    WHERE granularity = $1 AND done_through = $2`, granularity, from, to)
+	if err != nil {
+		return fmt.Errorf("error moving %s rollup watermark: %w", granularity, err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n != 1 {
+		return fmt.Errorf("%s rollup watermark moved concurrently", granularity)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return nil
+}
+
+// expire deletes what is older than its retention and already rolled up:
+// raw clicks before hourMark, hourly rollups before dayMark, and daily
+// rollups and visitor sketches.
+func expire(ctx context.Context, conn *sql.Conn, now, hourMark, dayMark time.Time, retention model.Retention) (int64, error) {
+	before := func(retention time.Duration, mark time.Time) time.Time {
+		cutoff := now.Add(-retention)
+		if mark.Before(cutoff) {
+			return mark
+		}
+		return cutoff
+	}
+
+	type deletion struct {
+		what   string
+		stmt   string
+		cutoff any
+	}
+
+	var deletions []deletion
+	if retention.Raw > 0 {
+		deletions = append(deletions, deletion{what: "raw clicks", stmt: `DELETE FROM urlshortener_clicks WHERE at < $1`,
+			cutoff: before(retention.Raw, hourMark)})
+	}
+	if retention.Hourly > 0 {
+		deletions = append(deletions, deletion{what: "hourly rollups",
+			stmt:   `DELETE FROM urlshortener_click_rollups WHERE granularity = 'hour' AND bucket < $1`,
+			cutoff: before(retention.Hourly, dayMark)})
+	}
+	if retention.Daily > 0 {
+		cutoff := now.Add(-retention.Daily)
+		deletions = append(deletions,
+			deletion{what: "daily rollups", stmt: `DELETE FROM urlshortener_click_rollups WHERE granularity = 'day' AND bucket < $1`,
+				cutoff: cutoff},
+			deletion{what: "visitor sketches", stmt: `DELETE FROM urlshortener_visitors WHERE day < $1`, cutoff: date(cutoff)})
+	}
+
+	var deleted int64
+	for _, d := range deletions {
+		res, err := conn.ExecContext(ctx, d.stmt, d.cutoff)
+		if err != nil {
+			return deleted, fmt.Errorf("error deleting expired %s: %w", d.what, err)
+		}
+		if n, err := res.RowsAffected(); err == nil {
+			deleted += n
+		}
+	}
+
+	return deleted, nil
+}
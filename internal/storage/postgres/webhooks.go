@@ -0,0 +1,266 @@
+package postgres
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"go.uber.org/zap"
+
+	"url-shortener/internal/model"
+	"url-shortener/internal/storage/errs"
+)
+
+// MarkFirstClick records that the link of key was first clicked at at and
+// reports whether it had not been clicked before. Of several instances
+// marking a link at once, only one gets true, and only its transaction queues
+// the deliveries of the first click.
+func (s *Storage) MarkFirstClick(key model.LinkKey, at time.Time) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	link, err := scanLink(tx.QueryRow(`UPDATE urlshortener SET first_clicked_at = $4
+    WHERE tenant = $1 AND domain = $2 AND short_url = $3 AND first_clicked_at IS NULL
+    RETURNING `+linkColumns, key.Tenant, key.Domain, key.ShortURL, at))
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error marking first click: %w", err)
+	}
+
+	if err = s.writeDeliveries(tx, model.LinkEvent{Type: model.EventLinkFirstClicked, Link: link, At: at}); err != nil {
+		return false, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return false, fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	return true, nil
+}
+
+// QueueWebhookDeliveries makes every link created, updated, deleted or first
+// clicked queue the delivery build returns to each webhook of the link's
+// tenant that subscribes to the event, in the same transaction as the change.
+// It must be called before the storage is used.
+func (s *Storage) QueueWebhookDeliveries(build func(model.LinkEvent) (model.WebhookDelivery, error)) {
+	s.deliveries = build
+}
+
+// writeDeliveries queues the deliveries of events within tx. Only the
+// webhooks of each event's tenant that subscribe to it are read.
+func (s *Storage) writeDeliveries(tx *sql.Tx, events ...model.LinkEvent) error {
+	if s.deliveries == nil {
+		return nil
+	}
+
+	for _, event := range events {
+		d, err := s.deliveries(event)
+		if err != nil {
+			return fmt.Errorf("error building webhook delivery: %w", err)
+		}
+
+		_, err = tx.Exec(`INSERT INTO urlshortener_webhook_outbox
+        (webhook_id, event_id, event, payload, next_attempt_at, created_at)
+    SELECT id, $3, $2, $4, $5, $6 FROM urlshortener_webhooks
+    WHERE tenant = $1 AND (cardinality(events) = 0 OR $2 = ANY(events))`,
+			event.Link.Tenant, d.Event, d.EventID, d.Payload, d.NextAttemptAt, d.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("error queueing webhook deliveries: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Storage) PutWebhook(webhook model.Webhook) error {
+	s.log.Info("storage.put-webhook", zap.String("id", webhook.ID), zap.String("tenant", webhook.Tenant))
+
+	// A nil array would be NULL.
+	events := append(pq.StringArray{}, webhook.Events...)
+	_, err := s.db.Exec(`INSERT INTO urlshortener_webhooks (id, tenant, url, secret, events, created_at)
+    VALUES ($1, $2, $3, $4, $5, $6)`, webhook.ID, webhook.Tenant, webhook.URL, webhook.Secret, events, webhook.CreatedAt)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return errs.ErrWebhookIsExist
+		}
+
+		return fmt.Errorf("error inserting webhook: %w", err)
+	}
+
+	return nil
+}
+
+const webhookColumns = `id, tenant, url, secret, events, created_at`
+
+func scanWebhook(row rowScanner) (model.Webhook, error) {
+	var webhook model.Webhook
+	err := row.Scan(&webhook.ID, &webhook.Tenant, &webhook.URL, &webhook.Secret, (*pq.StringArray)(&webhook.Events),
+		&webhook.CreatedAt)
+
+	return webhook, err
+}
+
+func (s *Storage) GetWebhook(id string) (model.Webhook, error) {
+	webhook, err := scanWebhook(s.db.QueryRow(`SELECT `+webhookColumns+` FROM urlshortener_webhooks WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return model.Webhook{}, errs.ErrWebhookIsNotExist
+	}
+	if err != nil {
+		return model.Webhook{}, fmt.Errorf("error scanning webhook: %w", err)
+	}
+
+	return webhook, nil
+}
+
+func (s *Storage) ListWebhooks() ([]model.Webhook, error) {
+	rows, err := s.db.Query(`SELECT ` + webhookColumns + ` FROM urlshortener_webhooks ORDER BY created_at`)
+	if err != nil {
+		return nil, fmt.Errorf("error listing webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	var webhooks []model.Webhook
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning webhook: %w", err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, rows.Err()
+}
+
+// DeleteWebhook deletes the webhook; its deliveries go with it.
+func (s *Storage) DeleteWebhook(id string) error {
+	s.log.Info("storage.delete-webhook", zap.String("id", id))
+
+	res, err := s.db.Exec(`DELETE FROM urlshortener_webhooks WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("error deleting webhook: %w", err)
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return errs.ErrWebhookIsNotExist
+	}
+
+	return nil
+}
+
+const deliveryColumns = `id, webhook_id, event_id, event, payload, attempts, next_attempt_at, last_error, created_at, dead_at`
+
+func scanDelivery(row rowScanner, extra ...any) (model.WebhookDelivery, error) {
+	var d model.WebhookDelivery
+	var deadAt sql.NullTime
+
+	dest := append([]any{&d.ID, &d.WebhookID, &d.EventID, &d.Event, &d.Payload, &d.Attempts, &d.NextAttemptAt,
+		&d.LastError, &d.CreatedAt, &deadAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return model.WebhookDelivery{}, err
+	}
+	d.DeadAt = deadAt.Time
+
+	return d, nil
+}
+
+// ClaimWebhookDeliveries returns up to limit deliveries due at now, oldest
+// first, and postpones them to until so that they are not claimed again while
+// they are being sent. Instances claiming at once skip each other's rows.
+func (s *Storage) ClaimWebhookDeliveries(now, until time.Time, limit int) ([]model.WebhookDelivery, error) {
+	rows, err := s.db.Query(`WITH claimed AS (
+        UPDATE urlshortener_webhook_outbox SET next_attempt_at = $2
+        WHERE id IN (SELECT id FROM urlshortener_webhook_outbox
+            WHERE dead_at IS NULL AND next_attempt_at <= $1
+            ORDER BY next_attempt_at, id LIMIT $3 FOR UPDATE SKIP LOCKED)
+        RETURNING `+deliveryColumns+`
+    )
+    SELECT c.*, w.url, w.secret FROM claimed c JOIN urlshortener_webhooks w ON w.id = c.webhook_id ORDER BY c.id`,
+		now, until, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error claiming webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []model.WebhookDelivery
+	for rows.Next() {
+		var url, secret string
+		d, err := scanDelivery(rows, &url, &secret)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning webhook delivery: %w", err)
+		}
+		d.URL, d.Secret = url, secret
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// DeleteWebhookDelivery removes a delivered delivery from the outbox.
+func (s *Storage) DeleteWebhookDelivery(id int64) error {
+	if _, err := s.db.Exec(`DELETE FROM urlshortener_webhook_outbox WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("error deleting webhook delivery: %w", err)
+	}
+
+	return nil
+}
+
+// RetryWebhookDelivery records a failed attempt: the attempts, next attempt,
+// last error and dead time of d.
+func (s *Storage) RetryWebhookDelivery(d model.WebhookDelivery) error {
+	deadAt := sql.NullTime{Time: d.DeadAt, Valid: !d.DeadAt.IsZero()}
+	_, err := s.db.Exec(`UPDATE urlshortener_webhook_outbox
+    SET attempts = $2, next_attempt_at = $3, last_error = $4, dead_at = $5 WHERE id = $1`,
+		d.ID, d.Attempts, d.NextAttemptAt, d.LastError, deadAt)
+	if err != nil {
+		return fmt.Errorf("error updating webhook delivery: %w", err)
+	}
+
+	return nil
+}
+
+// ListDeadWebhookDeliveries returns up to limit deliveries given up on for
+// the webhook, oldest first.
+func (s *Storage) ListDeadWebhookDeliveries(webhookID string, limit int) ([]model.WebhookDelivery, error) {
+	rows, err := s.db.Query(`SELECT `+deliveryColumns+` FROM urlshortener_webhook_outbox
+    WHERE webhook_id = $1 AND dead_at IS NOT NULL ORDER BY id LIMIT $2`, webhookID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error listing dead webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []model.WebhookDelivery
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	return deliveries, rows.Err()
+}
+
+// ReplayWebhookDeliveries queues the dead deliveries of the webhook with the
+// IDs, or all of them if there are none, for delivery at at with fresh
+// attempts. It returns how many it queued.
+func (s *Storage) ReplayWebhookDeliveries(webhookID string, ids []int64, at time.Time) (int64, error) {
+	s.log.Info("storage.replay-webhook-deliveries", zap.String("webhook", webhookID), zap.Int("ids", len(ids)))
+
+	res, err := s.db.Exec(`UPDATE urlshortener_webhook_outbox
+    SET attempts = 0, next_attempt_at = $3, last_error = '', dead_at = NULL
+    WHERE webhook_id = $1 AND dead_at IS NOT NULL AND (cardinality($2::bigint[]) = 0 OR id = ANY($2::bigint[]))`,
+		webhookID, append(pq.Int64Array{}, ids...), at)
+	if err != nil {
+		return 0, fmt.Errorf("error replaying webhook deliveries: %w", err)
+	}
+
+	return res.RowsAffected()
+}
@@ -1,23 +1,76 @@
 package storage
 
 import (
+	"time"
+
 	"go.uber.org/zap"
 
 	"url-shortener/internal/config"
+	"url-shortener/internal/model"
 	"url-shortener/internal/storage/memory"
 	"url-shortener/internal/storage/postgres"
 )
 
 type Storage interface {
-	Put(url, shortURL string) error
+	Put(link model.Link) error
+	// Get resolves a short URL of the default tenant and domain.
 	Get(url string) (string, error)
+	GetLink(key model.LinkKey) (model.Link, error)
+	// Update replaces the destination of an existing link.
+	Update(link model.Link) error
+	Delete(key model.LinkKey) error
+	// ListByOwner returns up to limit links of owner in tenant, newest first,
+	// starting after the link with the domain and short URL of after, or
+	// from the newest if after has no short URL.
+	ListByOwner(tenant, owner string, after model.LinkKey, limit int) ([]model.Link, error)
+	CountByTenant(tenant string) (int, error)
+	NextBlock(name string, size uint64) (uint64, error)
+	ReleaseBlock(name string, start, end uint64) error
+
+	PutAPIKey(key model.APIKey) error
+	GetAPIKey(id string) (model.APIKey, error)
+	ListAPIKeys() ([]model.APIKey, error)
+	RevokeAPIKey(id string, at time.Time) error
+	TouchAPIKey(id string, at time.Time) error
+
+	PutClicks(clicks []model.Click) error
+	MergeVisitors(sketches []model.VisitorSketch) error
+	ClickStats(key model.LinkKey, q model.ClickQuery) (model.ClickStats, error)
+	ExportClicks(q model.ExportQuery, after model.Click, limit int) ([]model.Click, error)
+	ExportRollups(granularity string, q model.ExportQuery, after model.ClickRollup, limit int) ([]model.ClickRollup, error)
+	MarkFirstClick(key model.LinkKey, at time.Time) (bool, error)
+
+	PutWebhook(webhook model.Webhook) error
+	GetWebhook(id string) (model.Webhook, error)
+	ListWebhooks() ([]model.Webhook, error)
+	DeleteWebhook(id string) error
+	QueueWebhookDeliveries(build func(model.LinkEvent) (model.WebhookDelivery, error))
+	ClaimWebhookDeliveries(now, until time.Time, limit int) ([]model.WebhookDelivery, error)
+	DeleteWebhookDelivery(id int64) error
+	RetryWebhookDelivery(d model.WebhookDelivery) error
+	ListDeadWebhookDeliveries(webhookID string, limit int) ([]model.WebhookDelivery, error)
+	ReplayWebhookDeliveries(webhookID string, ids []int64, at time.Time) (int64, error)
+
+	// RelayEvents passes up to limit of the oldest events in the outbox to
+	// publish and removes them once it succeeds. It returns how many were
+	// relayed.
+	RelayEvents(limit int, publish func([]model.OutboxEvent) error) (int, error)
 }
 
 func NewStorage(storageConf *config.StorageConfig, log *zap.Logger) (Storage, error) {
 	switch storageConf.Type {
 	case "postgres":
-		return postgres.NewStorage(storageConf.Postgres, log)
+		s, err := postgres.NewStorage(storageConf.Postgres, log)
+		if err != nil {
+			return nil, err
+		}
+		s.Outbox = storageConf.Outbox
+
+		return s, nil
 	default:
-		return memory.NewStorageInMemory(log), nil
+		s := memory.NewStorageInMemory(log)
+		s.Outbox = storageConf.Outbox
+
+		return s, nil
 	}
 }
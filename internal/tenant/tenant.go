@@ -0,0 +1,126 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/ratelimit"
+)
+
+// Default is the tenant of requests that do not belong to any workspace.
+const Default = ""
+
+var (
+	ErrLinkQuotaExceeded  = errors.New("tenant link quota exceeded")
+	ErrCreateRateExceeded = errors.New("tenant link creation rate exceeded")
+)
+
+type ctxKey struct{}
+
+// WithTenant returns a copy of ctx carrying the tenant id.
+func WithTenant(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext returns the tenant stored by WithTenant, or Default.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
+
+// Quota limits what a tenant may create.
+type Quota struct {
+	// MaxLinks is the number of links the tenant may hold; 0 is unlimited.
+	MaxLinks int
+	Create   ratelimit.Rule
+}
+
+// Registry knows the configured tenants: which hosts they own and their
+// quotas. Tenants that are not configured have no quotas.
+type Registry struct {
+	hosts   map[string]string
+	quotas  map[string]Quota
+	limiter ratelimit.Limiter
+	log     *zap.Logger
+}
+
+// NewRegistry builds a registry from configuration. limiter enforces creation
+// rates and may be nil if no tenant sets one.
+func NewRegistry(cfgs []config.TenantConfig, limiter ratelimit.Limiter, log *zap.Logger) *Registry {
+	r := &Registry{
+		hosts:   make(map[string]string),
+		quotas:  make(map[string]Quota, len(cfgs)),
+		limiter: limiter,
+		log:     log,
+	}
+
+	for _, cfg := range cfgs {
+		for _, host := range cfg.Hosts {
+			r.hosts[strings.ToLower(host)] = cfg.ID
+		}
+
+		r.quotas[cfg.ID] = Quota{
+			MaxLinks: cfg.MaxLinks,
+			Create: ratelimit.RuleFromConfig("tenant:"+cfg.ID, config.RateLimitRule{
+				Rate:  cfg.CreateRate,
+				Burst: cfg.CreateBurst,
+				Key:   ratelimit.KeyRoute,
+			}),
+		}
+	}
+
+	return r
+}
+
+// ForHost returns the tenant owning host, which may include a port, or
+// Default if no tenant claims it.
+func (r *Registry) ForHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	return r.hosts[strings.ToLower(host)]
+}
+
+// Quota returns the quota of tenant id.
+func (r *Registry) Quota(id string) Quota {
+	return r.quotas[id]
+}
+
+// AllowCreate checks that tenant id may create one more link. count returns
+// how many links the tenant holds; it is only called if the tenant has a link
+// quota. Concurrent creations may overshoot the quota by a few links.
+func (r *Registry) AllowCreate(ctx context.Context, id string, count func(tenant string) (int, error)) error {
+	quota, ok := r.quotas[id]
+	if !ok {
+		return nil
+	}
+
+	if quota.MaxLinks > 0 {
+		n, err := count(id)
+		if err != nil {
+			return err
+		}
+		if n >= quota.MaxLinks {
+			return ErrLinkQuotaExceeded
+		}
+	}
+
+	if quota.Create.Enabled() && r.limiter != nil {
+		res, err := r.limiter.Allow(ctx, quota.Create.BucketKey("", ""), quota.Create)
+		switch {
+		case err != nil:
+			// Like the per-client limits, tenant limits fail open.
+			r.log.Error("tenant rate limiter failed", zap.String("tenant", id), zap.Error(err))
+		case !res.Allowed:
+			return ErrCreateRateExceeded
+		}
+	}
+
+	return nil
+}
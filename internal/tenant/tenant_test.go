@@ -0,0 +1,49 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zaptest"
+
+	"url-shortener/internal/config"
+	"url-shortener/internal/ratelimit"
+)
+
+func TestRegistry_ForHost(t *testing.T) {
+	r := NewRegistry([]config.TenantConfig{{ID: "acme", Hosts: []string{"go.acme.com"}}}, nil, zaptest.NewLogger(t))
+
+	assert.Equal(t, "acme", r.ForHost("go.acme.com"))
+	assert.Equal(t, "acme", r.ForHost("GO.Acme.com:8080"))
+	assert.Equal(t, Default, r.ForHost("localhost:8080"))
+	assert.Equal(t, Default, r.ForHost(""))
+}
+
+func TestRegistry_AllowCreate(t *testing.T) {
+	r := NewRegistry([]config.TenantConfig{
+		{ID: "small", MaxLinks: 2},
+		{ID: "slow", CreateRate: 0.001, CreateBurst: 2},
+	}, ratelimit.NewMemory(), zaptest.NewLogger(t))
+
+	links := map[string]int{"small": 1}
+	count := func(tenant string) (int, error) { return links[tenant], nil }
+
+	assert.NoError(t, r.AllowCreate(context.Background(), "small", count))
+	links["small"] = 2
+	assert.ErrorIs(t, r.AllowCreate(context.Background(), "small", count), ErrLinkQuotaExceeded)
+
+	assert.NoError(t, r.AllowCreate(context.Background(), "slow", count))
+	assert.NoError(t, r.AllowCreate(context.Background(), "slow", count))
+	assert.ErrorIs(t, r.AllowCreate(context.Background(), "slow", count), ErrCreateRateExceeded)
+
+	failing := func(string) (int, error) { return 0, errors.New("db down") }
+	assert.NoError(t, r.AllowCreate(context.Background(), "unknown", failing), "unconfigured tenants have no quota")
+	assert.Error(t, r.AllowCreate(context.Background(), "small", failing))
+}
+
+func TestContext(t *testing.T) {
+	assert.Equal(t, Default, FromContext(context.Background()))
+	assert.Equal(t, "acme", FromContext(WithTenant(context.Background(), "acme")))
+}
@@ -0,0 +1,31 @@
+package threat
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+// Fake is a Checker for tests. It flags URLs whose host is a key of Hosts;
+// Err, if set, is returned for every check instead.
+type Fake struct {
+	Hosts map[string]string
+	Err   error
+}
+
+func (f *Fake) Check(_ context.Context, rawURL string) (Verdict, error) {
+	if f.Err != nil {
+		return Verdict{}, f.Err
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Verdict{}, err
+	}
+
+	if threat, ok := f.Hosts[strings.ToLower(u.Hostname())]; ok {
+		return Verdict{Malicious: true, Threat: threat, Source: "fake"}, nil
+	}
+
+	return Verdict{}, nil
+}
@@ -0,0 +1,246 @@
+package threat
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"url-shortener/internal/config"
+)
+
+const (
+	defaultThreat = "malicious"
+
+	// maxHostSuffixes and maxPathPrefixes bound how many expressions are
+	// hashed per URL, as in the Safe Browsing URL hashing scheme.
+	maxHostSuffixes = 5
+	maxPathPrefixes = 4
+
+	minPrefixBytes = 4
+)
+
+type entry struct {
+	threat string
+	source string
+}
+
+// ListChecker matches URLs against locally stored lists and reloads them
+// periodically.
+//
+// Domain lists hold one domain per line, optionally followed by the threat
+// type. A listed domain also flags all of its subdomains.
+//
+// Hash-prefix lists hold one hex-encoded SHA-256 prefix (4 to 32 bytes) per
+// line, optionally followed by the threat type. The hashed expressions are
+// host suffixes combined with path prefixes, e.g. "evil.com/login/". A prefix
+// match is treated as a hit, so lists should contain prefixes long enough to
+// make false positives unlikely.
+type ListChecker struct {
+	domainFiles []string
+	prefixFiles []string
+	interval    time.Duration
+	log         *zap.Logger
+
+	mu       sync.RWMutex
+	domains  map[string]entry
+	prefixes map[string]entry
+	lengths  map[int]struct{}
+}
+
+func NewListChecker(cfg config.ThreatConfig, log *zap.Logger) (*ListChecker, error) {
+	c := &ListChecker{
+		domainFiles: cfg.DomainLists,
+		prefixFiles: cfg.HashPrefixLists,
+		interval:    cfg.ReloadInterval,
+		log:         log,
+	}
+
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Reload reads all lists again and swaps them in atomically. On error the
+// previously loaded lists stay in use.
+func (c *ListChecker) Reload() error {
+	domains := make(map[string]entry)
+	for _, path := range c.domainFiles {
+		err := readList(path, func(value string, e entry) error {
+			domains[strings.TrimSuffix(strings.ToLower(value), ".")] = e
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	prefixes := make(map[string]entry)
+	lengths := make(map[int]struct{})
+	for _, path := range c.prefixFiles {
+		err := readList(path, func(value string, e entry) error {
+			raw, err := hex.DecodeString(value)
+			if err != nil || len(raw) < minPrefixBytes || len(raw) > sha256.Size {
+				return fmt.Errorf("invalid hash prefix %q", value)
+			}
+			prefixes[string(raw)] = e
+			lengths[len(raw)] = struct{}{}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	c.domains, c.prefixes, c.lengths = domains, prefixes, lengths
+	c.mu.Unlock()
+
+	c.log.Info("threat lists loaded", zap.Int("domains", len(domains)), zap.Int("hash-prefixes", len(prefixes)))
+
+	return nil
+}
+
+// Run reloads the lists every configured interval until ctx is done.
+func (c *ListChecker) Run(ctx context.Context) {
+	if c.interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.Reload(); err != nil {
+				c.log.Error("failed to reload threat lists", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (c *ListChecker) Check(_ context.Context, rawURL string) (Verdict, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Verdict{}, fmt.Errorf("failed to parse url: %w", err)
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	suffixes := hostSuffixes(host)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, h := range suffixes {
+		if e, ok := c.domains[h]; ok {
+			return Verdict{Malicious: true, Threat: e.threat, Source: e.source}, nil
+		}
+	}
+
+	if len(c.prefixes) == 0 {
+		return Verdict{}, nil
+	}
+
+	for _, h := range suffixes {
+		for _, p := range pathPrefixes(u) {
+			sum := sha256.Sum256([]byte(h + p))
+			for length := range c.lengths {
+				if e, ok := c.prefixes[string(sum[:length])]; ok {
+					return Verdict{Malicious: true, Threat: e.threat, Source: e.source}, nil
+				}
+			}
+		}
+	}
+
+	return Verdict{}, nil
+}
+
+// hostSuffixes returns host followed by its parent domains, down to the
+// registrable two-label domain. IP addresses are returned as is.
+func hostSuffixes(host string) []string {
+	if net.ParseIP(host) != nil {
+		return []string{host}
+	}
+
+	suffixes := []string{host}
+	labels := strings.Split(host, ".")
+	for i := 1; i < len(labels)-1 && len(suffixes) < maxHostSuffixes; i++ {
+		suffixes = append(suffixes, strings.Join(labels[i:], "."))
+	}
+
+	return suffixes
+}
+
+// pathPrefixes returns the path with and without the query followed by its
+// directory prefixes, e.g. "/a/b?q", "/a/b", "/a/", "/".
+func pathPrefixes(u *url.URL) []string {
+	p := u.EscapedPath()
+	if p == "" {
+		p = "/"
+	}
+
+	var prefixes []string
+	if u.RawQuery != "" {
+		prefixes = append(prefixes, p+"?"+u.RawQuery)
+	}
+	prefixes = append(prefixes, p)
+
+	dirs := 0
+	for i := 0; i < len(p)-1 && dirs < maxPathPrefixes; i++ {
+		if p[i] == '/' {
+			prefixes = append(prefixes, p[:i+1])
+			dirs++
+		}
+	}
+
+	return prefixes
+}
+
+// readList calls add for every non-empty, non-comment line of the file at
+// path. The first field is the value, the optional second one the threat.
+func readList(path string, add func(value string, e entry) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open threat list: %w", err)
+	}
+	defer f.Close()
+
+	source := filepath.Base(path)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		e := entry{threat: defaultThreat, source: source}
+		if len(fields) > 1 {
+			e.threat = fields[1]
+		}
+
+		if err := add(fields[0], e); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read threat list: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package threat
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"url-shortener/internal/config"
+)
+
+func writeList(t *testing.T, dir, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	return path
+}
+
+func hashPrefix(expr string, n int) string {
+	sum := sha256.Sum256([]byte(expr))
+	return hex.EncodeToString(sum[:n])
+}
+
+func TestListChecker_Domains(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	domains := writeList(t, dir, "domains.txt", "# phishing feed\nevil.example phishing\nmalware.test\n")
+
+	checker, err := NewListChecker(config.ThreatConfig{DomainLists: []string{domains}}, zaptest.NewLogger(t))
+	require.NoError(t, err)
+
+	tests := []struct {
+		url       string
+		malicious bool
+		threat    string
+	}{
+		{url: "https://evil.example/login", malicious: true, threat: "phishing"},
+		{url: "https://account.EVIL.example./", malicious: true, threat: "phishing"},
+		{url: "http://malware.test/x.exe", malicious: true, threat: "malicious"},
+		{url: "https://notevil.example/", malicious: false},
+		{url: "https://example.com/", malicious: false},
+	}
+
+	for _, tt := range tests {
+		verdict, err := checker.Check(context.Background(), tt.url)
+		require.NoError(t, err)
+		assert.Equal(t, tt.malicious, verdict.Malicious, tt.url)
+		if tt.malicious {
+			assert.Equal(t, tt.threat, verdict.Threat, tt.url)
+			assert.Equal(t, "domains.txt", verdict.Source)
+		}
+	}
+}
+
+func TestListChecker_HashPrefixes(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	content := hashPrefix("bad.example/phish/", 4) + " phishing\n" +
+		hashPrefix("files.example/payload.exe", 32) + " malware\n"
+	prefixes := writeList(t, dir, "prefixes.txt", content)
+
+	checker, err := NewListChecker(config.ThreatConfig{HashPrefixLists: []string{prefixes}}, zaptest.NewLogger(t))
+	require.NoError(t, err)
+
+	tests := []struct {
+		url    string
+		threat string
+	}{
+		{url: "https://bad.example/phish/login.html?next=1", threat: "phishing"},
+		{url: "https://www.bad.example/phish/", threat: "phishing"},
+		{url: "https://files.example/payload.exe", threat: "malware"},
+		{url: "https://bad.example/safe/"},
+		{url: "https://files.example/other.exe"},
+	}
+
+	for _, tt := range tests {
+		verdict, err := checker.Check(context.Background(), tt.url)
+		require.NoError(t, err)
+		assert.Equal(t, tt.threat != "", verdict.Malicious, tt.url)
+		assert.Equal(t, tt.threat, verdict.Threat, tt.url)
+	}
+}
+
+func TestListChecker_InvalidPrefix(t *testing.T) {
+	t.Parallel()
+
+	path := writeList(t, t.TempDir(), "prefixes.txt", "abc\n")
+
+	_, err := NewListChecker(config.ThreatConfig{HashPrefixLists: []string{path}}, zaptest.NewLogger(t))
+	assert.Error(t, err)
+}
+
+func TestListChecker_Reload(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := writeList(t, dir, "domains.txt", "")
+
+	cfg := config.ThreatConfig{DomainLists: []string{path}, ReloadInterval: 10 * time.Millisecond}
+	checker, err := NewListChecker(cfg, zaptest.NewLogger(t))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go checker.Run(ctx)
+
+	verdict, err := checker.Check(ctx, "https://new-threat.example/")
+	require.NoError(t, err)
+	assert.False(t, verdict.Malicious)
+
+	writeList(t, dir, "domains.txt", "new-threat.example phishing\n")
+
+	assert.Eventually(t, func() bool {
+		verdict, err := checker.Check(ctx, "https://new-threat.example/")
+		return err == nil && verdict.Malicious
+	}, time.Second, 10*time.Millisecond)
+
+	// A broken list must not replace the one in use.
+	require.NoError(t, os.Remove(path))
+	assert.Error(t, checker.Reload())
+
+	verdict, err = checker.Check(ctx, "https://new-threat.example/")
+	require.NoError(t, err)
+	assert.True(t, verdict.Malicious)
+}
@@ -0,0 +1,37 @@
+package threat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var ErrMalicious = errors.New("destination is listed as malicious")
+
+// Verdict is the result of checking a URL against threat intelligence.
+type Verdict struct {
+	Malicious bool
+	// Threat is the kind of threat, such as "phishing" or "malware".
+	Threat string
+	// Source names the list or provider that flagged the URL.
+	Source string
+}
+
+// Checker looks URLs up in threat intelligence. ListChecker works off local
+// files; a remote lookup provider can be plugged in by implementing Checker.
+type Checker interface {
+	Check(ctx context.Context, url string) (Verdict, error)
+}
+
+// Error is returned when a destination is flagged. It matches ErrMalicious.
+type Error struct {
+	Verdict Verdict
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s (%s)", ErrMalicious, e.Verdict.Threat, e.Verdict.Source)
+}
+
+func (e *Error) Is(target error) bool {
+	return target == ErrMalicious
+}
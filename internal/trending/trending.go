@@ -0,0 +1,243 @@
+// Package trending tracks which links are resolved most right now.
+package trending
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"url-shortener/internal/analytics"
+	"url-shortener/internal/model"
+	"url-shortener/internal/sketch"
+)
+
+const (
+	// DefaultTopK is how many links each window keeps track of.
+	DefaultTopK = 100
+
+	// slotsPerWindow is how finely windows slide: a window covers between
+	// 11/12 and all of its size.
+	slotsPerWindow = 12
+
+	sketchWidth = 2048
+	sketchDepth = 4
+)
+
+// Windows are the sliding windows trending links are counted over.
+var Windows = []time.Duration{time.Minute, 15 * time.Minute, time.Hour}
+
+var ErrUnknownWindow = errors.New(`window must be "1m", "15m" or "1h"`)
+
+// WindowName returns the short name of a window, such as "15m".
+func WindowName(window time.Duration) string {
+	if window%time.Hour == 0 {
+		return fmt.Sprintf("%dh", window/time.Hour)
+	}
+
+	return fmt.Sprintf("%dm", window/time.Minute)
+}
+
+// ParseWindow returns the window named name, or 0 for all windows if name is
+// empty.
+func ParseWindow(name string) (time.Duration, error) {
+	if name == "" {
+		return 0, nil
+	}
+
+	for _, window := range Windows {
+		if WindowName(window) == name {
+			return window, nil
+		}
+	}
+
+	return 0, ErrUnknownWindow
+}
+
+// Entry is a link with its estimated resolves in a window.
+type Entry struct {
+	Key   model.LinkKey
+	Count uint64
+}
+
+// Top is the ranking of one window.
+type Top struct {
+	Window  time.Duration
+	Entries []Entry
+}
+
+// Tracker counts resolves per link in sliding windows with a Count-Min Sketch
+// and a top-K list per slot, so memory stays fixed however many links there
+// are. Counts may overestimate by about 0.1% of all resolves in a window;
+// links outside the top K of every slot are not ranked.
+type Tracker struct {
+	mu      sync.Mutex
+	k       int
+	windows []*window
+	now     func() time.Time
+}
+
+func NewTracker(k int) *Tracker {
+	if k <= 0 {
+		k = DefaultTopK
+	}
+
+	t := &Tracker{k: k, now: time.Now}
+	for _, size := range Windows {
+		w := &window{size: size, slotWidth: size / slotsPerWindow, slots: make([]slot, slotsPerWindow)}
+		for i := range w.slots {
+			w.slots[i].hitters = sketch.NewHeavyHitters(k, sketchWidth, sketchDepth)
+		}
+		t.windows = append(t.windows, w)
+	}
+
+	return t
+}
+
+// Record counts a resolve of the link identified by key, unless the visitor
+// in ctx is a bot or suspicious. It matches the click recorder interface of
+// the service.
+func (t *Tracker) Record(ctx context.Context, key model.LinkKey) {
+	if v, ok := analytics.VisitorFromContext(ctx); ok && v.Class != "" && v.Class != model.ClassHuman {
+		return
+	}
+
+	item := encode(key)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	for _, w := range t.windows {
+		w.current(now).hitters.Add(item)
+	}
+}
+
+// Top returns up to limit links of every window, most resolved first. A limit
+// of 0 or more than the tracked K returns K links.
+func (t *Tracker) Top(limit int) []Top {
+	return t.rank(limit, nil)
+}
+
+// TopOf returns up to limit links of tenant in every window, most resolved
+// first. Links are ranked among all tenants, so a tenant only sees those of
+// its links that made the top K of a slot.
+func (t *Tracker) TopOf(tenant string, limit int) []Top {
+	return t.rank(limit, func(key model.LinkKey) bool { return key.Tenant == tenant })
+}
+
+// rank returns the rankings of every window, keeping only the links match
+// accepts, or all links if it is nil.
+func (t *Tracker) rank(limit int, match func(model.LinkKey) bool) []Top {
+	if limit <= 0 || limit > t.k {
+		limit = t.k
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	tops := make([]Top, 0, len(t.windows))
+	for _, w := range t.windows {
+		tops = append(tops, Top{Window: w.size, Entries: w.top(now, limit, match)})
+	}
+
+	return tops
+}
+
+type window struct {
+	size      time.Duration
+	slotWidth time.Duration
+	slots     []slot
+}
+
+type slot struct {
+	// epoch is the number of slot widths since the Unix epoch the slot
+	// counts.
+	epoch   int64
+	hitters *sketch.HeavyHitters
+}
+
+func (w *window) epoch(now time.Time) int64 {
+	return now.UnixNano() / int64(w.slotWidth)
+}
+
+// current returns the slot now falls into, clearing it if it still holds an
+// older epoch.
+func (w *window) current(now time.Time) *slot {
+	epoch := w.epoch(now)
+	s := &w.slots[epoch%int64(len(w.slots))]
+	if s.epoch != epoch {
+		s.hitters.Reset()
+		s.epoch = epoch
+	}
+
+	return s
+}
+
+// live returns the slots within the window ending at now.
+func (w *window) live(now time.Time) []*slot {
+	epoch := w.epoch(now)
+
+	var live []*slot
+	for i := range w.slots {
+		if s := &w.slots[i]; s.epoch > epoch-int64(len(w.slots)) && s.epoch <= epoch {
+			live = append(live, s)
+		}
+	}
+
+	return live
+}
+
+// top ranks the leaders of all live slots that match accepts by their counts
+// summed over the slots.
+func (w *window) top(now time.Time, limit int, match func(model.LinkKey) bool) []Entry {
+	live := w.live(now)
+
+	candidates := make(map[string]struct{})
+	for _, s := range live {
+		for _, c := range s.hitters.Top() {
+			candidates[c.Item] = struct{}{}
+		}
+	}
+
+	entries := make([]Entry, 0, len(candidates))
+	for item := range candidates {
+		key := decode(item)
+		if match != nil && !match(key) {
+			continue
+		}
+
+		var count uint64
+		for _, s := range live {
+			count += s.hitters.Estimate(item)
+		}
+		entries = append(entries, Entry{Key: key, Count: count})
+	}
+
+	slices.SortFunc(entries, func(a, b Entry) int {
+		return cmp.Or(
+			cmp.Compare(b.Count, a.Count),
+			cmp.Compare(a.Key.Tenant, b.Key.Tenant),
+			cmp.Compare(a.Key.Domain, b.Key.Domain),
+			cmp.Compare(a.Key.ShortURL, b.Key.ShortURL),
+		)
+	})
+
+	return entries[:min(limit, len(entries))]
+}
+
+// encode joins the parts of key with a byte that none of them contains.
+func encode(key model.LinkKey) string {
+	return key.Tenant + "\x00" + key.Domain + "\x00" + key.ShortURL
+}
+
+func decode(item string) model.LinkKey {
+	parts := strings.SplitN(item, "\x00", 3)
+
+	return model.LinkKey{Tenant: parts[0], Domain: parts[1], ShortURL: parts[2]}
+}
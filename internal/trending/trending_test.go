@@ -0,0 +1,96 @@
+package trending
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"url-shortener/internal/analytics"
+	"url-shortener/internal/model"
+)
+
+func TestTracker_SlidingWindows(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tracker := NewTracker(10)
+	tracker.now = func() time.Time { return now }
+
+	promo := model.LinkKey{Tenant: "acme", Domain: "go.acme.com", ShortURL: "promo"}
+	sale := model.LinkKey{ShortURL: "sale"}
+
+	record := func(key model.LinkKey, n int) {
+		for range n {
+			tracker.Record(context.Background(), key)
+		}
+	}
+
+	record(promo, 5)
+	now = now.Add(10 * time.Minute)
+	record(sale, 3)
+	record(promo, 1)
+
+	tops := tracker.Top(0)
+	if assert.Len(t, tops, 3) {
+		assert.Equal(t, time.Minute, tops[0].Window)
+		assert.Equal(t, []Entry{{Key: sale, Count: 3}, {Key: promo, Count: 1}}, tops[0].Entries)
+		assert.Equal(t, []Entry{{Key: promo, Count: 6}, {Key: sale, Count: 3}}, tops[1].Entries)
+		assert.Equal(t, []Entry{{Key: promo, Count: 6}, {Key: sale, Count: 3}}, tops[2].Entries)
+	}
+
+	tops = tracker.TopOf("acme", 0)
+	assert.Equal(t, []Entry{{Key: promo, Count: 1}}, tops[0].Entries)
+	assert.Equal(t, []Entry{{Key: promo, Count: 6}}, tops[2].Entries)
+	assert.Equal(t, []Entry{{Key: sale, Count: 3}}, tracker.TopOf("", 1)[0].Entries)
+
+	now = now.Add(20 * time.Minute)
+	tops = tracker.Top(1)
+	assert.Empty(t, tops[0].Entries)
+	assert.Empty(t, tops[1].Entries)
+	assert.Equal(t, []Entry{{Key: promo, Count: 6}}, tops[2].Entries)
+
+	now = now.Add(time.Hour)
+	assert.Empty(t, tracker.Top(0)[2].Entries)
+}
+
+func TestTracker_SlotsAreReused(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tracker := NewTracker(10)
+	tracker.now = func() time.Time { return now }
+
+	key := model.LinkKey{ShortURL: "promo"}
+	tracker.Record(context.Background(), key)
+
+	// The same slot of the 1m window an exact window later.
+	now = now.Add(time.Minute)
+	tracker.Record(context.Background(), key)
+
+	assert.Equal(t, []Entry{{Key: key, Count: 1}}, tracker.Top(0)[0].Entries)
+	assert.Equal(t, []Entry{{Key: key, Count: 2}}, tracker.Top(0)[1].Entries)
+}
+
+func TestTracker_SkipsBots(t *testing.T) {
+	tracker := NewTracker(10)
+	key := model.LinkKey{ShortURL: "promo"}
+
+	tracker.Record(analytics.WithVisitor(context.Background(), analytics.Visitor{Class: model.ClassBot, Bot: "Slack"}), key)
+	tracker.Record(analytics.WithVisitor(context.Background(), analytics.Visitor{Class: model.ClassSuspicious}), key)
+	tracker.Record(analytics.WithVisitor(context.Background(), analytics.Visitor{Class: model.ClassHuman}), key)
+
+	assert.Equal(t, []Entry{{Key: key, Count: 1}}, tracker.Top(0)[0].Entries)
+}
+
+func TestParseWindow(t *testing.T) {
+	for _, window := range Windows {
+		got, err := ParseWindow(WindowName(window))
+		assert.NoError(t, err)
+		assert.Equal(t, window, got)
+	}
+
+	got, err := ParseWindow("")
+	assert.NoError(t, err)
+	assert.Zero(t, got)
+
+	_, err = ParseWindow("5m")
+	assert.ErrorIs(t, err, ErrUnknownWindow)
+}
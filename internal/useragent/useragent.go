@@ -0,0 +1,98 @@
+// Package useragent tells the device type, operating system and browser from
+// a User-Agent header, by name only and without versions.
+package useragent
+
+import "strings"
+
+// Device types.
+const (
+	Desktop = "desktop"
+	Mobile  = "mobile"
+	Tablet  = "tablet"
+	TV      = "tv"
+	Console = "console"
+	Other   = "other"
+)
+
+// Client is what a user agent runs on. Fields are empty for an empty user
+// agent and "other" when unrecognized.
+type Client struct {
+	Device  string
+	OS      string
+	Browser string
+}
+
+type rule struct {
+	tokens []string
+	name   string
+}
+
+// The first rule with a token the user agent contains wins, so rules for user
+// agents that mimic others come first: Edge and Opera claim to be Chrome,
+// Chrome claims to be Safari.
+var (
+	osRules = []rule{
+		{tokens: []string{"windows phone"}, name: "Windows Phone"},
+		{tokens: []string{"windows"}, name: "Windows"},
+		{tokens: []string{"iphone", "ipad", "ipod"}, name: "iOS"},
+		{tokens: []string{"mac os x", "macintosh"}, name: "macOS"},
+		{tokens: []string{"android"}, name: "Android"},
+		{tokens: []string{"cros"}, name: "ChromeOS"},
+		{tokens: []string{"linux", "x11"}, name: "Linux"},
+	}
+
+	browserRules = []rule{
+		{tokens: []string{"fban", "fbav"}, name: "Facebook"},
+		{tokens: []string{"instagram"}, name: "Instagram"},
+		{tokens: []string{"edg/", "edge/", "edga/", "edgios/"}, name: "Edge"},
+		{tokens: []string{"opr/", "opera"}, name: "Opera"},
+		{tokens: []string{"yabrowser"}, name: "Yandex Browser"},
+		{tokens: []string{"samsungbrowser"}, name: "Samsung Internet"},
+		{tokens: []string{"ucbrowser"}, name: "UC Browser"},
+		{tokens: []string{"vivaldi"}, name: "Vivaldi"},
+		{tokens: []string{"firefox/", "fxios/"}, name: "Firefox"},
+		{tokens: []string{"chrome/", "crios/", "chromium/"}, name: "Chrome"},
+		{tokens: []string{"msie ", "trident/"}, name: "Internet Explorer"},
+		{tokens: []string{"safari/"}, name: "Safari"},
+	}
+
+	deviceRules = []rule{
+		{tokens: []string{"smart-tv", "smarttv", "googletv", "appletv", "hbbtv", "roku", "crkey", "aftb", "aftt"}, name: TV},
+		{tokens: []string{"playstation", "xbox", "nintendo"}, name: Console},
+		{tokens: []string{"ipad", "tablet", "kindle", "silk/", "playbook"}, name: Tablet},
+		{tokens: []string{"mobi", "iphone", "ipod", "windows phone", "blackberry"}, name: Mobile},
+	}
+)
+
+// Parse recognizes the client of userAgent.
+func Parse(userAgent string) Client {
+	ua := strings.ToLower(userAgent)
+	if strings.TrimSpace(ua) == "" {
+		return Client{}
+	}
+
+	c := Client{OS: match(ua, osRules), Browser: match(ua, browserRules), Device: match(ua, deviceRules)}
+	if c.Device == Other {
+		switch c.OS {
+		// Android phones say "Mobile"; Android tablets do not.
+		case "Android":
+			c.Device = Tablet
+		case "Windows", "macOS", "Linux", "ChromeOS":
+			c.Device = Desktop
+		}
+	}
+
+	return c
+}
+
+func match(ua string, rules []rule) string {
+	for _, r := range rules {
+		for _, token := range r.tokens {
+			if strings.Contains(ua, token) {
+				return r.name
+			}
+		}
+	}
+
+	return Other
+}
@@ -0,0 +1,63 @@
+package useragent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		ua   string
+		want Client
+	}{
+		{
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36",
+			want: Client{Device: Desktop, OS: "Windows", Browser: "Chrome"},
+		},
+		{
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36 Edg/126.0.0.0",
+			want: Client{Device: Desktop, OS: "Windows", Browser: "Edge"},
+		},
+		{
+			ua:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_5) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Safari/605.1.15",
+			want: Client{Device: Desktop, OS: "macOS", Browser: "Safari"},
+		},
+		{
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1",
+			want: Client{Device: Mobile, OS: "iOS", Browser: "Safari"},
+		},
+		{
+			ua:   "Mozilla/5.0 (iPad; CPU OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/126.0 Mobile/15E148 Safari/604.1",
+			want: Client{Device: Tablet, OS: "iOS", Browser: "Chrome"},
+		},
+		{
+			ua:   "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0 Mobile Safari/537.36",
+			want: Client{Device: Mobile, OS: "Android", Browser: "Chrome"},
+		},
+		{
+			ua:   "Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/25.0 Chrome/121.0 Safari/537.36",
+			want: Client{Device: Tablet, OS: "Android", Browser: "Samsung Internet"},
+		},
+		{
+			ua:   "Mozilla/5.0 (X11; Linux x86_64; rv:127.0) Gecko/20100101 Firefox/127.0",
+			want: Client{Device: Desktop, OS: "Linux", Browser: "Firefox"},
+		},
+		{
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 [FBAN/FBIOS;FBAV/470.0]",
+			want: Client{Device: Mobile, OS: "iOS", Browser: "Facebook"},
+		},
+		{
+			ua:   "Mozilla/5.0 (Web0S; Linux/SmartTV) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/87.0 Safari/537.36",
+			want: Client{Device: TV, OS: "Linux", Browser: "Chrome"},
+		},
+		{ua: "curl/8.4.0", want: Client{Device: Other, OS: Other, Browser: Other}},
+		{ua: "", want: Client{}},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Parse(tt.ua), tt.ua)
+	}
+}
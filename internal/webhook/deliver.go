@@ -0,0 +1,187 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"url-shortener/internal/model"
+)
+
+const (
+	// maxErrorLength bounds the error kept with a failed delivery.
+	maxErrorLength = 512
+	// maxResponseBody is how much of a response is read so the connection
+	// can be reused.
+	maxResponseBody = 64 << 10
+)
+
+// Run delivers due deliveries every poll interval and checks resolves for
+// first clicks until ctx is done. Deliveries in flight are finished first.
+func (d *Dispatcher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		d.runClicks(ctx)
+	}()
+
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		d.deliverDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runClicks checks queued resolves for first clicks until ctx is done. Those
+// still queued then are dropped; their links are checked again on their next
+// resolve.
+func (d *Dispatcher) runClicks(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case c := <-d.clicks:
+			d.firstClick(c)
+		}
+	}
+}
+
+// deliverDue sends due deliveries a batch at a time until none are left or
+// ctx is done.
+func (d *Dispatcher) deliverDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		now := d.now().UTC()
+		deliveries, err := d.store.ClaimWebhookDeliveries(now, now.Add(d.lease), d.batch)
+		if err != nil {
+			d.log.Error("failed to claim webhook deliveries", zap.Error(err))
+			return
+		}
+
+		var wg sync.WaitGroup
+		for _, delivery := range deliveries {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				d.deliver(delivery)
+			}()
+		}
+		wg.Wait()
+
+		if len(deliveries) < d.batch {
+			return
+		}
+	}
+}
+
+// deliver sends a delivery and removes it from the outbox, or schedules the
+// next attempt, or gives up on it once it has failed too often.
+func (d *Dispatcher) deliver(delivery model.WebhookDelivery) {
+	log := d.log.With(zap.Int64("delivery", delivery.ID), zap.String("webhook", delivery.WebhookID),
+		zap.String("event", delivery.Event))
+
+	err := d.send(delivery)
+	if err == nil {
+		if err := d.store.DeleteWebhookDelivery(delivery.ID); err != nil {
+			log.Error("failed to remove delivered webhook delivery, it will be sent again", zap.Error(err))
+			return
+		}
+		log.Debug("webhook delivered", zap.Int("attempts", delivery.Attempts+1))
+		return
+	}
+
+	now := d.now().UTC()
+	delivery.Attempts++
+	delivery.LastError = err.Error()
+	if len(delivery.LastError) > maxErrorLength {
+		delivery.LastError = delivery.LastError[:maxErrorLength]
+	}
+
+	if delivery.Attempts >= d.maxAttempts {
+		delivery.DeadAt, delivery.NextAttemptAt = now, now
+		log.Warn("webhook delivery given up", zap.Int("attempts", delivery.Attempts), zap.Error(err))
+	} else {
+		delivery.NextAttemptAt = now.Add(d.backoff(delivery.Attempts))
+		log.Info("webhook delivery failed, retrying", zap.Int("attempts", delivery.Attempts),
+			zap.Time("next", delivery.NextAttemptAt), zap.Error(err))
+	}
+
+	if err := d.store.RetryWebhookDelivery(delivery); err != nil {
+		log.Error("failed to record failed webhook delivery", zap.Error(err))
+	}
+}
+
+// send posts the payload of the delivery, signed, and fails unless the
+// endpoint answers with a 2xx status.
+func (d *Dispatcher) send(delivery model.WebhookDelivery) error {
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+
+	timestamp := d.now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "url-shortener-webhooks")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderID, delivery.EventID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(delivery.Secret, timestamp, delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBody))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("endpoint answered %s", resp.Status)
+	}
+
+	return nil
+}
+
+// Sign returns the signature header of a delivery of body at the Unix
+// timestamp. Receivers compute it the same way, compare it in constant time
+// and reject old timestamps to stop replays.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// backoff is the wait after the given number of failed attempts: the initial
+// backoff doubled after every failure but the first, at most the maximum,
+// plus up to a tenth more at random so that deliveries failing together do
+// not retry together.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	wait := d.initialBackoff
+	for i := 1; i < attempts && wait < d.maxBackoff; i++ {
+		wait *= 2
+	}
+	wait = min(wait, d.maxBackoff)
+
+	return wait + rand.N(wait/10+1)
+}
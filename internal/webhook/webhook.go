@@ -0,0 +1,384 @@
+// Package webhook delivers link events to subscribed HTTP endpoints.
+//
+// Storage queues the deliveries of an event in an outbox in the same
+// transaction as the change it describes, and they are delivered at least
+// once: a delivery stays in the outbox until its endpoint answers with a 2xx status
+// and is retried with exponential backoff until too many attempts have
+// failed. It is then kept as a dead letter, which can be replayed.
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"url-shortener/internal/analytics"
+	"url-shortener/internal/config"
+	"url-shortener/internal/model"
+	"url-shortener/internal/policy"
+	"url-shortener/pkg/util/random"
+)
+
+// Headers of every delivery. The signature is "sha256=" followed by the hex
+// HMAC-SHA256 of the timestamp, a dot and the body, keyed with the secret of
+// the webhook.
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderID        = "X-Webhook-Id"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+const (
+	defaultPollInterval   = time.Second
+	defaultBatchSize      = 50
+	defaultTimeout        = 10 * time.Second
+	defaultMaxAttempts    = 10
+	defaultInitialBackoff = 10 * time.Second
+	defaultMaxBackoff     = time.Hour
+
+	idLength     = 12
+	secretLength = 32
+	secretPrefix = "whsec_"
+	idAlphabet   = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890"
+
+	// leaseMargin is how much longer than a request a claimed delivery is
+	// hidden from other claims. If its instance stops before recording the
+	// outcome, the delivery is sent again after the lease.
+	leaseMargin = time.Minute
+
+	// clickQueueSize bounds the resolves waiting to be checked for a first
+	// click.
+	clickQueueSize = 1000
+	// maxSeen bounds the links remembered as clicked before the memory is
+	// cleared.
+	maxSeen = 100000
+)
+
+// Events are the event types webhooks can subscribe to.
+var Events = []string{model.EventLinkCreated, model.EventLinkUpdated, model.EventLinkDeleted, model.EventLinkExpired,
+	model.EventLinkFirstClicked}
+
+var (
+	ErrUnknownEvent = errors.New("unknown webhook event")
+	ErrInvalidURL   = errors.New("webhook URL must be an absolute http or https URL")
+)
+
+// Store keeps webhooks and their outbox. storage.Storage implements it.
+type Store interface {
+	// MarkFirstClick records that the link has been clicked and reports
+	// whether it had not been before, queueing the first click if so.
+	MarkFirstClick(key model.LinkKey, at time.Time) (bool, error)
+	// QueueWebhookDeliveries makes the store queue the delivery build
+	// returns for every link event to the webhooks of the link's tenant
+	// subscribed to it, in the same transaction as the change.
+	QueueWebhookDeliveries(build func(model.LinkEvent) (model.WebhookDelivery, error))
+
+	PutWebhook(webhook model.Webhook) error
+	GetWebhook(id string) (model.Webhook, error)
+	ListWebhooks() ([]model.Webhook, error)
+	DeleteWebhook(id string) error
+
+	// ClaimWebhookDeliveries returns up to limit deliveries due at now and
+	// postpones them to until, so that they are not claimed twice.
+	ClaimWebhookDeliveries(now, until time.Time, limit int) ([]model.WebhookDelivery, error)
+	DeleteWebhookDelivery(id int64) error
+	// RetryWebhookDelivery stores the attempts, next attempt, last error and
+	// dead time of a delivery that failed.
+	RetryWebhookDelivery(d model.WebhookDelivery) error
+	ListDeadWebhookDeliveries(webhookID string, limit int) ([]model.WebhookDelivery, error)
+	ReplayWebhookDeliveries(webhookID string, ids []int64, at time.Time) (int64, error)
+}
+
+// Payload is the JSON body of a delivery.
+type Payload struct {
+	// ID identifies the event; it is the same in every retry.
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Link       Link      `json:"link"`
+}
+
+type Link struct {
+	Tenant    string    `json:"tenant,omitempty"`
+	Domain    string    `json:"domain,omitempty"`
+	Code      string    `json:"code"`
+	URL       string    `json:"url"`
+	Owner     string    `json:"owner,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Dispatcher manages webhooks, builds the deliveries of the link events they
+// subscribe to and delivers them.
+type Dispatcher struct {
+	store  Store
+	client *http.Client
+	// policy checks the URLs of new webhooks.
+	policy   *policy.Policy
+	interval time.Duration
+	batch    int
+	// lease is how long a claimed delivery is hidden from other claims.
+	lease time.Duration
+
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+
+	// clicks queues resolves to check for a first click; seen holds the
+	// links known to have been clicked.
+	clicks chan click
+	seenMu sync.Mutex
+	seen   map[model.LinkKey]struct{}
+
+	log *zap.Logger
+	now func() time.Time
+}
+
+type click struct {
+	key model.LinkKey
+	at  time.Time
+}
+
+// NewDispatcher builds a dispatcher and has store queue the deliveries of link
+// events from then on. Unless cfg.AllowPrivateIPs is set,
+// webhooks may not point at internal addresses: their URLs are checked when
+// they are created, and every connection is checked again when it is dialed,
+// so a host cannot be pointed at an internal address afterwards.
+func NewDispatcher(store Store, cfg config.WebhooksConfig, log *zap.Logger) *Dispatcher {
+	timeout := orDefault(cfg.Timeout, defaultTimeout)
+
+	client := &http.Client{
+		Timeout: timeout,
+		// A redirect fails the attempt: it would turn the POST into a GET.
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	if !cfg.AllowPrivateIPs {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		// Deliveries go straight to their endpoints: the check would see the
+		// address of a proxy instead.
+		transport.Proxy = nil
+		transport.DialContext = (&net.Dialer{Timeout: timeout, Control: policy.DialControl}).DialContext
+		client.Transport = transport
+	}
+
+	d := &Dispatcher{
+		store:          store,
+		client:         client,
+		policy:         policy.New(config.PolicyConfig{BlockPrivateIPs: !cfg.AllowPrivateIPs}, nil),
+		lease:          timeout + leaseMargin,
+		interval:       orDefault(cfg.PollInterval, defaultPollInterval),
+		batch:          orDefault(cfg.BatchSize, defaultBatchSize),
+		maxAttempts:    orDefault(cfg.MaxAttempts, defaultMaxAttempts),
+		initialBackoff: orDefault(cfg.InitialBackoff, defaultInitialBackoff),
+		maxBackoff:     orDefault(cfg.MaxBackoff, defaultMaxBackoff),
+		clicks:         make(chan click, clickQueueSize),
+		seen:           make(map[model.LinkKey]struct{}),
+		log:            log.With(zap.String("op", "webhooks")),
+		now:            time.Now,
+	}
+	store.QueueWebhookDeliveries(d.delivery)
+
+	return d
+}
+
+func orDefault[T int | time.Duration](v, def T) T {
+	if v <= 0 {
+		return def
+	}
+
+	return v
+}
+
+// Subscribe creates a webhook delivering the events of the tenant's links to
+// rawURL; no events means all of them. The returned webhook holds the secret
+// its deliveries are signed with. A URL the destination policy rejects is
+// returned as an error wrapping policy.ErrForbiddenDestination.
+func (d *Dispatcher) Subscribe(ctx context.Context, tenant, rawURL string, events []string) (model.Webhook, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return model.Webhook{}, ErrInvalidURL
+	}
+
+	if err := d.policy.Check(ctx, rawURL); err != nil {
+		return model.Webhook{}, err
+	}
+
+	for _, event := range events {
+		if !slices.Contains(Events, event) {
+			return model.Webhook{}, fmt.Errorf("%w: %q", ErrUnknownEvent, event)
+		}
+	}
+
+	id, err := random.NewRandomStringFromAlphabet(idAlphabet, idLength)
+	if err != nil {
+		return model.Webhook{}, fmt.Errorf("failed to generate webhook id: %w", err)
+	}
+
+	secret, err := random.NewRandomStringFromAlphabet(idAlphabet, secretLength)
+	if err != nil {
+		return model.Webhook{}, fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+
+	webhook := model.Webhook{
+		ID:        id,
+		Tenant:    tenant,
+		URL:       rawURL,
+		Secret:    secretPrefix + secret,
+		Events:    events,
+		CreatedAt: d.now().UTC(),
+	}
+	if err := d.store.PutWebhook(webhook); err != nil {
+		return model.Webhook{}, fmt.Errorf("failed to store webhook: %w", err)
+	}
+
+	return webhook, nil
+}
+
+func (d *Dispatcher) List() ([]model.Webhook, error) {
+	return d.store.ListWebhooks()
+}
+
+// Unsubscribe deletes the webhook together with its pending and dead
+// deliveries.
+func (d *Dispatcher) Unsubscribe(id string) error {
+	return d.store.DeleteWebhook(id)
+}
+
+// DeadLetters returns up to limit deliveries to the webhook that were given
+// up on, oldest first.
+func (d *Dispatcher) DeadLetters(id string, limit int) ([]model.WebhookDelivery, error) {
+	if _, err := d.store.GetWebhook(id); err != nil {
+		return nil, err
+	}
+
+	return d.store.ListDeadWebhookDeliveries(id, limit)
+}
+
+// Replay queues the dead deliveries to the webhook with the given IDs, or all
+// of them if there are none, for delivery right away with fresh attempts. It
+// returns how many were queued.
+func (d *Dispatcher) Replay(id string, deliveries []int64) (int64, error) {
+	if _, err := d.store.GetWebhook(id); err != nil {
+		return 0, err
+	}
+
+	return d.store.ReplayWebhookDeliveries(id, deliveries, d.now().UTC())
+}
+
+// Publish watches resolves for the first click of their link; storage queues
+// the deliveries of every other event with the change. Resolves are checked in
+// the background, so Publish never blocks a redirect; resolves by bots and
+// suspicious visitors are not clicks.
+func (d *Dispatcher) Publish(ctx context.Context, event model.LinkEvent) {
+	key := event.Link.Key()
+
+	switch event.Type {
+	case model.EventLinkResolved:
+		if v, ok := analytics.VisitorFromContext(ctx); ok && v.Class != "" && v.Class != model.ClassHuman {
+			return
+		}
+		d.resolved(click{key: key, at: event.At})
+	case model.EventLinkCreated, model.EventLinkDeleted:
+		// A link deleted and created again may be clicked for the first
+		// time again.
+		d.forget(key)
+	}
+}
+
+// delivery builds the delivery of the event, due right away, for storage to
+// queue to every webhook subscribed to it.
+func (d *Dispatcher) delivery(event model.LinkEvent) (model.WebhookDelivery, error) {
+	payload, body, err := newPayload(event)
+	if err != nil {
+		return model.WebhookDelivery{}, err
+	}
+
+	now := d.now().UTC()
+
+	return model.WebhookDelivery{
+		EventID:       payload.ID,
+		Event:         event.Type,
+		Payload:       body,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}, nil
+}
+
+func newPayload(event model.LinkEvent) (Payload, []byte, error) {
+	var id [16]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return Payload{}, nil, fmt.Errorf("failed to generate event id: %w", err)
+	}
+
+	payload := Payload{
+		ID:         hex.EncodeToString(id[:]),
+		Type:       event.Type,
+		OccurredAt: event.At.UTC(),
+		Link: Link{
+			Tenant:    event.Link.Tenant,
+			Domain:    event.Link.Domain,
+			Code:      event.Link.ShortURL,
+			URL:       event.Link.URL,
+			Owner:     event.Link.Owner,
+			CreatedAt: event.Link.CreatedAt.UTC(),
+		},
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return Payload{}, nil, err
+	}
+
+	return payload, body, nil
+}
+
+// resolved queues a resolve to be checked for the first click of its link,
+// unless the link is known to have been clicked. When the queue is full the
+// resolve is dropped, and the next one is checked instead.
+func (d *Dispatcher) resolved(c click) {
+	d.seenMu.Lock()
+	if _, ok := d.seen[c.key]; ok {
+		d.seenMu.Unlock()
+		return
+	}
+	if len(d.seen) >= maxSeen {
+		clear(d.seen)
+	}
+	d.seen[c.key] = struct{}{}
+	d.seenMu.Unlock()
+
+	select {
+	case d.clicks <- c:
+	default:
+		d.forget(c.key)
+	}
+}
+
+func (d *Dispatcher) forget(key model.LinkKey) {
+	d.seenMu.Lock()
+	delete(d.seen, key)
+	d.seenMu.Unlock()
+}
+
+// firstClick marks the link of c as clicked, which queues the first click
+// event if it had not been clicked before. Storage decides, so of several
+// instances only one announces the first click.
+func (d *Dispatcher) firstClick(c click) {
+	if _, err := d.store.MarkFirstClick(c.key, c.at); err != nil {
+		d.log.Error("failed to mark first click", zap.String("code", c.key.ShortURL), zap.Error(err))
+		d.forget(c.key)
+	}
+}
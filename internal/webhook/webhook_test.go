@@ -0,0 +1,282 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"url-shortener/internal/analytics"
+	"url-shortener/internal/config"
+	"url-shortener/internal/model"
+	"url-shortener/internal/policy"
+	"url-shortener/internal/storage/errs"
+	"url-shortener/internal/storage/memory"
+)
+
+type request struct {
+	header http.Header
+	body   []byte
+}
+
+// receiver is a local endpoint recording the deliveries it gets and
+// answering them with status.
+type receiver struct {
+	mu       sync.Mutex
+	status   int
+	requests []request
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, request{header: req.Header.Clone(), body: body})
+	w.WriteHeader(r.status)
+}
+
+func (r *receiver) received() []request {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]request(nil), r.requests...)
+}
+
+func (r *receiver) answer(status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status = status
+}
+
+func setup(t *testing.T, status int) (*Dispatcher, *memory.StorageInMemory, *receiver, *httptest.Server, *time.Time) {
+	t.Helper()
+
+	log := zaptest.NewLogger(t)
+	store := memory.NewStorageInMemory(log)
+	recv := &receiver{status: status}
+	server := httptest.NewServer(recv)
+	t.Cleanup(server.Close)
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	d := NewDispatcher(store, config.WebhooksConfig{
+		MaxAttempts:    3,
+		InitialBackoff: time.Minute,
+		MaxBackoff:     time.Hour,
+		// The receiver listens on the loopback interface.
+		AllowPrivateIPs: true,
+	}, log)
+	d.now = func() time.Time { return now }
+
+	return d, store, recv, server, &now
+}
+
+func TestDispatcher_DeliversSigned(t *testing.T) {
+	d, store, recv, server, now := setup(t, http.StatusNoContent)
+
+	webhook, err := d.Subscribe(context.Background(), "acme", server.URL, nil)
+	require.NoError(t, err)
+	assert.Contains(t, webhook.Secret, secretPrefix)
+
+	link := model.Link{ShortURL: "promo", URL: "https://acme.com/sale", Tenant: "acme", Owner: "alice", CreatedAt: *now}
+	require.NoError(t, store.Put(link))
+	d.deliverDue(context.Background())
+
+	requests := recv.received()
+	require.Len(t, requests, 1)
+	req := requests[0]
+
+	timestamp, err := strconv.ParseInt(req.header.Get(HeaderTimestamp), 10, 64)
+	require.NoError(t, err)
+	assert.Equal(t, now.Unix(), timestamp)
+	assert.Equal(t, Sign(webhook.Secret, timestamp, req.body), req.header.Get(HeaderSignature))
+	assert.NotEqual(t, Sign("whsec_other", timestamp, req.body), req.header.Get(HeaderSignature))
+	assert.Equal(t, model.EventLinkCreated, req.header.Get(HeaderEvent))
+	assert.Equal(t, "application/json", req.header.Get("Content-Type"))
+
+	var payload Payload
+	require.NoError(t, json.Unmarshal(req.body, &payload))
+	assert.Equal(t, req.header.Get(HeaderID), payload.ID)
+	assert.Equal(t, model.EventLinkCreated, payload.Type)
+	assert.Equal(t, Link{Tenant: "acme", Code: "promo", URL: "https://acme.com/sale", Owner: "alice", CreatedAt: *now},
+		payload.Link)
+
+	// Delivered deliveries leave the outbox.
+	d.deliverDue(context.Background())
+	assert.Len(t, recv.received(), 1)
+}
+
+func TestDispatcher_RetriesDeadLettersAndReplays(t *testing.T) {
+	d, store, recv, server, now := setup(t, http.StatusInternalServerError)
+
+	webhook, err := d.Subscribe(context.Background(), "", server.URL, []string{model.EventLinkDeleted})
+	require.NoError(t, err)
+
+	require.NoError(t, store.Put(model.Link{ShortURL: "gone", URL: "https://example.com"}))
+	require.NoError(t, store.Delete(model.LinkKey{ShortURL: "gone"}))
+
+	d.deliverDue(context.Background())
+	require.Len(t, recv.received(), 1)
+
+	// Not due again until the backoff has passed.
+	*now = now.Add(30 * time.Second)
+	d.deliverDue(context.Background())
+	assert.Len(t, recv.received(), 1)
+
+	for range 2 {
+		*now = now.Add(3 * time.Hour)
+		d.deliverDue(context.Background())
+	}
+	requests := recv.received()
+	require.Len(t, requests, 3)
+	// Retries carry the same event ID, so receivers can drop duplicates.
+	assert.Equal(t, requests[0].header.Get(HeaderID), requests[2].header.Get(HeaderID))
+
+	dead, err := d.DeadLetters(webhook.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	assert.Equal(t, 3, dead[0].Attempts)
+	assert.Equal(t, "endpoint answered 500 Internal Server Error", dead[0].LastError)
+	assert.Equal(t, *now, dead[0].DeadAt)
+
+	// Dead letters are not retried.
+	*now = now.Add(3 * time.Hour)
+	d.deliverDue(context.Background())
+	assert.Len(t, recv.received(), 3)
+
+	recv.answer(http.StatusOK)
+	replayed, err := d.Replay(webhook.ID, nil)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, replayed)
+
+	d.deliverDue(context.Background())
+	assert.Len(t, recv.received(), 4)
+	dead, err = d.DeadLetters(webhook.ID, 10)
+	require.NoError(t, err)
+	assert.Empty(t, dead)
+
+	_, err = d.Replay("missing", nil)
+	assert.ErrorIs(t, err, errs.ErrWebhookIsNotExist)
+
+	require.NoError(t, d.Unsubscribe(webhook.ID))
+	assert.ErrorIs(t, d.Unsubscribe(webhook.ID), errs.ErrWebhookIsNotExist)
+	_, err = d.DeadLetters(webhook.ID, 10)
+	assert.ErrorIs(t, err, errs.ErrWebhookIsNotExist)
+}
+
+func TestDispatcher_FiltersByTenantAndEvent(t *testing.T) {
+	d, store, recv, server, _ := setup(t, http.StatusOK)
+
+	_, err := d.Subscribe(context.Background(), "acme", server.URL, []string{model.EventLinkUpdated})
+	require.NoError(t, err)
+
+	for _, tenant := range []string{"acme", "globex"} {
+		require.NoError(t, store.Put(model.Link{ShortURL: "x", URL: "https://example.com", Tenant: tenant}))
+	}
+	require.NoError(t, store.Update(model.Link{ShortURL: "x", URL: "https://example.com/globex", Tenant: "globex"}))
+	require.NoError(t, store.Update(model.Link{ShortURL: "x", URL: "https://example.com/acme", Tenant: "acme"}))
+	d.deliverDue(context.Background())
+
+	requests := recv.received()
+	require.Len(t, requests, 1)
+	assert.Equal(t, model.EventLinkUpdated, requests[0].header.Get(HeaderEvent))
+
+	var payload Payload
+	require.NoError(t, json.Unmarshal(requests[0].body, &payload))
+	assert.Equal(t, "https://example.com/acme", payload.Link.URL)
+}
+
+func TestDispatcher_FirstClick(t *testing.T) {
+	d, store, recv, server, now := setup(t, http.StatusOK)
+
+	_, err := d.Subscribe(context.Background(), "", server.URL, []string{model.EventLinkFirstClicked})
+	require.NoError(t, err)
+	link := model.Link{ShortURL: "promo", URL: "https://example.com"}
+	require.NoError(t, store.Put(link))
+
+	bot := analytics.WithVisitor(context.Background(), analytics.Visitor{Class: model.ClassBot})
+	d.Publish(bot, model.LinkEvent{Type: model.EventLinkResolved, Link: link, At: *now})
+	assert.Empty(t, d.clicks, "bots do not click")
+
+	for range 3 {
+		d.Publish(context.Background(), model.LinkEvent{Type: model.EventLinkResolved, Link: link, At: *now})
+	}
+	// The link is remembered as clicked, so only the first resolve is queued.
+	require.Len(t, d.clicks, 1)
+	d.firstClick(<-d.clicks)
+	d.deliverDue(context.Background())
+
+	requests := recv.received()
+	require.Len(t, requests, 1)
+	assert.Equal(t, model.EventLinkFirstClicked, requests[0].header.Get(HeaderEvent))
+
+	// Another instance does not announce it again.
+	d.forget(link.Key())
+	d.Publish(context.Background(), model.LinkEvent{Type: model.EventLinkResolved, Link: link, At: *now})
+	d.firstClick(<-d.clicks)
+	d.deliverDue(context.Background())
+	assert.Len(t, recv.received(), 1)
+}
+
+func TestDispatcher_Subscribe(t *testing.T) {
+	d, _, _, _, _ := setup(t, http.StatusOK)
+
+	for _, rawURL := range []string{"", "ftp://example.com", "/hooks", "https://"} {
+		_, err := d.Subscribe(context.Background(), "", rawURL, nil)
+		assert.ErrorIs(t, err, ErrInvalidURL, rawURL)
+	}
+
+	_, err := d.Subscribe(context.Background(), "", "https://example.com/hooks", []string{model.EventLinkResolved})
+	assert.ErrorIs(t, err, ErrUnknownEvent)
+
+	webhook, err := d.Subscribe(context.Background(), "acme", "https://example.com/hooks", []string{model.EventLinkExpired})
+	require.NoError(t, err)
+
+	webhooks, err := d.List()
+	require.NoError(t, err)
+	assert.Equal(t, []model.Webhook{webhook}, webhooks)
+}
+
+func TestDispatcher_RefusesInternalAddresses(t *testing.T) {
+	log := zaptest.NewLogger(t)
+	store := memory.NewStorageInMemory(log)
+	recv := &receiver{status: http.StatusOK}
+	server := httptest.NewServer(recv)
+	t.Cleanup(server.Close)
+
+	d := NewDispatcher(store, config.WebhooksConfig{}, log)
+
+	for _, rawURL := range []string{server.URL, "http://169.254.169.254/latest/meta-data", "http://[::1]:8080/hooks",
+		"http://0x7f000001/hooks"} {
+		_, err := d.Subscribe(context.Background(), "", rawURL, nil)
+		assert.ErrorIs(t, err, policy.ErrForbiddenDestination, rawURL)
+	}
+
+	// A host that resolved to a public address when the webhook was created
+	// may point at an internal one by the time it is delivered to.
+	require.NoError(t, store.PutWebhook(model.Webhook{ID: "rebound", URL: server.URL, Secret: "whsec_x"}))
+	require.NoError(t, store.Put(model.Link{ShortURL: "promo", URL: "https://example.com"}))
+	d.deliverDue(context.Background())
+
+	assert.Empty(t, recv.received(), "the connection is refused when it is dialed")
+}
+
+func TestDispatcher_Backoff(t *testing.T) {
+	d := &Dispatcher{initialBackoff: 10 * time.Second, maxBackoff: time.Minute}
+
+	for attempts, want := range map[int]time.Duration{1: 10 * time.Second, 2: 20 * time.Second,
+		3: 40 * time.Second, 4: time.Minute, 50: time.Minute} {
+		wait := d.backoff(attempts)
+		assert.GreaterOrEqual(t, wait, want, attempts)
+		assert.LessOrEqual(t, wait, want+want/10, attempts)
+	}
+}
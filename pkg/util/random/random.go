@@ -4,27 +4,95 @@ import (
 	"crypto/rand"
 	"errors"
 	"fmt"
+	"io"
 	"math/big"
 	"strings"
-	"unicode/utf8"
 )
 
+// DefaultAlphabet contains every character allowed in a short code exactly once.
+const DefaultAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890_"
+
+// lookAlikes are characters that are easy to confuse when a code is read aloud
+// or copied by hand.
+const lookAlikes = "0Ol1I"
+
 var (
-	alphabet = []byte("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890_")
+	ErrInvalidLength  = errors.New("stringLength must be > 0")
+	ErrEmptyAlphabet  = errors.New("alphabet must contain at least 2 characters")
+	ErrDuplicateChar  = errors.New("alphabet contains duplicate characters")
+	ErrUnsafeAlphabet = errors.New("alphabet must contain only the URL-safe characters A-Z, a-z, 0-9, '-', '.', '_' and '~'")
 )
 
-var ErrInvalidLength = errors.New("stringLength must be > 0")
+// ValidateAlphabet checks that alphabet can be used to build codes: it must
+// only contain characters that stay as they are in a URL path, the unreserved
+// characters of RFC 3986, and must not repeat characters, since a repeated
+// character would be picked more often than the others.
+func ValidateAlphabet(alphabet string) error {
+	if len(alphabet) < 2 {
+		return ErrEmptyAlphabet
+	}
+
+	var seen [128]bool
+	for i := range len(alphabet) {
+		c := alphabet[i]
+		if !unreserved(c) {
+			return fmt.Errorf("%w: %q", ErrUnsafeAlphabet, c)
+		}
+		if seen[c] {
+			return fmt.Errorf("%w: %q", ErrDuplicateChar, c)
+		}
+		seen[c] = true
+	}
+
+	return nil
+}
+
+func unreserved(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+
+	return c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+// ExcludeLookAlikes removes 0/O and l/1/I from alphabet.
+func ExcludeLookAlikes(alphabet string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(lookAlikes, r) {
+			return -1
+		}
+		return r
+	}, alphabet)
+}
 
 func NewRandomString(stringLength int) (string, error) {
+	return NewRandomStringFromAlphabet(DefaultAlphabet, stringLength)
+}
+
+// NewRandomStringFromAlphabet returns a string of stringLength characters, each
+// drawn uniformly from alphabet. The alphabet must pass ValidateAlphabet.
+func NewRandomStringFromAlphabet(alphabet string, stringLength int) (string, error) {
+	return newRandomString(rand.Reader, alphabet, stringLength)
+}
+
+// newRandomString draws the characters from source, which tests replace with
+// a seeded one.
+func newRandomString(source io.Reader, alphabet string, stringLength int) (string, error) {
 	if stringLength <= 0 {
 		return "", ErrInvalidLength
 	}
 
+	if err := ValidateAlphabet(alphabet); err != nil {
+		return "", err
+	}
+
 	var builder strings.Builder
+	builder.Grow(stringLength)
 
-	alphaLength := big.NewInt(int64(utf8.RuneCount(alphabet)))
+	alphaLength := big.NewInt(int64(len(alphabet)))
 	for range stringLength {
-		n, err := rand.Int(rand.Reader, alphaLength)
+		n, err := rand.Int(source, alphaLength)
 		if err != nil {
 			return "", fmt.Errorf("failed to generate random integer: %w", err)
 		}
@@ -1,9 +1,14 @@
 package random
 
 import (
+	"crypto/rand"
+	"math"
+	"math/big"
+	mathrand "math/rand/v2"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewRandomString_stringLength(t *testing.T) {
@@ -73,3 +78,130 @@ func TestNewRandomString_Error(t *testing.T) {
 		})
 	}
 }
+
+// chiSquareCritical approximates the 99.9th percentile of the chi-square
+// distribution with df degrees of freedom (Wilson–Hilferty). The samples are
+// drawn from seeded sources, so a uniform generator passes the check on every
+// run rather than failing once in a thousand.
+func chiSquareCritical(df int) float64 {
+	const z = 3.09
+	k := float64(df)
+	term := 1 - 2/(9*k) + z*math.Sqrt(2/(9*k))
+
+	return k * term * term * term
+}
+
+func chiSquare(counts map[byte]int, alphabet string, total int) float64 {
+	expected := float64(total) / float64(len(alphabet))
+
+	var stat float64
+	for i := range len(alphabet) {
+		diff := float64(counts[alphabet[i]]) - expected
+		stat += diff * diff / expected
+	}
+
+	return stat
+}
+
+func TestNewRandomString_UniformDistribution(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		alphabet string
+	}{
+		{name: "default alphabet", alphabet: DefaultAlphabet},
+		{name: "without look-alikes", alphabet: ExcludeLookAlikes(DefaultAlphabet)},
+		{name: "hex", alphabet: "0123456789abcdef"},
+	}
+
+	const samples = 20000
+	const length = 10
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			source := mathrand.NewChaCha8([32]byte{byte(i)})
+			overall := make(map[byte]int)
+			first := make(map[byte]int)
+			for range samples {
+				str, err := newRandomString(source, tt.alphabet, length)
+				require.NoError(t, err)
+
+				first[str[0]]++
+				for i := range len(str) {
+					overall[str[i]]++
+				}
+			}
+
+			critical := chiSquareCritical(len(tt.alphabet) - 1)
+			assert.Less(t, chiSquare(overall, tt.alphabet, samples*length), critical)
+			assert.Less(t, chiSquare(first, tt.alphabet, samples), critical)
+		})
+	}
+}
+
+func TestChiSquare_DetectsDuplicatedCharacters(t *testing.T) {
+	t.Parallel()
+
+	// The alphabet used to list the uppercase letters twice; sampling from it
+	// directly must fail the same uniformity check.
+	biased := "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890_"
+
+	const total = 200000
+	source := mathrand.NewChaCha8([32]byte{})
+	counts := make(map[byte]int)
+	for range total {
+		n, err := rand.Int(source, big.NewInt(int64(len(biased))))
+		require.NoError(t, err)
+		counts[biased[n.Int64()]]++
+	}
+
+	assert.Greater(t, chiSquare(counts, DefaultAlphabet, total), chiSquareCritical(len(DefaultAlphabet)-1))
+}
+
+func TestValidateAlphabet(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		alphabet string
+		err      error
+	}{
+		{name: "default", alphabet: DefaultAlphabet},
+		{name: "too short", alphabet: "a", err: ErrEmptyAlphabet},
+		{name: "duplicate", alphabet: "abcABCa", err: ErrDuplicateChar},
+		{name: "unreserved", alphabet: "abc-._~"},
+		{name: "non ascii", alphabet: "abcé", err: ErrUnsafeAlphabet},
+		{name: "space", alphabet: "ab c", err: ErrUnsafeAlphabet},
+		{name: "reserved", alphabet: "abc/", err: ErrUnsafeAlphabet},
+		{name: "percent", alphabet: "abc%", err: ErrUnsafeAlphabet},
+		{name: "query", alphabet: "abc?", err: ErrUnsafeAlphabet},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := ValidateAlphabet(tt.alphabet)
+			if tt.err == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tt.err)
+		})
+	}
+}
+
+func TestExcludeLookAlikes(t *testing.T) {
+	t.Parallel()
+
+	got := ExcludeLookAlikes(DefaultAlphabet)
+
+	assert.Len(t, got, len(DefaultAlphabet)-5)
+	for _, c := range "0Ol1I" {
+		assert.NotContains(t, got, string(c))
+	}
+	assert.NoError(t, ValidateAlphabet(got))
+}